@@ -0,0 +1,439 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"projectx/proxytestlib/rewriter"
+)
+
+// abSignificance - уровень значимости, ниже которого разница считается реальной
+const abSignificance = 0.05
+
+// ABVariant - один из сравниваемых наборов. Вариант без configs и pool_id
+// использует набор варианта A, что позволяет сравнить два набора настроек
+// (rewrite_rules) на одних и тех же прокси
+type ABVariant struct {
+	Name         string          `json:"name"`
+	Configs      []string        `json:"configs"`
+	PoolID       string          `json:"pool_id"`
+	RewriteRules json.RawMessage `json:"rewrite_rules"`
+}
+
+// ABTestRequest - тело запроса на A/B тест
+type ABTestRequest struct {
+	Name    string    `json:"name"`
+	A       ABVariant `json:"a"`
+	B       ABVariant `json:"b"`
+	Rounds  int       `json:"rounds"`
+	Timeout int       `json:"timeout"`
+}
+
+// ABVariantResult - статистика замеров одного варианта
+type ABVariantResult struct {
+	Name          string  `json:"name"`
+	Proxies       int     `json:"proxies"`
+	Samples       int     `json:"samples"`
+	Successful    int     `json:"successful"`
+	SuccessRate   float64 `json:"success_rate"`
+	MeanLatency   string  `json:"mean_latency"`
+	MedianLatency string  `json:"median_latency"`
+	StdDevLatency string  `json:"stddev_latency"`
+
+	latencies []float64
+}
+
+// ABComparison - статистическое сравнение вариантов
+type ABComparison struct {
+	PairWinsA      int     `json:"pair_wins_a"` // Пары, где A ответил быстрее B
+	PairWinsB      int     `json:"pair_wins_b"`
+	PairTies       int     `json:"pair_ties"` // Пары, где оба варианта не ответили
+	LatencyZ       float64 `json:"latency_z"` // Манна-Уитни, положительное значение - A медленнее
+	LatencyPValue  float64 `json:"latency_p_value"`
+	Faster         string  `json:"faster"` // a, b или none
+	ReliabilityZ   float64 `json:"reliability_z"`
+	ReliabilityP   float64 `json:"reliability_p_value"`
+	MoreReliable   string  `json:"more_reliable"`
+	Recommendation string  `json:"recommendation"`
+}
+
+// ABTest - A/B тест и его результат
+type ABTest struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Status      string          `json:"status"`
+	Rounds      int             `json:"rounds"`
+	StartedAt   time.Time       `json:"started_at"`
+	CompletedAt time.Time       `json:"completed_at,omitempty"`
+	A           ABVariantResult `json:"a"`
+	B           ABVariantResult `json:"b"`
+	Comparison  *ABComparison   `json:"comparison,omitempty"`
+}
+
+var abTests = make(map[string]*ABTest)
+
+// registerABTestRoutes подключает эндпоинты A/B тестов к группе API
+func registerABTestRoutes(api *gin.RouterGroup) {
+	api.POST("/ab-tests", startABTest)
+	api.GET("/ab-tests/:id", getABTest)
+}
+
+// startABTest запускает сравнение двух наборов прокси
+func startABTest(c *gin.Context) {
+	var request ABTestRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	linksA, err := request.A.links(nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant a", "details": err.Error()})
+		return
+	}
+	linksB, err := request.B.links(request.A.rawLinks())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant b", "details": err.Error()})
+		return
+	}
+
+	if request.Rounds <= 0 {
+		request.Rounds = 3
+	}
+	if request.Timeout <= 0 {
+		request.Timeout = 30
+	}
+	if request.A.Name == "" {
+		request.A.Name = "a"
+	}
+	if request.B.Name == "" {
+		request.B.Name = "b"
+	}
+
+	now := now()
+	test := &ABTest{
+		ID:        ids.NewID("ab"),
+		Name:      request.Name,
+		Status:    "running",
+		Rounds:    request.Rounds,
+		StartedAt: now,
+		A:         ABVariantResult{Name: request.A.Name, Proxies: len(linksA)},
+		B:         ABVariantResult{Name: request.B.Name, Proxies: len(linksB)},
+	}
+
+	mu.Lock()
+	abTests[test.ID] = test
+	mu.Unlock()
+
+	go runABTest(test, linksA, linksB, time.Duration(request.Timeout)*time.Second)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ab_test_id": test.ID,
+		"status":     "started",
+		"started_at": test.StartedAt.Format(time.RFC3339),
+	})
+}
+
+// getABTest возвращает статус и, после завершения, результат A/B теста
+func getABTest(c *gin.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	test, exists := abTests[c.Param("id")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "A/B test not found"})
+		return
+	}
+	c.JSON(http.StatusOK, test)
+}
+
+// rawLinks возвращает ссылки варианта до применения правил перезаписи
+func (v *ABVariant) rawLinks() []string {
+	if v.PoolID == "" {
+		return v.Configs
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	pool, exists := pools[v.PoolID]
+	if !exists {
+		return nil
+	}
+	links := make([]string, 0, len(pool.Proxies))
+	for _, proxy := range pool.Proxies {
+		links = append(links, proxy.Link)
+	}
+	return links
+}
+
+// links возвращает ссылки варианта с применёнными правилами перезаписи.
+// fallback используется, если вариант не задаёт свой набор прокси
+func (v *ABVariant) links(fallback []string) ([]string, error) {
+	if v.PoolID != "" {
+		mu.Lock()
+		_, exists := pools[v.PoolID]
+		mu.Unlock()
+		if !exists {
+			return nil, fmt.Errorf("pool %s not found", v.PoolID)
+		}
+	}
+
+	links := v.rawLinks()
+	if len(links) == 0 {
+		links = fallback
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("configs or pool_id required")
+	}
+
+	rules := rewriteRules
+	if len(v.RewriteRules) > 0 {
+		variantRules, err := rewriter.ParseRules(v.RewriteRules)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(append([]rewriter.Rule{}, rules...), variantRules...)
+	}
+
+	rewritten := make([]string, len(links))
+	for i, link := range links {
+		result, _, err := rewriter.Apply(link, rules)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %d: %w", i+1, err)
+		}
+		rewritten[i] = result
+	}
+	return rewritten, nil
+}
+
+// runABTest проводит замеры парами: в каждой паре прокси A и B проверяются
+// одновременно, чтобы оба замера попали в одинаковые сетевые условия.
+// Порядок запуска внутри пары чередуется от раунда к раунду
+func runABTest(test *ABTest, linksA, linksB []string, timeout time.Duration) {
+	log.Printf("Starting A/B test %s: %d vs %d proxies, %d rounds", test.ID, len(linksA), len(linksB), test.Rounds)
+	release := resources.acquireOwner(test.ID)
+	defer release()
+
+	pairs := len(linksA)
+	if len(linksB) > pairs {
+		pairs = len(linksB)
+	}
+
+	mu.Lock()
+	resultA := ABVariantResult{Name: test.A.Name, Proxies: test.A.Proxies}
+	resultB := ABVariantResult{Name: test.B.Name, Proxies: test.B.Proxies}
+	mu.Unlock()
+
+	var comparison ABComparison
+
+	for round := 0; round < test.Rounds; round++ {
+		for i := 0; i < pairs; i++ {
+			linkA := linksA[i%len(linksA)]
+			linkB := linksB[i%len(linksB)]
+
+			var (
+				wg                 sync.WaitGroup
+				latencyA, latencyB time.Duration
+				errA, errB         error
+			)
+			measure := func(link string, latency *time.Duration, err *error) {
+				defer wg.Done()
+				*latency, *err = testProxy(test.ID, link, nil, timeout)
+			}
+
+			wg.Add(2)
+			if round%2 == 0 {
+				go measure(linkA, &latencyA, &errA)
+				go measure(linkB, &latencyB, &errB)
+			} else {
+				go measure(linkB, &latencyB, &errB)
+				go measure(linkA, &latencyA, &errA)
+			}
+			wg.Wait()
+
+			resultA.record(latencyA, errA)
+			resultB.record(latencyB, errB)
+
+			switch {
+			case errA != nil && errB != nil:
+				comparison.PairTies++
+			case errB != nil || (errA == nil && latencyA < latencyB):
+				comparison.PairWinsA++
+			default:
+				comparison.PairWinsB++
+			}
+		}
+	}
+
+	resultA.summarize()
+	resultB.summarize()
+	comparison.compare(&resultA, &resultB)
+
+	mu.Lock()
+	test.A = resultA
+	test.B = resultB
+	test.Comparison = &comparison
+	test.Status = "completed"
+	test.CompletedAt = now()
+	mu.Unlock()
+
+	log.Printf("A/B test %s completed: %s", test.ID, comparison.Recommendation)
+}
+
+// record добавляет замер
+func (r *ABVariantResult) record(latency time.Duration, err error) {
+	r.Samples++
+	if err != nil {
+		return
+	}
+	r.Successful++
+	r.latencies = append(r.latencies, float64(latency))
+}
+
+// summarize считает доли и статистику задержек
+func (r *ABVariantResult) summarize() {
+	if r.Samples > 0 {
+		r.SuccessRate = float64(r.Successful) / float64(r.Samples) * 100
+	}
+	if len(r.latencies) == 0 {
+		r.MeanLatency, r.MedianLatency, r.StdDevLatency = "N/A", "N/A", "N/A"
+		return
+	}
+
+	sorted := append([]float64{}, r.latencies...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, value := range sorted {
+		sum += value
+	}
+	mean := sum / float64(len(sorted))
+
+	var squares float64
+	for _, value := range sorted {
+		squares += (value - mean) * (value - mean)
+	}
+	stddev := 0.0
+	if len(sorted) > 1 {
+		stddev = math.Sqrt(squares / float64(len(sorted)-1))
+	}
+
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+
+	r.MeanLatency = time.Duration(mean).String()
+	r.MedianLatency = time.Duration(median).String()
+	r.StdDevLatency = time.Duration(stddev).String()
+}
+
+// compare сравнивает задержки критерием Манна-Уитни (задержки далеки от
+// нормального распределения) и доли успешных замеров z-критерием для двух долей
+func (c *ABComparison) compare(a, b *ABVariantResult) {
+	c.Faster, c.MoreReliable = "none", "none"
+
+	if len(a.latencies) > 0 && len(b.latencies) > 0 {
+		c.LatencyZ = mannWhitneyZ(a.latencies, b.latencies)
+		c.LatencyPValue = twoSidedP(c.LatencyZ)
+		if c.LatencyPValue < abSignificance {
+			if c.LatencyZ > 0 {
+				c.Faster = "b"
+			} else {
+				c.Faster = "a"
+			}
+		}
+	} else {
+		c.LatencyPValue = 1
+	}
+
+	c.ReliabilityP = 1
+	if a.Samples > 0 && b.Samples > 0 {
+		pa := float64(a.Successful) / float64(a.Samples)
+		pb := float64(b.Successful) / float64(b.Samples)
+		pooled := float64(a.Successful+b.Successful) / float64(a.Samples+b.Samples)
+		se := math.Sqrt(pooled * (1 - pooled) * (1/float64(a.Samples) + 1/float64(b.Samples)))
+		if se > 0 {
+			c.ReliabilityZ = (pa - pb) / se
+			c.ReliabilityP = twoSidedP(c.ReliabilityZ)
+			if c.ReliabilityP < abSignificance {
+				if c.ReliabilityZ > 0 {
+					c.MoreReliable = "a"
+				} else {
+					c.MoreReliable = "b"
+				}
+			}
+		}
+	}
+
+	names := map[string]string{"a": a.Name, "b": b.Name}
+	switch {
+	case c.Faster != "none" && c.Faster == c.MoreReliable:
+		c.Recommendation = fmt.Sprintf("%s is both faster and more reliable", names[c.Faster])
+	case c.Faster != "none" && c.MoreReliable != "none":
+		c.Recommendation = fmt.Sprintf("%s is faster, %s is more reliable", names[c.Faster], names[c.MoreReliable])
+	case c.Faster != "none":
+		c.Recommendation = fmt.Sprintf("%s is faster, reliability difference is not significant", names[c.Faster])
+	case c.MoreReliable != "none":
+		c.Recommendation = fmt.Sprintf("%s is more reliable, latency difference is not significant", names[c.MoreReliable])
+	default:
+		c.Recommendation = "no significant difference, consider more rounds"
+	}
+}
+
+// mannWhitneyZ возвращает нормальное приближение U-статистики с поправкой на
+// связи. Положительное значение означает, что задержки a в среднем больше
+func mannWhitneyZ(a, b []float64) float64 {
+	type sample struct {
+		value float64
+		fromA bool
+	}
+	all := make([]sample, 0, len(a)+len(b))
+	for _, value := range a {
+		all = append(all, sample{value, true})
+	}
+	for _, value := range b {
+		all = append(all, sample{value, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	var rankSumA, tieCorrection float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // средний ранг группы связей, ранги с 1
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankSumA += rank
+			}
+		}
+		ties := float64(j - i)
+		tieCorrection += ties*ties*ties - ties
+		i = j
+	}
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	n := n1 + n2
+	u := rankSumA - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - tieCorrection/(n*(n-1)))
+	if variance <= 0 {
+		return 0
+	}
+	return (u - mean) / math.Sqrt(variance)
+}
+
+// twoSidedP - двусторонний p-value для z-статистики
+func twoSidedP(z float64) float64 {
+	return math.Erfc(math.Abs(z) / math.Sqrt2)
+}
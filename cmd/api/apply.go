@@ -0,0 +1,414 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Manifest - декларативное описание мониторов (подписок), пулов и
+// уведомлений (контроллеров). Объекты сопоставляются с существующими по имени.
+// Раздел, которого нет в манифесте, не трогается; пустой список удаляет все
+// объекты этого вида
+type Manifest struct {
+	Monitors      []SubscriptionRequest `json:"monitors"`
+	Pools         []PoolRequest         `json:"pools"`
+	Notifications []ControllerRequest   `json:"notifications"`
+}
+
+// ApplyRequest - тело запроса apply
+type ApplyRequest struct {
+	Manifest
+	DryRun bool `json:"dry_run"`
+}
+
+// ApplyAction - одно действие плана
+type ApplyAction struct {
+	Kind    string   `json:"kind"` // monitor, pool или notification
+	Name    string   `json:"name"`
+	ID      string   `json:"id,omitempty"`
+	Action  string   `json:"action"` // create, update, delete или unchanged
+	Changes []string `json:"changes,omitempty"`
+}
+
+// registerApplyRoutes подключает эндпоинт декларативной настройки к группе API
+func registerApplyRoutes(api *gin.RouterGroup) {
+	api.POST("/apply", applyManifest)
+}
+
+// applyManifest приводит мониторы, пулы и уведомления к описанным в манифесте:
+// создаёт недостающие, изменяет отличающиеся и удаляет лишние. Манифест
+// проверяется целиком до любых изменений. С dry_run возвращается только план
+func applyManifest(c *gin.Context) {
+	var request ApplyRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if err := request.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid manifest", "details": err.Error()})
+		return
+	}
+
+	mu.Lock()
+	var actions []ApplyAction
+	var created []string
+	if request.Monitors != nil {
+		var monitorActions []ApplyAction
+		monitorActions, created = applyMonitors(request.Monitors, request.DryRun)
+		actions = append(actions, monitorActions...)
+	}
+	if request.Pools != nil {
+		actions = append(actions, applyPools(request.Pools, request.DryRun)...)
+	}
+	if request.Notifications != nil {
+		actions = append(actions, applyNotifications(request.Notifications, request.DryRun)...)
+	}
+	mu.Unlock()
+
+	// Как и при создании через POST, новые подписки сразу загружаются
+	for _, id := range created {
+		go refreshSubscription(id)
+	}
+
+	summary := map[string]int{"create": 0, "update": 0, "delete": 0, "unchanged": 0}
+	for _, action := range actions {
+		summary[action.Action]++
+	}
+	c.JSON(http.StatusOK, gin.H{"dry_run": request.DryRun, "summary": summary, "actions": actions})
+}
+
+// validate проверяет все объекты манифеста. Имена должны быть заданы и
+// уникальны в пределах вида, потому что по ним объекты сопоставляются
+func (r *ApplyRequest) validate() error {
+	names := make(map[string]bool)
+	checkName := func(kind, name string) error {
+		if name == "" {
+			return fmt.Errorf("%s without name", kind)
+		}
+		if names[kind+"/"+name] {
+			return fmt.Errorf("duplicate %s %q", kind, name)
+		}
+		names[kind+"/"+name] = true
+		return nil
+	}
+
+	statusPages := make(map[string]bool)
+	for i := range r.Monitors {
+		if err := checkName("monitor", r.Monitors[i].Name); err != nil {
+			return err
+		}
+		if err := r.Monitors[i].validate(); err != nil {
+			return fmt.Errorf("monitor %q: %w", r.Monitors[i].Name, err)
+		}
+		if page := r.Monitors[i].StatusPage; page != "" {
+			if statusPages[page] {
+				return fmt.Errorf("monitor %q: duplicate status_page %q", r.Monitors[i].Name, page)
+			}
+			statusPages[page] = true
+		}
+	}
+	for i := range r.Pools {
+		if err := checkName("pool", r.Pools[i].Name); err != nil {
+			return err
+		}
+		if err := r.Pools[i].validate(); err != nil {
+			return fmt.Errorf("pool %q: %w", r.Pools[i].Name, err)
+		}
+	}
+	for i := range r.Notifications {
+		if err := checkName("notification", r.Notifications[i].Name); err != nil {
+			return err
+		}
+		if err := r.Notifications[i].validate(); err != nil {
+			return fmt.Errorf("notification %q: %w", r.Notifications[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// matchByName сопоставляет объявленные имена с ID существующих объектов.
+// Если несколько объектов носят одно имя, остаётся объект с наименьшим ID,
+// остальные попадают в лишние вместе с необъявленными
+func matchByName(existing map[string]string, declared []string) (matched map[string]string, extra []string) {
+	ids := make([]string, 0, len(existing))
+	for id := range existing {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	wanted := make(map[string]bool, len(declared))
+	for _, name := range declared {
+		wanted[name] = true
+	}
+	matched = make(map[string]string)
+	for _, id := range ids {
+		name := existing[id]
+		if _, taken := matched[name]; wanted[name] && !taken {
+			matched[name] = id
+			continue
+		}
+		extra = append(extra, id)
+	}
+	return matched, extra
+}
+
+// applyMonitors сводит подписки к манифесту. Вызывается под mu; возвращает
+// план и ID созданных подписок
+func applyMonitors(declared []SubscriptionRequest, dryRun bool) ([]ApplyAction, []string) {
+	existing := make(map[string]string, len(subscriptions))
+	for id, sub := range subscriptions {
+		existing[id] = sub.Name
+	}
+	names := make([]string, 0, len(declared))
+	for _, request := range declared {
+		names = append(names, request.Name)
+	}
+	matched, extra := matchByName(existing, names)
+
+	var actions []ApplyAction
+	var created []string
+	for _, request := range declared {
+		id, exists := matched[request.Name]
+		if !exists {
+			action := ApplyAction{Kind: "monitor", Name: request.Name, Action: "create"}
+			if !dryRun {
+				sub := newSubscription(request)
+				for subscriptions[sub.ID] != nil {
+					sub.ID += "_"
+				}
+				subscriptions[sub.ID] = sub
+				action.ID = sub.ID
+				created = append(created, sub.ID)
+			}
+			actions = append(actions, action)
+			continue
+		}
+
+		sub := subscriptions[id]
+		var changes []string
+		if sub.URL != request.URL {
+			changes = append(changes, "url")
+		}
+		if sub.Interval != request.Interval {
+			changes = append(changes, "interval")
+		}
+		if sub.Timeout != request.Timeout {
+			changes = append(changes, "timeout")
+		}
+		if sub.CheckOnChange != request.CheckOnChange {
+			changes = append(changes, "check_on_change")
+		}
+		if sub.StatusPage != request.StatusPage {
+			changes = append(changes, "status_page")
+		}
+		actions = append(actions, planned("monitor", request.Name, id, changes))
+		if len(changes) > 0 && !dryRun {
+			sub.URL = request.URL
+			sub.Interval = request.Interval
+			sub.Timeout = request.Timeout
+			sub.CheckOnChange = request.CheckOnChange
+			sub.StatusPage = request.StatusPage
+			sub.UpdatedAt = now()
+		}
+	}
+
+	for _, id := range extra {
+		actions = append(actions, ApplyAction{Kind: "monitor", Name: subscriptions[id].Name, ID: id, Action: "delete"})
+		if !dryRun {
+			delete(subscriptions, id)
+		}
+	}
+	return actions, created
+}
+
+// applyPools сводит пулы к манифесту. Ссылки пула, которых нет в манифесте,
+// удаляются (в том числе из pruned), недостающие добавляются, теги объявленных
+// ссылок заменяются тегами манифеста. Счётчики неудач оставшихся прокси
+// сохраняются. Вызывается под mu
+func applyPools(declared []PoolRequest, dryRun bool) []ApplyAction {
+	existing := make(map[string]string, len(pools))
+	for id, pool := range pools {
+		existing[id] = pool.Name
+	}
+	names := make([]string, 0, len(declared))
+	for _, request := range declared {
+		names = append(names, request.Name)
+	}
+	matched, extra := matchByName(existing, names)
+
+	var actions []ApplyAction
+	for _, request := range declared {
+		id, exists := matched[request.Name]
+		if !exists {
+			action := ApplyAction{Kind: "pool", Name: request.Name, Action: "create"}
+			if !dryRun {
+				pool := newPool(request)
+				for pools[pool.ID] != nil {
+					pool.ID += "_"
+				}
+				pools[pool.ID] = pool
+				action.ID = pool.ID
+			}
+			actions = append(actions, action)
+			continue
+		}
+
+		pool := pools[id]
+		changes := syncPool(pool, request, dryRun)
+		actions = append(actions, planned("pool", request.Name, id, changes))
+		if len(changes) > 0 && !dryRun {
+			pool.UpdatedAt = now()
+		}
+	}
+
+	for _, id := range extra {
+		actions = append(actions, ApplyAction{Kind: "pool", Name: pools[id].Name, ID: id, Action: "delete"})
+		if !dryRun {
+			delete(pools, id)
+		}
+	}
+	return actions
+}
+
+// syncPool приводит ссылки, теги и политику чистки пула к запросу и
+// возвращает описание изменений. С dryRun пул не меняется
+func syncPool(pool *Pool, request PoolRequest, dryRun bool) []string {
+	wanted := make(map[string]bool, len(request.Configs))
+	for _, link := range request.Configs {
+		wanted[link] = true
+	}
+
+	present := make(map[string]bool)
+	removed, retagged := 0, 0
+	keep := func(list []*PoolProxy) []*PoolProxy {
+		var kept []*PoolProxy
+		for _, proxy := range list {
+			if !wanted[proxy.Link] || present[proxy.Link] {
+				removed++
+				continue
+			}
+			present[proxy.Link] = true
+			if !equalTags(proxy.Tags, request.Tags) {
+				retagged++
+				if !dryRun {
+					proxy.Tags = append([]string{}, request.Tags...)
+				}
+			}
+			kept = append(kept, proxy)
+		}
+		return kept
+	}
+	proxies, pruned := keep(pool.Proxies), keep(pool.Pruned)
+
+	var added []string
+	for _, link := range request.Configs {
+		if !present[link] {
+			present[link] = true
+			added = append(added, link)
+		}
+	}
+
+	var changes []string
+	if len(added) > 0 {
+		changes = append(changes, fmt.Sprintf("add %d proxies", len(added)))
+	}
+	if removed > 0 {
+		changes = append(changes, fmt.Sprintf("remove %d proxies", removed))
+	}
+	if retagged > 0 {
+		changes = append(changes, fmt.Sprintf("retag %d proxies", retagged))
+	}
+	if !reflect.DeepEqual(pool.Prune, request.Prune) {
+		changes = append(changes, "prune")
+	}
+
+	if !dryRun {
+		pool.Proxies, pool.Pruned = proxies, pruned
+		for _, link := range added {
+			pool.add(link, request.Tags)
+		}
+		pool.Prune = request.Prune
+	}
+	return changes
+}
+
+// applyNotifications сводит контроллеры к манифесту. Вызывается под mu
+func applyNotifications(declared []ControllerRequest, dryRun bool) []ApplyAction {
+	existing := make(map[string]string, len(controllers))
+	for id, ctrl := range controllers {
+		existing[id] = ctrl.Name
+	}
+	names := make([]string, 0, len(declared))
+	for _, request := range declared {
+		names = append(names, request.Name)
+	}
+	matched, extra := matchByName(existing, names)
+
+	var actions []ApplyAction
+	for _, request := range declared {
+		id, exists := matched[request.Name]
+		if !exists {
+			action := ApplyAction{Kind: "notification", Name: request.Name, Action: "create"}
+			if !dryRun {
+				ctrl := request.controller()
+				for controllers[ctrl.ID] != nil {
+					ctrl.ID += "_"
+				}
+				controllers[ctrl.ID] = ctrl
+				action.ID = ctrl.ID
+			}
+			actions = append(actions, action)
+			continue
+		}
+
+		ctrl := controllers[id]
+		var changes []string
+		if ctrl.URL != request.URL {
+			changes = append(changes, "url")
+		}
+		if ctrl.secret != request.Secret {
+			changes = append(changes, "secret")
+		}
+		if ctrl.Group != request.Group {
+			changes = append(changes, "group")
+		}
+		if ctrl.Provider != request.Provider {
+			changes = append(changes, "provider")
+		}
+		if ctrl.Subscription != request.Subscription || ctrl.Pool != request.Pool || ctrl.Namespace != request.Namespace {
+			changes = append(changes, "binding")
+		}
+		actions = append(actions, planned("notification", request.Name, id, changes))
+		if len(changes) > 0 && !dryRun {
+			ctrl.URL = request.URL
+			ctrl.secret = request.Secret
+			ctrl.Group = request.Group
+			ctrl.Provider = request.Provider
+			ctrl.Subscription = request.Subscription
+			ctrl.Pool = request.Pool
+			ctrl.Namespace = request.Namespace
+		}
+	}
+
+	for _, id := range extra {
+		actions = append(actions, ApplyAction{Kind: "notification", Name: controllers[id].Name, ID: id, Action: "delete"})
+		if !dryRun {
+			delete(controllers, id)
+		}
+	}
+	return actions
+}
+
+// planned возвращает действие для существующего объекта
+func planned(kind, name, id string, changes []string) ApplyAction {
+	action := ApplyAction{Kind: kind, Name: name, ID: id, Action: "unchanged"}
+	if len(changes) > 0 {
+		action.Action = "update"
+		action.Changes = changes
+	}
+	return action
+}
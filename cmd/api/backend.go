@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backendRecheckInterval - как часто заново ищется бинарник Xray, чтобы
+// установка без перезапуска сервера подхватывалась сама
+const backendRecheckInterval = 30 * time.Second
+
+// xrayBinary - имя или путь бинарника Xray из XRAY_BINARY
+var xrayBinary = loadXrayBinary()
+
+func loadXrayBinary() string {
+	if value := os.Getenv("XRAY_BINARY"); value != "" {
+		return value
+	}
+	return "xray"
+}
+
+// BackendStatus - доступность средства проверки протоколов, которым нужен Xray
+type BackendStatus struct {
+	Name            string   `json:"name"` // xray или simulate
+	Available       bool     `json:"available"`
+	Path            string   `json:"path,omitempty"`   // Найденный бинарник Xray
+	Error           string   `json:"error,omitempty"`  // Почему бинарник не найден
+	NativeProtocols []string `json:"native_protocols"` // Проверяются и без Xray
+}
+
+var (
+	backendMu      sync.Mutex
+	backendState   BackendStatus
+	backendChecked time.Time
+)
+
+// backendStatus ищет бинарник Xray, результат кешируется на backendRecheckInterval
+func backendStatus() BackendStatus {
+	if simulation != nil {
+		return BackendStatus{Name: "simulate", Available: true, NativeProtocols: nativeProtocols()}
+	}
+
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if time.Since(backendChecked) < backendRecheckInterval {
+		return backendState
+	}
+
+	state := BackendStatus{Name: "xray", NativeProtocols: nativeProtocols()}
+	if path, err := exec.LookPath(xrayBinary); err != nil {
+		state.Error = err.Error()
+	} else {
+		state.Available = true
+		state.Path = path
+	}
+	if state.Available != backendState.Available || backendChecked.IsZero() {
+		if state.Available {
+			log.Printf("Xray backend available: %s", state.Path)
+		} else {
+			log.Printf("Xray backend unavailable, only %v proxies will be checked: %s", state.NativeProtocols, state.Error)
+		}
+	}
+	backendState, backendChecked = state, time.Now()
+	return state
+}
+
+// nativeProtocols возвращает схемы ссылок, которые проверяются без Xray
+func nativeProtocols() []string {
+	var schemes []string
+	for scheme, handler := range protocols {
+		if handler.xrayConfig == nil && isDirectProxy(scheme+"://") {
+			schemes = append(schemes, scheme)
+		}
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// backendUnavailableReason возвращает причину пропуска ссылки, которой нужен
+// недоступный Xray, или пустую строку, если ссылку можно проверить
+func backendUnavailableReason(proxyURL string) string {
+	scheme, _, _ := strings.Cut(proxyURL, "://")
+	if handler := protocols[strings.ToLower(scheme)]; handler.singBox {
+		return "skipped (backend unavailable): " + strings.ToLower(scheme) + " needs the sing-box backend, the API checks through Xray only"
+	}
+	if simulation != nil || isDirectProxy(proxyURL) {
+		return ""
+	}
+	if status := backendStatus(); !status.Available {
+		return "skipped (backend unavailable): Xray binary " + xrayBinary + " not found; install Xray-core or set XRAY_BINARY, socks and http proxies are still checked"
+	}
+	return ""
+}
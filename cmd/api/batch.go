@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cancelledReason - причина пропуска ссылок, до которых отменённый тест не дошёл
+const cancelledReason = "not checked (test cancelled)"
+
+// testLaunch - параметры запуска теста, по ним тест перезапускается
+type testLaunch struct {
+	name       string
+	configs    []json.RawMessage
+	proxyCount int
+	timeout    int
+	opts       testOptions
+}
+
+// launches хранит параметры запуска тестов этого процесса, защищено mu.
+// Тесты, восстановленные из журнала, перезапустить нельзя
+var launches = make(map[string]testLaunch)
+
+// launchRetention - сколько хранятся параметры запуска завершённого теста,
+// то есть сколько его можно перезапустить
+var launchRetention = envDuration("RETRY_RETENTION", 24*time.Hour)
+
+// pruneLaunches удаляет параметры запуска тестов, которых больше нет или
+// которые закончились раньше launchRetention. Janitor вызывает её на
+// каждом проходе, иначе launches рос бы с каждым тестом
+func pruneLaunches() {
+	mu.Lock()
+	defer mu.Unlock()
+	for id := range launches {
+		test, ok := tests[id]
+		if !ok {
+			delete(launches, id)
+			continue
+		}
+		if test.Status == "running" || test.Status == "pending" {
+			continue
+		}
+		finished := test.CompletedAt
+		if finished.IsZero() {
+			finished = test.StartedAt
+		}
+		if since(finished) > launchRetention {
+			delete(launches, id)
+		}
+	}
+}
+
+// Исходы операции над одним тестом
+const (
+	batchCancelled = "cancelled"
+	batchRetried   = "retried"
+	batchNotFound  = "not_found"
+	batchSkipped   = "skipped" // Тест не подходит для операции, причина в error
+)
+
+// BatchFilter выбирает тесты по статусу, возрасту и пространству имён
+type BatchFilter struct {
+	Status    string `json:"status"`     // Пусто - для отмены running, для перезапуска любой
+	OlderThan string `json:"older_than"` // Длительность в формате Go, тест запущен раньше
+	Namespace string `json:"namespace"`
+}
+
+// BatchRequest - список тестов или фильтр, по которому они выбираются
+type BatchRequest struct {
+	IDs    []string     `json:"ids"`
+	Filter *BatchFilter `json:"filter"`
+}
+
+// BatchOutcome - исход операции над одним тестом
+type BatchOutcome struct {
+	TestID    string `json:"test_id"`
+	Outcome   string `json:"outcome"`               // cancelled, retried, not_found или skipped
+	NewTestID string `json:"new_test_id,omitempty"` // Тест, запущенный вместо этого
+	Error     string `json:"error,omitempty"`
+}
+
+func registerBatchRoutes(api *gin.RouterGroup) {
+	api.POST(`/tests\:batchCancel`, batchCancel)
+	api.POST(`/tests\:batchRetry`, batchRetry)
+}
+
+// batchCancel отменяет выполняющиеся тесты. Проверки, которые уже идут,
+// обрываются вместе с процессами Xray, остальные ссылки пропускаются;
+// результат теста сохраняется с тем, что успели проверить
+func batchCancel(c *gin.Context) {
+	ids, ok := batchSelect(c, "running")
+	if !ok {
+		return
+	}
+
+	outcomes := make([]BatchOutcome, 0, len(ids))
+	for _, id := range ids {
+		outcomes = append(outcomes, cancelTest(id))
+	}
+	c.JSON(http.StatusOK, gin.H{"matched": len(ids), "results": outcomes})
+}
+
+// batchRetry запускает завершённые тесты заново с теми же ссылками и
+// параметрами. Каждый перезапуск - новый тест со своим идентификатором
+func batchRetry(c *gin.Context) {
+	ids, ok := batchSelect(c, "")
+	if !ok {
+		return
+	}
+
+	outcomes := make([]BatchOutcome, 0, len(ids))
+	for _, id := range ids {
+		outcomes = append(outcomes, retryTest(id))
+	}
+	c.JSON(http.StatusOK, gin.H{"matched": len(ids), "results": outcomes})
+}
+
+// batchSelect разбирает запрос и возвращает идентификаторы тестов: из списка
+// как есть, по фильтру - найденные. defaultStatus подставляется в фильтр без статуса
+func batchSelect(c *gin.Context, defaultStatus string) ([]string, bool) {
+	var request BatchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return nil, false
+	}
+	if len(request.IDs) > 0 && request.Filter != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": "ids and filter are mutually exclusive"})
+		return nil, false
+	}
+	if len(request.IDs) > 0 {
+		return request.IDs, true
+	}
+	if request.Filter == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": "ids or filter is required"})
+		return nil, false
+	}
+
+	filter := *request.Filter
+	if filter.Status == "" && filter.OlderThan == "" && filter.Namespace == "" && defaultStatus == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": "filter must set status, older_than or namespace"})
+		return nil, false
+	}
+	if filter.Status == "" {
+		filter.Status = defaultStatus
+	}
+	var olderThan time.Duration
+	if filter.OlderThan != "" {
+		d, err := time.ParseDuration(filter.OlderThan)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": "older_than must be a non-negative duration such as 1h"})
+			return nil, false
+		}
+		olderThan = d
+	}
+
+	var ids []string
+	mu.Lock()
+	for id, test := range tests {
+		if filter.Status != "" && test.Status != filter.Status {
+			continue
+		}
+		if filter.Namespace != "" && test.Namespace != filter.Namespace {
+			continue
+		}
+		if olderThan > 0 && since(test.StartedAt) < olderThan {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	mu.Unlock()
+	sort.Strings(ids)
+	return ids, true
+}
+
+// testCancelled сообщает, что тест отменён
+func testCancelled(testID string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	test, exists := tests[testID]
+	return exists && test.Status == "cancelled"
+}
+
+// cancelTest помечает тест отменённым и убивает его процессы Xray. runTest
+// дописывает результат сам, когда закончатся начатые проверки
+func cancelTest(testID string) BatchOutcome {
+	outcome := BatchOutcome{TestID: testID}
+	mu.Lock()
+	test, exists := tests[testID]
+	switch {
+	case !exists:
+		outcome.Outcome = batchNotFound
+	case test.Status != "running":
+		outcome.Outcome = batchSkipped
+		outcome.Error = fmt.Sprintf("test is %s", test.Status)
+	default:
+		test.Status = "cancelled"
+		outcome.Outcome = batchCancelled
+	}
+	mu.Unlock()
+
+	if outcome.Outcome == batchCancelled {
+		killed := resources.killTest(testID)
+		log.Printf("Test %s cancelled, %d Xray processes killed", testID, killed)
+	}
+	return outcome
+}
+
+// retryTest запускает тест заново с сохранёнными параметрами
+func retryTest(testID string) BatchOutcome {
+	outcome := BatchOutcome{TestID: testID, Outcome: batchSkipped}
+	mu.Lock()
+	test, exists := tests[testID]
+	launch, launched := launches[testID]
+	var status string
+	if exists {
+		status = test.Status
+	}
+	mu.Unlock()
+
+	switch {
+	case !exists:
+		outcome.Outcome = batchNotFound
+		return outcome
+	case status == "running":
+		outcome.Error = "test is still running"
+		return outcome
+	case !launched:
+		outcome.Error = "launch parameters are not kept for tests recovered after a restart or finished more than " + launchRetention.String() + " ago"
+		return outcome
+	}
+	if err := usageMeter.checkQuota(launch.opts.namespace); err != nil {
+		outcome.Error = err.Error()
+		return outcome
+	}
+
+	retried := launchTest(launch.name, launch.configs, launch.proxyCount, launch.timeout, launch.opts)
+	log.Printf("Test %s retried as %s", testID, retried.ID)
+	outcome.Outcome = batchRetried
+	outcome.NewTestID = retried.ID
+	return outcome
+}
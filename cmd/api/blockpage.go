@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// blockPageLimit - сколько тела ответа читается для поиска признаков
+// страницы блокировки
+const blockPageLimit = 64 << 10
+
+// blockPageMarkers - фразы страниц блокировки провайдеров и регуляторов и
+// страниц авторизации гостевых сетей, в нижнем регистре
+var blockPageMarkers = []string{
+	"rkn.gov.ru",
+	"eais.rkn",
+	"доступ к информационному ресурсу ограничен",
+	"доступ ограничен",
+	"сайт заблокирован",
+	"ресурс заблокирован",
+	"access to this site is blocked",
+	"access to this website has been blocked",
+	"this site has been blocked",
+	"this website has been blocked",
+	"web page blocked",
+	"website blocked",
+	"url blocked",
+	"blocked by order",
+	"internet.gov.ir",
+	"peyvandha.ir",
+	"captive portal",
+	"hotspot login",
+	"wi-fi login",
+	"wifi login",
+	"accept the terms",
+}
+
+// blockedError - вместо ответа проверочного адреса пришла страница
+// блокировки или авторизации гостевой сети
+type blockedError struct {
+	reason string
+}
+
+func (e *blockedError) Error() string {
+	return "blocked: " + e.reason
+}
+
+// detectBlockPage ищет в ответе на проверочный запрос признаки подмены:
+// generate_204 никогда не отвечает телом и не перенаправляет на другой
+// хост, а страница блокировки или гостевой сети узнаётся по фразам или
+// мета-редиректу. body - начало тела ответа. nil - признаков нет
+func detectBlockPage(target string, resp *http.Response, body []byte) *blockedError {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil
+	}
+	expected, err := url.Parse(target)
+	if err != nil {
+		return nil
+	}
+
+	if strings.HasSuffix(expected.Path, "generate_204") {
+		if resp.Request != nil && resp.Request.URL.Host != expected.Host {
+			return &blockedError{reason: fmt.Sprintf("redirected to %s", resp.Request.URL.Host)}
+		}
+		if resp.StatusCode != http.StatusNoContent && len(body) > 0 {
+			return &blockedError{reason: fmt.Sprintf("status %d with a %d-byte body instead of an empty 204", resp.StatusCode, len(body))}
+		}
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+		return nil
+	}
+	page := bytes.ToLower(body)
+	for _, marker := range blockPageMarkers {
+		if bytes.Contains(page, []byte(marker)) {
+			return &blockedError{reason: fmt.Sprintf("page mentions %q", marker)}
+		}
+	}
+	if bytes.Contains(page, []byte(`http-equiv="refresh"`)) {
+		return &blockedError{reason: "page redirects with a meta refresh"}
+	}
+	return nil
+}
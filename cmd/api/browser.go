@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"projectx/parser"
+)
+
+const (
+	// browserTokenTTL - время жизни одноразового токена
+	browserTokenTTL = 15 * time.Minute
+	// browserMaxTargets - браузер проверяет только небольшой набор прокси
+	browserMaxTargets = 10
+	// browserSamples - замеров на каждый прокси
+	browserSamples = 3
+)
+
+// BrowserTarget - прокси, доступный браузеру по HTTP(S)
+type BrowserTarget struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Rank int    `json:"rank"` // Rank прокси в WorkingProxies
+}
+
+// BrowserMeasurement - замер, присланный браузером
+type BrowserMeasurement struct {
+	TargetID  int     `json:"target_id"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// VantagePoint - замеры из отдельной точки наблюдения, например из браузера пользователя
+type VantagePoint struct {
+	Source       string               `json:"source"`
+	ClientIP     string               `json:"client_ip"`
+	UserAgent    string               `json:"user_agent"`
+	SubmittedAt  time.Time            `json:"submitted_at"`
+	Targets      []BrowserTarget      `json:"targets"`
+	Measurements []BrowserMeasurement `json:"measurements"`
+}
+
+// browserCheck - выданный и ещё не использованный токен
+type browserCheck struct {
+	testID  string
+	targets []BrowserTarget
+	expires time.Time
+}
+
+var browserChecks = make(map[string]*browserCheck)
+
+// registerBrowserRoutes подключает эндпоинты проверки из браузера к группе API
+func registerBrowserRoutes(api *gin.RouterGroup) {
+	api.POST("/results/:id/browser-check", createBrowserCheck)
+	api.GET("/browser-checks/:token/script.js", browserCheckScript)
+	api.POST("/browser-checks/:token", submitBrowserCheck)
+}
+
+// createBrowserCheck выдаёт одноразовый токен и JS-сниппет, который
+// измеряет из браузера пользователя задержку до HTTP-доступных прокси теста
+func createBrowserCheck(c *gin.Context) {
+	testID := c.Param("id")
+	mu.Lock()
+	result, exists := results[testID]
+	var working []ProxyInfo
+	if exists {
+		working = append(working, result.WorkingProxies...)
+	}
+	mu.Unlock()
+
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Results not found", "test_id": testID})
+		return
+	}
+
+	targets := browserTargets(working)
+	if len(targets) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No HTTP-exposed working proxies (ws, xhttp, httpupgrade or http transport)"})
+		return
+	}
+
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	token := hex.EncodeToString(tokenBytes)
+	expires := now().Add(browserTokenTTL)
+
+	mu.Lock()
+	for key, check := range browserChecks {
+		if now().After(check.expires) {
+			delete(browserChecks, key)
+		}
+	}
+	browserChecks[token] = &browserCheck{testID: testID, targets: targets, expires: expires}
+	mu.Unlock()
+
+	base := browserCheckBase(c, token)
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": expires.Format(time.RFC3339),
+		"targets":    targets,
+		"script_url": base + "/script.js",
+		"snippet":    browserScript(base, targets),
+	})
+}
+
+// browserCheckScript отдаёт сниппет как JS-файл для вставки через <script src>
+func browserCheckScript(c *gin.Context) {
+	token := c.Param("token")
+	mu.Lock()
+	check, exists := browserChecks[token]
+	mu.Unlock()
+
+	if !exists || now().After(check.expires) {
+		c.String(http.StatusNotFound, "// token not found or expired\n")
+		return
+	}
+
+	script := browserScript(browserCheckBase(c, token), check.targets)
+	c.Data(http.StatusOK, "application/javascript; charset=utf-8", []byte(script))
+}
+
+// browserCheckBase - адрес, на который сниппет отправляет замеры
+func browserCheckBase(c *gin.Context, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/v1/browser-checks/%s", scheme, c.Request.Host, token)
+}
+
+// submitBrowserCheck принимает замеры браузера и добавляет их в результат
+// теста отдельной точкой наблюдения. Токен после этого недействителен
+func submitBrowserCheck(c *gin.Context) {
+	var body struct {
+		Measurements []BrowserMeasurement `json:"measurements"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	token := c.Param("token")
+	check, exists := browserChecks[token]
+	if !exists || now().After(check.expires) {
+		delete(browserChecks, token)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found or expired"})
+		return
+	}
+	delete(browserChecks, token)
+
+	result, exists := results[check.testID]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Results not found", "test_id": check.testID})
+		return
+	}
+
+	// Принимаем только замеры выданных целей, по одному на цель
+	measurements := make([]BrowserMeasurement, 0, len(check.targets))
+	seen := make(map[int]bool)
+	for _, m := range body.Measurements {
+		if m.TargetID < 0 || m.TargetID >= len(check.targets) || seen[m.TargetID] {
+			continue
+		}
+		seen[m.TargetID] = true
+		measurements = append(measurements, m)
+	}
+
+	result.Vantages = append(result.Vantages, VantagePoint{
+		Source:       "browser",
+		ClientIP:     c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		SubmittedAt:  now(),
+		Targets:      check.targets,
+		Measurements: measurements,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"test_id": check.testID, "accepted": len(measurements)})
+}
+
+// browserTargets выбирает рабочие прокси, к которым браузер может обратиться
+// напрямую по HTTP(S): транспорты ws, xhttp, httpupgrade и http.
+// REALITY не подходит - сервер отвечает от имени чужого сайта
+func browserTargets(working []ProxyInfo) []BrowserTarget {
+	var targets []BrowserTarget
+	for _, proxy := range working {
+		if len(targets) == browserMaxTargets {
+			break
+		}
+		config, err := parser.ParseProxyURL(proxy.Link)
+		if err != nil {
+			continue
+		}
+		switch config.Type {
+		case "ws", "xhttp", "httpupgrade", "http":
+		default:
+			continue
+		}
+		if config.Security == "reality" {
+			continue
+		}
+
+		scheme := "http"
+		host := config.Server
+		if config.Security == "tls" {
+			scheme = "https"
+			if config.SNI != "" {
+				host = config.SNI
+			}
+		}
+		if config.Host != "" {
+			host = strings.Split(config.Host, ",")[0]
+		}
+		path := config.Path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		targets = append(targets, BrowserTarget{
+			ID:   len(targets),
+			Name: proxy.Name,
+			URL:  scheme + "://" + net.JoinHostPort(host, strconv.Itoa(config.Port)) + path,
+			Rank: proxy.Rank,
+		})
+	}
+	return targets
+}
+
+// browserScript формирует JS-сниппет. Ответы no-cors запросов непрозрачны,
+// поэтому измеряется только время до ответа сервера
+func browserScript(base string, targets []BrowserTarget) string {
+	encodedTargets, _ := json.Marshal(targets)
+	encodedBase, _ := json.Marshal(base)
+	return fmt.Sprintf(`(async () => {
+  const base = %s;
+  const targets = %s;
+  const samples = %d;
+  const measurements = [];
+  for (const target of targets) {
+    const times = [];
+    let error = "";
+    for (let i = 0; i < samples; i++) {
+      const start = performance.now();
+      try {
+        await fetch(target.url + (target.url.includes("?") ? "&" : "?") + "_=" + Date.now(), {mode: "no-cors", cache: "no-store"});
+        times.push(performance.now() - start);
+      } catch (e) {
+        error = String(e);
+      }
+    }
+    times.sort((a, b) => a - b);
+    measurements.push(times.length
+      ? {target_id: target.id, latency_ms: times[Math.floor(times.length / 2)]}
+      : {target_id: target.id, latency_ms: 0, error: error || "no response"});
+  }
+  const response = await fetch(base, {method: "POST", headers: {"Content-Type": "application/json"}, body: JSON.stringify({measurements})});
+  console.log("Browser check submitted:", await response.json(), measurements);
+})();
+`, encodedBase, encodedTargets, browserSamples)
+}
@@ -0,0 +1,62 @@
+package main
+
+import "time"
+
+// budgetSkipReason - причина пропуска прокси, до которого не дошла очередь
+// в пределах бюджета теста
+const budgetSkipReason = "skipped (budget)"
+
+// testBudget ограничивает общее время теста. Незадолго до конца бюджета
+// новые проверки не начинаются, а идущие обрываются, чтобы тест успел
+// собрать результаты
+type testBudget struct {
+	budget time.Duration // 0 - без ограничения
+	stopAt time.Time
+}
+
+func newTestBudget(start time.Time, budget time.Duration) *testBudget {
+	if budget <= 0 {
+		return &testBudget{}
+	}
+	// Запас на сборку результатов: 5% бюджета, от 500мс до 10с
+	reserve := budget / 20
+	if reserve < 500*time.Millisecond {
+		reserve = 500 * time.Millisecond
+	}
+	if reserve > 10*time.Second {
+		reserve = 10 * time.Second
+	}
+	if reserve > budget/2 {
+		reserve = budget / 2
+	}
+	return &testBudget{budget: budget, stopAt: start.Add(budget - reserve)}
+}
+
+// timeout урезает таймаут проверки до остатка бюджета. truncated - таймаут
+// урезан, ok - бюджет ещё не исчерпан
+func (b *testBudget) timeout(full time.Duration) (limit time.Duration, truncated, ok bool) {
+	if b.budget == 0 {
+		return full, false, true
+	}
+	remaining := time.Until(b.stopAt)
+	if remaining <= 0 {
+		return 0, false, false
+	}
+	if remaining < full {
+		return remaining, true, true
+	}
+	return full, false, true
+}
+
+// exhausted сообщает, что время на проверки вышло
+func (b *testBudget) exhausted() bool {
+	return b.budget > 0 && !time.Now().Before(b.stopAt)
+}
+
+// usage возвращает долю бюджета, потраченную за elapsed, в процентах
+func (b *testBudget) usage(elapsed time.Duration) float64 {
+	if b.budget == 0 {
+		return 0
+	}
+	return float64(elapsed) / float64(b.budget) * 100
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// resultCacheTTL - сколько результат завершённого теста считается свежим для
+// повторного запроса с тем же набором конфигов и параметров
+var resultCacheTTL = envDuration("RESULT_CACHE_TTL", 10*time.Minute)
+
+// CacheInfo - сведения о свежем результате теста с тем же набором конфигов
+type CacheInfo struct {
+	TestID      string    `json:"test_id"`
+	Checksum    string    `json:"checksum"`
+	CompletedAt time.Time `json:"completed_at"`
+	Age         string    `json:"age"`
+	ExpiresIn   string    `json:"expires_in"`
+
+	startedAt time.Time
+}
+
+// testChecksum считает SHA-256 набора конфигов и параметров, влияющих на
+// результат. Ссылки сортируются, поэтому порядок конфигов в запросе не
+// важен. Пустая строка - тест с выборкой, его результат случаен и не кешируется
+func testChecksum(configs []json.RawMessage, proxyCount, timeout int, opts testOptions) string {
+	if opts.sample != nil {
+		return ""
+	}
+	if proxyCount < len(configs) {
+		configs = configs[:proxyCount]
+	}
+
+	entries := make([]string, 0, len(configs))
+	for _, config := range configs {
+		link, tags, err := configEntry(config)
+		if err != nil {
+			entries = append(entries, string(config))
+			continue
+		}
+		encoded, _ := json.Marshal(struct {
+			Link string   `json:"link"`
+			Tags []string `json:"tags"`
+		}{link, tags})
+		entries = append(entries, string(encoded))
+	}
+	sort.Strings(entries)
+
+	var speed []int64
+	if opts.speed != nil {
+		speed = []int64{opts.speed.size, int64(opts.speed.timeout)}
+	}
+	encoded, _ := json.Marshal(struct {
+		Configs        []string        `json:"configs"`
+		Timeout        int             `json:"timeout"`
+		Rules          interface{}     `json:"rules"`
+		SkipGarbage    bool            `json:"skip_garbage"`
+		Reference      string          `json:"reference"`
+		Ping           bool            `json:"ping"`
+		KeepDuplicates bool            `json:"keep_duplicates"`
+		Budget         time.Duration   `json:"budget"`
+		ContentTargets []ContentTarget `json:"content_targets"`
+		Unlock         bool            `json:"unlock"`
+		ExitIP         bool            `json:"exit_ip"`
+		Reputation     bool            `json:"reputation"`
+		DNSLeak        bool            `json:"dns_leak"`
+		UDP            bool            `json:"udp"`
+		CertCheck      bool            `json:"cert_check"`
+		Preflight      bool            `json:"preflight"`
+		TLSCheck       bool            `json:"tls_check"`
+		Check          string          `json:"check"`
+		Speed          []int64         `json:"speed"`
+		Probes         int             `json:"probes"`
+		MedianLatency  bool            `json:"median_latency"`
+		Namespace      string          `json:"namespace"`
+	}{entries, timeout, opts.rules, opts.skipGarbage, opts.reference, opts.ping, opts.keepDuplicates,
+		opts.budget, opts.contentTargets, opts.unlock, opts.exitIP, opts.reputation, opts.dnsLeak, opts.udp, opts.certCheck, opts.preflight, opts.tlsCheck, opts.check.String(), speed, opts.probes, opts.medianLatency, opts.namespace})
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedResult ищет самый свежий завершённый тест с той же контрольной
+// суммой, результат которого ещё хранится и не старше resultCacheTTL
+func cachedResult(checksum string) *CacheInfo {
+	if checksum == "" {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	var found *Test
+	for id, test := range tests {
+		if test.Checksum != checksum || test.Status != "completed" || results[id] == nil {
+			continue
+		}
+		if since(test.CompletedAt) > resultCacheTTL {
+			continue
+		}
+		if found == nil || test.CompletedAt.After(found.CompletedAt) {
+			found = test
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	age := since(found.CompletedAt)
+	return &CacheInfo{
+		TestID:      found.ID,
+		Checksum:    checksum,
+		CompletedAt: found.CompletedAt,
+		Age:         age.Round(time.Second).String(),
+		ExpiresIn:   (resultCacheTTL - age).Round(time.Second).String(),
+		startedAt:   found.StartedAt,
+	}
+}
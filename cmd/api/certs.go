@@ -0,0 +1,119 @@
+package main
+
+import (
+	"time"
+
+	"projectx/parser"
+	"projectx/proxytestlib/probe"
+)
+
+// Категории отказа, которые даёт осмотр сертификата
+const (
+	certMismatch  = "cert_mismatch"
+	certExpired   = "cert_expired"
+	certUntrusted = "cert_untrusted"
+)
+
+// CertReport - сертификат, который сервер прокси предъявил по SNI ссылки
+type CertReport struct {
+	SNI         string              `json:"sni"`
+	Security    string              `json:"security"` // tls или reality
+	Version     string              `json:"version,omitempty"`
+	Issuer      string              `json:"issuer"`
+	SANs        []string            `json:"sans"`
+	NotAfter    time.Time           `json:"not_after"`
+	SNIMatch    bool                `json:"sni_match"` // Сертификат выдан на имя из SNI
+	Expired     bool                `json:"expired"`
+	Trusted     bool                `json:"trusted"`                // Цепочка проверяется системными корневыми сертификатами
+	Problem     string              `json:"problem,omitempty"`      // cert_mismatch, cert_expired или cert_untrusted
+	VerifyError string              `json:"verify_error,omitempty"` // Почему цепочка не проверилась
+	Chain       []probe.Certificate `json:"chain"`
+	Error       string              `json:"error,omitempty"` // Почему не удалось получить сертификат
+}
+
+// tlsHandshake - рукопожатие TLS с сервером прокси по SNI ссылки. Из него
+// берутся и сертификат (cert_check), и согласованная защита (tls_check)
+type tlsHandshake struct {
+	sni      string
+	security string // tls или reality
+	result   *probe.TLSResult
+	err      error
+}
+
+// inspectHandshake подключается к серверу прокси напрямую, без туннеля, и
+// выполняет рукопожатие TLS по SNI ссылки. Для ссылок без TLS и REALITY
+// возвращает nil. TUIC работает поверх QUIC и не осматривается
+func inspectHandshake(proxyURL string, timeout time.Duration) *tlsHandshake {
+	config, err := parser.ParseProxyURL(proxyURL)
+	if err != nil || config.Protocol == "tuic" {
+		return nil
+	}
+	if config.Security != "tls" && config.Security != "reality" {
+		return nil
+	}
+	handshake := &tlsHandshake{sni: config.SNI, security: config.Security}
+	if simulation != nil {
+		handshake.result, handshake.err = simulation.handshake(proxyURL, config.SNI, config.Security)
+	} else {
+		handshake.result, handshake.err = probe.InspectTLS(config.Server, config.Port, config.SNI, config.ALPN, timeout)
+	}
+	return handshake
+}
+
+// certificate описывает сертификат, предъявленный при рукопожатии
+func (h *tlsHandshake) certificate() *CertReport {
+	if h == nil {
+		return nil
+	}
+	report := &CertReport{SNI: h.sni, Security: h.security}
+	if h.err != nil {
+		report.Error = h.err.Error()
+		return report
+	}
+	leaf := h.result.Chain[0]
+	report.Version = h.result.Version
+	report.Issuer = leaf.Issuer
+	report.SANs = leaf.DNSNames
+	report.NotAfter = leaf.NotAfter
+	report.SNIMatch = h.result.NameMatch
+	report.Expired = h.result.Expired
+	report.Trusted = h.result.Trusted
+	report.VerifyError = h.result.VerifyError
+	report.Chain = h.result.Chain
+	report.Problem = report.problem()
+	return report
+}
+
+// problem - главная проблема сертификата: несовпадение имени важнее срока,
+// срок - важнее недоверенного издателя
+func (r *CertReport) problem() string {
+	switch {
+	case !r.SNIMatch:
+		return certMismatch
+	case r.Expired:
+		return certExpired
+	case !r.Trusted:
+		return certUntrusted
+	}
+	return ""
+}
+
+// certFailureCategory уточняет категорию отказа прокси по сертификату.
+// Клиент с TLS без allowInsecure отвергает такой сертификат, поэтому
+// проблема сертификата и есть причина отказа. REALITY цепочку не
+// проверяет, а ошибки до рукопожатия (DNS, отказ соединения) важнее
+func certFailureCategory(category string, proxyURL string, report *CertReport) string {
+	if report == nil || report.Problem == "" || report.Security != "tls" {
+		return category
+	}
+	switch category {
+	case "tls", "timeout", "proxy_rejected", "other":
+	default:
+		return category
+	}
+	config, err := parser.ParseProxyURL(proxyURL)
+	if err != nil || config.AllowInsecure {
+		return category
+	}
+	return report.Problem
+}
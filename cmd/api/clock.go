@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Clock - источник текущего времени для хранения результатов, расписаний
+// подписок и пулов, сроков токенов и окон доступности. Задержки и время
+// выполнения тестов всегда меряются настоящими часами
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator выдаёт идентификаторы тестов, подписок, пулов, контроллеров
+// и A/B-тестов. kind - префикс идентификатора: test, sub, pool, ctrl, ab
+type IDGenerator interface {
+	NewID(kind string) string
+}
+
+// clock и ids подменяются в симуляции, чтобы интеграционные тесты сдвигали
+// время и получали предсказуемые идентификаторы
+var (
+	clock Clock       = loadClock()
+	ids   IDGenerator = loadIDGenerator()
+)
+
+// now возвращает текущее время часов сервера
+func now() time.Time {
+	return clock.Now()
+}
+
+// since - время, прошедшее с t по часам сервера
+func since(t time.Time) time.Duration {
+	return clock.Now().Sub(t)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// manualClock стоит на месте, пока его не сдвинут через Advance
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// timeIDs - идентификаторы по умолчанию: тесты по секунде запуска, остальное
+// по наносекундам
+type timeIDs struct{}
+
+func (timeIDs) NewID(kind string) string {
+	if kind == "test" {
+		return "test_" + now().Format("20060102150405")
+	}
+	return fmt.Sprintf("%s_%d", kind, now().UnixNano())
+}
+
+// sequentialIDs нумерует объекты каждого вида подряд: test_1, test_2, sub_1
+type sequentialIDs struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+func (s *sequentialIDs) NewID(kind string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next[kind]++
+	return fmt.Sprintf("%s_%d", kind, s.next[kind])
+}
+
+// loadClock включает ручные часы в симуляции с SIM_START_TIME (RFC 3339):
+// время стоит на месте и сдвигается через POST /api/v1/debug/clock
+func loadClock() Clock {
+	value := os.Getenv("SIM_START_TIME")
+	if value == "" || os.Getenv("API_BACKEND") != "simulate" {
+		return systemClock{}
+	}
+	start, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Printf("Invalid SIM_START_TIME=%q, using system clock", value)
+		return systemClock{}
+	}
+	log.Printf("⚠️ Manual clock enabled, starting at %s", start.Format(time.RFC3339))
+	return &manualClock{now: start}
+}
+
+// loadIDGenerator включает последовательные идентификаторы в симуляции с SIM_SEQUENTIAL_IDS
+func loadIDGenerator() IDGenerator {
+	sequential, _ := strconv.ParseBool(os.Getenv("SIM_SEQUENTIAL_IDS"))
+	if sequential && os.Getenv("API_BACKEND") == "simulate" {
+		return &sequentialIDs{next: make(map[string]int)}
+	}
+	return timeIDs{}
+}
+
+// ClockRequest - сдвиг ручных часов
+type ClockRequest struct {
+	Advance string `json:"advance"` // Длительность в формате Go, например 90m
+}
+
+// getClock возвращает текущее время сервера и признак ручных часов
+func getClock(c *gin.Context) {
+	_, manual := clock.(*manualClock)
+	c.JSON(http.StatusOK, gin.H{"now": now().Format(time.RFC3339Nano), "manual": manual})
+}
+
+// advanceClock сдвигает ручные часы вперёд. Расписания и сроки хранения
+// срабатывают на ближайшей проверке по своему таймеру
+func advanceClock(c *gin.Context) {
+	manual, ok := clock.(*manualClock)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "Clock is not manual", "details": "start the server with API_BACKEND=simulate and SIM_START_TIME"})
+		return
+	}
+
+	var request ClockRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	d, err := time.ParseDuration(request.Advance)
+	if err != nil || d < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid advance", "details": "advance must be a non-negative duration such as 90m"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"now": manual.Advance(d).Format(time.RFC3339Nano), "manual": true})
+}
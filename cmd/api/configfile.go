@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadConfigFile читает файл со ссылками по http(s)-адресу или локальному
+// пути. Локальные файлы читаются только из каталога API_CONFIG_DIR, чтобы
+// через API нельзя было прочитать произвольный файл сервера. Если задан
+// checksum (SHA-256 в hex, можно с префиксом sha256:), содержимое сверяется
+// с ним до разбора
+func loadConfigFile(location, checksum string) ([]json.RawMessage, error) {
+	maxSize := envInt("CONFIG_FILE_MAX_SIZE", subscriptionMaxSize)
+
+	var body []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		body, err = download(location, maxSize)
+	} else {
+		body, err = readLocalConfigFile(location, maxSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if checksum != "" {
+		expected := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(checksum), "sha256:"))
+		sum := sha256.Sum256(body)
+		if actual := hex.EncodeToString(sum[:]); actual != expected {
+			return nil, fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", expected, actual)
+		}
+	}
+
+	configs, err := configFileConfigs(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("config file contains no proxy links")
+	}
+	return configs, nil
+}
+
+func readLocalConfigFile(path string, maxSize int) ([]byte, error) {
+	dir := os.Getenv("API_CONFIG_DIR")
+	if dir == "" {
+		return nil, fmt.Errorf("local config files are disabled: set API_CONFIG_DIR or pass an http(s) URL")
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API_CONFIG_DIR: %w", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if !withinDir(dir, path) {
+		return nil, fmt.Errorf("%s is outside API_CONFIG_DIR", path)
+	}
+
+	// Символическая ссылка внутри каталога может вести за его пределы,
+	// поэтому проверка повторяется для настоящих путей
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API_CONFIG_DIR: %w", err)
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if !withinDir(realDir, realPath) {
+		return nil, fmt.Errorf("%s is outside API_CONFIG_DIR", path)
+	}
+
+	info, err := os.Stat(realPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if info.Size() > int64(maxSize) {
+		return nil, fmt.Errorf("config file is larger than %d bytes", maxSize)
+	}
+	return os.ReadFile(realPath)
+}
+
+// withinDir проверяет, что path лежит внутри dir
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// configFileConfigs разбирает файл конфигов: JSON вида {"configs": [...]},
+// как тело запроса на тест (элементы - ссылки или объекты с тегами), или
+// любой формат подписки
+func configFileConfigs(body []byte) ([]json.RawMessage, error) {
+	var file struct {
+		Configs []json.RawMessage `json:"configs"`
+	}
+	if err := json.Unmarshal(body, &file); err == nil && len(file.Configs) > 0 {
+		var configs []json.RawMessage
+		for _, config := range file.Configs {
+			if link, _, err := configEntry(config); err == nil && link != "" {
+				configs = append(configs, config)
+			}
+		}
+		return configs, nil
+	}
+	links, err := subscriptionLinks(body)
+	if err != nil {
+		return nil, err
+	}
+	return appendLinks(nil, links), nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"projectx/proxytestlib/controller"
+)
+
+// Controller - запущенный Clash.Meta или sing-box, которому передаются рабочие
+// прокси завершённых тестов. Контроллер привязан ровно к одному источнику:
+// подписке, пулу или пространству имён, и получает только его результаты
+type Controller struct {
+	ID           string          `json:"id"`
+	Name         string          `json:"name"`
+	URL          string          `json:"url"`
+	Group        string          `json:"group,omitempty"`        // Selector, переключаемый на лучший рабочий прокси
+	Provider     string          `json:"provider,omitempty"`     // Proxy provider Clash.Meta, обновляемый после теста
+	Subscription string          `json:"subscription,omitempty"` // Тесты этой подписки
+	Pool         string          `json:"pool,omitempty"`         // Циклы этого пула
+	Namespace    string          `json:"namespace,omitempty"`    // Тесты этого пространства имён
+	LastPush     *ControllerPush `json:"last_push,omitempty"`
+
+	secret  string
+	working []ProxyInfo // Рабочие прокси последнего теста, отдаются как provider
+}
+
+// ControllerPush - итог передачи результатов контроллеру
+type ControllerPush struct {
+	TestID   string    `json:"test_id,omitempty"`
+	PoolID   string    `json:"pool_id,omitempty"`
+	At       time.Time `json:"at"`
+	Working  int       `json:"working"`
+	Selected string    `json:"selected,omitempty"`
+	Provider bool      `json:"provider_updated"`
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+// ControllerRequest - тело запроса на регистрацию контроллера
+type ControllerRequest struct {
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	Secret       string `json:"secret"`
+	Group        string `json:"group"`
+	Provider     string `json:"provider"`
+	Subscription string `json:"subscription"` // ID подписки
+	Pool         string `json:"pool"`         // ID пула
+	Namespace    string `json:"namespace"`
+}
+
+// pushSource - откуда результаты, передаваемые контроллерам: тест (с его
+// подпиской и пространством имён) или цикл пула
+type pushSource struct {
+	testID       string
+	subscription string
+	namespace    string
+	pool         string
+}
+
+var controllers = make(map[string]*Controller)
+
+// registerControllerRoutes подключает эндпоинты контроллеров к группе API
+func registerControllerRoutes(api *gin.RouterGroup) {
+	api.POST("/controllers", createController)
+	api.GET("/controllers", listControllers)
+	api.GET("/controllers/:id", getController)
+	api.DELETE("/controllers/:id", deleteController)
+	api.POST("/controllers/:id/push", pushController)
+	api.GET("/controllers/:id/provider", controllerProvider)
+}
+
+// createController регистрирует контроллер. Нужен хотя бы один из group и provider
+func createController(c *gin.Context) {
+	var request ControllerRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if err := request.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctrl := request.controller()
+
+	mu.Lock()
+	if request.Subscription != "" && subscriptions[request.Subscription] == nil {
+		mu.Unlock()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Subscription not found", "subscription": request.Subscription})
+		return
+	}
+	if request.Pool != "" && pools[request.Pool] == nil {
+		mu.Unlock()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pool not found", "pool": request.Pool})
+		return
+	}
+	controllers[ctrl.ID] = ctrl
+	mu.Unlock()
+
+	c.JSON(http.StatusCreated, ctrl)
+}
+
+// validate проверяет запрос на регистрацию контроллера
+func (r *ControllerRequest) validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be the http(s) address of the Clash API")
+	}
+	if r.Group == "" && r.Provider == "" {
+		return fmt.Errorf("group or provider is required")
+	}
+	bindings := 0
+	for _, binding := range []string{r.Subscription, r.Pool, r.Namespace} {
+		if binding != "" {
+			bindings++
+		}
+	}
+	if bindings != 1 {
+		return fmt.Errorf("exactly one of subscription, pool and namespace is required")
+	}
+	if r.Namespace != "" && !namespacePattern.MatchString(r.Namespace) {
+		return fmt.Errorf("namespace must match %s", namespacePattern)
+	}
+	return nil
+}
+
+// controller создаёт контроллер по запросу
+func (r *ControllerRequest) controller() *Controller {
+	return &Controller{
+		ID:           ids.NewID("ctrl"),
+		Name:         r.Name,
+		URL:          r.URL,
+		Group:        r.Group,
+		Provider:     r.Provider,
+		Subscription: r.Subscription,
+		Pool:         r.Pool,
+		Namespace:    r.Namespace,
+		secret:       r.Secret,
+	}
+}
+
+// matches проверяет, относятся ли результаты к источнику контроллера
+func (c *Controller) matches(source pushSource) bool {
+	switch {
+	case c.Subscription != "":
+		return c.Subscription == source.subscription
+	case c.Pool != "":
+		return c.Pool == source.pool
+	default:
+		return c.Namespace != "" && c.Namespace == source.namespace
+	}
+}
+
+// listControllers возвращает зарегистрированные контроллеры
+func listControllers(c *gin.Context) {
+	mu.Lock()
+	list := make([]*Controller, 0, len(controllers))
+	for _, ctrl := range controllers {
+		list = append(list, ctrl)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	c.JSON(http.StatusOK, gin.H{"controllers": list})
+	mu.Unlock()
+}
+
+// getController возвращает контроллер и итог последней передачи
+func getController(c *gin.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ctrl, exists := controllers[c.Param("id")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Controller not found"})
+		return
+	}
+	c.JSON(http.StatusOK, ctrl)
+}
+
+// deleteController удаляет контроллер
+func deleteController(c *gin.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, exists := controllers[c.Param("id")]; !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Controller not found"})
+		return
+	}
+	delete(controllers, c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Controller deleted"})
+}
+
+// pushController передаёт контроллеру результаты указанного теста
+// (поле test_id) прямо сейчас
+func pushController(c *gin.Context) {
+	var request struct {
+		TestID string `json:"test_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	mu.Lock()
+	ctrl, exists := controllers[c.Param("id")]
+	result, hasResult := results[request.TestID]
+	var working []ProxyInfo
+	if hasResult {
+		working = append(working, result.WorkingProxies...)
+	}
+	mu.Unlock()
+
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Controller not found"})
+		return
+	}
+	if !hasResult {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Results not found", "test_id": request.TestID})
+		return
+	}
+
+	push := pushToController(ctrl, pushSource{testID: request.TestID}, working)
+	status := http.StatusOK
+	if len(push.Errors) > 0 {
+		status = http.StatusBadGateway
+	}
+	c.JSON(status, push)
+}
+
+// controllerProvider отдаёт рабочие ссылки последнего теста в base64 - формат
+// подписки, который Clash.Meta принимает в proxy-providers. Адрес указывается
+// в url провайдера, который обновляется после каждого теста. Параметры
+// фильтра те же, что у экспорта результатов
+func controllerProvider(c *gin.Context) {
+	filter, ok := parseExportFilter(c)
+	if !ok {
+		return
+	}
+
+	mu.Lock()
+	ctrl, exists := controllers[c.Param("id")]
+	var working []ProxyInfo
+	if exists {
+		working = ctrl.working
+	}
+	mu.Unlock()
+
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Controller not found"})
+		return
+	}
+	links := make([]string, 0, len(working))
+	for i := range working {
+		if filter.selects(&working[i]) {
+			_, link := filter.rename(&working[i], working[i].Link)
+			links = append(links, link)
+		}
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n")))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(encoded))
+}
+
+// notifyControllers передаёт результаты контроллерам, привязанным к их источнику
+func notifyControllers(source pushSource, working []ProxyInfo) {
+	mu.Lock()
+	var list []*Controller
+	for _, ctrl := range controllers {
+		if ctrl.matches(source) {
+			list = append(list, ctrl)
+		}
+	}
+	mu.Unlock()
+
+	for _, ctrl := range list {
+		go pushToController(ctrl, source, working)
+	}
+}
+
+// pushToController обновляет provider и переключает group на рабочий прокси
+// с наименьшей задержкой из тех, что есть в группе. Если в группе нет ни
+// одного рабочего прокси, выбор не меняется
+func pushToController(ctrl *Controller, source pushSource, working []ProxyInfo) *ControllerPush {
+	push := &ControllerPush{TestID: source.testID, PoolID: source.pool, At: now(), Working: len(working)}
+
+	mu.Lock()
+	ctrl.working = working
+	client := controller.NewClient(ctrl.URL, ctrl.secret, 10*time.Second)
+	group, provider := ctrl.Group, ctrl.Provider
+	mu.Unlock()
+
+	if provider != "" {
+		if err := client.UpdateProvider(provider); err != nil {
+			push.Errors = append(push.Errors, fmt.Sprintf("provider %s: %v", provider, err))
+		} else {
+			push.Provider = true
+		}
+	}
+
+	if group != "" {
+		if err := selectBest(client, group, working, push); err != nil {
+			push.Errors = append(push.Errors, fmt.Sprintf("group %s: %v", group, err))
+		}
+	}
+
+	for _, err := range push.Errors {
+		log.Printf("Controller %s: %s", ctrl.ID, err)
+	}
+
+	mu.Lock()
+	ctrl.LastPush = push
+	mu.Unlock()
+	return push
+}
+
+// selectBest выбирает в группе рабочий прокси с наименьшей задержкой.
+// Прокси сопоставляются по имени (remark ссылки)
+func selectBest(client *controller.Client, group string, working []ProxyInfo, push *ControllerPush) error {
+	info, err := client.Group(group)
+	if err != nil {
+		return err
+	}
+	members := make(map[string]bool, len(info.All))
+	for _, name := range info.All {
+		members[name] = true
+	}
+
+	candidates := make([]ProxyInfo, 0, len(working))
+	for _, proxy := range working {
+		if members[proxy.Name] {
+			candidates = append(candidates, proxy)
+		}
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("none of %d working proxies is a member of the group", len(working))
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, _ := time.ParseDuration(candidates[i].Latency)
+		b, _ := time.ParseDuration(candidates[j].Latency)
+		return a < b
+	})
+	best := candidates[0].Name
+	push.Selected = best
+	if info.Now == best {
+		return nil
+	}
+	return client.Select(group, best)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Переопределяются при сборке: -ldflags "-X main.version=... -X main.commit=..."
+var (
+	version = "1.1.0"
+	commit  = "unknown"
+)
+
+var startedAt = time.Now()
+
+// registerDebugRoutes подключает отладочные эндпоинты к группе API
+func registerDebugRoutes(api *gin.RouterGroup) {
+	api.GET("/debug", getDebugInfo)
+
+	clockGroup := api.Group("/debug/clock", AdminAuthMiddleware())
+	{
+		clockGroup.GET("", getClock)
+		clockGroup.POST("", advanceClock)
+	}
+
+	pprofGroup := api.Group("/debug/pprof", AdminAuthMiddleware())
+	{
+		pprofGroup.GET("/", gin.WrapF(pprof.Index))
+		pprofGroup.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+		pprofGroup.GET("/profile", gin.WrapF(pprof.Profile))
+		pprofGroup.GET("/symbol", gin.WrapF(pprof.Symbol))
+		pprofGroup.POST("/symbol", gin.WrapF(pprof.Symbol))
+		pprofGroup.GET("/trace", gin.WrapF(pprof.Trace))
+		pprofGroup.GET("/:profile", func(c *gin.Context) {
+			pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request)
+		})
+	}
+}
+
+// AdminAuthMiddleware пропускает только запросы с токеном из API_ADMIN_TOKEN.
+// Если токен не задан, эндпоинт считается отключённым.
+func AdminAuthMiddleware() gin.HandlerFunc {
+	return tokenAuthMiddleware("API_ADMIN_TOKEN", "Admin endpoints are disabled")
+}
+
+// tokenAuthMiddleware пропускает только запросы с Bearer-токеном из
+// переменной окружения env. Без неё эндпоинт отвечает 404 с disabled
+func tokenAuthMiddleware(env, disabled string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := os.Getenv(env)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": disabled})
+			return
+		}
+
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// getDebugInfo возвращает информацию о сборке и состоянии рантайма
+func getDebugInfo(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	tempFiles, xrayProcesses := resources.counts()
+
+	c.JSON(http.StatusOK, gin.H{
+		"build": gin.H{
+			"version":    version,
+			"commit":     commit,
+			"go_version": runtime.Version(),
+			"os":         runtime.GOOS,
+			"arch":       runtime.GOARCH,
+		},
+		"runtime": gin.H{
+			"uptime_seconds":  int64(time.Since(startedAt).Seconds()),
+			"goroutines":      runtime.NumGoroutine(),
+			"num_cpu":         runtime.NumCPU(),
+			"heap_alloc":      mem.HeapAlloc,
+			"heap_sys":        mem.HeapSys,
+			"heap_objects":    mem.HeapObjects,
+			"total_alloc":     mem.TotalAlloc,
+			"sys":             mem.Sys,
+			"num_gc":          mem.NumGC,
+			"pause_total_ns":  mem.PauseTotalNs,
+			"last_gc_unix_ns": mem.LastGC,
+		},
+		"process": gin.H{
+			"rss_bytes": processRSS(),
+			"open_fds":  openFDs(),
+		},
+		"resources": gin.H{
+			"xray_processes": xrayProcesses,
+			"temp_files":     tempFiles,
+			"inbound_ports":  resources.portCount(),
+		},
+		"pprof_enabled": os.Getenv("API_ADMIN_TOKEN") != "",
+		"timestamp":     now().Format(time.RFC3339),
+	})
+}
+
+// processRSS возвращает резидентную память процесса, -1 если /proc недоступен
+func processRSS() int64 {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return -1
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return -1
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return pages * int64(os.Getpagesize())
+}
+
+// openFDs возвращает число открытых файловых дескрипторов, -1 если /proc недоступен
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
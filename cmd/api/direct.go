@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"projectx/parser"
+	"projectx/proxytestlib/models"
+)
+
+// isDirectProxy проверяет, является ли ссылка обычным SOCKS5/HTTP прокси,
+// который проверяется напрямую без запуска Xray
+func isDirectProxy(proxyURL string) bool {
+	scheme, _, _ := strings.Cut(proxyURL, "://")
+	switch strings.ToLower(scheme) {
+	case "socks", "socks5", "socks5h", "http", "https":
+		return true
+	}
+	return false
+}
+
+// parseDirectProxy разбирает ссылку socks5:// или http(s)://
+func parseDirectProxy(proxyURL string) (*models.ProxyConfig, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	return parser.ParseDirectProxyConfig(u)
+}
+
+// testDirectProxy проверяет SOCKS5/HTTP прокси, используя его как прокси
+// HTTP-клиента без промежуточного Xray
+func testDirectProxy(testID, proxyURL string, spec *checkSpec, timeout time.Duration, after ...tunnelCheck) (checkTimings, error) {
+	config, err := parseDirectProxy(proxyURL)
+	if err != nil {
+		return checkTimings{}, err
+	}
+	timings, err := traceCheck(config.DirectURL(), spec, timeout, usageMeter.test(testID))
+	if err != nil {
+		return checkTimings{}, err
+	}
+	runTunnelChecks(config.DirectURL(), after)
+	return timings, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dnsLeakCanaries - сколько уникальных имён резолвится через прокси. Несколько
+// имён нужны, чтобы увидеть все резолверы, между которыми балансируется сервер
+const dnsLeakCanaries = 3
+
+// dnsLeakURL - сервис проверки утечек DNS в формате bash.ws: выдаёт
+// идентификатор, записывает резолверы, запросившие имена <n>.<id>.<домен>,
+// и отдаёт их списком
+var dnsLeakURL = loadDNSLeakURL()
+
+func loadDNSLeakURL() string {
+	if value := os.Getenv("DNS_LEAK_URL"); value != "" {
+		return strings.TrimRight(value, "/")
+	}
+	return "https://bash.ws"
+}
+
+// DNSResolver - резолвер, запросивший проверочное имя
+type DNSResolver struct {
+	IP      string `json:"ip"`
+	Country string `json:"country,omitempty"` // ISO-код страны
+	ASN     string `json:"asn,omitempty"`     // Номер и владелец автономной системы
+}
+
+// DNSLeakReport - результат проверки утечки DNS
+type DNSLeakReport struct {
+	Leak        bool          `json:"leak"`                   // Резолвер в другой стране, чем выходной IP
+	ExitIP      string        `json:"exit_ip,omitempty"`      // Выходной IP, каким его увидел сервис
+	ExitCountry string        `json:"exit_country,omitempty"` // Страна выходного IP
+	Resolvers   []DNSResolver `json:"resolvers"`
+}
+
+// dnsLeakEntry - строка ответа сервиса: type ip - адрес клиента, dns - резолвер
+type dnsLeakEntry struct {
+	IP      string `json:"ip"`
+	Country string `json:"country"`
+	ASN     string `json:"asn"`
+	Type    string `json:"type"`
+}
+
+// checkDNSLeak резолвит через прокси уникальные имена и спрашивает у
+// сервиса, какие резолверы их запросили. Имена отправляются прокси
+// без локального резолва, поэтому их видит только резолвер на стороне
+// сервера. Утечка - резолвер находится в другой стране, чем выходной IP:
+// такой резолвер выдаёт настоящее расположение клиента
+func checkDNSLeak(proxyURL string, proxy *url.URL, timeout time.Duration, usage *testUsage) (*DNSLeakReport, error) {
+	if simulation != nil {
+		return simulation.dnsLeak(proxyURL), nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	client := &http.Client{Timeout: timeout, Transport: countingTransport(proxy, usage)}
+	id, err := fetchText(client, dnsLeakURL+"/id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a canary id: %w", err)
+	}
+	service, err := url.Parse(dnsLeakURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Имена не обязаны открываться: достаточно, что сервер их резолвил
+	canaryClient := &http.Client{Timeout: time.Until(deadline) / 3, Transport: client.Transport}
+	var wg sync.WaitGroup
+	for i := 1; i <= dnsLeakCanaries; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := canaryClient.Get(fmt.Sprintf("http://%d.%s.%s/", i, id, service.Hostname()))
+			if err == nil {
+				resp.Body.Close()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	client.Timeout = time.Until(deadline)
+	if client.Timeout <= 0 {
+		return nil, fmt.Errorf("timed out before fetching the resolver list")
+	}
+	body, err := fetchText(client, dnsLeakURL+"/dnsleak/test/"+url.PathEscape(id)+"?json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the resolver list: %w", err)
+	}
+	var entries []dnsLeakEntry
+	if err := json.Unmarshal([]byte(body), &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse the resolver list: %w", err)
+	}
+	return dnsLeakReport(entries)
+}
+
+// dnsLeakReport собирает отчёт из ответа сервиса
+func dnsLeakReport(entries []dnsLeakEntry) (*DNSLeakReport, error) {
+	report := &DNSLeakReport{}
+	for _, entry := range entries {
+		switch entry.Type {
+		case "ip":
+			report.ExitIP, report.ExitCountry = entry.IP, strings.ToUpper(entry.Country)
+		case "dns":
+			report.Resolvers = append(report.Resolvers, DNSResolver{IP: entry.IP, Country: strings.ToUpper(entry.Country), ASN: entry.ASN})
+		}
+	}
+	if len(report.Resolvers) == 0 {
+		return nil, fmt.Errorf("no resolver queried the canary names")
+	}
+	for _, resolver := range report.Resolvers {
+		if report.ExitCountry != "" && resolver.Country != "" && resolver.Country != report.ExitCountry {
+			report.Leak = true
+		}
+	}
+	return report, nil
+}
+
+// resolvers перечисляет резолверы для текстового экспорта: "1.1.1.1 (DE), 8.8.8.8 (US)"
+func (r *DNSLeakReport) resolvers() string {
+	parts := make([]string, 0, len(r.Resolvers))
+	for _, resolver := range r.Resolvers {
+		if resolver.Country != "" {
+			parts = append(parts, fmt.Sprintf("%s (%s)", resolver.IP, resolver.Country))
+		} else {
+			parts = append(parts, resolver.IP)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// fetchText загружает небольшой текстовый ответ
+func fetchText(client *http.Client, target string) (string, error) {
+	resp, err := client.Get(target)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"sync"
+
+	"projectx/proxytestlib/probe"
+)
+
+// tlsHistorySize - сколько серверов помнит tlsHistory. При переполнении
+// память сбрасывается: сравнение с прошлыми проверками - подсказка, а не
+// основа отчёта
+const tlsHistorySize = 100000
+
+// TLSReport - защита, которую сервер прокси на деле согласовал при
+// рукопожатии, и признаки её ослабления
+type TLSReport struct {
+	Security   string `json:"security"` // tls или reality
+	Version    string `json:"version,omitempty"`
+	Cipher     string `json:"cipher,omitempty"`
+	ALPN       string `json:"alpn,omitempty"`
+	Expected   string `json:"expected"`           // Наименьшая версия, ожидаемая от такого сервера
+	Downgrade  bool   `json:"downgrade"`          // Версия ниже ожидаемой или ниже прежде согласованной
+	Previous   string `json:"previous,omitempty"` // Прежде согласованная версия, если сейчас она ниже
+	WeakCipher bool   `json:"weak_cipher"`        // Шифр из числа небезопасных
+	Plaintext  bool   `json:"plaintext"`          // Сервер ответил без TLS
+	Error      string `json:"error,omitempty"`    // Почему рукопожатие не удалось
+}
+
+// tlsHistory - наибольшая версия TLS, согласованная сервером, по StableID
+// ссылки. Позволяет заметить, что сервер, прежде отвечавший TLS 1.3, молча
+// перешёл на TLS 1.2
+var tlsHistory = struct {
+	mu       sync.Mutex
+	versions map[string]uint16
+}{versions: make(map[string]uint16)}
+
+// expectedTLSVersion - наименьшая приемлемая версия: REALITY работает только
+// поверх TLS 1.3, обычному TLS достаточно 1.2
+func expectedTLSVersion(security string) uint16 {
+	if security == "reality" {
+		return tls.VersionTLS13
+	}
+	return tls.VersionTLS12
+}
+
+// protection описывает согласованную при рукопожатии защиту. Версия
+// сравнивается с ожидаемой для типа защиты и с наибольшей, которую сервер
+// согласовывал в прошлых проверках
+func (h *tlsHandshake) protection(proxyURL string) *TLSReport {
+	if h == nil {
+		return nil
+	}
+	expected := expectedTLSVersion(h.security)
+	report := &TLSReport{Security: h.security, Expected: tls.VersionName(expected)}
+	if h.err != nil {
+		var plaintext *probe.PlaintextError
+		if errors.As(h.err, &plaintext) {
+			report.Plaintext = true
+			report.Downgrade = true
+		}
+		report.Error = h.err.Error()
+		return report
+	}
+	report.Version = h.result.Version
+	report.Cipher = h.result.CipherSuite
+	report.ALPN = h.result.ALPN
+	report.WeakCipher = h.result.WeakCipher
+	report.Downgrade = h.result.VersionID < expected
+
+	id := linkStableID(proxyURL)
+	if id == "" {
+		return report
+	}
+	tlsHistory.mu.Lock()
+	defer tlsHistory.mu.Unlock()
+	previous, seen := tlsHistory.versions[id]
+	switch {
+	case seen && previous > h.result.VersionID:
+		report.Downgrade = true
+		report.Previous = tls.VersionName(previous)
+	case !seen && len(tlsHistory.versions) >= tlsHistorySize:
+		tlsHistory.versions = make(map[string]uint16)
+		fallthrough
+	default:
+		tlsHistory.versions[id] = h.result.VersionID
+	}
+	return report
+}
+
+// weakened сообщает, ослаблена ли защита: понижение версии, ответ без TLS
+// или небезопасный шифр
+func (r *TLSReport) weakened() bool {
+	return r != nil && (r.Downgrade || r.Plaintext || r.WeakCipher)
+}
@@ -0,0 +1,410 @@
+//go:build e2e
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"projectx/cmd/internal/testrun"
+)
+
+// Сквозная проверка: реальные серверы Xray в Docker, API в этом же процессе.
+//
+//	go test -tags e2e ./cmd/api -run E2E -v
+//
+// Без Docker или бинарника Xray тест пропускается
+var (
+	e2eImage = flag.String("image", "ghcr.io/xtls/xray-core:latest", "Docker image with the xray binary")
+	e2eWait  = flag.Duration("wait", 3*time.Minute, "Maximum time to wait for the API test to complete")
+	e2eKeep  = flag.Bool("keep", false, "Keep containers running after the run")
+)
+
+// e2eScenario описывает один тестовый сервер Xray и ссылку для подключения к нему
+type e2eScenario struct {
+	Name     string
+	Port     int
+	Inbound  string // JSON inbound сервера
+	ShareURL string // Ссылка, которую получит API
+}
+
+const (
+	e2eUUID = "6e3f9a4c-0f6b-4d1e-9a51-3c7d2b8e5f10"
+	// e2eSS2022Key - ключ Shadowsocks 2022: 16 байт в base64 для aes-128-gcm
+	e2eSS2022Key = "WRjkSGsDQbQdZ1Ry5Ne2fQ=="
+	// e2eTLSName - имя в самоподписанном сертификате TLS-серверов
+	e2eTLSName = "e2e.test"
+	// e2eRealityTarget - сайт, под который маскируется сервер REALITY
+	e2eRealityTarget = "www.cloudflare.com"
+	e2eShortID       = "6ba85179e30d4fc2"
+	// e2eConfigDir - каталог конфигов и сертификата внутри контейнера
+	e2eConfigDir = "/etc/xray"
+)
+
+// e2eScenarios - набор серверов, поднимаемых в контейнерах
+var e2eScenarios = []e2eScenario{
+	{
+		Name: "vless-tcp",
+		Port: 21001,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "vless",
+			"settings": {"clients": [{"id": "{{.UUID}}"}], "decryption": "none"},
+			"streamSettings": {"network": "tcp"}
+		}`,
+		ShareURL: "vless://{{.UUID}}@127.0.0.1:{{.Port}}?type=tcp&security=none#vless-tcp",
+	},
+	{
+		Name: "vless-ws",
+		Port: 21002,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "vless",
+			"settings": {"clients": [{"id": "{{.UUID}}"}], "decryption": "none"},
+			"streamSettings": {"network": "ws", "wsSettings": {"path": "/ws"}}
+		}`,
+		ShareURL: "vless://{{.UUID}}@127.0.0.1:{{.Port}}?type=ws&security=none&path=%2Fws#vless-ws",
+	},
+	{
+		Name: "vless-grpc",
+		Port: 21003,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "vless",
+			"settings": {"clients": [{"id": "{{.UUID}}"}], "decryption": "none"},
+			"streamSettings": {"network": "grpc", "grpcSettings": {"serviceName": "e2e"}}
+		}`,
+		ShareURL: "vless://{{.UUID}}@127.0.0.1:{{.Port}}?type=grpc&security=none&serviceName=e2e#vless-grpc",
+	},
+	{
+		Name: "trojan-tcp",
+		Port: 21004,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "trojan",
+			"settings": {"clients": [{"password": "{{.UUID}}"}]},
+			"streamSettings": {"network": "tcp"}
+		}`,
+		ShareURL: "trojan://{{.UUID}}@127.0.0.1:{{.Port}}?type=tcp&security=none#trojan-tcp",
+	},
+	{
+		Name: "trojan-ws",
+		Port: 21005,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "trojan",
+			"settings": {"clients": [{"password": "{{.UUID}}"}]},
+			"streamSettings": {"network": "ws", "wsSettings": {"path": "/ws"}}
+		}`,
+		ShareURL: "trojan://{{.UUID}}@127.0.0.1:{{.Port}}?type=ws&security=none&path=%2Fws#trojan-ws",
+	},
+	{
+		Name: "vmess-tcp",
+		Port: 21006,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "vmess",
+			"settings": {"clients": [{"id": "{{.UUID}}"}]},
+			"streamSettings": {"network": "tcp"}
+		}`,
+		ShareURL: `vmess://{{base64 (printf "{\"v\":\"2\",\"ps\":\"vmess-tcp\",\"add\":\"127.0.0.1\",\"port\":%d,\"id\":\"%s\",\"aid\":0,\"net\":\"tcp\",\"type\":\"none\",\"tls\":\"\"}" .Port .UUID)}}`,
+	},
+	{
+		Name: "vmess-ws",
+		Port: 21007,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "vmess",
+			"settings": {"clients": [{"id": "{{.UUID}}"}]},
+			"streamSettings": {"network": "ws", "wsSettings": {"path": "/ws"}}
+		}`,
+		ShareURL: `vmess://{{base64 (printf "{\"v\":\"2\",\"ps\":\"vmess-ws\",\"add\":\"127.0.0.1\",\"port\":%d,\"id\":\"%s\",\"aid\":0,\"net\":\"ws\",\"path\":\"/ws\",\"tls\":\"\"}" .Port .UUID)}}`,
+	},
+	{
+		Name: "ss-aes-gcm",
+		Port: 21008,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "shadowsocks",
+			"settings": {"method": "aes-256-gcm", "password": "{{.UUID}}", "network": "tcp,udp"}
+		}`,
+		ShareURL: `ss://{{base64 (print "aes-256-gcm:" .UUID)}}@127.0.0.1:{{.Port}}#ss-aes-gcm`,
+	},
+	{
+		Name: "ss-2022",
+		Port: 21009,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "shadowsocks",
+			"settings": {"method": "2022-blake3-aes-128-gcm", "password": "{{.SS2022Key}}", "network": "tcp,udp"}
+		}`,
+		ShareURL: "ss://2022-blake3-aes-128-gcm:{{urlquery .SS2022Key}}@127.0.0.1:{{.Port}}#ss-2022",
+	},
+	{
+		Name: "vless-tls",
+		Port: 21010,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "vless",
+			"settings": {"clients": [{"id": "{{.UUID}}"}], "decryption": "none"},
+			"streamSettings": {
+				"network": "tcp", "security": "tls",
+				"tlsSettings": {"certificates": [{"certificateFile": "{{.CertFile}}", "keyFile": "{{.KeyFile}}"}]}
+			}
+		}`,
+		ShareURL: "vless://{{.UUID}}@127.0.0.1:{{.Port}}?type=tcp&security=tls&sni={{.TLSName}}&allowInsecure=1#vless-tls",
+	},
+	{
+		Name: "trojan-tls",
+		Port: 21011,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "trojan",
+			"settings": {"clients": [{"password": "{{.UUID}}"}]},
+			"streamSettings": {
+				"network": "tcp", "security": "tls",
+				"tlsSettings": {"certificates": [{"certificateFile": "{{.CertFile}}", "keyFile": "{{.KeyFile}}"}]}
+			}
+		}`,
+		ShareURL: "trojan://{{.UUID}}@127.0.0.1:{{.Port}}?type=tcp&security=tls&sni={{.TLSName}}&allowInsecure=1#trojan-tls",
+	},
+	{
+		Name: "vless-reality",
+		Port: 21012,
+		Inbound: `{
+			"port": {{.Port}}, "protocol": "vless",
+			"settings": {"clients": [{"id": "{{.UUID}}"}], "decryption": "none"},
+			"streamSettings": {
+				"network": "tcp", "security": "reality",
+				"realitySettings": {
+					"dest": "{{.RealityTarget}}:443", "serverNames": ["{{.RealityTarget}}"],
+					"privateKey": "{{.RealityPrivateKey}}", "shortIds": ["{{.ShortID}}"]
+				}
+			}
+		}`,
+		ShareURL: "vless://{{.UUID}}@127.0.0.1:{{.Port}}?type=tcp&security=reality&sni={{.RealityTarget}}&fp=chrome&pbk={{.RealityPublicKey}}&sid={{.ShortID}}#vless-reality",
+	},
+}
+
+const e2eServerConfig = `{
+	"log": {"loglevel": "warning"},
+	"inbounds": [{{.Inbound}}],
+	"outbounds": [{"protocol": "freedom"}]
+}`
+
+// e2eResult - часть ответа /api/v1/results/:id, нужная для проверок
+type e2eResult struct {
+	WorkingProxies []struct {
+		Name string
+	}
+	FailedProxies []struct {
+		Name  string
+		Error string
+	}
+}
+
+// TestE2E поднимает сервер каждого сценария в контейнере, проверяет ссылки
+// на них через API и ждёт, что все попадут в список рабочих прокси
+func TestE2E(t *testing.T) {
+	requireDocker(t)
+	if _, err := exec.LookPath(xrayBinary); err != nil {
+		t.Skipf("Xray binary %s not found: %v", xrayBinary, err)
+	}
+
+	api := httptest.NewServer(newRouter())
+	defer api.Close()
+
+	workDir := t.TempDir()
+	// Контейнер может работать не от владельца каталога
+	if err := os.Chmod(workDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := e2eData(t, workDir)
+
+	var links []string
+	for _, sc := range e2eScenarios {
+		links = append(links, startE2EServer(t, sc, workDir, data))
+		t.Logf("%s server started on port %d", sc.Name, sc.Port)
+	}
+
+	testID, err := testrun.Start(api.URL, "e2e", 15, links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := testrun.Wait(api.URL, testID, *e2eWait, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status == "failed" {
+		t.Fatalf("test %s failed", testID)
+	}
+
+	var result e2eResult
+	if err := testrun.GetJSON(api.URL+"/api/v1/results/"+testID, &result); err != nil {
+		t.Fatal(err)
+	}
+	working := make(map[string]bool)
+	for _, proxy := range result.WorkingProxies {
+		working[proxy.Name] = true
+	}
+	failures := make(map[string]string)
+	for _, proxy := range result.FailedProxies {
+		failures[proxy.Name] = proxy.Error
+	}
+
+	for _, sc := range e2eScenarios {
+		t.Run(sc.Name, func(t *testing.T) {
+			if !working[sc.Name] {
+				t.Errorf("not reported as working: %s", failures[sc.Name])
+			}
+		})
+	}
+}
+
+// requireDocker пропускает тест, если Docker недоступен
+func requireDocker(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker not found in PATH")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, "docker", "info").CombinedOutput(); err != nil {
+		t.Skipf("docker is not available: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+}
+
+// e2eData возвращает значения для шаблонов сценариев: общие учётные данные,
+// самоподписанный сертификат TLS в workDir и ключи REALITY
+func e2eData(t *testing.T, workDir string) map[string]interface{} {
+	t.Helper()
+	writeE2ECertificate(t, workDir)
+
+	realityKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{
+		"UUID":              e2eUUID,
+		"SS2022Key":         e2eSS2022Key,
+		"TLSName":           e2eTLSName,
+		"CertFile":          e2eConfigDir + "/cert.pem",
+		"KeyFile":           e2eConfigDir + "/key.pem",
+		"RealityTarget":     e2eRealityTarget,
+		"RealityPrivateKey": base64.RawURLEncoding.EncodeToString(realityKey.Bytes()),
+		"RealityPublicKey":  base64.RawURLEncoding.EncodeToString(realityKey.PublicKey().Bytes()),
+		"ShortID":           e2eShortID,
+	}
+}
+
+// writeE2ECertificate записывает в dir самоподписанный сертификат на
+// e2eTLSName и его ключ
+func writeE2ECertificate(t *testing.T, dir string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: e2eTLSName},
+		DNSNames:     []string{e2eTLSName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]*pem.Block{
+		"cert.pem": {Type: "CERTIFICATE", Bytes: certDER},
+		"key.pem":  {Type: "PRIVATE KEY", Bytes: keyDER},
+	}
+	for name, block := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// renderE2E подставляет порт сценария и data в шаблон. base64 кодирует
+// строку, как в ссылках vmess и ss
+func renderE2E(t *testing.T, text string, sc e2eScenario, data map[string]interface{}) string {
+	t.Helper()
+	values := map[string]interface{}{"Port": sc.Port}
+	for k, v := range data {
+		values[k] = v
+	}
+
+	tmpl, err := template.New(sc.Name).Funcs(template.FuncMap{
+		"base64": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	}).Parse(text)
+	if err != nil {
+		t.Fatalf("%s: %v", sc.Name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		t.Fatalf("%s: %v", sc.Name, err)
+	}
+	return buf.String()
+}
+
+// startE2EServer запускает контейнер с сервером сценария, ждёт открытия
+// порта и возвращает ссылку на сервер. Контейнер удаляется по завершении
+// теста, если не задан -keep
+func startE2EServer(t *testing.T, sc e2eScenario, workDir string, data map[string]interface{}) string {
+	t.Helper()
+	inbound := renderE2E(t, sc.Inbound, sc, data)
+	config := renderE2E(t, e2eServerConfig, sc, map[string]interface{}{"Inbound": inbound})
+	link := renderE2E(t, sc.ShareURL, sc, data)
+
+	if err := os.WriteFile(filepath.Join(workDir, sc.Name+".json"), []byte(config), 0644); err != nil {
+		t.Fatalf("%s: failed to write server config: %v", sc.Name, err)
+	}
+
+	out, err := exec.Command("docker", "run", "-d",
+		"-p", fmt.Sprintf("127.0.0.1:%d:%d", sc.Port, sc.Port),
+		"-v", workDir+":"+e2eConfigDir+":ro",
+		*e2eImage, "run", "-c", e2eConfigDir+"/"+sc.Name+".json",
+	).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: docker run failed: %v: %s", sc.Name, err, strings.TrimSpace(string(out)))
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		if *e2eKeep {
+			return
+		}
+		exec.Command("docker", "rm", "-f", id).Run()
+	})
+
+	addr := fmt.Sprintf("127.0.0.1:%d", sc.Port)
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return link
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	logs, _ := exec.Command("docker", "logs", id).CombinedOutput()
+	t.Fatalf("%s: server did not start listening on %s:\n%s", sc.Name, addr, logs)
+	return ""
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// envDuration читает длительность вида "10m" из переменной окружения
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s=%q, using default %s", name, value, def)
+		return def
+	}
+	return d
+}
+
+// envInt читает целое число из переменной окружения
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %d", name, value, def)
+		return def
+	}
+	return n
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"projectx/proxytestlib/geoip"
+)
+
+// ipCheckURL - сервис, который возвращает IP клиента текстом. Запрос через
+// прокси показывает его выходной IP
+var ipCheckURL = loadIPCheckURL()
+
+func loadIPCheckURL() string {
+	if value := os.Getenv("IP_CHECK_URL"); value != "" {
+		return value
+	}
+	return "https://api.ipify.org?format=text"
+}
+
+// ExitInfo - выходной IP прокси и его расположение по GeoIP
+type ExitInfo struct {
+	IP      string `json:"ip"`
+	Country string `json:"country,omitempty"` // ISO-код страны
+	City    string `json:"city,omitempty"`
+	ASN     int    `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`     // Владелец автономной системы
+	Network string `json:"network,omitempty"` // datacenter или residential, оценка по ASN и владельцу
+
+	ServerIPs []string `json:"server_ips,omitempty"` // Адреса сервера из ссылки
+	Relayed   bool     `json:"relayed"`              // Выход в другой сети, чем сервер: релей, каскад или CDN
+	ServerASN int      `json:"server_asn,omitempty"` // Автономная система сервера, если выход в другой сети
+	Front     string   `json:"front,omitempty"`      // CDN, через которую работает сервер: cloudflare, fastly и др.
+}
+
+// location описывает расположение для текстового экспорта, пустая строка -
+// GeoIP ничего не знает об адресе
+func (e *ExitInfo) location() string {
+	var parts []string
+	if e.Country != "" {
+		parts = append(parts, e.Country)
+	}
+	if e.City != "" {
+		parts = append(parts, e.City)
+	}
+	if e.ASN != 0 {
+		parts = append(parts, strings.TrimSpace(fmt.Sprintf("AS%d %s", e.ASN, e.Org)))
+	}
+	if e.Network != "" {
+		parts = append(parts, e.Network)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkExit узнаёт выходной IP прокси через ipCheckURL и дополняет его
+// данными GeoIP, если они настроены. Без GeoIP возвращается только адрес
+func checkExit(proxyURL string, proxy *url.URL, timeout time.Duration, usage *testUsage) (*ExitInfo, error) {
+	if simulation != nil {
+		return simulation.exit(proxyURL), nil
+	}
+
+	client := http.Client{
+		Timeout:   timeout,
+		Transport: countingTransport(proxy, usage),
+	}
+	resp, err := client.Get(ipCheckURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return nil, fmt.Errorf("%s did not return an IP address", ipCheckURL)
+	}
+
+	exit := &ExitInfo{IP: ip.String()}
+	if geoResolver == nil {
+		return exit, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if info, err := geoResolver.Lookup(ctx, ip); err == nil {
+		exit.Country, exit.City, exit.ASN, exit.Org = info.CountryCode, info.City, info.ASN, info.Org
+		exit.Network = geoip.NetworkType(info)
+	}
+	return exit, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"projectx/parser"
+)
+
+// WorkingProxy - рабочий прокси со ссылкой для импорта в клиент
+type WorkingProxy struct {
+	ProxyInfo
+	ShareLink string
+}
+
+// registerExportRoutes подключает эндпоинты экспорта результатов к группе API
+func registerExportRoutes(api *gin.RouterGroup) {
+	api.GET("/results/:id/working", getWorkingProxies)
+	api.GET("/results/:id/export", exportResults)
+	api.GET("/results/:id/stream-ndjson", streamResults)
+	api.GET("/results/:id/metrics", getTestMetrics)
+}
+
+// getWorkingProxies возвращает рабочие прокси теста в порядке рейтинга
+func getWorkingProxies(c *gin.Context) {
+	testID := c.Param("id")
+	filter, ok := parseExportFilter(c)
+	if !ok {
+		return
+	}
+	working, exists := workingProxies(testID, filter)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Results not found", "test_id": testID})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"test_id": testID, "count": len(working), "proxies": working})
+}
+
+// exportResults отдаёт рабочие прокси файлом: format=links - ссылка на
+// строку, base64 - подписка в base64, text - описание для человека на
+// языке из Accept-Language
+func exportResults(c *gin.Context) {
+	testID := c.Param("id")
+	format := c.DefaultQuery("format", "links")
+	if format != "links" && format != "base64" && format != "text" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format", "details": "format must be links, base64 or text"})
+		return
+	}
+
+	filter, ok := parseExportFilter(c)
+	if !ok {
+		return
+	}
+	working, exists := workingProxies(testID, filter)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Results not found", "test_id": testID})
+		return
+	}
+
+	var body string
+	switch format {
+	case "links", "base64":
+		links := make([]string, 0, len(working))
+		for _, proxy := range working {
+			links = append(links, proxy.ShareLink)
+		}
+		body = strings.Join(links, "\n")
+		if format == "base64" {
+			body = base64.StdEncoding.EncodeToString([]byte(body))
+		}
+	case "text":
+		body = formatWorkingProxies(requestLanguage(c), testID, working)
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s-working.txt", testID))
+	c.String(http.StatusOK, body)
+}
+
+// workingProxies копирует рабочие прокси теста, прошедшие фильтр, и кодирует
+// их ссылки. Шаблон имени фильтра применяется к имени и к ссылке
+func workingProxies(testID string, filter *exportFilter) ([]WorkingProxy, bool) {
+	mu.Lock()
+	result, exists := results[testID]
+	var proxies []ProxyInfo
+	if exists {
+		proxies = append(proxies, result.WorkingProxies...)
+	}
+	mu.Unlock()
+
+	if !exists {
+		return nil, false
+	}
+	working := make([]WorkingProxy, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !filter.selects(&proxy) {
+			continue
+		}
+		var link string
+		proxy.Name, link = filter.rename(&proxy, shareLink(proxy.Link))
+		working = append(working, WorkingProxy{ProxyInfo: proxy, ShareLink: link})
+	}
+	return working, true
+}
+
+// shareLink приводит ссылку к виду, который импортируют клиенты: параметры,
+// выведенные парсером, записываются явно. Если ссылку не удалось разобрать
+// или закодировать, возвращается исходная
+func shareLink(link string) string {
+	config, err := parser.ParseProxyURL(link)
+	if err != nil {
+		return link
+	}
+	encoded, err := config.ShareURI()
+	if err != nil {
+		return link
+	}
+	return encoded
+}
+
+func formatWorkingProxies(lang, testID string, working []WorkingProxy) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, translate(lang, "export.title", testID, len(working)))
+	for _, proxy := range working {
+		fmt.Fprintf(&b, "\n%d. %s\n", proxy.Rank, proxy.Name)
+		fmt.Fprintf(&b, "   %s\n", translate(lang, "export.proxy", proxy.Protocol, proxy.Server, proxy.Port, proxy.Latency))
+		if proxy.Exit != nil {
+			exit := translate(lang, "export.exit", proxy.Exit.IP)
+			if location := proxy.Exit.location(); location != "" {
+				exit += " (" + location + ")"
+			}
+			fmt.Fprintf(&b, "   %s\n", exit)
+			if proxy.Exit.Relayed {
+				fmt.Fprintf(&b, "   %s\n", translate(lang, "export.relay", strings.Join(proxy.Exit.ServerIPs, ", ")))
+			}
+		}
+		if proxy.Reputation != nil {
+			fmt.Fprintf(&b, "   %s\n", translate(lang, "export.risk", proxy.Reputation.Risk, proxy.Reputation.Level, proxy.Reputation.Provider))
+		}
+		if proxy.DNSLeak != nil {
+			fmt.Fprintf(&b, "   %s\n", translate(lang, "export.dns", proxy.DNSLeak.resolvers()))
+			if proxy.DNSLeak.Leak {
+				fmt.Fprintf(&b, "   %s\n", translate(lang, "export.leak"))
+			}
+		}
+		if proxy.TLS != nil && proxy.TLS.Plaintext {
+			fmt.Fprintf(&b, "   %s\n", translate(lang, "export.plain"))
+		} else if proxy.TLS.weakened() {
+			fmt.Fprintf(&b, "   %s\n", translate(lang, "export.tls", proxy.TLS.Version, proxy.TLS.Cipher, proxy.TLS.Expected))
+		}
+		fmt.Fprintf(&b, "   %s\n", proxy.ShareLink)
+	}
+	return b.String()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"projectx/proxytestlib/geoip"
+	"projectx/proxytestlib/rewriter"
+)
+
+// nameTemplateField - подстановка {field} в шаблоне имени
+var nameTemplateField = regexp.MustCompile(`\{(\w+)\}`)
+
+// nameTemplateFields - значения подстановок шаблона имени для прокси
+var nameTemplateFields = map[string]func(proxy *ProxyInfo) string{
+	"name":     func(proxy *ProxyInfo) string { return proxy.Name },
+	"rank":     func(proxy *ProxyInfo) string { return strconv.Itoa(proxy.Rank) },
+	"protocol": func(proxy *ProxyInfo) string { return proxy.Protocol },
+	"server":   func(proxy *ProxyInfo) string { return proxy.Server },
+	"port":     func(proxy *ProxyInfo) string { return strconv.Itoa(proxy.Port) },
+	"country":  func(proxy *ProxyInfo) string { return proxy.Country },
+	"flag":     func(proxy *ProxyInfo) string { return countryFlag(proxy.Country) },
+	"latency_ms": func(proxy *ProxyInfo) string {
+		if latency, err := time.ParseDuration(proxy.Latency); err == nil {
+			return strconv.FormatInt(latency.Milliseconds(), 10)
+		}
+		return ""
+	},
+	"speed_mbps": func(proxy *ProxyInfo) string {
+		if proxy.Throughput <= 0 {
+			return ""
+		}
+		return strconv.FormatFloat(proxy.Throughput*8, 'f', 1, 64)
+	},
+}
+
+// exportFilter - отбор и переименование рабочих прокси для одного запроса
+// экспорта. Разные потребители одного теста или контроллера (телефон,
+// роутер) забирают один список с разными порогами и именами
+type exportFilter struct {
+	network      string        // datacenter или residential, пусто - любая сеть выхода
+	maxLatency   time.Duration // 0 - без ограничения
+	minSpeedMbps float64       // Мбит/с, 0 - без ограничения
+	nameTemplate string        // Шаблон имени с подстановками {field}, пусто - имя не меняется
+}
+
+// parseExportFilter читает параметры network, max_latency_ms, min_speed_mbps
+// и name_template. При ошибке ответ уже отправлен
+func parseExportFilter(c *gin.Context) (*exportFilter, bool) {
+	filter := &exportFilter{network: c.Query("network"), nameTemplate: c.Query("name_template")}
+	if filter.network != "" && filter.network != geoip.NetworkDatacenter && filter.network != geoip.NetworkResidential {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid network", "details": "network must be datacenter or residential"})
+		return nil, false
+	}
+	if value := c.Query("max_latency_ms"); value != "" {
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid max_latency_ms", "details": "max_latency_ms must be a positive number"})
+			return nil, false
+		}
+		filter.maxLatency = time.Duration(ms) * time.Millisecond
+	}
+	if value := c.Query("min_speed_mbps"); value != "" {
+		speed, err := strconv.ParseFloat(value, 64)
+		if err != nil || speed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_speed_mbps", "details": "min_speed_mbps must be a positive number"})
+			return nil, false
+		}
+		filter.minSpeedMbps = speed
+	}
+	for _, match := range nameTemplateField.FindAllStringSubmatch(filter.nameTemplate, -1) {
+		if _, known := nameTemplateFields[match[1]]; !known {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid name_template", "details": fmt.Sprintf("unknown field {%s}", match[1])})
+			return nil, false
+		}
+	}
+	return filter, true
+}
+
+// selects проверяет, проходит ли прокси пороги. Прокси с неизвестной сетью
+// выхода или без замера скорости не проходят соответствующий фильтр
+func (f *exportFilter) selects(proxy *ProxyInfo) bool {
+	if f.network != "" && (proxy.Exit == nil || proxy.Exit.Network != f.network) {
+		return false
+	}
+	if f.maxLatency > 0 {
+		latency, err := time.ParseDuration(proxy.Latency)
+		if err != nil || latency > f.maxLatency {
+			return false
+		}
+	}
+	if f.minSpeedMbps > 0 && proxy.Throughput*8 < f.minSpeedMbps {
+		return false
+	}
+	return true
+}
+
+// rename возвращает имя прокси по шаблону и ссылку с этим именем. Без
+// шаблона, с пустым результатом или если имя не удалось записать в ссылку,
+// имя и ссылка не меняются
+func (f *exportFilter) rename(proxy *ProxyInfo, link string) (string, string) {
+	if f.nameTemplate == "" {
+		return proxy.Name, link
+	}
+	name := nameTemplateField.ReplaceAllStringFunc(f.nameTemplate, func(field string) string {
+		return nameTemplateFields[strings.Trim(field, "{}")](proxy)
+	})
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return proxy.Name, link
+	}
+	renamed, err := rewriter.SetLinkName(link, name)
+	if err != nil {
+		return proxy.Name, link
+	}
+	return name, renamed
+}
+
+// countryFlag - эмодзи флага по ISO-коду страны
+func countryFlag(country string) string {
+	if len(country) != 2 {
+		return ""
+	}
+	var flag strings.Builder
+	for _, letter := range strings.ToUpper(country) {
+		if letter < 'A' || letter > 'Z' {
+			return ""
+		}
+		flag.WriteRune(0x1F1E6 + letter - 'A')
+	}
+	return flag.String()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// externalMaxOutcomes - сколько исходов принимается за один запрос
+const externalMaxOutcomes = 10000
+
+// externalSourcePattern - допустимое имя источника: его видно в отчётах
+var externalSourcePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@:-]{0,63}$`)
+
+// ExternalOutcome - исход проверки одного прокси внешним инструментом
+type ExternalOutcome struct {
+	Name         string  `json:"name"`
+	Link         string  `json:"link"`
+	Working      bool    `json:"working"`
+	LatencyMs    float64 `json:"latency_ms,omitempty"`
+	Error        string  `json:"error,omitempty"`
+	ServerStatus string  `json:"server_status"` // Исход проверки сервера: working, failed или skipped
+}
+
+// ExternalCheck - исходы, присланные одним внешним источником
+type ExternalCheck struct {
+	Source        string            `json:"source"`
+	ClientIP      string            `json:"client_ip"`
+	SubmittedAt   time.Time         `json:"submitted_at"`
+	Working       int               `json:"working"`
+	Failed        int               `json:"failed"`
+	Disagreements int               `json:"disagreements"` // Исходов, расходящихся с проверкой сервера; пропущенные сервером не считаются
+	Outcomes      []ExternalOutcome `json:"outcomes"`
+}
+
+// ExternalRequest - тело POST /results/{id}/external
+type ExternalRequest struct {
+	Source  string `json:"source"`
+	Results []struct {
+		Link      string  `json:"link"`
+		Working   bool    `json:"working"`
+		LatencyMs float64 `json:"latency_ms"`
+		Error     string  `json:"error"`
+	} `json:"results"`
+}
+
+// registerExternalRoutes подключает приём результатов внешних проверок к группе API
+func registerExternalRoutes(api *gin.RouterGroup) {
+	api.POST("/results/:id/external", tokenAuthMiddleware("EXTERNAL_RESULTS_TOKEN", "External results are disabled"), submitExternalResults)
+}
+
+// submitExternalResults принимает исходы проверки от доверенного внешнего
+// инструмента, например скрипта на curl для платформы, где Xray не
+// запускается, и добавляет их в результат теста отдельным источником.
+// Прокси сопоставляются по StableID ссылки, поэтому имя и порядок
+// параметров могут отличаться. Повторная отправка того же источника
+// заменяет его предыдущие исходы
+func submitExternalResults(c *gin.Context) {
+	var request ExternalRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if !externalSourcePattern.MatchString(request.Source) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source", "details": "source must be 1-64 letters, digits or ._@:- characters"})
+		return
+	}
+	if len(request.Results) == 0 || len(request.Results) > externalMaxOutcomes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid results", "details": "results must contain 1 to 10000 outcomes"})
+		return
+	}
+
+	testID := c.Param("id")
+	mu.Lock()
+	defer mu.Unlock()
+
+	result, exists := results[testID]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Results not found", "test_id": testID})
+		return
+	}
+
+	tested := testedProxies(result)
+	check := ExternalCheck{Source: request.Source, ClientIP: c.ClientIP(), SubmittedAt: now()}
+	unmatched := []int{}
+	seen := make(map[string]bool)
+	for i, outcome := range request.Results {
+		id := linkStableID(outcome.Link)
+		proxy, known := tested[id]
+		if id == "" || !known || seen[id] {
+			unmatched = append(unmatched, i)
+			continue
+		}
+		seen[id] = true
+
+		if outcome.Working {
+			check.Working++
+			outcome.Error = ""
+		} else {
+			check.Failed++
+			outcome.LatencyMs = 0
+		}
+		if proxy.status != "skipped" && outcome.Working != (proxy.status == "working") {
+			check.Disagreements++
+		}
+		check.Outcomes = append(check.Outcomes, ExternalOutcome{
+			Name:         proxy.name,
+			Link:         proxy.link,
+			Working:      outcome.Working,
+			LatencyMs:    outcome.LatencyMs,
+			Error:        outcome.Error,
+			ServerStatus: proxy.status,
+		})
+	}
+	if len(check.Outcomes) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No outcome matches a proxy of the test", "unmatched": unmatched})
+		return
+	}
+
+	replaced := false
+	for i := range result.External {
+		if result.External[i].Source == check.Source {
+			result.External[i] = check
+			replaced = true
+		}
+	}
+	if !replaced {
+		result.External = append(result.External, check)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"test_id":       testID,
+		"source":        check.Source,
+		"accepted":      len(check.Outcomes),
+		"unmatched":     unmatched,
+		"disagreements": check.Disagreements,
+		"replaced":      replaced,
+	})
+}
+
+// testedProxy - прокси теста и исход его проверки сервером
+type testedProxy struct {
+	name, link, status string
+}
+
+// testedProxies индексирует прокси результата по StableID ссылки. Вызывается под mu
+func testedProxies(result *TestResult) map[string]testedProxy {
+	tested := make(map[string]testedProxy)
+	add := func(name, link, status string) {
+		if id := linkStableID(link); id != "" {
+			if _, exists := tested[id]; !exists {
+				tested[id] = testedProxy{name: name, link: link, status: status}
+			}
+		}
+	}
+	for _, proxy := range result.WorkingProxies {
+		add(proxy.Name, proxy.Link, "working")
+	}
+	for _, proxy := range result.FailedProxies {
+		add(proxy.Name, proxy.Link, "failed")
+	}
+	for _, proxy := range result.SkippedProxies {
+		add(proxy.Name, proxy.Link, "skipped")
+	}
+	return tested
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"projectx/parser"
+	"projectx/proxytestlib/models"
+)
+
+// tracerouteHops - сколько строк трассировки попадает в отчёт
+const tracerouteHops = 15
+
+var (
+	// tracerouteMaxHosts - сколько серверов трассируется для одного теста,
+	// остальные попадают в отчёт без трассировки
+	tracerouteMaxHosts = envInt("TRACEROUTE_MAX_HOSTS", 20)
+	// tracerouteTTL - сколько хранятся трассировки теста: повторные отчёты
+	// в пределах этого времени их не перезапускают
+	tracerouteTTL = envDuration("TRACEROUTE_CACHE_TTL", 10*time.Minute)
+)
+
+// tracerouteRun - трассировки серверов одного теста
+type tracerouteRun struct {
+	done       chan struct{}     // Закрывается, когда routes заполнены
+	routes     map[string]string // По адресу сервера
+	finishedAt time.Time         // Нулевое, пока трассировка идёт; защищено tracerouteMu
+}
+
+var (
+	tracerouteMu   sync.Mutex
+	tracerouteRuns = make(map[string]*tracerouteRun) // По ID теста
+)
+
+// FailedProxy - прокси, не прошедший проверку
+type FailedProxy struct {
+	Name     string    `json:"name"`
+	Protocol string    `json:"protocol"`
+	Server   string    `json:"server"`
+	Port     int       `json:"port"`
+	Link     string    `json:"link"`
+	Category string    `json:"category"`
+	Field    string    `json:"field,omitempty"` // Параметр ссылки, не прошедший проверку конфига
+	Error    string    `json:"error"`
+	Summary  string    `json:"summary,omitempty"` // Описание категории на языке запроса
+	FailedAt time.Time `json:"failed_at"`
+
+	Certificate *CertReport `json:"certificate,omitempty"` // Сертификат сервера, если задано cert_check
+	TLS         *TLSReport  `json:"tls,omitempty"`         // Согласованная защита, если задано tls_check
+}
+
+// ProviderReport - неработающие ноды одного провайдера
+type ProviderReport struct {
+	Provider string            `json:"provider"`
+	Nodes    []FailedProxy     `json:"nodes"`
+	Routes   map[string]string `json:"traceroutes,omitempty"` // По адресу сервера
+	Counts   map[string]int    `json:"categories"`
+}
+
+// newFailedProxy описывает неудачную проверку для отчёта
+func newFailedProxy(info ProxyInfo, link string, err error) FailedProxy {
+	var field string
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		field = validationErr.Field
+	}
+	return FailedProxy{
+		Name:     info.Name,
+		Protocol: info.Protocol,
+		Server:   info.Server,
+		Port:     info.Port,
+		Link:     link,
+		Category: categorizeError(err),
+		Field:    field,
+		Error:    err.Error(),
+		FailedAt: now(),
+	}
+}
+
+// categorizeError сводит ошибку проверки к категории, понятной поддержке провайдера
+func categorizeError(err error) string {
+	var (
+		dnsErr         *net.DNSError
+		unsupportedErr *parser.UnsupportedError
+		validationErr  *models.ValidationError
+		blockedErr     *blockedError
+	)
+	switch {
+	case errors.As(err, &blockedErr):
+		return "blocked"
+	case errors.As(err, &unsupportedErr):
+		return "unsupported"
+	case errors.As(err, &validationErr):
+		return "invalid_config"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection_reset"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return "unreachable"
+	case errors.Is(err, context.DeadlineExceeded), isTimeout(err):
+		return "timeout"
+	}
+
+	message := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(message, "unsupported scheme"), strings.Contains(message, "invalid"),
+		strings.Contains(message, "not found in url"), strings.Contains(message, "failed to parse"):
+		return "invalid_link"
+	case strings.Contains(message, "failed to start xray"), strings.Contains(message, "generate xray config"):
+		return "local_error"
+	case strings.Contains(message, "tls"), strings.Contains(message, "certificate"), strings.Contains(message, "handshake"):
+		return "tls"
+	case strings.Contains(message, "unexpected status code"), strings.Contains(message, "unexpected response body"):
+		return "unexpected_status"
+	case strings.Contains(message, "socks"), strings.Contains(message, "eof"):
+		return "proxy_rejected"
+	}
+	return "other"
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// failedReport возвращает неработающие ноды теста, сгруппированные по
+// провайдеру, в виде текста для тикета поддержки (format=json - в JSON).
+// С traceroute=true к каждому серверу добавляется начало трассировки
+func failedReport(c *gin.Context) {
+	testID := c.Param("id")
+	lang := requestLanguage(c)
+	mu.Lock()
+	result, exists := results[testID]
+	var failed []FailedProxy
+	if exists {
+		failed = localizeFailures(lang, result.FailedProxies)
+	}
+	mu.Unlock()
+
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Results not found", "test_id": testID})
+		return
+	}
+
+	reports := groupByProvider(failed)
+	if c.Query("traceroute") == "true" {
+		addTraceroutes(testID, reports)
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, gin.H{"test_id": testID, "providers": reports})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s-failed.txt", testID))
+	c.String(http.StatusOK, formatProviderReports(lang, testID, reports))
+}
+
+// groupByProvider группирует ноды по зарегистрированному домену сервера.
+// Ноды с IP-адресом вместо домена попадают в общую группу
+func groupByProvider(failed []FailedProxy) []*ProviderReport {
+	byProvider := make(map[string]*ProviderReport)
+	for _, node := range failed {
+		provider := (&models.ProxyConfig{Server: node.Server}).GetProvider()
+		switch {
+		case node.Server == "":
+			provider = "unparsed links"
+		case provider == "":
+			provider = "IP addresses"
+		}
+		report, ok := byProvider[provider]
+		if !ok {
+			report = &ProviderReport{Provider: provider, Counts: make(map[string]int)}
+			byProvider[provider] = report
+		}
+		report.Nodes = append(report.Nodes, node)
+		report.Counts[node.Category]++
+	}
+
+	reports := make([]*ProviderReport, 0, len(byProvider))
+	for _, report := range byProvider {
+		sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].FailedAt.Before(report.Nodes[j].FailedAt) })
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if len(reports[i].Nodes) != len(reports[j].Nodes) {
+			return len(reports[i].Nodes) > len(reports[j].Nodes)
+		}
+		return reports[i].Provider < reports[j].Provider
+	})
+	return reports
+}
+
+// addTraceroutes добавляет к отчёту трассировки серверов теста
+func addTraceroutes(testID string, reports []*ProviderReport) {
+	routes := testTraceroutes(testID, reports)
+	for _, report := range reports {
+		report.Routes = make(map[string]string)
+		for _, node := range report.Nodes {
+			if route, ok := routes[node.Server]; ok {
+				report.Routes[node.Server] = route
+			}
+		}
+	}
+}
+
+// testTraceroutes возвращает трассировки серверов теста. Трассировка
+// запускается один раз на tracerouteTTL: одновременные запросы отчёта
+// ждут уже идущую, последующие получают её результат
+func testTraceroutes(testID string, reports []*ProviderReport) map[string]string {
+	tracerouteMu.Lock()
+	run, ok := tracerouteRuns[testID]
+	if ok && !run.finishedAt.IsZero() && since(run.finishedAt) > tracerouteTTL {
+		ok = false
+	}
+	if !ok {
+		run = &tracerouteRun{done: make(chan struct{})}
+		tracerouteRuns[testID] = run
+	}
+	tracerouteMu.Unlock()
+
+	if !ok {
+		run.routes = traceServers(reports)
+		tracerouteMu.Lock()
+		run.finishedAt = now()
+		tracerouteMu.Unlock()
+		close(run.done)
+	}
+	<-run.done
+	return run.routes
+}
+
+// traceServers трассирует уникальные серверы отчёта, не более четырёх
+// одновременно и не более tracerouteMaxHosts всего. Серверы, которые не
+// являются IP-адресом или именем хоста, не трассируются
+func traceServers(reports []*ProviderReport) map[string]string {
+	routes := make(map[string]string)
+	var hosts []string
+	for _, report := range reports {
+		for _, node := range report.Nodes {
+			server := node.Server
+			if _, seen := routes[server]; seen || server == "" {
+				continue
+			}
+			switch {
+			case !traceableHost(server):
+				routes[server] = "not traced: not a valid hostname or IP address"
+			case len(hosts) >= tracerouteMaxHosts:
+				routes[server] = fmt.Sprintf("not traced: only %d servers are traced per test", tracerouteMaxHosts)
+			default:
+				routes[server] = ""
+				hosts = append(hosts, server)
+			}
+		}
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, 4)
+		rmu sync.Mutex
+	)
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			route := traceroute(host)
+			<-sem
+			rmu.Lock()
+			routes[host] = route
+			rmu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+	return routes
+}
+
+// traceableHost проверяет, что host - IP-адрес или имя хоста. Сервер
+// берётся из ссылки пользователя и не должен читаться как опция traceroute
+func traceableHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pruneTraceroutes удаляет завершённые трассировки старше tracerouteTTL
+func pruneTraceroutes() {
+	tracerouteMu.Lock()
+	defer tracerouteMu.Unlock()
+	for testID, run := range tracerouteRuns {
+		if !run.finishedAt.IsZero() && since(run.finishedAt) > tracerouteTTL {
+			delete(tracerouteRuns, testID)
+		}
+	}
+}
+
+// traceroute возвращает первые строки трассировки до хоста. Используется
+// traceroute, при его отсутствии - tracepath
+func traceroute(host string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	commands := [][]string{
+		{"traceroute", "-n", "-q", "1", "-w", "1", "-m", fmt.Sprint(tracerouteHops), "--", host},
+		{"tracepath", "-n", "-m", fmt.Sprint(tracerouteHops), "--", host},
+	}
+	for _, args := range commands {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		if len(lines) > tracerouteHops+1 {
+			lines = lines[:tracerouteHops+1]
+		}
+		snippet := strings.Join(lines, "\n")
+		if err != nil && snippet == "" {
+			return fmt.Sprintf("%s failed: %v", args[0], err)
+		}
+		return snippet
+	}
+	return "traceroute unavailable on the checking host"
+}
+
+// formatProviderReports оформляет отчёт для вставки в тикет на языке lang.
+// Ссылки с учётными данными в текст не попадают
+func formatProviderReports(lang, testID string, reports []*ProviderReport) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, translate(lang, "report.title", testID, now().UTC().Format(time.RFC3339)))
+	if len(reports) == 0 {
+		fmt.Fprintf(&b, "\n%s\n", translate(lang, "report.empty"))
+		return b.String()
+	}
+
+	for _, report := range reports {
+		fmt.Fprintf(&b, "\n=== %s ===\n", translate(lang, "report.provider", report.Provider))
+		fmt.Fprintln(&b, translate(lang, "report.failing", len(report.Nodes)))
+
+		categories := make([]string, 0, len(report.Counts))
+		for category := range report.Counts {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		for _, category := range categories {
+			fmt.Fprintf(&b, "  %s: %d\n", category, report.Counts[category])
+		}
+
+		printed := make(map[string]bool)
+		for _, node := range report.Nodes {
+			if node.Server == "" {
+				fmt.Fprintf(&b, "\n- %s\n", node.Name)
+			} else {
+				fmt.Fprintf(&b, "\n- %s (%s, %s)\n", node.Name, node.Protocol, net.JoinHostPort(node.Server, fmt.Sprint(node.Port)))
+			}
+			fmt.Fprintf(&b, "  %s\n", translate(lang, "report.failed_at", node.FailedAt.UTC().Format(time.RFC3339)))
+			fmt.Fprintf(&b, "  %s\n", translate(lang, "report.category", node.Category+" - "+node.Summary))
+			fmt.Fprintf(&b, "  %s\n", translate(lang, "report.error", node.Error))
+			if route := report.Routes[node.Server]; route != "" && !printed[node.Server] {
+				printed[node.Server] = true
+				fmt.Fprintf(&b, "  %s\n", translate(lang, "report.traceroute"))
+				for _, line := range strings.Split(route, "\n") {
+					fmt.Fprintf(&b, "    %s\n", line)
+				}
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ContentTarget - адрес, часто блокируемый цензорами, и его категория
+type ContentTarget struct {
+	Category string `json:"category"`
+	URL      string `json:"url"`
+}
+
+// defaultContentTargets - категории по умолчанию, по 1-2 адреса на категорию.
+// Используется https, поэтому подмена ответа на выходе тоже считается блокировкой
+var defaultContentTargets = []ContentTarget{
+	{"social", "https://x.com/"},
+	{"social", "https://www.facebook.com/"},
+	{"social", "https://www.instagram.com/"},
+	{"messaging", "https://telegram.org/"},
+	{"messaging", "https://web.whatsapp.com/"},
+	{"video", "https://www.youtube.com/"},
+	{"news", "https://www.bbc.com/"},
+	{"reference", "https://www.wikipedia.org/"},
+	{"privacy", "https://www.torproject.org/"},
+	{"privacy", "https://protonvpn.com/"},
+}
+
+// contentTargets - адреса для проверки фильтрации из файла CONTENT_TARGETS
+// или список по умолчанию
+var contentTargets = loadContentTargets()
+
+func loadContentTargets() []ContentTarget {
+	path := os.Getenv("CONTENT_TARGETS")
+	if path == "" {
+		return defaultContentTargets
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to load content targets: %v", err)
+	}
+	var targets []ContentTarget
+	if err := json.Unmarshal(data, &targets); err != nil {
+		log.Fatalf("Failed to load content targets: invalid %s: %v", path, err)
+	}
+	if err := validateContentTargets(targets); err != nil {
+		log.Fatalf("Failed to load content targets: %v", err)
+	}
+	log.Printf("Loaded %d content targets from %s", len(targets), path)
+	return targets
+}
+
+func validateContentTargets(targets []ContentTarget) error {
+	if len(targets) == 0 {
+		return fmt.Errorf("no targets")
+	}
+	for _, target := range targets {
+		if target.Category == "" {
+			return fmt.Errorf("target %q has no category", target.URL)
+		}
+		u, err := url.Parse(target.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("target %q is not an http(s) URL", target.URL)
+		}
+	}
+	return nil
+}
+
+// ContentReport - какие категории сайтов открываются через прокси
+type ContentReport struct {
+	FreedomScore float64          `json:"freedom_score"` // Доля доступных категорий, в процентах
+	Reachable    []string         `json:"reachable"`
+	Blocked      []string         `json:"blocked"`
+	Targets      []ContentOutcome `json:"targets"`
+}
+
+// ContentOutcome - результат загрузки одного адреса
+type ContentOutcome struct {
+	Category  string `json:"category"`
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
+	Status    int    `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// checkContent загружает адреса targets через прокси. Адрес доступен, если
+// пришёл любой HTTP-ответ; категория доступна, если доступен хотя бы один
+// её адрес. Ошибка TLS (подмена сертификата) считается блокировкой
+func checkContent(proxyURL string, proxy *url.URL, targets []ContentTarget, timeout time.Duration, usage *testUsage) *ContentReport {
+	outcomes := make([]ContentOutcome, len(targets))
+	if simulation != nil {
+		for i, target := range targets {
+			outcomes[i] = simulation.content(proxyURL, target)
+		}
+		return contentReport(outcomes)
+	}
+
+	client := http.Client{
+		Timeout:   timeout,
+		Transport: countingTransport(proxy, usage),
+		// Редирект на страницу блокировки не должен засчитываться как доступ
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target ContentTarget) {
+			defer wg.Done()
+			outcomes[i] = ContentOutcome{Category: target.Category, URL: target.URL}
+			resp, err := client.Get(target.URL)
+			if err != nil {
+				outcomes[i].Error = err.Error()
+				return
+			}
+			resp.Body.Close()
+			outcomes[i].Status = resp.StatusCode
+			outcomes[i].Reachable = true
+		}(i, target)
+	}
+	wg.Wait()
+	return contentReport(outcomes)
+}
+
+func contentReport(outcomes []ContentOutcome) *ContentReport {
+	reachable := make(map[string]bool)
+	for _, outcome := range outcomes {
+		reachable[outcome.Category] = reachable[outcome.Category] || outcome.Reachable
+	}
+
+	report := &ContentReport{Targets: outcomes}
+	for category, ok := range reachable {
+		if ok {
+			report.Reachable = append(report.Reachable, category)
+		} else {
+			report.Blocked = append(report.Blocked, category)
+		}
+	}
+	sort.Strings(report.Reachable)
+	sort.Strings(report.Blocked)
+	if len(reachable) > 0 {
+		report.FreedomScore = float64(len(report.Reachable)) / float64(len(reachable)) * 100
+	}
+	return report
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultRemoteIPHeaders - заголовки с адресом клиента, которые выставляют nginx и большинство балансировщиков
+var defaultRemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// configureTrustedProxies задаёт, от каких соседей принимать адрес клиента из
+// заголовков. TRUSTED_PROXIES - адреса и сети CIDR через запятую; без неё
+// заголовкам не доверяет никто и клиентом считается адрес соединения, иначе
+// любой клиент подставил бы себе чужой IP. REMOTE_IP_HEADERS заменяет список
+// заголовков, например CF-Connecting-IP за Cloudflare
+func configureTrustedProxies(r *gin.Engine) {
+	trusted := splitEnvList("TRUSTED_PROXIES")
+	if err := r.SetTrustedProxies(trusted); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	r.RemoteIPHeaders = defaultRemoteIPHeaders
+	if headers := splitEnvList("REMOTE_IP_HEADERS"); len(headers) > 0 {
+		r.RemoteIPHeaders = headers
+	}
+
+	if len(trusted) == 0 {
+		log.Printf("No trusted proxies, forwarded client IP headers are ignored")
+		return
+	}
+	log.Printf("Trusted proxies: %s, client IP from %s", strings.Join(trusted, ", "), strings.Join(r.RemoteIPHeaders, ", "))
+}
+
+// splitEnvList разбирает список через запятую из переменной окружения
+func splitEnvList(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
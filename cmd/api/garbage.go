@@ -0,0 +1,66 @@
+package main
+
+import (
+	"projectx/parser"
+	"projectx/proxytestlib/dedup"
+	"projectx/proxytestlib/heuristics"
+	"projectx/proxytestlib/models"
+)
+
+// SkippedProxy - прокси, пропущенный эвристиками мусорных нод
+type SkippedProxy struct {
+	Name    string   `json:"name"`
+	Link    string   `json:"link"`
+	Reasons []string `json:"reasons"`
+
+	index int // Номер ссылки в тесте
+}
+
+// findDuplicates возвращает для ссылок-дубликатов имя первой ноды с тем же
+// ключом (протокол, сервер, порт, учётные данные, транспорт)
+func findDuplicates(links []string) map[int]string {
+	var proxies []*models.ProxyConfig
+	indexes := make(map[*models.ProxyConfig]int)
+	for i, link := range links {
+		if link == "" {
+			continue
+		}
+		proxy, err := parser.ParseProxyURL(link)
+		if err != nil {
+			continue
+		}
+		proxies = append(proxies, proxy)
+		indexes[proxy] = i
+	}
+
+	_, found := dedup.Dedup(proxies)
+	duplicates := make(map[int]string, len(found))
+	for _, duplicate := range found {
+		duplicates[indexes[duplicate.Proxy]] = duplicate.Of.Name
+	}
+	return duplicates
+}
+
+// flagGarbage прогоняет ссылки через эвристики и возвращает причины по индексу ссылки.
+// Ссылки, которые не удалось разобрать, не проверяются
+func flagGarbage(links []string) map[int][]string {
+	var proxies []*models.ProxyConfig
+	indexes := make(map[*models.ProxyConfig]int)
+	for i, link := range links {
+		if link == "" {
+			continue
+		}
+		proxy, err := parser.ParseProxyURL(link)
+		if err != nil {
+			continue
+		}
+		proxies = append(proxies, proxy)
+		indexes[proxy] = i
+	}
+
+	flagged := make(map[int][]string)
+	for _, finding := range heuristics.Inspect(proxies) {
+		flagged[indexes[finding.Proxy]] = finding.Reasons
+	}
+	return flagged
+}
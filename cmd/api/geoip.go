@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"projectx/proxytestlib/geoip"
+	"projectx/proxytestlib/models"
+)
+
+// geoResolver определяет страну серверов без флага в имени. Настраивается
+// теми же переменными, что и xray-checker: GEOIP_PROVIDERS (по умолчанию
+// mmdb), GEOIP_MMDB_PATH, GEOIP_IPINFO_TOKEN, GEOIP_CACHE_TTL (секунды)
+var geoResolver = loadGeoIP()
+
+func loadGeoIP() *geoip.Resolver {
+	providers, ok := os.LookupEnv("GEOIP_PROVIDERS")
+	if !ok {
+		providers = "mmdb"
+	}
+	ttl := time.Duration(envInt("GEOIP_CACHE_TTL", 86400)) * time.Second
+
+	resolver, err := geoip.NewFromSpec(providers, os.Getenv("GEOIP_MMDB_PATH"), os.Getenv("GEOIP_IPINFO_TOKEN"), ttl)
+	if err != nil {
+		log.Fatalf("Failed to set up GeoIP: %v", err)
+	}
+	if resolver != nil {
+		log.Printf("GeoIP providers: %s", strings.Join(resolver.Providers(), ", "))
+	}
+	return resolver
+}
+
+// proxyCountry возвращает ISO-код страны из флага в имени прокси, а без
+// флага - по GeoIP адреса сервера. Пустая строка, если страну определить
+// не удалось
+func proxyCountry(proxy ProxyInfo) string {
+	if country := (&models.ProxyConfig{Name: proxy.Name}).GetCountry(); country != "" {
+		return country
+	}
+	if geoResolver == nil || proxy.Server == "" {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return geoResolver.Country(ctx, proxy.Server)
+}
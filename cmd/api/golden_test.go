@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update перезаписывает golden-файлы вместо сравнения:
+//
+//	go test ./cmd/api -run Golden -update
+var update = flag.Bool("update", false, "Rewrite golden files instead of comparing")
+
+const (
+	// goldenDir - ссылки links.txt общие с тестом генератора в proxytestlib/xray,
+	// golden-файлы API лежат в подкаталоге api
+	goldenDir = "../../testdata/golden"
+	// goldenPort - порт inbound в golden-файлах
+	goldenPort = 10000
+)
+
+// TestGolden сравнивает конфиги GenerateXrayConfig для ссылок
+// testdata/golden/links.txt с файлами в testdata/golden/api
+func TestGolden(t *testing.T) {
+	file, err := os.Open(filepath.Join(goldenDir, "links.txt"))
+	if err != nil {
+		t.Fatalf("error reading fixtures: %v", err)
+	}
+	defer file.Close()
+
+	outDir := filepath.Join(goldenDir, "api")
+	if *update {
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, link, ok := strings.Cut(line, " ")
+		if !ok {
+			t.Fatalf("invalid fixture line: %s", line)
+		}
+
+		t.Run(name, func(t *testing.T) {
+			path, got := renderGolden(outDir, name, strings.TrimSpace(link))
+			if *update {
+				if err := os.WriteFile(path, got, 0644); err != nil {
+					t.Fatalf("error writing %s: %v", path, err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("missing golden file %s (run with -update): %v", path, err)
+			}
+			if !bytes.Equal(want, got) {
+				t.Errorf("output differs from %s:\n%s", path, got)
+			}
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// renderGolden возвращает путь golden-файла и содержимое: отформатированный
+// конфиг или текст ошибки, в том числе если шаблон дал невалидный JSON
+func renderGolden(dir, name, link string) (string, []byte) {
+	config, err := GenerateXrayConfig(link, goldenPort)
+	if err != nil {
+		return filepath.Join(dir, name+".error"), []byte(err.Error() + "\n")
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(config), "", "  "); err != nil {
+		return filepath.Join(dir, name+".error"), []byte("invalid JSON: " + err.Error() + "\n")
+	}
+	out.WriteByte('\n')
+	return filepath.Join(dir, name+".xray.json"), out.Bytes()
+}
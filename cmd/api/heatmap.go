@@ -0,0 +1,205 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"projectx/proxytestlib/history"
+)
+
+const (
+	heatmapWindow     = 24 * time.Hour
+	heatmapMaxWindow  = 90 * 24 * time.Hour
+	heatmapBuckets    = 48
+	heatmapMaxBuckets = 500
+)
+
+// heatmapOffline - значение ячейки, в которой все проверки прокси не прошли
+const heatmapOffline = -1
+
+// HeatmapRow - прокси, строка тепловой карты
+type HeatmapRow struct {
+	Key  string `json:"key"` // Ключ истории, как в GET /history/{key}
+	Name string `json:"name"`
+}
+
+// Heatmap - матрица задержек прокси по интервалам времени. LatencyMs[i][j] -
+// средняя задержка успешных проверок прокси i в интервале j: nil - проверок
+// не было, heatmapOffline - все проверки не прошли
+type Heatmap struct {
+	From          time.Time    `json:"from"`
+	To            time.Time    `json:"to"`
+	BucketSeconds int          `json:"bucket_seconds"`
+	Times         []time.Time  `json:"times"` // Начало каждого интервала
+	Proxies       []HeatmapRow `json:"proxies"`
+	LatencyMs     [][]*int64   `json:"latency_ms"`
+	MinMs         int64        `json:"min_ms"` // Границы шкалы цвета по всем ячейкам с задержкой
+	MaxMs         int64        `json:"max_ms"`
+}
+
+// getHeatmap строит тепловую карту задержек прокси подписки (?subscription=)
+// или пула (?pool=) за окно ?window= (по умолчанию 24h), разбитое на
+// ?buckets= интервалов (по умолчанию 48). Без подписки и пула - все прокси истории
+func getHeatmap(c *gin.Context) {
+	window := heatmapWindow
+	if value := c.Query("window"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > heatmapMaxWindow {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window", "details": "window must be a duration up to 2160h, such as 24h"})
+			return
+		}
+		window = d
+	}
+	buckets := heatmapBuckets
+	if value := c.Query("buckets"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > heatmapMaxBuckets {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid buckets", "details": "buckets must be a number from 1 to 500"})
+			return
+		}
+		buckets = n
+	}
+	bucket := window / time.Duration(buckets)
+	if bucket < time.Second {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid buckets", "details": "buckets must be at least one second long"})
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, ok := heatmapRows(c)
+	if !ok {
+		return
+	}
+
+	to := now().UTC()
+	from := to.Add(-bucket * time.Duration(buckets))
+	heatmap := Heatmap{
+		From:          from,
+		To:            to,
+		BucketSeconds: int(bucket / time.Second),
+		Times:         make([]time.Time, buckets),
+		Proxies:       rows,
+		LatencyMs:     make([][]*int64, len(rows)),
+	}
+	for j := range heatmap.Times {
+		heatmap.Times[j] = from.Add(bucket * time.Duration(j))
+	}
+
+	first := true
+	for i, row := range rows {
+		heatmap.LatencyMs[i] = heatmapCells(proxyHistory[row.Key], from, bucket, buckets)
+		for _, cell := range heatmap.LatencyMs[i] {
+			if cell == nil || *cell == heatmapOffline {
+				continue
+			}
+			if first || *cell < heatmap.MinMs {
+				heatmap.MinMs = *cell
+			}
+			if first || *cell > heatmap.MaxMs {
+				heatmap.MaxMs = *cell
+			}
+			first = false
+		}
+	}
+	c.JSON(http.StatusOK, heatmap)
+}
+
+// heatmapRows выбирает прокси подписки, пула или всей истории. Вызывается под mu
+func heatmapRows(c *gin.Context) ([]HeatmapRow, bool) {
+	var links []string
+	switch {
+	case c.Query("subscription") != "":
+		sub, exists := subscriptions[c.Query("subscription")]
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+			return nil, false
+		}
+		links = sub.Links
+	case c.Query("pool") != "":
+		pool, exists := pools[c.Query("pool")]
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pool not found"})
+			return nil, false
+		}
+		for _, proxy := range pool.Proxies {
+			links = append(links, proxy.Link)
+		}
+	default:
+		rows := make([]HeatmapRow, 0, len(proxyHistory))
+		for key, entries := range proxyHistory {
+			rows = append(rows, HeatmapRow{Key: key, Name: entries[len(entries)-1].Name})
+		}
+		sortHeatmapRows(rows)
+		return rows, true
+	}
+
+	rows := make([]HeatmapRow, 0, len(links))
+	seen := make(map[string]bool)
+	for _, proxy := range knownProxies(links) {
+		key := proxy.GenerateStableID()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		rows = append(rows, HeatmapRow{Key: key, Name: proxy.Name})
+	}
+	sortHeatmapRows(rows)
+	return rows, true
+}
+
+func sortHeatmapRows(rows []HeatmapRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Name != rows[j].Name {
+			return rows[i].Name < rows[j].Name
+		}
+		return rows[i].Key < rows[j].Key
+	})
+}
+
+// heatmapCells раскладывает точки истории по интервалам
+func heatmapCells(entries []history.Entry, from time.Time, bucket time.Duration, buckets int) []*int64 {
+	type cell struct {
+		measured, failed int
+		latency          int64
+	}
+	cells := make([]cell, buckets)
+	// Точки отсортированы по времени, начинаем с первой в окне
+	start := sort.Search(len(entries), func(i int) bool { return !entries[i].At.Before(from) })
+	for _, entry := range entries[start:] {
+		j := int(entry.At.Sub(from) / bucket)
+		if j == buckets && entry.At.Equal(from.Add(bucket*time.Duration(buckets))) {
+			j-- // Точка ровно в конце окна, например только что записанная
+		}
+		if j >= buckets {
+			break
+		}
+		// В истории xray-checker статус может быть без задержки, такая точка
+		// не влияет на ячейку
+		switch {
+		case !entry.Online:
+			cells[j].failed++
+		case entry.LatencyMs > 0:
+			cells[j].measured++
+			cells[j].latency += entry.LatencyMs
+		}
+	}
+
+	row := make([]*int64, buckets)
+	for j, cell := range cells {
+		switch {
+		case cell.measured > 0:
+			mean := cell.latency / int64(cell.measured)
+			row[j] = &mean
+		case cell.failed > 0:
+			offline := int64(heatmapOffline)
+			row[j] = &offline
+		}
+	}
+	return row
+}
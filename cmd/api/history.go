@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"projectx/parser"
+	"projectx/proxytestlib/history"
+	"projectx/proxytestlib/models"
+)
+
+// historySize - сколько последних точек хранится для одного прокси
+const historySize = 5000
+
+// HistoryImportRequest - тело запроса на импорт результатов другого инструмента
+type HistoryImportRequest struct {
+	Format string   `json:"format"` // xray-checker или litespeedtest, пусто - определить по содержимому
+	Data   string   `json:"data"`
+	At     string   `json:"at"`    // RFC3339, время проверки для форматов без отметок времени
+	Links  []string `json:"links"` // Текущие ссылки для сопоставления со StableID
+}
+
+// proxyHistory - история проверок по ключу прокси: StableID или, если его не
+// удалось определить, протокол, адрес и имя
+var proxyHistory = make(map[string][]history.Entry)
+
+// registerHistoryRoutes подключает эндпоинты истории к группе API
+func registerHistoryRoutes(api *gin.RouterGroup) {
+	api.POST("/history/import", importHistory)
+	api.GET("/history", listHistory)
+	api.GET("/history/heatmap", getHeatmap)
+	api.GET("/history/:key", getHistory)
+}
+
+// importHistory загружает историю из результатов xray-checker или
+// LiteSpeedTest. Записи без ссылки сопоставляются со StableID по ссылкам
+// запроса, пулов и подписок
+func importHistory(c *gin.Context) {
+	var request HistoryImportRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	at := now()
+	if request.At != "" {
+		parsed, err := time.Parse(time.RFC3339, request.At)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at must be an RFC3339 time", "details": err.Error()})
+			return
+		}
+		at = parsed
+	}
+
+	format := request.Format
+	if format == "" {
+		format = history.Detect([]byte(request.Data))
+	}
+	entries, err := history.Parse(format, []byte(request.Data), at)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid results", "details": err.Error()})
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	links := append([]string{}, request.Links...)
+	for _, pool := range pools {
+		for _, proxy := range append(append([]*PoolProxy{}, pool.Proxies...), pool.Pruned...) {
+			links = append(links, proxy.Link)
+		}
+	}
+	for _, sub := range subscriptions {
+		links = append(links, sub.Links...)
+	}
+	mapped := history.MapStableIDs(entries, knownProxies(links))
+
+	imported := 0
+	keys := make(map[string]bool)
+	for _, entry := range entries {
+		if addHistory(entry) {
+			imported++
+			keys[historyKey(entry)] = true
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"format":   format,
+		"entries":  len(entries),
+		"imported": imported, // Без уже загруженных точек
+		"mapped":   mapped,
+		"unmapped": len(entries) - mapped,
+		"proxies":  len(keys),
+	})
+}
+
+// listHistory возвращает аптайм и среднюю задержку каждого прокси
+func listHistory(c *gin.Context) {
+	mu.Lock()
+	list := make([]gin.H, 0, len(proxyHistory))
+	for key, entries := range proxyHistory {
+		list = append(list, historySummary(key, entries))
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i]["key"].(string) < list[j]["key"].(string) })
+	c.JSON(http.StatusOK, gin.H{"history": list})
+}
+
+// getHistory возвращает все точки истории прокси
+func getHistory(c *gin.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	entries, exists := proxyHistory[c.Param("key")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "History not found"})
+		return
+	}
+	body := historySummary(c.Param("key"), entries)
+	body["entries"] = entries
+	c.JSON(http.StatusOK, body)
+}
+
+// recordHistory добавляет в историю результаты завершённого теста
+func recordHistory(testID string, working []ProxyInfo, failed []FailedProxy) {
+	now := now().UTC()
+	source := "test:" + testID
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, proxy := range working {
+		latency, _ := time.ParseDuration(proxy.Latency)
+		addHistory(history.Entry{
+			StableID:  linkStableID(proxy.Link),
+			Name:      proxy.Name,
+			Protocol:  proxy.Protocol,
+			Server:    proxy.Server,
+			Port:      proxy.Port,
+			At:        now,
+			Online:    true,
+			LatencyMs: latency.Milliseconds(),
+			Source:    source,
+		})
+	}
+	for _, proxy := range failed {
+		addHistory(history.Entry{
+			StableID: linkStableID(proxy.Link),
+			Name:     proxy.Name,
+			Protocol: proxy.Protocol,
+			Server:   proxy.Server,
+			Port:     proxy.Port,
+			At:       now,
+			Source:   source,
+		})
+	}
+}
+
+// addHistory вставляет точку с сохранением порядка по времени. Точка с тем
+// же временем не добавляется, поэтому повторный импорт файла безопасен.
+// Вызывается под mu
+func addHistory(entry history.Entry) bool {
+	key := historyKey(entry)
+	entries := proxyHistory[key]
+
+	i := sort.Search(len(entries), func(i int) bool { return !entries[i].At.Before(entry.At) })
+	if i < len(entries) && entries[i].At.Equal(entry.At) {
+		return false
+	}
+	entries = append(entries, history.Entry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = entry
+
+	if len(entries) > historySize {
+		entries = entries[len(entries)-historySize:]
+	}
+	proxyHistory[key] = entries
+	return true
+}
+
+func historyKey(entry history.Entry) string {
+	if entry.StableID != "" {
+		return entry.StableID
+	}
+	return fmt.Sprintf("%s|%s:%d|%s", entry.Protocol, entry.Server, entry.Port, entry.Name)
+}
+
+func historySummary(key string, entries []history.Entry) gin.H {
+	online, measured := 0, 0
+	var latency int64
+	for _, entry := range entries {
+		if entry.Online {
+			online++
+		}
+		// В истории xray-checker статус может быть без задержки
+		if entry.LatencyMs > 0 {
+			measured++
+			latency += entry.LatencyMs
+		}
+	}
+	last := entries[len(entries)-1]
+	summary := gin.H{
+		"key":       key,
+		"stable_id": last.StableID,
+		"name":      last.Name,
+		"points":    len(entries),
+		"uptime":    float64(online) / float64(len(entries)) * 100,
+		"first":     entries[0].At,
+		"last":      last.At,
+	}
+	if measured > 0 {
+		summary["average_latency_ms"] = latency / int64(measured)
+	}
+	return summary
+}
+
+// knownProxies разбирает ссылки, пропуская те, что не удалось разобрать
+func knownProxies(links []string) []*models.ProxyConfig {
+	proxies := make([]*models.ProxyConfig, 0, len(links))
+	for _, link := range links {
+		if config, err := parser.ParseProxyURL(link); err == nil {
+			proxies = append(proxies, config)
+		}
+	}
+	return proxies
+}
+
+// linkStableID возвращает StableID ссылки или пустую строку
+func linkStableID(link string) string {
+	config, err := parser.ParseProxyURL(link)
+	if err != nil {
+		return ""
+	}
+	return config.GenerateStableID()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultLanguage - язык человекочитаемых строк, если Accept-Language не
+// задан или в нём нет поддерживаемого языка
+const defaultLanguage = "en"
+
+// messages - переводы строк для людей: названия статусов, описания категорий
+// ошибок и тексты экспорта. Ключи без перевода выводятся как есть
+var messages = map[string]map[string]string{
+	"en": {
+		"status.pending":     "Pending",
+		"status.running":     "Running",
+		"status.completed":   "Completed",
+		"status.failed":      "Failed",
+		"status.interrupted": "Interrupted",
+		"status.cancelled":   "Cancelled",
+
+		"category.unsupported":        "Protocol or option is not supported",
+		"category.invalid_config":     "Invalid proxy configuration",
+		"category.invalid_link":       "Link could not be parsed",
+		"category.dns":                "Server name does not resolve",
+		"category.connection_refused": "Server refused the connection",
+		"category.connection_reset":   "Connection was reset",
+		"category.unreachable":        "Server is unreachable",
+		"category.timeout":            "Timed out",
+		"category.local_error":        "Checking host failed to start Xray",
+		"category.tls":                "TLS handshake failed",
+		"category.cert_mismatch":      "Certificate does not match the SNI",
+		"category.cert_expired":       "Certificate has expired",
+		"category.cert_untrusted":     "Certificate is not trusted",
+		"category.unexpected_status":  "Unexpected response through the proxy",
+		"category.proxy_rejected":     "Proxy rejected the request",
+		"category.blocked":            "Block page or captive portal instead of the check response",
+		"category.other":              "Other error",
+
+		"export.title": "Working proxies of test %s: %d",
+		"export.proxy": "%s %s:%d, latency %s",
+		"export.exit":  "exit IP %s",
+		"export.risk":  "risk %d/100 (%s, %s)",
+		"export.dns":   "DNS resolvers %s",
+		"export.leak":  "DNS leak: resolvers outside the exit country",
+		"export.tls":   "weakened TLS: %s %s, expected at least %s",
+		"export.plain": "server answered without TLS",
+		"export.relay": "relayed: exit is in another network than server %s",
+
+		"report.title":      "Failed proxy report for test %s, generated %s",
+		"report.empty":      "No failed proxies.",
+		"report.provider":   "Provider: %s",
+		"report.failing":    "Failing nodes: %d",
+		"report.failed_at":  "Failed at: %s",
+		"report.category":   "Category:  %s",
+		"report.error":      "Error:     %s",
+		"report.traceroute": "Traceroute:",
+	},
+	"ru": {
+		"status.pending":     "В очереди",
+		"status.running":     "Выполняется",
+		"status.completed":   "Завершён",
+		"status.failed":      "Ошибка",
+		"status.interrupted": "Прерван",
+		"status.cancelled":   "Отменён",
+
+		"category.unsupported":        "Протокол или параметр не поддерживается",
+		"category.invalid_config":     "Некорректная конфигурация прокси",
+		"category.invalid_link":       "Не удалось разобрать ссылку",
+		"category.dns":                "Имя сервера не резолвится",
+		"category.connection_refused": "Сервер отклонил соединение",
+		"category.connection_reset":   "Соединение сброшено",
+		"category.unreachable":        "Сервер недоступен",
+		"category.timeout":            "Превышено время ожидания",
+		"category.local_error":        "Не удалось запустить Xray на проверяющем хосте",
+		"category.tls":                "Ошибка TLS-рукопожатия",
+		"category.cert_mismatch":      "Сертификат выдан не на имя из SNI",
+		"category.cert_expired":       "Срок действия сертификата истёк",
+		"category.cert_untrusted":     "Сертификат не заслуживает доверия",
+		"category.unexpected_status":  "Неожиданный ответ через прокси",
+		"category.proxy_rejected":     "Прокси отклонил запрос",
+		"category.blocked":            "Вместо ответа проверки - страница блокировки или авторизации",
+		"category.other":              "Другая ошибка",
+
+		"export.title": "Рабочие прокси теста %s: %d",
+		"export.proxy": "%s %s:%d, задержка %s",
+		"export.exit":  "выходной IP %s",
+		"export.risk":  "риск %d/100 (%s, %s)",
+		"export.dns":   "резолверы DNS %s",
+		"export.leak":  "утечка DNS: резолверы не в стране выхода",
+		"export.tls":   "ослабленный TLS: %s %s, ожидался не ниже %s",
+		"export.plain": "сервер ответил без TLS",
+		"export.relay": "релей: выход в другой сети, чем сервер %s",
+
+		"report.title":      "Отчёт о неработающих прокси теста %s, сформирован %s",
+		"report.empty":      "Неработающих прокси нет.",
+		"report.provider":   "Провайдер: %s",
+		"report.failing":    "Неработающих нод: %d",
+		"report.failed_at":  "Время:     %s",
+		"report.category":   "Категория: %s",
+		"report.error":      "Ошибка:    %s",
+		"report.traceroute": "Трассировка:",
+	},
+}
+
+// requestLanguage выбирает язык по заголовку Accept-Language: поддерживаемый
+// язык с наибольшим весом q, при равных весах - указанный раньше
+func requestLanguage(c *gin.Context) string {
+	type candidate struct {
+		lang   string
+		weight float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if _, ok := messages[lang]; !ok {
+			continue
+		}
+		weight := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if weight > 0 {
+			candidates = append(candidates, candidate{lang, weight})
+		}
+	}
+	if len(candidates) == 0 {
+		return defaultLanguage
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].weight > candidates[j].weight })
+	return candidates[0].lang
+}
+
+// translate возвращает строку key на языке lang, подставляя args как в
+// fmt.Sprintf. Без перевода используется английский, без него - сам ключ
+func translate(lang, key string, args ...interface{}) string {
+	text, ok := messages[lang][key]
+	if !ok {
+		text, ok = messages[defaultLanguage][key]
+	}
+	if !ok {
+		text = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// localizeFailures копирует неработающие прокси с описанием категории на языке lang
+func localizeFailures(lang string, failed []FailedProxy) []FailedProxy {
+	localized := make([]FailedProxy, len(failed))
+	for i, node := range failed {
+		node.Summary = translate(lang, "category."+node.Category)
+		localized[i] = node
+	}
+	return localized
+}
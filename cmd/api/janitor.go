@@ -0,0 +1,221 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const tempConfigPattern = "xray-config-*.json"
+
+var (
+	leakedTempFiles = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "proxy_api_leaked_temp_files_total",
+		Help: "Temporary Xray config files removed by the janitor",
+	})
+	leakedXrayProcesses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "proxy_api_leaked_xray_processes_total",
+		Help: "Orphaned Xray processes killed by the janitor",
+	})
+)
+
+// trackedFile - временный конфиг, созданный для теста
+type trackedFile struct {
+	testID    string
+	createdAt time.Time
+}
+
+// trackedProcess - процесс Xray, запущенный для теста
+type trackedProcess struct {
+	testID    string
+	cmd       *exec.Cmd
+	startedAt time.Time
+}
+
+// resourceRegistry учитывает все временные файлы, процессы и порты,
+// созданные и занятые тестами
+type resourceRegistry struct {
+	mu        sync.Mutex
+	files     map[string]*trackedFile
+	processes map[int]*trackedProcess
+	ports     map[int]*trackedPort
+	owners    map[string]int // Выполняющиеся владельцы ресурсов помимо тестов (A/B-тесты, циклы пулов)
+}
+
+var resources = &resourceRegistry{
+	files:     make(map[string]*trackedFile),
+	processes: make(map[int]*trackedProcess),
+	ports:     make(map[int]*trackedPort),
+	owners:    make(map[string]int),
+}
+
+// acquireOwner отмечает ID, под которым запускаются проверки вне тестов из
+// tests, как выполняющийся, чтобы janitor не счёл его процессы осиротевшими.
+// Возвращает функцию, снимающую отметку по завершении
+func (r *resourceRegistry) acquireOwner(ownerID string) func() {
+	r.mu.Lock()
+	r.owners[ownerID]++
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.owners[ownerID]--; r.owners[ownerID] <= 0 {
+			delete(r.owners, ownerID)
+		}
+	}
+}
+
+func (r *resourceRegistry) trackFile(testID, path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files[path] = &trackedFile{testID: testID, createdAt: time.Now()}
+}
+
+// removeFile удаляет файл и снимает его с учёта
+func (r *resourceRegistry) removeFile(path string) {
+	r.mu.Lock()
+	delete(r.files, path)
+	r.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove temp file %s: %v", path, err)
+	}
+}
+
+func (r *resourceRegistry) trackProcess(testID string, cmd *exec.Cmd) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processes[cmd.Process.Pid] = &trackedProcess{testID: testID, cmd: cmd, startedAt: time.Now()}
+}
+
+func (r *resourceRegistry) releaseProcess(cmd *exec.Cmd) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.processes, cmd.Process.Pid)
+}
+
+// killTest убивает процессы Xray теста, освобождает его порты и возвращает
+// число убитых процессов
+func (r *resourceRegistry) killTest(testID string) int {
+	var victims []*trackedProcess
+	r.mu.Lock()
+	for pid, proc := range r.processes {
+		if proc.testID == testID {
+			victims = append(victims, proc)
+			delete(r.processes, pid)
+		}
+	}
+	r.releaseTestPorts(testID)
+	r.mu.Unlock()
+
+	for _, proc := range victims {
+		if err := proc.cmd.Process.Kill(); err != nil {
+			log.Printf("Failed to kill process %d of test %s: %v", proc.cmd.Process.Pid, testID, err)
+		}
+	}
+	return len(victims)
+}
+
+// counts возвращает число учтённых файлов и процессов
+func (r *resourceRegistry) counts() (files int, processes int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.files), len(r.processes)
+}
+
+// sweep удаляет файлы старше maxAge, убивает процессы тестов, которые уже не
+// выполняются, и освобождает их порты
+func (r *resourceRegistry) sweep(maxAge time.Duration) {
+	running := make(map[string]bool)
+	mu.Lock()
+	for id, test := range tests {
+		if test.Status == "running" {
+			running[id] = true
+		}
+	}
+	mu.Unlock()
+
+	var (
+		staleFiles []string
+		orphans    []*trackedProcess
+	)
+
+	r.mu.Lock()
+	for ownerID := range r.owners {
+		running[ownerID] = true
+	}
+	for path, file := range r.files {
+		if time.Since(file.createdAt) > maxAge {
+			staleFiles = append(staleFiles, path)
+		}
+	}
+	for pid, proc := range r.processes {
+		if !running[proc.testID] {
+			orphans = append(orphans, proc)
+			delete(r.processes, pid)
+		}
+	}
+	for port, reserved := range r.ports {
+		if !running[reserved.testID] {
+			delete(r.ports, port)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, path := range staleFiles {
+		log.Printf("Janitor: removing stale temp file %s", path)
+		r.removeFile(path)
+		leakedTempFiles.Inc()
+	}
+
+	for _, proc := range orphans {
+		log.Printf("Janitor: killing orphaned Xray process %d of test %s", proc.cmd.Process.Pid, proc.testID)
+		if err := proc.cmd.Process.Kill(); err != nil {
+			log.Printf("Janitor: failed to kill process %d: %v", proc.cmd.Process.Pid, err)
+		}
+		leakedXrayProcesses.Inc()
+	}
+}
+
+// removeLeftoverConfigs удаляет конфиги, оставшиеся от предыдущего запуска сервера
+func removeLeftoverConfigs(maxAge time.Duration) {
+	matches, err := filepath.Glob(filepath.Join(os.TempDir(), tempConfigPattern))
+	if err != nil {
+		return
+	}
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) <= maxAge {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			leakedTempFiles.Inc()
+		}
+	}
+}
+
+// startJanitor периодически чистит утёкшие ресурсы.
+// Интервал и возраст файлов задаются через JANITOR_INTERVAL и JANITOR_MAX_AGE.
+func startJanitor() {
+	interval := envDuration("JANITOR_INTERVAL", time.Minute)
+	maxAge := envDuration("JANITOR_MAX_AGE", 10*time.Minute)
+
+	removeLeftoverConfigs(maxAge)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			resources.sweep(maxAge)
+			pruneTraceroutes()
+			pruneLaunches()
+		}
+	}()
+}
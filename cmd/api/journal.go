@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"projectx/proxytestlib/rewriter"
+)
+
+// journalDir - каталог журналов тестов (JOURNAL_DIR), пусто - журнал не ведётся
+var journalDir = os.Getenv("JOURNAL_DIR")
+
+// interruptedReason - причина пропуска ссылок, до которых прерванный тест не дошёл
+const interruptedReason = "not checked (test interrupted)"
+
+// JournalEntry - строка журнала теста. Журнал пишется только дописыванием:
+// start со ссылками теста, затем по строке на каждый исход проверки, как
+// только он известен, и end с итоговым результатом
+type JournalEntry struct {
+	Type    string        `json:"type"` // start, working, failed, skipped, end
+	Time    time.Time     `json:"time"`
+	Index   int           `json:"index"` // Номер ссылки в тесте
+	Test    *Test         `json:"test,omitempty"`
+	Links   []string      `json:"links,omitempty"`
+	Working *ProxyInfo    `json:"working,omitempty"`
+	Failed  *FailedProxy  `json:"failed,omitempty"` // nil - ссылку не удалось прочитать
+	Skipped *SkippedProxy `json:"skipped,omitempty"`
+	Result  *TestResult   `json:"result,omitempty"`
+}
+
+// testJournal - открытый журнал теста. Методы nil-журнала ничего не делают
+type testJournal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openJournal создаёт журнал теста и записывает в него ссылки. Ошибка журнала
+// не останавливает тест: она пишется в лог, а тест идёт без журнала
+func openJournal(testID string, links []string) *testJournal {
+	if journalDir == "" {
+		return nil
+	}
+
+	mu.Lock()
+	var test Test
+	if t, exists := tests[testID]; exists {
+		test = *t
+	}
+	mu.Unlock()
+
+	file, err := os.OpenFile(journalPath(testID), os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0600)
+	if err != nil {
+		log.Printf("Journal for test %s not created: %v", testID, err)
+		return nil
+	}
+	journal := &testJournal{file: file}
+	journal.record(JournalEntry{Type: "start", Test: &test, Links: links})
+	return journal
+}
+
+func journalPath(testID string) string {
+	return filepath.Join(journalDir, testID+".jsonl")
+}
+
+// record дописывает строку и сбрасывает её на диск до возврата, поэтому
+// записанный исход переживает панику и аварийное завершение процесса
+func (j *testJournal) record(entry JournalEntry) {
+	if j == nil {
+		return
+	}
+	entry.Time = now()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Journal entry not written: %v", err)
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Journal entry not written to %s: %v", j.file.Name(), err)
+		return
+	}
+	if err := j.file.Sync(); err != nil {
+		log.Printf("Journal %s not synced: %v", j.file.Name(), err)
+	}
+}
+
+func (j *testJournal) working(index int, proxy ProxyInfo) {
+	j.record(JournalEntry{Type: "working", Index: index, Working: &proxy})
+}
+
+func (j *testJournal) failed(index int, proxy *FailedProxy) {
+	j.record(JournalEntry{Type: "failed", Index: index, Failed: proxy})
+}
+
+func (j *testJournal) skipped(proxy SkippedProxy) {
+	j.record(JournalEntry{Type: "skipped", Index: proxy.index, Skipped: &proxy})
+}
+
+// finish записывает итоговый результат и закрывает журнал
+func (j *testJournal) finish(test *Test, result *TestResult) {
+	if j == nil {
+		return
+	}
+	j.record(JournalEntry{Type: "end", Test: test, Result: result})
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.file.Close(); err != nil {
+		log.Printf("Journal %s not closed: %v", j.file.Name(), err)
+	}
+}
+
+// recoverJournals загружает тесты из журналов JOURNAL_DIR при старте.
+// Завершённые тесты берутся из строки end, прерванные собираются из
+// записанных исходов, а результат дописывается в журнал, чтобы не собирать
+// его при каждом запуске
+func recoverJournals() {
+	if journalDir == "" {
+		return
+	}
+	if err := os.MkdirAll(journalDir, 0700); err != nil {
+		log.Fatalf("Failed to create JOURNAL_DIR: %v", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(journalDir, "*.jsonl"))
+	if err != nil {
+		log.Fatalf("Failed to read JOURNAL_DIR: %v", err)
+	}
+
+	loaded, recovered := 0, 0
+	for _, path := range paths {
+		entries, err := readJournal(path)
+		if err != nil {
+			log.Printf("Journal %s skipped: %v", path, err)
+			continue
+		}
+		test, result, complete := compileJournal(entries)
+		if test == nil || result == nil {
+			log.Printf("Journal %s skipped: no start entry", path)
+			continue
+		}
+		if !complete {
+			appendJournalEnd(path, test, result)
+			recovered++
+		}
+
+		mu.Lock()
+		tests[test.ID] = test
+		results[test.ID] = result
+		mu.Unlock()
+		loaded++
+	}
+	if loaded > 0 {
+		log.Printf("Loaded %d tests from %s, %d of them recovered after interruption", loaded, journalDir, recovered)
+	}
+}
+
+// readJournal читает строки журнала. Оборванная последняя строка - след
+// аварийного завершения во время записи, она пропускается
+func readJournal(path string) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			log.Printf("Journal %s: line %d skipped: %v", path, line, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// compileJournal собирает тест и результат из строк журнала. complete -
+// журнал закончен строкой end и результат взят из неё
+func compileJournal(entries []JournalEntry) (*Test, *TestResult, bool) {
+	var (
+		start   *JournalEntry
+		last    time.Time
+		result  = &TestResult{Recovered: true}
+		checked = make(map[int]bool)
+		total   time.Duration
+	)
+	for i := range entries {
+		entry := &entries[i]
+		last = entry.Time
+		switch entry.Type {
+		case "start":
+			start = entry
+		case "end":
+			if entry.Test != nil && entry.Result != nil {
+				return entry.Test, entry.Result, true
+			}
+		case "working":
+			if entry.Working != nil {
+				result.WorkingProxies = append(result.WorkingProxies, *entry.Working)
+				if latency, err := time.ParseDuration(entry.Working.Latency); err == nil {
+					total += latency
+				}
+			}
+			checked[entry.Index] = true
+		case "failed":
+			if entry.Failed != nil {
+				result.FailedProxies = append(result.FailedProxies, *entry.Failed)
+			}
+			checked[entry.Index] = true
+		case "skipped":
+			if entry.Skipped != nil {
+				entry.Skipped.index = entry.Index
+				result.SkippedProxies = append(result.SkippedProxies, *entry.Skipped)
+			}
+			checked[entry.Index] = true
+		}
+	}
+	if start == nil || start.Test == nil {
+		return nil, nil, false
+	}
+
+	for i, link := range start.Links {
+		if !checked[i] && link != "" {
+			result.SkippedProxies = append(result.SkippedProxies, SkippedProxy{Name: rewriter.LinkName(link), Link: link, Reasons: []string{interruptedReason}})
+		}
+	}
+
+	test := start.Test
+	test.Status = "interrupted"
+	test.CompletedAt = last
+
+	result.TestID = test.ID
+	result.TotalProxies = test.ProxyCount
+	result.Successful = len(result.WorkingProxies)
+	result.Skipped = len(result.SkippedProxies)
+	result.Failed = result.TotalProxies - result.Successful - result.Skipped
+	result.AverageLatency = "N/A"
+	if result.Successful > 0 {
+		result.AverageLatency = (total / time.Duration(result.Successful)).String()
+	}
+	if result.TotalProxies > 0 {
+		result.SuccessRate = float64(result.Successful) / float64(result.TotalProxies) * 100
+	}
+	result.Elapsed = last.Sub(test.StartedAt).Round(time.Millisecond).String()
+	return test, result, false
+}
+
+// appendJournalEnd дописывает собранный результат прерванного теста
+func appendJournalEnd(path string, test *Test, result *TestResult) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf("Journal %s not finished: %v", path, err)
+		return
+	}
+	// Оборванная строка завершается, иначе end склеится с ней. Лишняя пустая
+	// строка при чтении пропускается
+	if _, err := file.Write([]byte("\n")); err != nil {
+		log.Printf("Journal %s not finished: %v", path, err)
+		file.Close()
+		return
+	}
+	journal := &testJournal{file: file}
+	journal.finish(test, result)
+	log.Printf("Test %s recovered from journal: %d working, %d failed, %d not checked",
+		test.ID, result.Successful, result.Failed, countReason(result.SkippedProxies, interruptedReason))
+}
+
+func countReason(skipped []SkippedProxy, reason string) int {
+	n := 0
+	for _, proxy := range skipped {
+		for _, r := range proxy.Reasons {
+			if r == reason {
+				n++
+			}
+		}
+	}
+	return n
+}
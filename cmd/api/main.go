@@ -3,29 +3,42 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
-	"strconv"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"text/template"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/errgroup"
+
+	"projectx/parser"
+	"projectx/proxytestlib/importer"
+	"projectx/proxytestlib/models"
+	"projectx/proxytestlib/reputation"
+	"projectx/proxytestlib/rewriter"
 )
 
 // Test представляет информацию о тесте
 type Test struct {
 	ID          string
 	Name        string
-	Status      string // pending, running, completed, failed
+	Status      string // pending, running, completed, failed, interrupted, cancelled
+	Namespace   string // Пространство имён для учёта ресурсов и квот
 	ProxyCount  int
 	StartedAt   time.Time
 	CompletedAt time.Time
+	Checksum    string // SHA-256 набора конфигов и параметров, по нему находятся повторные тесты
+	Error       string // Почему тест не завершился, если Status - failed
 }
 
 // TestResult представляет результаты теста
@@ -34,9 +47,26 @@ type TestResult struct {
 	TotalProxies   int
 	Successful     int
 	Failed         int
+	Skipped        int
 	SuccessRate    float64
 	AverageLatency string
+	Reference      string // Эталон, относительно которого считается LatencyDelta
+	AverageDelta   string
+	Duplicates     int // Пропущено дубликатов, входят в Skipped
+	Elapsed        string
+	Budget         string        // Бюджет времени теста, пусто - без ограничения
+	BudgetUsage    float64       // Доля бюджета, потраченная тестом, в процентах
+	BudgetSkipped  int           // Не проверено из-за исчерпания бюджета, входят в Skipped
+	Dead           int           // Отсеяно предварительной проверкой TCP, входят в Failed
+	AverageSpeed   float64       // Средняя скорость загрузки рабочих прокси, МБ/с
+	Usage          ResourceUsage // Потраченные тестом ресурсы
+	Sample         *SampleReport // Оценка по выборке, если проверялась только выборка
 	WorkingProxies []ProxyInfo
+	SkippedProxies []SkippedProxy
+	FailedProxies  []FailedProxy
+	Vantages       []VantagePoint  // Замеры из других точек, например из браузера пользователя
+	External       []ExternalCheck // Исходы внешних инструментов, присланные в POST /results/{id}/external
+	Recovered      bool            // Собран из журнала после аварийного завершения теста
 }
 
 // ProxyInfo представляет информацию о прокси
@@ -47,34 +77,135 @@ type ProxyInfo struct {
 	Port     int
 	Latency  string
 	Rank     int
+	Link     string // Ссылка после применения правил перезаписи
+	Country  string // ISO-код страны: из флага в имени или по GeoIP сервера
+
+	ReferenceLatency string // Задержка эталона, измеренная сразу после этого прокси
+	LatencyDelta     string // Latency минус ReferenceLatency
+
+	Ping      string // RTT до сервера без туннеля
+	PingProbe string // Чем измерен Ping: icmp, tcp или simulated
+
+	Content *ContentReport // Доступность часто блокируемых сайтов через прокси
+	Tags    []string       // Теги из объекта конфига и параметра tags ссылки
+
+	Throughput  float64 // Скорость загрузки через прокси, МБ/с
+	Downloaded  int64   // Загружено байт при замере скорости
+	SpeedCapped bool    // Замер притормаживал SPEED_BANDWIDTH_LIMIT, Throughput - нижняя оценка
+
+	Probes  *ProbeStats   // Задержки серии проверочных запросов, если задано probes
+	Samples []string      // Задержки одновременных запросов, медиана которых стала Latency, если latency_mode=median
+	Timings *CheckTimings // Этапы проверочного запроса: соединение, TTFB, весь запрос
+
+	Unlock []UnlockOutcome // Доступность Netflix, YouTube Premium и ChatGPT, если задано unlock_check
+	Exit   *ExitInfo       // Выходной IP и его страна, город и ASN, если задано exit_ip
+
+	Reputation *reputation.Score // Оценка риска выходного IP, если задано reputation
+	DNSLeak    *DNSLeakReport    // Резолверы DNS прокси и признак утечки, если задано dns_leak
+	UDP        *UDPReport        // Проходит ли через прокси UDP, если задано udp_check
+
+	Certificate *CertReport // Сертификат сервера TLS и REALITY, если задано cert_check
+	TLS         *TLSReport  // Согласованные версия TLS и шифр, если задано tls_check
 }
 
 // VLESSConfig содержит параметры для VLESS прокси
 type VLESSConfig struct {
-	UUID        string
-	Address     string
-	Port        int
-	Flow        string
-	Encryption  string
-	Network     string
-	TLS         bool
-	SNI         string
-	Fingerprint string
-	Path        string
-	ServiceName string // Для gRPC
-	Mode        string // Для gRPC (multi или gun)
-	Host        string // Для WebSocket
-	Type        string // Для WebSocket (none, http, ws)
-	Headers     map[string]string
-	Fragment    string // Исходный фрагмент URL
+	UUID          string
+	Address       string
+	Port          int
+	Flow          string
+	Encryption    string
+	Network       string
+	TLS           bool
+	SNI           string
+	Fingerprint   string
+	AllowInsecure bool
+	Reality       bool
+	PublicKey     string // Для REALITY (pbk)
+	ShortID       string // Для REALITY (sid)
+	SpiderX       string // Для REALITY (spx)
+	Path          string
+	ServiceName   string // Для gRPC
+	Mode          string // Для gRPC (multi или gun) и XHTTP (auto, packet-up, stream-up, stream-one)
+	Host          string // Для WebSocket и XHTTP
+	Type          string // Для WebSocket (none, http, ws)
+	Seed          string // Для mKCP
+	HeaderType    string // Для mKCP (none, srtp, utp, wechat-video, dtls, wireguard)
+	Headers       map[string]string
+	Fragment      string   // Исходный фрагмент URL
+	Inferred      []string // Значения, подставленные по умолчанию, например порт
 }
 
 // TestRequest определяет структуру для входящих запросов на тест
 type TestRequest struct {
-	Name       string            `json:"name"`
-	ProxyCount int               `json:"proxy_count"`
-	Timeout    int               `json:"timeout"`
-	Configs    []json.RawMessage `json:"configs"`
+	Name           string            `json:"name"`
+	ProxyCount     int               `json:"proxy_count"`
+	Timeout        int               `json:"timeout"`
+	Configs        []json.RawMessage `json:"configs"`
+	URIs           string            `json:"uris"`          // Ссылки по одной на строку
+	RewriteRules   json.RawMessage   `json:"rewrite_rules"` // Применяются после правил из REWRITE_RULES
+	SkipGarbage    bool              `json:"skip_garbage"`  // Не проверять ноды, отмеченные эвристиками
+	Reference      string            `json:"reference"`     // "direct" или ссылка на эталонный прокси
+	Clash          string            `json:"clash"`         // Конфиг или provider-файл Clash в YAML, секция proxies
+	SingBox        json.RawMessage   `json:"singbox"`       // Конфиг sing-box, массив outbounds
+	Subscription   string            `json:"subscription_url"`
+	ConfigFile     string            `json:"config_file"`        // http(s)-адрес или путь в API_CONFIG_DIR
+	ConfigChecksum string            `json:"config_file_sha256"` // Ожидаемый SHA-256 файла конфигов
+	Ping           bool              `json:"ping"`               // Измерить ping до сервера каждого рабочего прокси
+	KeepDuplicates bool              `json:"keep_duplicates"`    // Не схлопывать дубликаты нод
+	Budget         int               `json:"budget"`             // Общее время теста в секундах, 0 - без ограничения
+	Sample         *SampleRequest    `json:"sample"`             // Проверить только выборку из списка
+	ContentCheck   bool              `json:"content_check"`      // Проверить доступность часто блокируемых сайтов
+	ContentTargets []ContentTarget   `json:"content_targets"`    // Свои адреса вместо CONTENT_TARGETS
+	UnlockCheck    bool              `json:"unlock_check"`       // Проверить доступность стриминга и ChatGPT через прокси
+	ExitIP         bool              `json:"exit_ip"`            // Узнать выходной IP прокси и его расположение по GeoIP
+	Reputation     bool              `json:"reputation"`         // Оценить риск выходного IP у провайдеров репутации
+	DNSLeak        bool              `json:"dns_leak"`           // Проверить, какие резолверы DNS видят запросы через прокси
+	UDPCheck       bool              `json:"udp_check"`          // Проверить UDP запросом DNS через SOCKS5 UDP ASSOCIATE
+	CertCheck      bool              `json:"cert_check"`         // Осмотреть сертификат серверов TLS и REALITY
+	Preflight      bool              `json:"preflight"`          // Отсеять серверы, не принимающие TCP-соединения, до запуска Xray
+	TLSCheck       bool              `json:"tls_check"`          // Проверить, не согласуют ли серверы TLS и REALITY ослабленную защиту
+	CheckURL       string            `json:"check_url"`          // Адрес проверочного запроса вместо CHECK_URLS
+	ExpectStatus   string            `json:"expect_status"`      // Коды ответа, при которых прокси рабочий: "204", "200-299,301"
+	ExpectBody     string            `json:"expect_body"`        // Подстрока, которая должна быть в теле ответа
+	UserAgent      string            `json:"user_agent"`         // User-Agent проверочного запроса вместо клиента Go
+	CheckHeaders   map[string]string `json:"check_headers"`      // Дополнительные заголовки проверочного запроса
+	IncludeTags    []string          `json:"include_tags"`       // Проверять только конфиги хотя бы с одним из тегов
+	Namespace      string            `json:"namespace"`          // Пространство имён для учёта ресурсов, по умолчанию default
+	ExcludeTags    []string          `json:"exclude_tags"`       // Не проверять конфиги с любым из тегов
+	Speed          bool              `json:"speed"`              // Замерить скорость загрузки через каждый рабочий прокси
+	SpeedSize      int               `json:"speed_size"`         // Размер загрузки в байтах вместо SPEED_TEST_SIZE
+	SpeedTimeout   int               `json:"speed_timeout"`      // Ограничение времени замера в секундах вместо SPEED_TEST_TIMEOUT
+	Probes         int               `json:"probes"`             // Проверочных запросов на рабочий прокси для оценки джиттера и потерь
+	LatencyMode    string            `json:"latency_mode"`       // single или median - медиана трёх одновременных запросов
+	UseCache       bool              `json:"use_cache"`          // Вернуть свежий результат теста с тем же набором вместо нового запуска
+}
+
+// testOptions - параметры запуска теста помимо списка конфигов
+type testOptions struct {
+	rules          []rewriter.Rule
+	skipGarbage    bool
+	reference      string
+	ping           bool
+	keepDuplicates bool
+	budget         time.Duration
+	sample         *samplePlan
+	contentTargets []ContentTarget // nil - без проверки фильтрации
+	unlock         bool            // Проверить доступность стриминга и ChatGPT
+	exitIP         bool            // Узнать выходной IP и его расположение
+	reputation     bool            // Оценить риск выходного IP, включает exitIP
+	dnsLeak        bool            // Проверить утечку DNS
+	udp            bool            // Проверить UDP через прокси
+	certCheck      bool            // Осмотреть сертификат сервера
+	preflight      bool            // Проверить TCP-соединение с сервером до запуска Xray
+	tlsCheck       bool            // Проверить согласованные версию TLS и шифр
+	check          *checkSpec      // Адреса проверочного запроса и ожидаемый ответ
+	speed          *speedTest      // nil - без замера скорости
+	probes         int             // Проверочных запросов на прокси, 0 и 1 - один
+	medianLatency  bool            // Задержка - медиана одновременных запросов
+	namespace      string
+	subscription   string // Подписка, запустившая тест
+	checksum       string // Контрольная сумма набора, пусто - тест не кешируется
 }
 
 // In-memory хранилище для демонстрации
@@ -85,7 +216,22 @@ var (
 )
 
 func main() {
+	r := newRouter()
+
+	backendStatus()
+	recoverJournals()
+	startJanitor()
+	startPoolScheduler()
+	startSubscriptionScheduler()
+
+	log.Println("🚀 Proxy Test API server starting on :8080")
+	log.Fatal(r.Run(":8080"))
+}
+
+// newRouter собирает обработчики API без фоновых задач сервера
+func newRouter() *gin.Engine {
 	r := gin.Default()
+	configureTrustedProxies(r)
 
 	// Middleware
 	r.Use(gin.Logger())
@@ -93,12 +239,19 @@ func main() {
 	r.Use(CORSMiddleware())
 
 	// Health check
+	// Без Xray сервис работает, но проверяет только socks и http
 	r.GET("/health", func(c *gin.Context) {
+		backend := backendStatus()
+		status := "healthy"
+		if !backend.Available {
+			status = "degraded"
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"status":    "healthy",
-			"timestamp": time.Now().Unix(),
-			"version":   "1.1.0", // Incremented version
+			"status":    status,
+			"timestamp": now().Unix(),
+			"version":   version,
 			"service":   "proxy-test-api",
+			"backend":   backend,
 		})
 	})
 
@@ -108,18 +261,34 @@ func main() {
 		api.GET("/status", getStatus)
 		api.POST("/tests", startTest)
 		api.GET("/tests/:id", getTestStatus)
+		registerBatchRoutes(api)
 		api.GET("/results/:id", getResults)
+		api.GET("/results/:id/failed-report", failedReport)
+		registerExportRoutes(api)
+		registerPoolRoutes(api)
+		registerPruneRoutes(api)
+		registerSubscriptionRoutes(api)
+		registerControllerRoutes(api)
+		registerApplyRoutes(api)
+		registerHistoryRoutes(api)
+		registerABTestRoutes(api)
+		registerBrowserRoutes(api)
+		registerExternalRoutes(api)
+		registerDebugRoutes(api)
+		registerUsageRoutes(api)
 	}
 
-	log.Println("🚀 Proxy Test API server starting on :8080")
-	log.Fatal(r.Run(":8080"))
+	registerStatusPageRoutes(r)
+
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	return r
 }
 
 // CORSMiddleware добавляет CORS заголовки
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Header("Access-control-Allow-Headers", "Content-Type, Authorization")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -131,31 +300,151 @@ func CORSMiddleware() gin.HandlerFunc {
 
 // getStatus возвращает статус системы
 func getStatus(c *gin.Context) {
+	backend := backendStatus()
+
 	mu.Lock()
 	defer mu.Unlock()
 	c.JSON(http.StatusOK, gin.H{
 		"system":        "proxy-test-api",
+		"backend":       backend.Name,
+		"backend_ready": backend.Available,
 		"status":        "running",
 		"active_tests":  len(tests),
 		"total_results": len(results),
-		"timestamp":     time.Now().Format(time.RFC3339),
+		"timestamp":     now().Format(time.RFC3339),
 	})
 }
 
 // startTest запускает новый тест
 func startTest(c *gin.Context) {
-	var request TestRequest
-
-	if err := c.BindJSON(&request); err != nil {
+	request, err := bindTestRequest(c)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
 		return
 	}
 
+	if request.Namespace == "" {
+		request.Namespace = defaultNamespace
+	}
+	if !namespacePattern.MatchString(request.Namespace) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid namespace", "details": "use up to 64 letters, digits, '.', '_' or '-'"})
+		return
+	}
+	if err := usageMeter.checkQuota(request.Namespace); err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Quota exceeded", "details": err.Error()})
+		return
+	}
+
+	if request.URIs != "" {
+		request.Configs = appendLinks(request.Configs, uriLines(request.URIs))
+	}
+
+	if request.Clash != "" {
+		links, err := importer.ClashLinks([]byte(request.Clash))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid clash config", "details": err.Error()})
+			return
+		}
+		request.Configs = appendLinks(request.Configs, links)
+	}
+
+	if request.Subscription != "" {
+		links, err := fetchSubscription(request.Subscription)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to load subscription", "details": err.Error()})
+			return
+		}
+		request.Configs = appendLinks(request.Configs, links)
+	}
+
+	if request.ConfigFile != "" {
+		configs, err := loadConfigFile(request.ConfigFile, request.ConfigChecksum)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to load config file", "details": err.Error()})
+			return
+		}
+		request.Configs = append(request.Configs, configs...)
+	}
+
+	if len(request.SingBox) > 0 {
+		links, err := importer.SingBoxLinks(request.SingBox)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid singbox config", "details": err.Error()})
+			return
+		}
+		request.Configs = appendLinks(request.Configs, links)
+	}
+
 	if len(request.Configs) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "configs array cannot be empty"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "configs array cannot be empty", "details": "pass links in configs, uris or an uploaded file"})
+		return
+	}
+
+	if len(request.IncludeTags) > 0 || len(request.ExcludeTags) > 0 {
+		request.Configs = filterByTags(request.Configs, request.IncludeTags, request.ExcludeTags)
+		if len(request.Configs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No configs match the tag filters", "details": "check include_tags and exclude_tags"})
+			return
+		}
+	}
+
+	rules := rewriteRules
+	if len(request.RewriteRules) > 0 {
+		requestRules, err := rewriter.ParseRules(request.RewriteRules)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rewrite_rules", "details": err.Error()})
+			return
+		}
+		rules = append(append([]rewriter.Rule{}, rules...), requestRules...)
+	}
+
+	if err := validateReference(request.Reference); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reference", "details": err.Error()})
 		return
 	}
 
+	var targets []ContentTarget
+	if len(request.ContentTargets) > 0 {
+		if err := validateContentTargets(request.ContentTargets); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid content_targets", "details": err.Error()})
+			return
+		}
+		targets = request.ContentTargets
+	} else if request.ContentCheck {
+		targets = contentTargets
+	}
+
+	speed, err := speedTestFor(request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid speed test", "details": err.Error()})
+		return
+	}
+
+	if err := validateProbes(request.Probes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid probes", "details": err.Error()})
+		return
+	}
+	if err := validateLatencyMode(request.LatencyMode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid latency_mode", "details": err.Error()})
+		return
+	}
+
+	check, err := newCheckSpec(request.CheckURL, request.ExpectStatus, request.ExpectBody, request.UserAgent, request.CheckHeaders)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid check", "details": err.Error()})
+		return
+	}
+
+	var plan *samplePlan
+	if request.Sample != nil {
+		if err := request.Sample.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sample", "details": err.Error()})
+			return
+		}
+		request.Configs, plan = sampleConfigs(request.Configs, *request.Sample)
+		request.ProxyCount = len(request.Configs)
+	}
+
 	if request.ProxyCount <= 0 || request.ProxyCount > len(request.Configs) {
 		request.ProxyCount = len(request.Configs)
 	}
@@ -164,27 +453,106 @@ func startTest(c *gin.Context) {
 		request.Timeout = 30 // default timeout
 	}
 
-	testID := generateTestID()
+	if request.Budget < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid budget", "details": "budget must be a number of seconds, 0 for no limit"})
+		return
+	}
+
+	if request.Reputation && reputationChecker == nil && simulation == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "IP reputation is not configured", "details": "set REPUTATION_PROVIDERS to ipqualityscore, abuseipdb or list"})
+		return
+	}
+
+	opts := testOptions{
+		rules:          rules,
+		skipGarbage:    request.SkipGarbage,
+		reference:      request.Reference,
+		ping:           request.Ping,
+		keepDuplicates: request.KeepDuplicates,
+		budget:         time.Duration(request.Budget) * time.Second,
+		sample:         plan,
+		contentTargets: targets,
+		unlock:         request.UnlockCheck,
+		exitIP:         request.ExitIP || request.Reputation,
+		reputation:     request.Reputation,
+		dnsLeak:        request.DNSLeak,
+		udp:            request.UDPCheck,
+		certCheck:      request.CertCheck,
+		preflight:      request.Preflight,
+		tlsCheck:       request.TLSCheck,
+		check:          check,
+		speed:          speed,
+		probes:         request.Probes,
+		medianLatency:  request.LatencyMode == latencyModeMedian,
+		namespace:      request.Namespace,
+	}
+	opts.checksum = testChecksum(request.Configs, request.ProxyCount, request.Timeout, opts)
+
+	// Тот же набор недавно проверялся: по use_cache отдаём его результат,
+	// иначе запускаем тест и сообщаем о готовом результате в поле cached
+	cached := cachedResult(opts.checksum)
+	if cached != nil && request.UseCache {
+		c.JSON(http.StatusOK, gin.H{
+			"test_id":    cached.TestID,
+			"status":     "cached",
+			"message":    "Identical config set was checked recently, returning its result",
+			"started_at": cached.startedAt.Format(time.RFC3339),
+			"cached":     cached,
+		})
+		return
+	}
+
+	test := launchTest(request.Name, request.Configs, request.ProxyCount, request.Timeout, opts)
+
+	response := gin.H{
+		"test_id":    test.ID,
+		"status":     "started",
+		"message":    "Test started successfully",
+		"started_at": test.StartedAt.Format(time.RFC3339),
+	}
+	if cached != nil {
+		response["cached"] = cached
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// launchTest регистрирует тест и запускает его в фоне
+func launchTest(name string, configs []json.RawMessage, proxyCount, timeout int, opts testOptions) *Test {
+	if opts.namespace == "" {
+		opts.namespace = defaultNamespace
+	}
 	test := &Test{
-		ID:         testID,
-		Name:       request.Name,
+		Name:       name,
 		Status:     "running",
-		ProxyCount: request.ProxyCount,
-		StartedAt:  time.Now(),
+		Namespace:  opts.namespace,
+		ProxyCount: proxyCount,
+		StartedAt:  now(),
+		Checksum:   opts.checksum,
 	}
 
 	mu.Lock()
-	tests[testID] = test
+	// Тесты, запущенные в одну секунду (например, планировщиком), получают суффикс
+	base := generateTestID()
+	test.ID = base
+	for n := 2; tests[test.ID] != nil; n++ {
+		test.ID = fmt.Sprintf("%s_%d", base, n)
+	}
+	tests[test.ID] = test
+	launches[test.ID] = testLaunch{name: name, configs: configs, proxyCount: proxyCount, timeout: timeout, opts: opts}
 	mu.Unlock()
+	usageMeter.begin(test.ID, opts.namespace)
 
-	go runTest(testID, request.Configs, request.ProxyCount, request.Timeout)
+	go runTest(test.ID, configs, proxyCount, timeout, opts)
+	return test
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"test_id":    testID,
-		"status":     "started",
-		"message":    "Test started successfully",
-		"started_at": test.StartedAt.Format(time.RFC3339),
-	})
+// appendLinks добавляет ссылки, полученные из подписки или импорта, к конфигам запроса
+func appendLinks(configs []json.RawMessage, links []string) []json.RawMessage {
+	for _, link := range links {
+		encoded, _ := json.Marshal(link)
+		configs = append(configs, encoded)
+	}
+	return configs
 }
 
 // getTestStatus возвращает статус теста
@@ -197,7 +565,10 @@ func getTestStatus(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found", "test_id": testID})
 		return
 	}
-	c.JSON(http.StatusOK, test)
+	c.JSON(http.StatusOK, struct {
+		Test
+		StatusLabel string // Status на языке из Accept-Language
+	}{*test, translate(requestLanguage(c), "status."+test.Status)})
 }
 
 // getResults возвращает результаты теста
@@ -210,80 +581,366 @@ func getResults(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Results not found", "test_id": testID})
 		return
 	}
-	c.JSON(http.StatusOK, result)
+	localized := *result
+	localized.FailedProxies = localizeFailures(requestLanguage(c), result.FailedProxies)
+	c.JSON(http.StatusOK, localized)
 }
 
 // runTest запускает тест
-func runTest(testID string, configs []json.RawMessage, proxyCount int, timeout int) {
+func runTest(testID string, configs []json.RawMessage, proxyCount int, timeout int, opts testOptions) {
 	log.Printf("Starting test %s with %d proxies", testID, proxyCount)
+	start := time.Now()
+	budget := newTestBudget(start, opts.budget)
+
+	// Паника вне проверок отдельных прокси не должна оставлять тест в running
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Test %s panicked: %v\n%s", testID, r, debug.Stack())
+			failTest(testID, fmt.Errorf("internal error: %v", r), time.Since(start))
+		}
+	}()
 
 	var (
 		workingProxies []ProxyInfo
+		skippedProxies []SkippedProxy
+		failedProxies  []FailedProxy
 		successful     int
-		failed         int
+		skipped        int
+		duplicates     int
+		budgetSkipped  int
+		dead           int
 		totalLatency   time.Duration
-		wg             sync.WaitGroup
-		proxyResults   = make(chan ProxyInfo, len(configs))
-		muResults      sync.Mutex
+		totalDelta     time.Duration
+		deltas         int
+		totalSpeed     float64
+		speeds         int
 	)
 
-	for i, rawConfig := range configs {
-		if i >= proxyCount {
-			break
+	if proxyCount < len(configs) {
+		configs = configs[:proxyCount]
+	}
+
+	// Пустая строка - конфиг, который не удалось разобрать
+	links := make([]string, len(configs))
+	tags := make([][]string, len(configs))
+	for i, config := range configs {
+		var err error
+		if links[i], tags[i], err = configEntry(config); err != nil {
+			log.Printf("Error unmarshaling config for test %s: %v", testID, err)
+			links[i] = ""
+			continue
+		}
+		if rewritten, changed, err := rewriter.Apply(links[i], opts.rules); err != nil {
+			log.Printf("Proxy %d: rewrite rules not applied: %v", i+1, err)
+		} else if changed {
+			links[i] = rewritten
+		}
+	}
+
+	var dups map[int]string
+	if !opts.keepDuplicates {
+		dups = findDuplicates(links)
+	}
+
+	// Дубликаты не прогоняются через эвристики, чтобы не отмечать их дважды
+	unique := make([]string, len(links))
+	for i, link := range links {
+		if _, dup := dups[i]; !dup {
+			unique[i] = link
+		}
+	}
+	flagged := flagGarbage(unique)
+
+	journal := openJournal(testID, links)
+
+	// Каждая проверка пишет исход только в ячейку своей ссылки, а итоги
+	// считаются после завершения всех проверок в порядке ссылок, поэтому
+	// результат не зависит от того, какая проверка закончилась первой
+	outcomes := make([]proxyOutcome, len(links))
+	skip := func(index int, reasons ...string) {
+		skippedProxy := SkippedProxy{Name: rewriter.LinkName(links[index]), Link: links[index], Reasons: reasons, index: index}
+		journal.skipped(skippedProxy)
+		outcomes[index].skipped = &skippedProxy
+	}
+
+	// checkProxy проверяет одну ссылку и записывает исход в outcomes[index]
+	checkProxy := func(index int, proxyURL string) {
+		link, err := parseProxyLink(proxyURL)
+		if err != nil {
+			log.Printf("Proxy %d (%s) rejected: %v", index+1, proxyURL, err)
+			if link.Name == "" {
+				link.Name = rewriter.LinkName(proxyURL)
+			}
+			failure := newFailedProxy(link, proxyURL, err)
+			journal.failed(index, &failure)
+			outcomes[index].failed = &failure
+			return
+		}
+
+		skipForCancel := func() {
+			skippedProxy := SkippedProxy{Name: link.Name, Link: proxyURL, Reasons: []string{cancelledReason}, index: index}
+			journal.skipped(skippedProxy)
+			outcomes[index].skipped = &skippedProxy
+		}
+		if testCancelled(testID) {
+			skipForCancel()
+			return
+		}
+
+		skipForBudget := func() {
+			log.Printf("Proxy %d (%s) %s", index+1, proxyURL, budgetSkipReason)
+			skippedProxy := SkippedProxy{Name: link.Name, Link: proxyURL, Reasons: []string{budgetSkipReason}, index: index}
+			journal.skipped(skippedProxy)
+			outcomes[index].skipped = &skippedProxy
+			outcomes[index].budgetSkipped = true
 		}
-		wg.Add(1)
-		go func(index int, config json.RawMessage) {
-			defer wg.Done()
 
-			var proxyURL string
-			if err := json.Unmarshal(config, &proxyURL); err != nil {
-				log.Printf("Error unmarshaling config for test %s: %v", testID, err)
-				muResults.Lock()
-				failed++
-				muResults.Unlock()
+		checkTimeout, truncated, ok := budget.timeout(time.Duration(timeout) * time.Second)
+		if !ok {
+			skipForBudget()
+			return
+		}
+
+		// Мёртвый сервер отсеивается одним TCP-соединением, без запуска Xray
+		if opts.preflight {
+			if err := preflight(proxyURL, min(preflightTimeout, checkTimeout)); err != nil {
+				log.Printf("Proxy %d (%s) failed pre-flight: %v", index+1, proxyURL, err)
+				failure := newFailedProxy(link, proxyURL, err)
+				journal.failed(index, &failure)
+				outcomes[index] = proxyOutcome{failed: &failure, dead: true}
 				return
 			}
+		}
 
-			vlessConfig, err := ParseVLESSConfig(proxyURL)
-			if err != nil {
-				log.Printf("Proxy %d (%s) failed to parse: %v", index+1, proxyURL, err)
-				muResults.Lock()
-				failed++
-				muResults.Unlock()
+		// Замеры задержки идут первыми, пока на них не влияют другие проверки
+		var (
+			checks        []tunnelCheck
+			samples       []time.Duration
+			probeLatency  []time.Duration
+			probeFailures int
+		)
+		if opts.medianLatency {
+			checks = append(checks, func(proxy *url.URL) {
+				samples = sampleLatency(proxyURL, proxy, opts.check, checkTimeout, usageMeter.test(testID))
+			})
+		}
+		if opts.probes > 1 {
+			checks = append(checks, func(proxy *url.URL) {
+				probeLatency, probeFailures = sendProbes(proxyURL, proxy, opts.check, opts.probes-1, checkTimeout, usageMeter.test(testID))
+			})
+		}
+		if opts.contentTargets != nil {
+			checks = append(checks, func(proxy *url.URL) {
+				link.Content = checkContent(proxyURL, proxy, opts.contentTargets, checkTimeout, usageMeter.test(testID))
+			})
+		}
+		if opts.exitIP {
+			checks = append(checks, func(proxy *url.URL) {
+				exit, err := checkExit(proxyURL, proxy, checkTimeout, usageMeter.test(testID))
+				if err != nil {
+					log.Printf("Proxy %d: exit IP check failed: %v", index+1, err)
+					return
+				}
+				detectRelay(proxyURL, link.Server, exit, min(5*time.Second, checkTimeout))
+				link.Exit = exit
+			})
+		}
+		if opts.udp {
+			checks = append(checks, func(proxy *url.URL) {
+				link.UDP = checkUDP(proxyURL, proxy, checkTimeout, usageMeter.test(testID))
+			})
+		}
+		if opts.dnsLeak {
+			checks = append(checks, func(proxy *url.URL) {
+				report, err := checkDNSLeak(proxyURL, proxy, checkTimeout, usageMeter.test(testID))
+				if err != nil {
+					log.Printf("Proxy %d: DNS leak check failed: %v", index+1, err)
+					return
+				}
+				link.DNSLeak = report
+			})
+		}
+		if opts.unlock {
+			checks = append(checks, func(proxy *url.URL) {
+				link.Unlock = checkUnlock(proxyURL, proxy, checkTimeout, usageMeter.test(testID))
+			})
+		}
+		if opts.speed != nil {
+			checks = append(checks, func(proxy *url.URL) {
+				speed := *opts.speed
+				if speed.timeout > checkTimeout {
+					speed.timeout = checkTimeout
+				}
+				result, err := measureSpeed(proxyURL, proxy, speed, usageMeter.test(testID))
+				if err != nil {
+					log.Printf("Proxy %d: speed test failed: %v", index+1, err)
+					return
+				}
+				link.Throughput, link.Downloaded, link.SpeedCapped = result.rate, result.downloaded, result.capped
+			})
+		}
+
+		timings, err := traceProxy(testID, proxyURL, opts.check, checkTimeout, checks...)
+		latency := timings.latency
+		if err != nil {
+			// Проверка, оборванная концом бюджета, - не отказ прокси
+			if truncated && budget.exhausted() {
+				skipForBudget()
 				return
 			}
+			// Отмена убивает процессы Xray, и оборванная проверка - тоже не отказ
+			if testCancelled(testID) {
+				skipForCancel()
+				return
+			}
+			log.Printf("Proxy %d (%s) failed: %v", index+1, proxyURL, err)
+			failure := newFailedProxy(link, proxyURL, err)
+			// Сертификат часто объясняет отказ точнее ошибки Xray
+			if extraTimeout, _, ok := budget.timeout(time.Duration(timeout) * time.Second); ok && (opts.certCheck || opts.tlsCheck) {
+				handshake := inspectHandshake(proxyURL, extraTimeout)
+				if opts.certCheck {
+					failure.Certificate = handshake.certificate()
+					failure.Category = certFailureCategory(failure.Category, proxyURL, failure.Certificate)
+				}
+				if opts.tlsCheck {
+					failure.TLS = handshake.protection(proxyURL)
+				}
+			}
+			journal.failed(index, &failure)
+			outcomes[index].failed = &failure
+			return
+		}
+
+		if opts.probes > 1 {
+			link.Probes = probeStats(append([]time.Duration{latency}, probeLatency...), probeFailures)
+		}
+		// Если все одновременные запросы не удались, остаётся задержка основной проверки
+		if len(samples) > 0 {
+			latency = medianLatency(samples)
+			for _, sample := range samples {
+				link.Samples = append(link.Samples, sample.String())
+			}
+		}
 
-			latency, err := testProxy(proxyURL, time.Duration(timeout)*time.Second)
+		log.Printf("Proxy %d (%s) successful, latency: %s", index+1, proxyURL, latency)
+		link.Latency = latency.String()
+		link.Rank = index + 1
+		link.Link = proxyURL
+		link.Country = proxyCountry(link)
+		link.Tags = tags[index]
+		link.Timings = timings.report()
+
+		outcome := proxyOutcome{working: &link, latency: latency}
+		if extraTimeout, _, ok := budget.timeout(time.Duration(timeout) * time.Second); ok && opts.reference != "" {
+			referenceLatency, err := measureReference(testID, opts.reference, opts.check, extraTimeout)
 			if err != nil {
-				log.Printf("Proxy %d (%s) failed: %v", index+1, proxyURL, err)
-				muResults.Lock()
-				failed++
-				muResults.Unlock()
-				return
+				log.Printf("Proxy %d: reference measurement failed: %v", index+1, err)
+			} else {
+				delta := latency - referenceLatency
+				outcome.delta = &delta
+				link.ReferenceLatency = referenceLatency.String()
+				link.LatencyDelta = delta.String()
 			}
+		}
 
-			log.Printf("Proxy %d (%s) successful, latency: %s", index+1, proxyURL, latency)
-			proxyInfo := ProxyInfo{
-				Name:     vlessConfig.Fragment,
-				Protocol: "vless",
-				Server:   vlessConfig.Address,
-				Port:     vlessConfig.Port,
-				Latency:  latency.String(),
-				Rank:     index + 1,
+		// Репутация запрашивается у провайдеров напрямую, туннель уже не нужен
+		if extraTimeout, _, ok := budget.timeout(time.Duration(timeout) * time.Second); ok && opts.reputation && link.Exit != nil {
+			score, err := checkReputation(proxyURL, link.Exit, extraTimeout)
+			if err != nil {
+				log.Printf("Proxy %d: reputation lookup failed: %v", index+1, err)
+			} else {
+				link.Reputation = score
 			}
-			proxyResults <- proxyInfo
-			muResults.Lock()
-			successful++
-			totalLatency += latency
-			muResults.Unlock()
-		}(i, rawConfig)
+		}
+
+		if extraTimeout, _, ok := budget.timeout(time.Duration(timeout) * time.Second); ok && opts.ping {
+			rtt, probeType, err := measurePing(link, proxyURL, extraTimeout)
+			link.PingProbe = probeType
+			if err != nil {
+				log.Printf("Proxy %d: ping failed: %v", index+1, err)
+			} else {
+				link.Ping = rtt.String()
+			}
+		}
+
+		// Одно рукопожатие показывает и сертификат, и согласованную защиту
+		if extraTimeout, _, ok := budget.timeout(time.Duration(timeout) * time.Second); ok && (opts.certCheck || opts.tlsCheck) {
+			handshake := inspectHandshake(proxyURL, extraTimeout)
+			if opts.certCheck {
+				link.Certificate = handshake.certificate()
+			}
+			if opts.tlsCheck {
+				link.TLS = handshake.protection(proxyURL)
+			}
+		}
+
+		journal.working(index, link)
+		outcomes[index] = outcome
 	}
 
-	wg.Wait()
-	close(proxyResults)
+	workers := new(errgroup.Group)
+	workers.SetLimit(testWorkers)
+	for i, proxyURL := range links {
+		// Пустая строка - конфиг, который не удалось разобрать: отказ без записи
+		if proxyURL == "" {
+			journal.failed(i, nil)
+			continue
+		}
+
+		if original, dup := dups[i]; dup {
+			skip(i, fmt.Sprintf("duplicate of %q", original))
+			duplicates++
+			continue
+		}
+
+		if reason := backendUnavailableReason(proxyURL); reason != "" {
+			skip(i, reason)
+			continue
+		}
+
+		if reasons := flagged[i]; len(reasons) > 0 {
+			log.Printf("Proxy %d (%s) looks like garbage: %s", i+1, proxyURL, strings.Join(reasons, "; "))
+			if opts.skipGarbage {
+				skip(i, reasons...)
+				continue
+			}
+		}
+
+		// Go блокируется, пока заняты все testWorkers проверок
+		workers.Go(func() error {
+			defer containProxyPanic(i, proxyURL, journal, &outcomes[i])
+			checkProxy(i, proxyURL)
+			return nil
+		})
+	}
+	workers.Wait()
 
-	for res := range proxyResults {
-		workingProxies = append(workingProxies, res)
+	for _, outcome := range outcomes {
+		switch {
+		case outcome.working != nil:
+			workingProxies = append(workingProxies, *outcome.working)
+			successful++
+			totalLatency += outcome.latency
+			if outcome.delta != nil {
+				totalDelta += *outcome.delta
+				deltas++
+			}
+			if outcome.working.Downloaded > 0 {
+				totalSpeed += outcome.working.Throughput
+				speeds++
+			}
+		case outcome.failed != nil:
+			failedProxies = append(failedProxies, *outcome.failed)
+			if outcome.dead {
+				dead++
+			}
+		case outcome.skipped != nil:
+			skippedProxies = append(skippedProxies, *outcome.skipped)
+			skipped++
+			if outcome.budgetSkipped {
+				budgetSkipped++
+			}
+		}
 	}
 
 	averageLatency := "N/A"
@@ -291,95 +948,308 @@ func runTest(testID string, configs []json.RawMessage, proxyCount int, timeout i
 		averageLatency = (totalLatency / time.Duration(successful)).String()
 	}
 
+	averageDelta := ""
+	if deltas > 0 {
+		averageDelta = (totalDelta / time.Duration(deltas)).String()
+	}
+
+	averageSpeed := 0.0
+	if speeds > 0 {
+		averageSpeed = math.Round(totalSpeed/float64(speeds)*100) / 100
+	}
+
 	successRate := 0.0
 	if proxyCount > 0 {
 		successRate = float64(successful) / float64(proxyCount) * 100
 	}
 
+	elapsed := time.Since(start).Round(time.Millisecond)
+	usage := usageMeter.finish(testID, elapsed)
+
+	var sample *SampleReport
+	if opts.sample != nil {
+		outcomes := make(map[int]bool, len(links))
+		for i := range links {
+			outcomes[i] = false
+		}
+		for _, proxy := range skippedProxies {
+			delete(outcomes, proxy.index)
+		}
+		for _, proxy := range workingProxies {
+			outcomes[proxy.Rank-1] = true
+		}
+		sample = opts.sample.report(outcomes)
+	}
+
 	mu.Lock()
 	results[testID] = &TestResult{
 		TestID:         testID,
 		TotalProxies:   proxyCount,
 		Successful:     successful,
-		Failed:         proxyCount - successful,
+		Failed:         proxyCount - successful - skipped,
+		Skipped:        skipped,
 		SuccessRate:    successRate,
 		AverageLatency: averageLatency,
+		Reference:      opts.reference,
+		AverageDelta:   averageDelta,
+		Duplicates:     duplicates,
+		Elapsed:        elapsed.String(),
+		BudgetSkipped:  budgetSkipped,
+		Dead:           dead,
+		AverageSpeed:   averageSpeed,
+		Sample:         sample,
+		Usage:          usage,
 		WorkingProxies: workingProxies,
+		SkippedProxies: skippedProxies,
+		FailedProxies:  failedProxies,
 	}
+	if opts.budget > 0 {
+		results[testID].Budget = opts.budget.String()
+		results[testID].BudgetUsage = budget.usage(elapsed)
+	}
+	var completed Test
 	if test, exists := tests[testID]; exists {
-		test.Status = "completed"
-		test.CompletedAt = time.Now()
+		if test.Status != "cancelled" {
+			test.Status = "completed"
+		}
+		test.CompletedAt = now()
+		completed = *test
 	}
+	result := *results[testID]
 	mu.Unlock()
+	journal.finish(&completed, &result)
+
+	if completed.Status == "cancelled" {
+		// Неполный результат не должен влиять на подписку и контроллеры
+		log.Printf("Test %s cancelled after %s. Successful: %d, Skipped: %d", testID, elapsed, successful, skipped)
+		recordHistory(testID, workingProxies, failedProxies)
+		return
+	}
+	log.Printf("Test %s completed in %s. Successful: %d, Failed: %d (dead: %d), Skipped: %d (duplicates: %d, budget: %d)", testID, elapsed, successful, proxyCount-successful-skipped, dead, skipped, duplicates, budgetSkipped)
+	recordHistory(testID, workingProxies, failedProxies)
+	recordSubscriptionStatus(opts.subscription, successful, proxyCount)
+	notifyControllers(pushSource{testID: testID, subscription: opts.subscription, namespace: opts.namespace}, workingProxies)
+}
+
+// testWorkers - сколько прокси одного теста проверяется одновременно
+var testWorkers = loadTestWorkers()
+
+func loadTestWorkers() int {
+	workers := envInt("TEST_WORKERS", 200)
+	if workers < 1 {
+		log.Printf("Invalid TEST_WORKERS=%d, using default 200", workers)
+		return 200
+	}
+	return workers
+}
+
+// proxyOutcome - исход проверки одной ссылки теста. Пустой исход - конфиг,
+// который не удалось разобрать
+type proxyOutcome struct {
+	working       *ProxyInfo
+	latency       time.Duration  // Задержка для AverageLatency
+	delta         *time.Duration // Разница с эталоном, nil - не измерялась
+	failed        *FailedProxy
+	dead          bool // Отказ дала предварительная проверка TCP
+	skipped       *SkippedProxy
+	budgetSkipped bool // Пропущен из-за исчерпания бюджета
+}
+
+// containProxyPanic превращает панику при проверке одного прокси в его
+// отказ. Без этого паника в любой горутине роняет весь процесс API, а тест
+// остаётся в статусе running. Вызывается через defer
+func containProxyPanic(index int, proxyURL string, journal *testJournal, outcome *proxyOutcome) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Printf("Proxy %d (%s) check panicked: %v\n%s", index+1, proxyURL, r, debug.Stack())
+	info, _ := parseProxyLink(proxyURL)
+	if info.Name == "" {
+		info.Name = rewriter.LinkName(proxyURL)
+	}
+	failure := newFailedProxy(info, proxyURL, fmt.Errorf("internal error: %v", r))
+	journal.failed(index, &failure)
+	*outcome = proxyOutcome{failed: &failure}
+}
 
-	log.Printf("Test %s completed. Successful: %d, Failed: %d", testID, successful, proxyCount-successful)
+// failTest отмечает тест, который не удалось довести до конца, статусом failed
+func failTest(testID string, err error, elapsed time.Duration) {
+	usageMeter.finish(testID, elapsed)
+	mu.Lock()
+	defer mu.Unlock()
+	if test, exists := tests[testID]; exists {
+		test.Status = "failed"
+		test.Error = err.Error()
+		test.CompletedAt = now()
+	}
 }
 
-// testProxy тестирует один прокси
-func testProxy(proxyURL string, timeout time.Duration) (time.Duration, error) {
-	xrayConfig, err := GenerateXrayConfig(proxyURL)
+// tunnelCheck - дополнительная проверка через прокси, которую нужно сделать,
+// пока туннель ещё поднят. proxy - адрес для HTTP-клиента, nil в симуляции
+type tunnelCheck func(proxy *url.URL)
+
+// testProxy тестирует один прокси и возвращает задержку. Проверки after
+// выполняются по очереди только после успешного проверочного запроса
+func testProxy(testID string, proxyURL string, spec *checkSpec, timeout time.Duration, after ...tunnelCheck) (time.Duration, error) {
+	timings, err := traceProxy(testID, proxyURL, spec, timeout, after...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to generate Xray config: %w", err)
+		return 0, err
 	}
+	return timings.latency, nil
+}
 
-	configFile, err := os.CreateTemp("", "xray-config-*.json")
+// traceProxy тестирует один прокси как testProxy, возвращая этапы
+// проверочного запроса
+func traceProxy(testID string, proxyURL string, spec *checkSpec, timeout time.Duration, after ...tunnelCheck) (checkTimings, error) {
+	if simulation != nil {
+		latency, err := simulation.testProxy(proxyURL, timeout)
+		if err != nil {
+			return checkTimings{}, err
+		}
+		runTunnelChecks(nil, after)
+		return simulation.timings(proxyURL, latency), nil
+	}
+	if isDirectProxy(proxyURL) {
+		return testDirectProxy(testID, proxyURL, spec, timeout, after...)
+	}
+
+	for attempt := 1; ; attempt++ {
+		port, err := resources.reservePort(testID)
+		if err != nil {
+			return checkTimings{}, fmt.Errorf("failed to reserve Xray inbound port: %w", err)
+		}
+		timings, err := traceThroughXray(testID, proxyURL, port, spec, timeout, after...)
+		resources.releasePort(port)
+		if !errors.Is(err, errPortConflict) || attempt == portConflictRetries {
+			return timings, err
+		}
+		log.Printf("Xray inbound port %d was taken before Xray opened it, retrying on another port", port)
+	}
+}
+
+// traceThroughXray поднимает Xray с inbound на порту port и проверяет прокси
+// через него. Если порт успели занять, возвращается ошибка errPortConflict
+func traceThroughXray(testID string, proxyURL string, port int, spec *checkSpec, timeout time.Duration, after ...tunnelCheck) (checkTimings, error) {
+	xrayConfig, err := GenerateXrayConfig(proxyURL, port)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create temp config file: %w", err)
+		return checkTimings{}, fmt.Errorf("failed to generate Xray config: %w", err)
 	}
-	defer os.Remove(configFile.Name())
+
+	configFile, err := os.CreateTemp("", tempConfigPattern)
+	if err != nil {
+		return checkTimings{}, fmt.Errorf("failed to create temp config file: %w", err)
+	}
+	resources.trackFile(testID, configFile.Name())
+	defer resources.removeFile(configFile.Name())
 
 	if _, err := configFile.WriteString(xrayConfig); err != nil {
-		return 0, fmt.Errorf("failed to write Xray config: %w", err)
+		return checkTimings{}, fmt.Errorf("failed to write Xray config: %w", err)
 	}
 	configFile.Close()
 
-	cmd := exec.Command("xray", "-c", configFile.Name())
+	cmd := exec.Command(xrayBinary, "-c", configFile.Name())
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 	if err := cmd.Start(); err != nil {
-		return 0, fmt.Errorf("failed to start Xray: %w", err)
+		return checkTimings{}, fmt.Errorf("failed to start Xray: %w", err)
 	}
+	resources.trackProcess(testID, cmd)
+	usage := usageMeter.test(testID)
+	usage.xrayStarted()
 	defer func() {
 		if err := cmd.Process.Kill(); err != nil {
 			log.Printf("Failed to kill Xray process: %v", err)
 		}
 		cmd.Wait()
+		usage.xrayExited(cmd.ProcessState)
+		resources.releaseProcess(cmd)
 	}()
 
 	time.Sleep(2 * time.Second) // Даем Xray время на запуск
 
-	client := http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(&url.URL{
-				Scheme: "socks5",
-				Host:   "127.0.0.1:10808", // Локальный порт Xray из шаблона
-			}),
-		},
+	proxy := &url.URL{
+		Scheme: "socks5",
+		Host:   fmt.Sprintf("127.0.0.1:%d", port),
+	}
+	timings, err := traceCheck(proxy, spec, timeout, usage)
+	if err != nil {
+		if isPortConflict(stderr.String()) {
+			return checkTimings{}, fmt.Errorf("%w: %d, Xray stderr: %s", errPortConflict, port, stderr.String())
+		}
+		return checkTimings{}, fmt.Errorf("%w, Xray stderr: %s", err, stderr.String())
 	}
+	runTunnelChecks(proxy, after)
+	return timings, nil
+}
 
-	start := time.Now()
-	resp, err := client.Get("http://www.google.com/generate_204") // Более надежный URL для проверки
+func runTunnelChecks(proxy *url.URL, checks []tunnelCheck) {
+	for _, check := range checks {
+		check(proxy)
+	}
+}
+
+// checkThroughProxy выполняет проверочный запрос через указанный прокси
+// Трафик запроса учитывается в usage, если он задан
+func checkThroughProxy(proxy *url.URL, spec *checkSpec, timeout time.Duration, usage *testUsage) (time.Duration, error) {
+	timings, err := traceCheck(proxy, spec, timeout, usage)
 	if err != nil {
-		return 0, fmt.Errorf("failed to connect via proxy, Xray stderr: %s, error: %w", stderr.String(), err)
+		return 0, err
 	}
-	defer resp.Body.Close()
+	return timings.latency, nil
+}
 
-	if resp.StatusCode != http.StatusNoContent {
-		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// parseProxyLink разбирает ссылку любого поддерживаемого протокола и
+// возвращает описание прокси для результатов теста
+func parseProxyLink(proxyURL string) (ProxyInfo, error) {
+	scheme, _, _ := strings.Cut(proxyURL, "://")
+	handler, ok := protocols[strings.ToLower(scheme)]
+	if !ok {
+		return ProxyInfo{}, fmt.Errorf("unsupported scheme: %s", scheme)
 	}
+	return handler.parse(proxyURL)
+}
 
-	return time.Since(start), nil
+// validateLink проверяет конфиг ссылки до генерации конфига Xray и
+// возвращает *models.ValidationError с параметром, который нужно исправить.
+// Прочие ошибки общего парсера не учитываются: ссылку уже разобрал парсер API
+func validateLink(proxyURL string) error {
+	_, err := parser.ParseProxyURL(proxyURL)
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		return err
+	}
+	return nil
 }
 
-// GenerateXrayConfig генерирует конфигурацию Xray для VLESS прокси
-func GenerateXrayConfig(vlessURL string) (string, error) {
-	config, err := ParseVLESSConfig(vlessURL)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse VLESS URL: %w", err)
+// GenerateXrayConfig генерирует конфигурацию Xray для прокси любого
+// протокола, который проверяется через Xray, с локальным SOCKS inbound на
+// порту port
+func GenerateXrayConfig(proxyURL string, port int) (string, error) {
+	scheme, _, _ := strings.Cut(proxyURL, "://")
+	handler, ok := protocols[strings.ToLower(scheme)]
+	if !ok || handler.xrayConfig == nil {
+		return "", fmt.Errorf("unsupported scheme for Xray: %s", scheme)
 	}
+	return handler.xrayConfig(proxyURL, port)
+}
 
-	tmpl, err := template.New("xrayConfig").Parse(xrayTemplate)
+// renderXrayConfig подставляет разобранную ссылку в шаблон конфигурации Xray,
+// порт inbound шаблоны берут из функции inboundPort. Строки из ссылки
+// подставляются через json: кавычка или обратная косая черта в них иначе
+// ломали бы конфиг или добавляли в него свои поля
+func renderXrayConfig(config interface{}, textTemplate string, port int) (string, error) {
+	funcs := template.FuncMap{
+		"inboundPort": func() int { return port },
+		"json": func(value string) string {
+			encoded, _ := json.Marshal(value)
+			return string(encoded)
+		},
+	}
+	tmpl, err := template.New("xrayConfig").Funcs(funcs).Parse(streamSettingsTemplate)
+	if err == nil {
+		tmpl, err = tmpl.Parse(textTemplate)
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to parse Xray template: %w", err)
 	}
@@ -407,14 +1277,9 @@ func ParseVLESSConfig(vlessURL string) (*VLESSConfig, error) {
 		return nil, fmt.Errorf("VLESS UUID not found in URL")
 	}
 
-	addressParts := strings.SplitN(u.Host, ":", 2)
-	if len(addressParts) != 2 {
-		return nil, fmt.Errorf("invalid VLESS host:port format")
-	}
-	address := addressParts[0]
-	port, err := strconv.Atoi(addressParts[1])
+	address, port, err := parser.SplitHostPort(u.Host)
 	if err != nil {
-		return nil, fmt.Errorf("invalid port: %w", err)
+		return nil, fmt.Errorf("invalid VLESS address: %w", err)
 	}
 
 	query := u.Query()
@@ -427,16 +1292,30 @@ func ParseVLESSConfig(vlessURL string) (*VLESSConfig, error) {
 		Flow:        query.Get("flow"),
 		Network:     query.Get("type"),
 		TLS:         query.Get("security") == "tls",
+		Reality:     query.Get("security") == "reality",
+		PublicKey:   query.Get("pbk"),
+		ShortID:     query.Get("sid"),
+		SpiderX:     query.Get("spx"),
 		SNI:         query.Get("sni"),
 		Fingerprint: query.Get("fp"),
 		Path:        query.Get("path"),
 		Host:        query.Get("host"),
 		ServiceName: query.Get("serviceName"),
 		Mode:        query.Get("mode"),
+		Seed:        query.Get("seed"),
+		HeaderType:  query.Get("headerType"),
+	}
+	config.AllowInsecure = parseBoolParam(query.Get("allowInsecure"))
+	config.Network = normalizeNetwork(config.Network)
+	if err := applyDefaultPort("vless", query.Get("security"), config.Network, &config.Port, &config.Inferred); err != nil {
+		return nil, fmt.Errorf("invalid VLESS address: %w", err)
 	}
 	if config.SNI == "" {
 		config.SNI = config.Host
 	}
+	if err := applyRealityDefaults(config.Reality, config.PublicKey, &config.Fingerprint); err != nil {
+		return nil, err
+	}
 
 	return config, nil
 }
@@ -448,7 +1327,7 @@ const xrayTemplate = `{
     },
     "inbounds": [
         {
-            "port": 10808,
+            "port": {{inboundPort}},
             "protocol": "socks",
             "settings": {
                 "auth": "noauth",
@@ -462,41 +1341,70 @@ const xrayTemplate = `{
             "settings": {
                 "vnext": [
                     {
-                        "address": "{{.Address}}",
+                        "address": {{json .Address}},
                         "port": {{.Port}},
                         "users": [
                             {
-                                "id": "{{.UUID}}",
+                                "id": {{json .UUID}},
                                 "encryption": "none",
-                                "flow": "{{.Flow}}"
+                                "flow": {{json .Flow}}
                             }
                         ]
                     }
                 ]
             },
-            "streamSettings": {
-                "network": "{{.Network}}",
-                "security": "{{if .TLS}}tls{{else}}none{{end}}",
+            {{template "streamSettings" .}}
+        }
+    ]
+}`
+
+// streamSettingsTemplate - общие настройки транспорта и TLS для всех протоколов
+const streamSettingsTemplate = `{{define "streamSettings"}}"streamSettings": {
+                "network": {{json .Network}},
+                "security": "{{if .Reality}}reality{{else if .TLS}}tls{{else}}none{{end}}",
+                {{- if .Reality}}
+                "realitySettings": {
+                    "serverName": {{json .SNI}},
+                    "fingerprint": {{json .Fingerprint}},
+                    "publicKey": {{json .PublicKey}},
+                    "shortId": {{json .ShortID}},
+                    "spiderX": {{json .SpiderX}}
+                },
+                {{- else}}
                 "tlsSettings": {
-                    "serverName": "{{.SNI}}",
-                    "fingerprint": "{{.Fingerprint}}"
+                    "serverName": {{json .SNI}},
+                    "fingerprint": {{json .Fingerprint}},
+                    "allowInsecure": {{.AllowInsecure}}
                 },
+                {{- end}}
                 "wsSettings": {
-                    "path": "{{.Path}}",
+                    "path": {{json .Path}},
                     "headers": {
-                        "Host": "{{.Host}}"
+                        "Host": {{json .Host}}
                     }
                 },
                 "grpcSettings": {
-                    "serviceName": "{{.ServiceName}}",
+                    "serviceName": {{json .ServiceName}},
                     "multiMode": {{if eq .Mode "multi"}}true{{else}}false{{end}}
                 }
-            }
-        }
-    ]
-}`
+                {{- if eq .Network "kcp"}},
+                "kcpSettings": {
+                    "header": {
+                        "type": {{if .HeaderType}}{{json .HeaderType}}{{else}}"none"{{end}}
+                    },
+                    "seed": {{json .Seed}}
+                }
+                {{- end}}
+                {{- if eq .Network "xhttp"}},
+                "xhttpSettings": {
+                    "path": {{json .Path}},
+                    "host": {{json .Host}},
+                    "mode": {{if .Mode}}{{json .Mode}}{{else}}"auto"{{end}}
+                }
+                {{- end}}
+            }{{end}}`
 
 // generateTestID генерирует уникальный ID теста
 func generateTestID() string {
-	return "test_" + time.Now().Format("20060102150405")
-}
\ No newline at end of file
+	return ids.NewID("test")
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"time"
+
+	"projectx/proxytestlib/probe"
+)
+
+// measurePing измеряет RTT до сервера прокси напрямую, без туннеля. Там, где
+// ICMP недоступен (контейнеры без CAP_NET_RAW), используется время TCP-соединения
+// с портом прокси. Возвращает также тип использованной пробы
+func measurePing(link ProxyInfo, proxyURL string, timeout time.Duration) (time.Duration, string, error) {
+	if simulation != nil {
+		rtt, err := simulation.ping(proxyURL, timeout)
+		return rtt, "simulated", err
+	}
+	result, err := probe.Ping(link.Server, link.Port, timeout)
+	return result.RTT, result.Type, err
+}
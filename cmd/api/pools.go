@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"projectx/proxytestlib/rewriter"
+)
+
+// Pool - сохранённый набор прокси, который можно редактировать и тестировать повторно
+type Pool struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Proxies   []*PoolProxy `json:"proxies"`
+	Pruned    []*PoolProxy `json:"pruned"` // Удалены политикой чистки, проверяются для возврата
+	Prune     *PrunePolicy `json:"prune,omitempty"`
+	LastCycle time.Time    `json:"last_cycle"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+
+	nextID  int
+	cycling bool
+}
+
+// PoolProxy - прокси в пуле
+type PoolProxy struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Link string   `json:"link"`
+	Tags []string `json:"tags"`
+
+	FailStreak  int       `json:"fail_streak"` // Неудачных циклов подряд
+	LastChecked time.Time `json:"last_checked"`
+}
+
+// PoolRequest - тело запроса на создание пула
+type PoolRequest struct {
+	Name    string       `json:"name"`
+	Configs []string     `json:"configs"`
+	Tags    []string     `json:"tags"`
+	Prune   *PrunePolicy `json:"prune"`
+}
+
+// PoolFilter выбирает прокси для массового изменения; пустой фильтр выбирает все
+type PoolFilter struct {
+	rewriter.Match
+	IDs  []string `json:"ids"`
+	Tags []string `json:"tags"` // прокси должен иметь все перечисленные теги
+}
+
+// PoolRename переименовывает прокси по регулярному выражению
+type PoolRename struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// PoolPatchRequest - массовое изменение прокси пула
+type PoolPatchRequest struct {
+	Filter     PoolFilter        `json:"filter"`
+	Set        map[string]string `json:"set"`    // параметры ссылки
+	Delete     []string          `json:"delete"` // удаляемые параметры ссылки
+	Rename     *PoolRename       `json:"rename"`
+	AddTags    []string          `json:"add_tags"`
+	RemoveTags []string          `json:"remove_tags"`
+	DryRun     bool              `json:"dry_run"`
+}
+
+// PoolChange - изменение одного прокси, возвращается в том числе при dry_run
+type PoolChange struct {
+	ID     string    `json:"id"`
+	Before PoolProxy `json:"before"`
+	After  PoolProxy `json:"after"`
+	Error  string    `json:"error,omitempty"`
+}
+
+var pools = make(map[string]*Pool)
+
+// registerPoolRoutes подключает эндпоинты пулов к группе API
+func registerPoolRoutes(api *gin.RouterGroup) {
+	api.POST("/pools", createPool)
+	api.GET("/pools", listPools)
+	api.GET("/pools/:id", getPool)
+	api.PATCH("/pools/:id", patchPool)
+	api.DELETE("/pools/:id", deletePool)
+}
+
+// createPool создаёт пул из списка ссылок
+func createPool(c *gin.Context) {
+	var request PoolRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if err := request.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pool := newPool(request)
+
+	mu.Lock()
+	pools[pool.ID] = pool
+	mu.Unlock()
+
+	c.JSON(http.StatusCreated, pool.summary())
+}
+
+// validate проверяет запрос и подставляет значения по умолчанию
+func (r *PoolRequest) validate() error {
+	if len(r.Configs) == 0 {
+		return fmt.Errorf("configs array cannot be empty")
+	}
+	if r.Prune != nil {
+		if r.Prune.MaxFailures <= 0 {
+			return fmt.Errorf("prune.max_failures must be positive")
+		}
+		if r.Prune.Interval < 0 {
+			return fmt.Errorf("prune.interval cannot be negative")
+		}
+		if r.Prune.Timeout <= 0 {
+			r.Prune.Timeout = 30
+		}
+	}
+	return nil
+}
+
+// newPool создаёт пул из проверенного запроса
+func newPool(request PoolRequest) *Pool {
+	now := now()
+	pool := &Pool{
+		ID:        ids.NewID("pool"),
+		Name:      request.Name,
+		Prune:     request.Prune,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, link := range request.Configs {
+		pool.add(link, request.Tags)
+	}
+	return pool
+}
+
+// listPools возвращает краткие сведения о всех пулах
+func listPools(c *gin.Context) {
+	mu.Lock()
+	list := make([]gin.H, 0, len(pools))
+	for _, pool := range pools {
+		list = append(list, pool.summary())
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i]["id"].(string) < list[j]["id"].(string) })
+	c.JSON(http.StatusOK, gin.H{"pools": list})
+}
+
+// getPool возвращает пул со всеми прокси
+func getPool(c *gin.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	pool, exists := pools[c.Param("id")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pool not found"})
+		return
+	}
+	c.JSON(http.StatusOK, pool)
+}
+
+// deletePool удаляет пул
+func deletePool(c *gin.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, exists := pools[c.Param("id")]; !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pool not found"})
+		return
+	}
+	delete(pools, c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Pool deleted"})
+}
+
+// patchPool массово изменяет прокси пула. С dry_run изменения только возвращаются
+func patchPool(c *gin.Context) {
+	var request PoolPatchRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if len(request.Set) == 0 && len(request.Delete) == 0 && request.Rename == nil &&
+		len(request.AddTags) == 0 && len(request.RemoveTags) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No changes requested"})
+		return
+	}
+	if err := request.Filter.Compile(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "details": err.Error()})
+		return
+	}
+
+	var rename *regexp.Regexp
+	if request.Rename != nil {
+		var err error
+		if rename, err = regexp.Compile(request.Rename.Pattern); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rename pattern", "details": err.Error()})
+			return
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	pool, exists := pools[c.Param("id")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pool not found"})
+		return
+	}
+
+	matched := 0
+	var changes []PoolChange
+	for _, proxy := range pool.Proxies {
+		if !request.Filter.selects(proxy) {
+			continue
+		}
+		matched++
+
+		after, err := request.apply(*proxy, rename)
+		change := PoolChange{ID: proxy.ID, Before: *proxy, After: after}
+		if err != nil {
+			change.Error = err.Error()
+			changes = append(changes, change)
+			continue
+		}
+		if after.Link == proxy.Link && after.Name == proxy.Name && equalTags(after.Tags, proxy.Tags) {
+			continue
+		}
+		changes = append(changes, change)
+
+		if !request.DryRun {
+			*proxy = after
+		}
+	}
+
+	if !request.DryRun && len(changes) > 0 {
+		pool.UpdatedAt = now()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pool_id": pool.ID,
+		"dry_run": request.DryRun,
+		"matched": matched,
+		"changed": len(changes),
+		"changes": changes,
+	})
+}
+
+// apply возвращает копию прокси с изменениями запроса
+func (r *PoolPatchRequest) apply(proxy PoolProxy, rename *regexp.Regexp) (PoolProxy, error) {
+	if len(r.Set) > 0 || len(r.Delete) > 0 {
+		rule := rewriter.Rule{Set: r.Set, Delete: r.Delete}
+		link, _, err := rewriter.Apply(proxy.Link, []rewriter.Rule{rule})
+		if err != nil {
+			return proxy, err
+		}
+		proxy.Link = link
+	}
+
+	if rename != nil {
+		name := rename.ReplaceAllString(proxy.Name, r.Rename.Replacement)
+		if name != proxy.Name {
+			link, err := rewriter.SetLinkName(proxy.Link, name)
+			if err != nil {
+				return proxy, err
+			}
+			proxy.Link = link
+			proxy.Name = name
+		}
+	}
+
+	tags := make([]string, 0, len(proxy.Tags)+len(r.AddTags))
+	for _, tag := range proxy.Tags {
+		if !containsString(r.RemoveTags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range r.AddTags {
+		if !containsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	proxy.Tags = tags
+
+	return proxy, nil
+}
+
+// selects проверяет, подходит ли прокси под фильтр
+func (f *PoolFilter) selects(proxy *PoolProxy) bool {
+	if len(f.IDs) > 0 && !containsString(f.IDs, proxy.ID) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !containsString(proxy.Tags, tag) {
+			return false
+		}
+	}
+	return f.Match.MatchesLink(proxy.Link)
+}
+
+// add добавляет ссылку в пул
+func (p *Pool) add(link string, tags []string) *PoolProxy {
+	p.nextID++
+	proxy := &PoolProxy{
+		ID:   fmt.Sprintf("p%d", p.nextID),
+		Name: rewriter.LinkName(link),
+		Link: link,
+		Tags: append([]string{}, tags...),
+	}
+	p.Proxies = append(p.Proxies, proxy)
+	return proxy
+}
+
+// summary - сведения о пуле без списка прокси
+func (p *Pool) summary() gin.H {
+	return gin.H{
+		"id":         p.ID,
+		"name":       p.Name,
+		"size":       len(p.Proxies),
+		"pruned":     len(p.Pruned),
+		"created_at": p.CreatedAt.Format(time.RFC3339),
+		"updated_at": p.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// portReserveAttempts - сколько раз ОС спрашивается о свободном порту, пока
+// не найдётся порт, не занятый другим тестом и свободный для UDP
+const portReserveAttempts = 10
+
+// portConflictRetries - сколько раз проверка перезапускает Xray на новом
+// порту, если порт успели занять до того, как Xray его открыл
+const portConflictRetries = 3
+
+// errPortConflict - Xray не смог открыть выданный ему порт
+var errPortConflict = errors.New("inbound port already in use")
+
+// trackedPort - локальный порт inbound Xray, выданный тесту
+type trackedPort struct {
+	testID     string
+	reservedAt time.Time
+}
+
+// reservePort выбирает свободный порт для inbound Xray и закрепляет его за
+// тестом. Порт выдаёт ОС (listen на порт 0), поэтому он не пересекается ни с
+// чужими сервисами, ни с проверками параллельных тестов. Inbound принимает и
+// UDP, так что порт должен быть свободен для обоих протоколов
+func (r *resourceRegistry) reservePort(testID string) (int, error) {
+	var lastErr error
+	for attempt := 0; attempt < portReserveAttempts; attempt++ {
+		port, err := probeFreePort()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		r.mu.Lock()
+		if _, taken := r.ports[port]; taken {
+			r.mu.Unlock()
+			lastErr = fmt.Errorf("port %d is reserved by another check", port)
+			continue
+		}
+		r.ports[port] = &trackedPort{testID: testID, reservedAt: time.Now()}
+		r.mu.Unlock()
+		return port, nil
+	}
+	return 0, fmt.Errorf("no free port after %d attempts: %w", portReserveAttempts, lastErr)
+}
+
+// probeFreePort получает от ОС свободный TCP-порт на 127.0.0.1 и проверяет,
+// что тот же порт свободен для UDP. Оба сокета закрываются сразу: порт
+// откроет Xray
+func probeFreePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	conn, err := net.ListenPacket("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return 0, fmt.Errorf("port %d is busy for UDP: %w", port, err)
+	}
+	conn.Close()
+	return port, nil
+}
+
+// releasePort возвращает порт в пул после проверки
+func (r *resourceRegistry) releasePort(port int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.ports, port)
+}
+
+// releaseTestPorts освобождает все порты теста и возвращает их число.
+// Вызывать с захваченным r.mu
+func (r *resourceRegistry) releaseTestPorts(testID string) int {
+	released := 0
+	for port, reserved := range r.ports {
+		if reserved.testID == testID {
+			delete(r.ports, port)
+			released++
+		}
+	}
+	return released
+}
+
+// portCount возвращает число выданных портов
+func (r *resourceRegistry) portCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.ports)
+}
+
+// isPortConflict сообщает, что Xray не открыл inbound, потому что порт занят
+func isPortConflict(stderr string) bool {
+	return strings.Contains(stderr, "address already in use")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"projectx/parser"
+	"projectx/proxytestlib/probe"
+)
+
+// preflightTimeout - сколько ждать TCP-соединения с сервером до полной проверки
+var preflightTimeout = envDuration("PREFLIGHT_TIMEOUT", 3*time.Second)
+
+// deadError - сервер прокси не принимает TCP-соединения, и запускать Xray
+// для полной проверки бессмысленно
+type deadError struct {
+	err error
+}
+
+func (e *deadError) Error() string {
+	return fmt.Sprintf("dead (tcp %s): %v", e.reason(), e.err)
+}
+
+func (e *deadError) Unwrap() error {
+	return e.err
+}
+
+// reason - почему соединение не открылось, коротко для текста ошибки
+func (e *deadError) reason() string {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(e.err, &dnsErr):
+		return "dns"
+	case errors.Is(e.err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.Is(e.err, syscall.EHOSTUNREACH), errors.Is(e.err, syscall.ENETUNREACH):
+		return "unreachable"
+	case isTimeout(e.err):
+		return "timeout"
+	}
+	return "failed"
+}
+
+// preflight открывает TCP-соединение с сервером прокси без Xray и возвращает
+// *deadError, если сервер соединений не принимает. Прокси поверх UDP (TUIC,
+// mKCP, QUIC) так не проверить, для них preflight ничего не делает
+func preflight(proxyURL string, timeout time.Duration) error {
+	config, err := parser.ParseProxyURL(proxyURL)
+	if err != nil || config.OverUDP() {
+		return nil
+	}
+	if simulation != nil {
+		err = simulation.dial(proxyURL, timeout)
+	} else {
+		err = probe.DialTCP(config.Server, config.Port, timeout)
+	}
+	if err != nil {
+		return &deadError{err: err}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxProbes ограничивает число проверочных запросов на один прокси
+const maxProbes = 100
+
+// Режимы замера задержки из поля latency_mode
+const (
+	latencyModeSingle = "single" // Задержка основной проверки
+	latencyModeMedian = "median" // Медиана medianSamples одновременных запросов
+)
+
+// medianSamples - сколько одновременных запросов отправляет режим median
+const medianSamples = 3
+
+// probeInterval - пауза между проверочными запросами одного прокси
+var probeInterval = envDuration("PROBE_INTERVAL", 200*time.Millisecond)
+
+// ProbeStats - задержки серии проверочных запросов через прокси
+type ProbeStats struct {
+	Samples      int     `json:"samples"`  // Отправлено запросов, включая основную проверку
+	Failures     int     `json:"failures"` // Запросов без ожидаемого ответа
+	FailureRatio float64 `json:"failure_ratio"`
+	MinLatency   string  `json:"min_latency"`
+	AvgLatency   string  `json:"avg_latency"`
+	MaxLatency   string  `json:"max_latency"`
+	P50          string  `json:"p50"` // Процентили задержек успешных запросов, ближайший ранг
+	P90          string  `json:"p90"`
+	P99          string  `json:"p99"`
+	Jitter       string  `json:"jitter"` // Стандартное отклонение задержек успешных запросов
+}
+
+// validateProbes проверяет число запросов из поля probes, 0 и 1 - одна проверка
+func validateProbes(probes int) error {
+	if probes < 0 || probes > maxProbes {
+		return fmt.Errorf("probes must be between 0 and %d", maxProbes)
+	}
+	return nil
+}
+
+// validateLatencyMode проверяет поле latency_mode, пусто - single
+func validateLatencyMode(mode string) error {
+	if mode != "" && mode != latencyModeSingle && mode != latencyModeMedian {
+		return fmt.Errorf("latency_mode must be %s or %s", latencyModeSingle, latencyModeMedian)
+	}
+	return nil
+}
+
+// sampleLatency отправляет medianSamples проверочных запросов через туннель
+// одновременно и возвращает задержки успешных. Когда сотни горутин меряют
+// задержку разом, отдельный запрос может попасть на паузу планировщика или
+// GC, а медиана одновременных запросов такой выброс отбрасывает
+func sampleLatency(proxyURL string, proxy *url.URL, spec *checkSpec, timeout time.Duration, usage *testUsage) []time.Duration {
+	samples := make([]time.Duration, medianSamples)
+	var wg sync.WaitGroup
+	for i := range samples {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var (
+				latency time.Duration
+				err     error
+			)
+			if simulation != nil {
+				// Номера после maxProbes не совпадают с запросами серии probes
+				latency, err = simulation.probe(proxyURL, maxProbes+i, timeout)
+			} else {
+				latency, err = checkThroughProxy(proxy, spec, timeout, usage)
+			}
+			if err == nil {
+				samples[i] = latency
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var latencies []time.Duration
+	for _, latency := range samples {
+		if latency > 0 {
+			latencies = append(latencies, latency)
+		}
+	}
+	return latencies
+}
+
+// medianLatency возвращает медиану задержек, при чётном числе - среднее двух
+// средних значений
+func medianLatency(latencies []time.Duration) time.Duration {
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// sendProbes отправляет count проверочных запросов через поднятый туннель и
+// возвращает задержки успешных и число неудачных. Ошибка одного запроса не
+// прерывает серию
+func sendProbes(proxyURL string, proxy *url.URL, spec *checkSpec, count int, timeout time.Duration, usage *testUsage) ([]time.Duration, int) {
+	var latencies []time.Duration
+	failures := 0
+	for i := 0; i < count; i++ {
+		time.Sleep(probeInterval)
+		var (
+			latency time.Duration
+			err     error
+		)
+		if simulation != nil {
+			latency, err = simulation.probe(proxyURL, i, timeout)
+		} else {
+			latency, err = checkThroughProxy(proxy, spec, timeout, usage)
+		}
+		if err != nil {
+			failures++
+			continue
+		}
+		latencies = append(latencies, latency)
+	}
+	return latencies, failures
+}
+
+// probeStats считает статистику серии. В latencies входит и задержка
+// основной проверки, поэтому хотя бы одно значение всегда есть
+func probeStats(latencies []time.Duration, failures int) *ProbeStats {
+	stats := &ProbeStats{Samples: len(latencies) + failures, Failures: failures}
+	stats.FailureRatio = math.Round(float64(failures)/float64(stats.Samples)*10000) / 10000
+
+	minLatency, maxLatency := latencies[0], latencies[0]
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+		minLatency = min(minLatency, latency)
+		maxLatency = max(maxLatency, latency)
+	}
+	avg := total / time.Duration(len(latencies))
+
+	var variance float64
+	for _, latency := range latencies {
+		d := float64(latency - avg)
+		variance += d * d
+	}
+	variance /= float64(len(latencies))
+
+	stats.MinLatency = minLatency.String()
+	stats.AvgLatency = avg.String()
+	stats.MaxLatency = maxLatency.String()
+
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+	stats.P50 = percentile(sorted, 50).String()
+	stats.P90 = percentile(sorted, 90).String()
+	stats.P99 = percentile(sorted, 99).String()
+	stats.Jitter = time.Duration(math.Sqrt(variance)).Round(time.Microsecond).String()
+	return stats
+}
+
+// percentile возвращает p-й процентиль отсортированных задержек по методу
+// ближайшего ранга: наименьшее значение, до которого включительно
+// укладываются p% выборки
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
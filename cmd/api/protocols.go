@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+
+	"projectx/parser"
+	"projectx/proxytestlib/models"
+	"projectx/proxytestlib/xray"
+)
+
+// protocolHandler разбирает ссылки одного протокола и генерирует для них
+// конфигурацию Xray. Благодаря этому в одном тесте можно смешивать протоколы
+type protocolHandler struct {
+	parse      func(proxyURL string) (ProxyInfo, error)
+	xrayConfig func(proxyURL string, port int) (string, error) // nil - проверяется без Xray
+	singBox    bool                                            // Нужен sing-box: у Xray нет такого outbound, ссылка пропускается
+}
+
+// protocols - обработчики по схеме ссылки
+var protocols = map[string]protocolHandler{
+	"vless":   {parse: parseVLESSLink, xrayConfig: vlessXrayConfig},
+	"trojan":  {parse: parseTrojanLink, xrayConfig: trojanXrayConfig},
+	"vmess":   {parse: parseLibraryLink, xrayConfig: libraryXrayConfig},
+	"ss":      {parse: parseLibraryLink, xrayConfig: libraryXrayConfig},
+	"socks":   {parse: parseDirectLink},
+	"socks5":  {parse: parseDirectLink},
+	"socks5h": {parse: parseDirectLink},
+	"http":    {parse: parseDirectLink},
+	"https":   {parse: parseDirectLink},
+	"ssr":     {parse: parseSSRLink},
+	"tuic":    {parse: parseLibraryLink, singBox: true},
+}
+
+func parseVLESSLink(proxyURL string) (ProxyInfo, error) {
+	config, err := ParseVLESSConfig(proxyURL)
+	if err != nil {
+		return ProxyInfo{}, err
+	}
+	info := ProxyInfo{Name: config.Fragment, Protocol: "vless", Server: config.Address, Port: config.Port}
+	return info, validateLink(proxyURL)
+}
+
+func vlessXrayConfig(proxyURL string, port int) (string, error) {
+	config, err := ParseVLESSConfig(proxyURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse VLESS URL: %w", err)
+	}
+	return renderXrayConfig(config, xrayTemplate, port)
+}
+
+func parseTrojanLink(proxyURL string) (ProxyInfo, error) {
+	config, err := ParseTrojanConfig(proxyURL)
+	if err != nil {
+		return ProxyInfo{}, err
+	}
+	info := ProxyInfo{Name: config.Fragment, Protocol: "trojan", Server: config.Address, Port: config.Port}
+	return info, validateLink(proxyURL)
+}
+
+func trojanXrayConfig(proxyURL string, port int) (string, error) {
+	config, err := ParseTrojanConfig(proxyURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse Trojan URL: %w", err)
+	}
+	return renderXrayConfig(config, trojanTemplate, port)
+}
+
+// parseLibraryLink разбирает VMess и Shadowsocks общим парсером, тем же,
+// что использует монитор: у этих протоколов много вариантов ссылок
+// (base64-JSON VMess, SIP002 и плагины Shadowsocks)
+func parseLibraryLink(proxyURL string) (ProxyInfo, error) {
+	config, err := parser.ParseProxyURL(proxyURL)
+	if err != nil {
+		return ProxyInfo{}, err
+	}
+	return ProxyInfo{Name: config.Name, Protocol: config.Protocol, Server: config.Server, Port: config.Port}, nil
+}
+
+// libraryXrayConfig генерирует конфиг генератором монитора с одним прокси,
+// его inbound получает порт port
+func libraryXrayConfig(proxyURL string, port int) (string, error) {
+	config, err := parser.ParseProxyURL(proxyURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse proxy URL: %w", err)
+	}
+	proxies := []*models.ProxyConfig{config}
+	xray.PrepareProxyConfigs(proxies)
+	generated, err := xray.GenerateConfig(proxies, port, "warning")
+	if err != nil {
+		return "", err
+	}
+	return string(generated), nil
+}
+
+func parseDirectLink(proxyURL string) (ProxyInfo, error) {
+	config, err := parseDirectProxy(proxyURL)
+	if err != nil {
+		return ProxyInfo{}, err
+	}
+	return ProxyInfo{Name: config.Name, Protocol: config.Protocol, Server: config.Server, Port: config.Port}, nil
+}
+
+// parseSSRLink разбирает SSR ради понятной причины отказа: даже совместимые
+// с Shadowsocks ноды этот бэкенд не проверяет
+func parseSSRLink(proxyURL string) (ProxyInfo, error) {
+	config, err := parser.ParseProxyURL(proxyURL)
+	if err != nil {
+		return ProxyInfo{}, err
+	}
+	return ProxyInfo{}, &parser.UnsupportedError{Protocol: "ssr", Reason: "backend", Value: config.Protocol + " is not checked by the API"}
+}
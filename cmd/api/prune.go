@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+)
+
+// PrunePolicy - политика автоматической чистки пула по результатам проверок
+type PrunePolicy struct {
+	MaxFailures int      `json:"max_failures"` // Подряд неудачных циклов до удаления прокси
+	Interval    int      `json:"interval"`     // Секунд между циклами, 0 - только ручной запуск
+	Timeout     int      `json:"timeout"`      // Таймаут проверки одного прокси, секунд
+	Grace       []string `json:"grace"`        // ID или имена прокси, которые никогда не удаляются
+}
+
+// PoolCycle - итог одного цикла проверки пула
+type PoolCycle struct {
+	PoolID   string    `json:"pool_id"`
+	Checked  int       `json:"checked"`
+	Failed   int       `json:"failed"`
+	Pruned   []string  `json:"pruned"`
+	Restored []string  `json:"restored"`
+	At       time.Time `json:"at"`
+}
+
+// registerPruneRoutes подключает эндпоинты чистки пулов к группе API
+func registerPruneRoutes(api *gin.RouterGroup) {
+	api.PUT("/pools/:id/prune", setPrunePolicy)
+	api.DELETE("/pools/:id/prune", deletePrunePolicy)
+	api.POST("/pools/:id/check", checkPool)
+}
+
+// setPrunePolicy включает или меняет политику чистки пула
+func setPrunePolicy(c *gin.Context) {
+	var policy PrunePolicy
+	if err := c.BindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if policy.MaxFailures <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_failures must be positive"})
+		return
+	}
+	if policy.Interval < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval cannot be negative"})
+		return
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = 30
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	pool, exists := pools[c.Param("id")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pool not found"})
+		return
+	}
+	pool.Prune = &policy
+	c.JSON(http.StatusOK, gin.H{"pool_id": pool.ID, "prune": pool.Prune})
+}
+
+// deletePrunePolicy отключает чистку. Уже удалённые прокси остаются в pruned
+// и могут быть возвращены ручной проверкой
+func deletePrunePolicy(c *gin.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	pool, exists := pools[c.Param("id")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pool not found"})
+		return
+	}
+	pool.Prune = nil
+	c.JSON(http.StatusOK, gin.H{"message": "Prune policy removed"})
+}
+
+// checkPool запускает цикл проверки пула и ждёт его завершения
+func checkPool(c *gin.Context) {
+	cycle, err := runPoolCycle(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if cycle == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pool not found"})
+		return
+	}
+	c.JSON(http.StatusOK, cycle)
+}
+
+// runPoolCycle проверяет все прокси пула, включая ранее удалённые. Прокси,
+// не прошедшие max_failures циклов подряд, переносятся в pruned; удалённые
+// прокси, снова прошедшие проверку, возвращаются в пул. Без политики цикл
+// только обновляет счётчики неудач. Возвращает nil, если пула нет
+func runPoolCycle(poolID string) (*PoolCycle, error) {
+	mu.Lock()
+	pool, exists := pools[poolID]
+	if !exists {
+		mu.Unlock()
+		return nil, nil
+	}
+	if pool.cycling {
+		mu.Unlock()
+		return nil, fmt.Errorf("pool %s is already being checked", poolID)
+	}
+	pool.cycling = true
+
+	timeout := 30 * time.Second
+	if pool.Prune != nil {
+		timeout = time.Duration(pool.Prune.Timeout) * time.Second
+	}
+	links := make(map[string]string, len(pool.Proxies)+len(pool.Pruned))
+	for _, proxy := range append(append([]*PoolProxy{}, pool.Proxies...), pool.Pruned...) {
+		links[proxy.ID] = proxy.Link
+	}
+	mu.Unlock()
+
+	release := resources.acquireOwner(poolID)
+	defer release()
+
+	var (
+		muCycle   sync.Mutex
+		working   = make(map[string]bool, len(links))
+		latencies = make(map[string]time.Duration, len(links))
+	)
+	// Как и в тесте, одновременно проверяется не больше testWorkers прокси
+	workers := new(errgroup.Group)
+	workers.SetLimit(testWorkers)
+	for id, link := range links {
+		id, link := id, link
+		workers.Go(func() error {
+			latency, err := testProxy(poolID, link, nil, timeout)
+			muCycle.Lock()
+			working[id] = err == nil
+			latencies[id] = latency
+			muCycle.Unlock()
+			return nil
+		})
+	}
+	workers.Wait()
+
+	// Контроллеры пула получают его рабочие прокси после снятия mu
+	var pushed []ProxyInfo
+	defer func() {
+		notifyControllers(pushSource{pool: poolID}, pushed)
+	}()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := now()
+	cycle := &PoolCycle{PoolID: poolID, At: now, Pruned: []string{}, Restored: []string{}}
+	pool.cycling = false
+	pool.LastCycle = now
+
+	// Прокси, изменённые или удалённые через PATCH во время цикла, сопоставляются по ID
+	var active []*PoolProxy
+	for _, proxy := range pool.Proxies {
+		ok, checked := working[proxy.ID]
+		if !checked {
+			active = append(active, proxy)
+			continue
+		}
+		cycle.Checked++
+		proxy.LastChecked = now
+		if ok {
+			proxy.FailStreak = 0
+			active = append(active, proxy)
+			continue
+		}
+		cycle.Failed++
+		proxy.FailStreak++
+		if pool.Prune != nil && proxy.FailStreak >= pool.Prune.MaxFailures && !pool.Prune.protects(proxy) {
+			pool.Pruned = append(pool.Pruned, proxy)
+			cycle.Pruned = append(cycle.Pruned, proxy.ID)
+			continue
+		}
+		active = append(active, proxy)
+	}
+
+	var pruned []*PoolProxy
+	for _, proxy := range pool.Pruned {
+		ok, checked := working[proxy.ID]
+		if !checked || containsString(cycle.Pruned, proxy.ID) {
+			pruned = append(pruned, proxy)
+			continue
+		}
+		cycle.Checked++
+		proxy.LastChecked = now
+		if ok {
+			proxy.FailStreak = 0
+			active = append(active, proxy)
+			cycle.Restored = append(cycle.Restored, proxy.ID)
+			continue
+		}
+		cycle.Failed++
+		proxy.FailStreak++
+		pruned = append(pruned, proxy)
+	}
+
+	pool.Proxies = active
+	pool.Pruned = pruned
+	for _, proxy := range active {
+		if working[proxy.ID] {
+			pushed = append(pushed, ProxyInfo{Name: proxy.Name, Link: proxy.Link, Latency: latencies[proxy.ID].String()})
+		}
+	}
+	if len(cycle.Pruned) > 0 || len(cycle.Restored) > 0 {
+		pool.UpdatedAt = now
+		log.Printf("Pool %s: pruned %v, restored %v", poolID, cycle.Pruned, cycle.Restored)
+	}
+
+	return cycle, nil
+}
+
+// protects проверяет, входит ли прокси в список grace
+func (p *PrunePolicy) protects(proxy *PoolProxy) bool {
+	return containsString(p.Grace, proxy.ID) || containsString(p.Grace, proxy.Name)
+}
+
+// startPoolScheduler запускает циклы пулов, у которых в политике задан interval
+func startPoolScheduler() {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			var due []string
+			mu.Lock()
+			for id, pool := range pools {
+				if pool.Prune == nil || pool.Prune.Interval <= 0 || pool.cycling {
+					continue
+				}
+				if since(pool.LastCycle) >= time.Duration(pool.Prune.Interval)*time.Second {
+					due = append(due, id)
+				}
+			}
+			mu.Unlock()
+
+			for _, id := range due {
+				go func(id string) {
+					if _, err := runPoolCycle(id); err != nil {
+						log.Printf("Pool %s cycle skipped: %v", id, err)
+					}
+				}(id)
+			}
+		}
+	}()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// referenceDirect - эталон без прокси: проверочный запрос идёт напрямую с
+// хоста, на котором работает API
+const referenceDirect = "direct"
+
+// validateReference проверяет значение поля reference запроса: пустое,
+// "direct" или ссылка на прокси
+func validateReference(reference string) error {
+	if reference == "" || reference == referenceDirect {
+		return nil
+	}
+	if _, err := parseProxyLink(reference); err != nil {
+		return fmt.Errorf("invalid reference proxy: %w", err)
+	}
+	return nil
+}
+
+// measureReference измеряет задержку эталона. Вызывается сразу после проверки
+// каждого прокси, чтобы оба замера попали в одно окно времени и разница не
+// зависела от временного состояния сети на проверяющем хосте
+func measureReference(testID, reference string, spec *checkSpec, timeout time.Duration) (time.Duration, error) {
+	if simulation != nil {
+		return simulation.testProxy(reference, timeout)
+	}
+	if reference == referenceDirect {
+		return checkThroughProxy(nil, spec, timeout, usageMeter.test(testID))
+	}
+	return testProxy(testID, reference, spec, timeout)
+}
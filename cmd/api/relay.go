@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// cdnNetworks - автономные системы CDN, через которые прокси часто
+// работают фронтом (WebSocket или gRPC за CDN). Выход таких прокси всегда
+// в другой сети, чем адрес из ссылки
+var cdnNetworks = map[int]string{
+	13335:  "cloudflare",
+	209242: "cloudflare",
+	54113:  "fastly",
+	20940:  "akamai",
+	16625:  "akamai",
+	60068:  "cdn77",
+	199524: "gcore",
+}
+
+// detectRelay сравнивает адреса сервера из ссылки с выходным IP и отмечает
+// прокси, который выпускает трафик из другой сети: релей, каскад или фронт
+// CDN. Выход из той же подсети (/24 для IPv4, /64 для IPv6) или, по GeoIP,
+// той же автономной системы релеем не считается: у сервера бывает несколько
+// адресов. Если адрес сервера не резолвится, сравнение не делается
+func detectRelay(proxyURL, server string, exit *ExitInfo, timeout time.Duration) {
+	var serverIPs []net.IP
+	if simulation != nil {
+		serverIPs = simulation.serverIPs(proxyURL, exit)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, server)
+		if err != nil {
+			return
+		}
+		for _, addr := range addrs {
+			serverIPs = append(serverIPs, addr.IP)
+		}
+	}
+	exitIP := net.ParseIP(exit.IP)
+	if len(serverIPs) == 0 || exitIP == nil {
+		return
+	}
+
+	exit.ServerIPs = make([]string, 0, len(serverIPs))
+	for _, ip := range serverIPs {
+		exit.ServerIPs = append(exit.ServerIPs, ip.String())
+	}
+	for _, ip := range serverIPs {
+		if sameSubnet(ip, exitIP) {
+			return
+		}
+	}
+
+	exit.Relayed = true
+	if geoResolver == nil || simulation != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	info, err := geoResolver.Lookup(ctx, serverIPs[0])
+	if err != nil || info.ASN == 0 {
+		return
+	}
+	exit.ServerASN = info.ASN
+	if info.ASN == exit.ASN {
+		exit.Relayed = false
+		return
+	}
+	exit.Front = cdnNetworks[info.ASN]
+}
+
+// sameSubnet сообщает, лежат ли адреса в одной /24 (IPv4) или /64 (IPv6)
+func sameSubnet(a, b net.IP) bool {
+	if a4, b4 := a.To4(), b.To4(); a4 != nil || b4 != nil {
+		return a4 != nil && b4 != nil && a4.Mask(net.CIDRMask(24, 32)).Equal(b4.Mask(net.CIDRMask(24, 32)))
+	}
+	return a.Mask(net.CIDRMask(64, 128)).Equal(b.Mask(net.CIDRMask(64, 128)))
+}
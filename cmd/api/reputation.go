@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"projectx/proxytestlib/reputation"
+)
+
+// reputationChecker оценивает риск выходных IP рабочих прокси. Провайдеры
+// перечисляются в REPUTATION_PROVIDERS (ipqualityscore, abuseipdb, list),
+// без них оценка недоступна
+var reputationChecker = loadReputation()
+
+func loadReputation() *reputation.Checker {
+	ttl := time.Duration(envInt("REPUTATION_CACHE_TTL", 86400)) * time.Second
+	checker, err := reputation.NewFromSpec(os.Getenv("REPUTATION_PROVIDERS"), os.Getenv("IPQS_API_KEY"),
+		os.Getenv("ABUSEIPDB_API_KEY"), os.Getenv("REPUTATION_LIST"), ttl)
+	if err != nil {
+		log.Fatalf("Failed to set up IP reputation: %v", err)
+	}
+	if checker != nil {
+		log.Printf("IP reputation providers: %s", strings.Join(checker.Providers(), ", "))
+	}
+	return checker
+}
+
+// checkReputation оценивает выходной IP прокси. Запрос идёт к провайдерам
+// напрямую, не через прокси, поэтому туннель для него не нужен
+func checkReputation(proxyURL string, exit *ExitInfo, timeout time.Duration) (*reputation.Score, error) {
+	if simulation != nil {
+		return simulation.reputation(proxyURL, exit), nil
+	}
+
+	ip := net.ParseIP(exit.IP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid exit IP %q", exit.IP)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return reputationChecker.Lookup(ctx, ip)
+}
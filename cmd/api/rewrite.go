@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"projectx/proxytestlib/rewriter"
+)
+
+// rewriteRules - правила перезаписи ссылок из файла REWRITE_RULES,
+// применяются ко всем тестам
+var rewriteRules = loadRewriteRules()
+
+// loadRewriteRules читает правила при старте; ошибка в файле останавливает сервер,
+// чтобы тесты не шли молча без ожидаемых исправлений
+func loadRewriteRules() []rewriter.Rule {
+	path := os.Getenv("REWRITE_RULES")
+	if path == "" {
+		return nil
+	}
+
+	rules, err := rewriter.LoadRules(path)
+	if err != nil {
+		log.Fatalf("Failed to load rewrite rules: %v", err)
+	}
+	log.Printf("Loaded %d rewrite rules from %s", len(rules), path)
+	return rules
+}
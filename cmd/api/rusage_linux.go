@@ -0,0 +1,16 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// peakMemory возвращает пиковый RSS завершившегося процесса в байтах
+func peakMemory(state *os.ProcessState) int64 {
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return rusage.Maxrss * 1024 // В Linux ru_maxrss - в килобайтах
+	}
+	return 0
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// peakMemory не поддерживается: единицы ru_maxrss зависят от ОС
+func peakMemory(state *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"projectx/proxytestlib/models"
+	"projectx/proxytestlib/rewriter"
+)
+
+// z95 - квантиль нормального распределения для 95% доверительного интервала
+const z95 = 1.959964
+
+// SampleRequest - проверка случайной выборки вместо всего списка
+type SampleRequest struct {
+	Percent  float64 `json:"percent"`  // Доля ссылок каждой страты, 0..100
+	Size     int     `json:"size"`     // Или общий размер выборки
+	Stratify string  `json:"stratify"` // "", country, protocol или country,protocol
+	Seed     int64   `json:"seed"`     // 0 - случайное зерно
+}
+
+func (r *SampleRequest) validate() error {
+	if (r.Percent > 0) == (r.Size > 0) {
+		return fmt.Errorf("set either percent or size")
+	}
+	if r.Percent < 0 || r.Percent > 100 {
+		return fmt.Errorf("percent must be between 0 and 100")
+	}
+	if r.Size < 0 {
+		return fmt.Errorf("size must be positive")
+	}
+	for _, key := range strings.Split(r.Stratify, ",") {
+		if key = strings.TrimSpace(key); key != "" && key != "country" && key != "protocol" {
+			return fmt.Errorf("unknown stratify key %q, expected country or protocol", key)
+		}
+	}
+	return nil
+}
+
+// SampleReport - оценка доли рабочих прокси во всём списке по выборке.
+// Интервалы - 95%, с поправкой на конечную совокупность
+type SampleReport struct {
+	Population           int               `json:"population"`
+	Sampled              int               `json:"sampled"`
+	Checked              int               `json:"checked"` // Без пропущенных (дубликаты, мусор, бюджет)
+	Stratify             string            `json:"stratify,omitempty"`
+	Seed                 int64             `json:"seed"`
+	EstimatedSuccessRate float64           `json:"estimated_success_rate"`
+	ConfidenceLow        float64           `json:"confidence_low"`
+	ConfidenceHigh       float64           `json:"confidence_high"`
+	EstimatedWorking     int               `json:"estimated_working"`
+	Strata               []StratumEstimate `json:"strata"`
+}
+
+// StratumEstimate - оценка по одной страте (стране, протоколу или их паре)
+type StratumEstimate struct {
+	Stratum        string  `json:"stratum"`
+	Population     int     `json:"population"`
+	Sampled        int     `json:"sampled"`
+	Checked        int     `json:"checked"`
+	Successful     int     `json:"successful"`
+	SuccessRate    float64 `json:"success_rate"`
+	ConfidenceLow  float64 `json:"confidence_low"`
+	ConfidenceHigh float64 `json:"confidence_high"`
+}
+
+// samplePlan - выбранные ссылки и их страты, порядок совпадает с конфигами теста
+type samplePlan struct {
+	stratify   string
+	seed       int64
+	strata     []string       // Страта каждой выбранной ссылки
+	population map[string]int // Размер страты во всём списке
+}
+
+// sampleConfigs выбирает из каждой страты долю ссылок, но не меньше одной,
+// чтобы все страты были представлены. Выборка воспроизводима при том же seed
+func sampleConfigs(configs []json.RawMessage, request SampleRequest) ([]json.RawMessage, *samplePlan) {
+	seed := request.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	plan := &samplePlan{stratify: request.Stratify, seed: seed, population: make(map[string]int)}
+
+	byStratum := make(map[string][]int)
+	var names []string
+	for i, config := range configs {
+		link, _, _ := configEntry(config)
+		stratum := stratumOf(link, request.Stratify)
+		if _, ok := byStratum[stratum]; !ok {
+			names = append(names, stratum)
+		}
+		byStratum[stratum] = append(byStratum[stratum], i)
+	}
+	sort.Strings(names)
+
+	fraction := request.Percent / 100
+	if request.Size > 0 {
+		fraction = math.Min(1, float64(request.Size)/float64(len(configs)))
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	var selected []int
+	stratumOfIndex := make(map[int]string)
+	for _, name := range names {
+		indexes := byStratum[name]
+		plan.population[name] = len(indexes)
+		n := int(math.Round(fraction * float64(len(indexes))))
+		if n < 1 {
+			n = 1
+		}
+		for _, j := range rng.Perm(len(indexes))[:n] {
+			selected = append(selected, indexes[j])
+			stratumOfIndex[indexes[j]] = name
+		}
+	}
+	// Исходный порядок, чтобы Rank и отчёты совпадали со списком
+	sort.Ints(selected)
+
+	sample := make([]json.RawMessage, 0, len(selected))
+	for _, i := range selected {
+		sample = append(sample, configs[i])
+		plan.strata = append(plan.strata, stratumOfIndex[i])
+	}
+	return sample, plan
+}
+
+// stratumOf возвращает страту ссылки: страну из флага в имени и/или схему
+func stratumOf(link, stratify string) string {
+	var parts []string
+	for _, key := range strings.Split(stratify, ",") {
+		switch strings.TrimSpace(key) {
+		case "country":
+			country := (&models.ProxyConfig{Name: rewriter.LinkName(link)}).GetCountry()
+			if country == "" {
+				country = "unknown"
+			}
+			parts = append(parts, country)
+		case "protocol":
+			scheme, _, found := strings.Cut(link, "://")
+			if !found || scheme == "" {
+				scheme = "unknown"
+			}
+			parts = append(parts, strings.ToLower(scheme))
+		}
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+	return strings.Join(parts, "/")
+}
+
+// report оценивает долю рабочих прокси по итогам теста. outcomes - итог
+// проверки по индексу ссылки: true - рабочий, false - нерабочий, нет - пропущен
+func (p *samplePlan) report(outcomes map[int]bool) *SampleReport {
+	report := &SampleReport{Stratify: p.stratify, Seed: p.seed, Sampled: len(p.strata)}
+
+	strata := make(map[string]*StratumEstimate)
+	for name, population := range p.population {
+		strata[name] = &StratumEstimate{Stratum: name, Population: population}
+		report.Population += population
+	}
+	for i, name := range p.strata {
+		stratum := strata[name]
+		stratum.Sampled++
+		if working, checked := outcomes[i]; checked {
+			stratum.Checked++
+			if working {
+				stratum.Successful++
+			}
+		}
+	}
+
+	// Стратифицированная оценка: доли страт взвешиваются по их размеру.
+	// Страты, где ничего не проверено, исключаются с перенормировкой весов
+	var covered int
+	for _, stratum := range strata {
+		if stratum.Checked > 0 {
+			covered += stratum.Population
+		}
+	}
+	var rate, variance float64
+	for _, stratum := range strata {
+		report.Checked += stratum.Checked
+		if stratum.Checked == 0 {
+			report.Strata = append(report.Strata, *stratum)
+			continue
+		}
+		p := float64(stratum.Successful) / float64(stratum.Checked)
+		low, high := wilsonInterval(stratum.Successful, stratum.Checked, stratum.Population)
+		stratum.SuccessRate = p * 100
+		stratum.ConfidenceLow = low * 100
+		stratum.ConfidenceHigh = high * 100
+		report.Strata = append(report.Strata, *stratum)
+
+		weight := float64(stratum.Population) / float64(covered)
+		rate += weight * p
+		variance += weight * weight * stratumVariance(p, stratum.Checked, stratum.Population)
+	}
+	sort.Slice(report.Strata, func(i, j int) bool { return report.Strata[i].Stratum < report.Strata[j].Stratum })
+
+	if covered > 0 {
+		margin := z95 * math.Sqrt(variance)
+		report.EstimatedSuccessRate = rate * 100
+		report.ConfidenceLow = math.Max(0, rate-margin) * 100
+		report.ConfidenceHigh = math.Min(1, rate+margin) * 100
+		report.EstimatedWorking = int(math.Round(rate * float64(report.Population)))
+	}
+	return report
+}
+
+// stratumVariance - дисперсия оценки доли по n из N; при n = 1 берётся
+// наихудшая p(1-p) = 0.25
+func stratumVariance(p float64, n, population int) float64 {
+	fpc := 1 - float64(n)/float64(population)
+	if n < 2 {
+		return 0.25 * fpc
+	}
+	return fpc * p * (1 - p) / float64(n-1)
+}
+
+// wilsonInterval - интервал Уилсона для successes из n, суженный к p
+// поправкой на конечную совокупность: при сплошной проверке он вырождается
+// в точку. При малых n точнее нормального приближения
+func wilsonInterval(successes, n, population int) (float64, float64) {
+	p := float64(successes) / float64(n)
+	nf := float64(n)
+	z2 := z95 * z95
+	center := (p + z2/(2*nf)) / (1 + z2/nf)
+	margin := z95 * math.Sqrt(p*(1-p)/nf+z2/(4*nf*nf)) / (1 + z2/nf)
+	low, high := math.Max(0, center-margin), math.Min(1, center+margin)
+
+	fpc := 1.0
+	if population > 1 {
+		fpc = math.Sqrt(float64(population-n) / float64(population-1))
+	}
+	return p - (p-low)*fpc, p + (high-p)*fpc
+}
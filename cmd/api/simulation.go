@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"projectx/proxytestlib/geoip"
+	"projectx/proxytestlib/probe"
+	"projectx/proxytestlib/reputation"
+)
+
+// simulator заменяет запуск Xray синтетическими результатами.
+// Результат для одной и той же ссылки при одинаковом SIM_SEED всегда одинаков,
+// поэтому прогоны нагрузочного теста воспроизводимы.
+type simulator struct {
+	seed        int64
+	dist        string
+	mean        time.Duration
+	stddev      time.Duration
+	failureRate float64
+}
+
+// simulation включается переменной API_BACKEND=simulate
+var simulation = loadSimulation()
+
+// loadSimulation читает параметры симуляции из окружения:
+// SIM_SEED, SIM_LATENCY_DIST (normal, lognormal, uniform, exponential),
+// SIM_LATENCY_MEAN, SIM_LATENCY_STDDEV, SIM_FAILURE_RATE (0..1)
+func loadSimulation() *simulator {
+	if os.Getenv("API_BACKEND") != "simulate" {
+		return nil
+	}
+
+	s := &simulator{
+		seed:        int64(envInt("SIM_SEED", 1)),
+		dist:        os.Getenv("SIM_LATENCY_DIST"),
+		mean:        envDuration("SIM_LATENCY_MEAN", 300*time.Millisecond),
+		stddev:      envDuration("SIM_LATENCY_STDDEV", 100*time.Millisecond),
+		failureRate: 0.3,
+	}
+	if s.dist == "" {
+		s.dist = "lognormal"
+	}
+	if value := os.Getenv("SIM_FAILURE_RATE"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			log.Printf("Invalid SIM_FAILURE_RATE=%q, using default %.2f", value, s.failureRate)
+		} else {
+			s.failureRate = rate
+		}
+	}
+
+	log.Printf("⚠️ Simulation backend enabled: %s latency (mean %s, stddev %s), failure rate %.2f, seed %d",
+		s.dist, s.mean, s.stddev, s.failureRate, s.seed)
+	return s
+}
+
+// rng возвращает генератор, детерминированный для пары (seed, ссылка)
+func (s *simulator) rng(proxyURL string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(proxyURL))
+	return rand.New(rand.NewSource(s.seed ^ int64(h.Sum64())))
+}
+
+// latency выбирает задержку из настроенного распределения
+func (s *simulator) latency(r *rand.Rand) time.Duration {
+	mean := float64(s.mean)
+	stddev := float64(s.stddev)
+
+	var value float64
+	switch s.dist {
+	case "normal":
+		value = mean + r.NormFloat64()*stddev
+	case "uniform":
+		value = mean - stddev + r.Float64()*2*stddev
+	case "exponential":
+		value = r.ExpFloat64() * mean
+	default:
+		// Параметры логнормального распределения с заданными средним и отклонением
+		sigma2 := math.Log(1 + (stddev*stddev)/(mean*mean))
+		mu := math.Log(mean) - sigma2/2
+		value = math.Exp(mu + r.NormFloat64()*math.Sqrt(sigma2))
+	}
+
+	if value < float64(time.Millisecond) {
+		value = float64(time.Millisecond)
+	}
+	return time.Duration(value)
+}
+
+// testProxy имитирует проверку прокси: ждёт синтетическую задержку и
+// возвращает ошибку с вероятностью failureRate
+func (s *simulator) testProxy(proxyURL string, timeout time.Duration) (time.Duration, error) {
+	r := s.rng(proxyURL)
+	failed := r.Float64() < s.failureRate
+	latency := s.latency(r)
+
+	if latency > timeout {
+		time.Sleep(timeout)
+		return 0, fmt.Errorf("simulated timeout after %s", timeout)
+	}
+	time.Sleep(latency)
+
+	if failed {
+		// Часть отказов - страница блокировки на выходе прокси
+		if s.rng(proxyURL+"#blocked").Float64() < 0.1 {
+			return 0, &blockedError{reason: fmt.Sprintf("page mentions %q", "rkn.gov.ru")}
+		}
+		return 0, fmt.Errorf("simulated failure")
+	}
+	return latency, nil
+}
+
+// dial имитирует TCP-соединение с сервером: половина прокси, которым
+// testProxy даёт отказ, не принимает соединения вовсе - обычно отказом в
+// соединении, реже молчанием до таймаута
+func (s *simulator) dial(proxyURL string, timeout time.Duration) error {
+	if s.rng(proxyURL).Float64() >= s.failureRate {
+		return nil
+	}
+	switch roll := s.rng(proxyURL + "#tcp").Float64(); {
+	case roll < 0.35:
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	case roll < 0.5:
+		time.Sleep(timeout)
+		return fmt.Errorf("simulated timeout after %s: %w", timeout, context.DeadlineExceeded)
+	}
+	return nil
+}
+
+// ping имитирует RTT до сервера: треть синтетической задержки проверки,
+// так как проверка включает несколько обменов через туннель
+func (s *simulator) ping(proxyURL string, timeout time.Duration) (time.Duration, error) {
+	rtt := s.latency(s.rng(proxyURL+"#ping")) / 3
+	if rtt > timeout {
+		return 0, fmt.Errorf("simulated timeout after %s", timeout)
+	}
+	return rtt, nil
+}
+
+// content имитирует загрузку адреса через прокси: категория блокируется
+// на выходе с вероятностью 20%, одинаково для всех её адресов
+func (s *simulator) content(proxyURL string, target ContentTarget) ContentOutcome {
+	outcome := ContentOutcome{Category: target.Category, URL: target.URL}
+	if s.rng(proxyURL+"#content/"+target.Category).Float64() < 0.2 {
+		outcome.Error = "simulated block"
+		return outcome
+	}
+	outcome.Reachable = true
+	outcome.Status = http.StatusOK
+	return outcome
+}
+
+// speed имитирует замер скорости загрузки: от 0,5 МБ/с, в среднем около 8 МБ/с.
+// Если файл не успевает загрузиться за ограничение времени, загрузка обрезается
+func (s *simulator) speed(proxyURL string, test speedTest) (float64, int64, error) {
+	rate := 0.5 + s.rng(proxyURL+"#speed").ExpFloat64()*7.5
+	downloaded := test.size
+	if limit := int64(rate * 1e6 * test.timeout.Seconds()); limit < downloaded {
+		downloaded = limit
+	}
+	return math.Round(rate*100) / 100, downloaded, nil
+}
+
+// probe имитирует повторный проверочный запрос через рабочий прокси: задержка
+// из того же распределения, отказ с вероятностью в пять раз ниже failureRate
+func (s *simulator) probe(proxyURL string, index int, timeout time.Duration) (time.Duration, error) {
+	r := s.rng(fmt.Sprintf("%s#probe/%d", proxyURL, index))
+	failed := r.Float64() < s.failureRate/5
+	latency := s.latency(r)
+	if latency > timeout {
+		return 0, fmt.Errorf("simulated timeout after %s", timeout)
+	}
+	time.Sleep(latency)
+	if failed {
+		return 0, fmt.Errorf("simulated probe failure")
+	}
+	return latency, nil
+}
+
+// timings делит синтетическую задержку на этапы: соединение с туннелем
+// занимает от трети до двух третей, остальное - ожидание первого байта
+func (s *simulator) timings(proxyURL string, latency time.Duration) checkTimings {
+	share := 1.0/3 + s.rng(proxyURL+"#timings").Float64()/3
+	connect := time.Duration(float64(latency) * share)
+	return checkTimings{
+		latency: latency,
+		connect: connect,
+		ttfb:    latency - connect,
+		total:   latency,
+	}
+}
+
+// simulatedRegions - страны выхода синтетических прокси
+var simulatedRegions = []string{"US", "DE", "NL", "GB", "JP", "SG", "FR", "FI"}
+
+// unlock имитирует проверку сервиса: страна выхода одна для всех сервисов
+// прокси, сервис недоступен с вероятностью 25%, у Netflix половина
+// недоступных открывает только собственные сериалы
+func (s *simulator) unlock(proxyURL, service string) UnlockOutcome {
+	outcome := UnlockOutcome{
+		Service: service,
+		Status:  unlockAvailable,
+		Region:  simulatedRegions[s.rng(proxyURL+"#region").Intn(len(simulatedRegions))],
+	}
+	r := s.rng(proxyURL + "#unlock/" + service)
+	if r.Float64() < 0.25 {
+		outcome.Status = unlockBlocked
+		if service == "netflix" && r.Intn(2) == 0 {
+			outcome.Status = unlockOriginals
+		}
+	}
+	return outcome
+}
+
+// simulatedNetworks - сети выхода синтетических прокси: хостинги и провайдеры
+var simulatedNetworks = []struct {
+	asn int
+	org string
+}{
+	{24940, "Hetzner Online GmbH"},
+	{16276, "OVH SAS"},
+	{14061, "DigitalOcean, LLC"},
+	{3320, "Deutsche Telekom AG"},
+	{7922, "Comcast Cable Communications, LLC"},
+}
+
+// exit имитирует выходной IP прокси: адрес из документационной сети
+// 198.51.100.0/24, та же страна, что и при проверке сервисов, и сеть -
+// чаще хостинг, как у большинства реальных нод
+func (s *simulator) exit(proxyURL string) *ExitInfo {
+	r := s.rng(proxyURL + "#exit")
+	exit := &ExitInfo{
+		IP:      fmt.Sprintf("198.51.100.%d", 1+r.Intn(254)),
+		Country: simulatedRegions[s.rng(proxyURL+"#region").Intn(len(simulatedRegions))],
+	}
+	network := simulatedNetworks[r.Intn(len(simulatedNetworks))]
+	exit.ASN, exit.Org = network.asn, network.org
+	exit.Network = geoip.NetworkType(&geoip.Info{ASN: network.asn, Org: network.org})
+	return exit
+}
+
+// serverIPs имитирует адреса сервера из ссылки: обычно это и есть выходной
+// IP, но примерно каждый седьмой прокси выпускает трафик из другой сети
+func (s *simulator) serverIPs(proxyURL string, exit *ExitInfo) []net.IP {
+	r := s.rng(proxyURL + "#server")
+	if r.Float64() < 0.15 {
+		return []net.IP{net.IPv4(203, 0, 113, byte(1+r.Intn(254)))}
+	}
+	return []net.IP{net.ParseIP(exit.IP)}
+}
+
+// reputation имитирует оценку риска: адреса хостингов получают оценку выше,
+// чем адреса домашних провайдеров
+func (s *simulator) reputation(proxyURL string, exit *ExitInfo) *reputation.Score {
+	r := s.rng(proxyURL + "#reputation")
+	score := &reputation.Score{IP: exit.IP, Risk: r.Intn(40), Provider: "simulate"}
+	if exit.Network == geoip.NetworkDatacenter {
+		score.Risk += 40 + r.Intn(21)
+		score.Proxy = true
+	}
+	score.Level = reputation.Level(score.Risk)
+	return score
+}
+
+// dnsLeak имитирует проверку утечки DNS: резолверы обычно в стране выхода,
+// но примерно у каждого пятого прокси один из них в другой стране
+func (s *simulator) dnsLeak(proxyURL string) *DNSLeakReport {
+	r := s.rng(proxyURL + "#dns")
+	exit := s.exit(proxyURL)
+	report := &DNSLeakReport{ExitIP: exit.IP, ExitCountry: exit.Country}
+	for i := 0; i < 1+r.Intn(2); i++ {
+		report.Resolvers = append(report.Resolvers, DNSResolver{IP: fmt.Sprintf("203.0.113.%d", 1+r.Intn(254)), Country: exit.Country})
+	}
+	if r.Float64() < 0.2 {
+		country := simulatedRegions[r.Intn(len(simulatedRegions))]
+		report.Resolvers = append(report.Resolvers, DNSResolver{IP: fmt.Sprintf("192.0.2.%d", 1+r.Intn(254)), Country: country})
+		report.Leak = country != exit.Country
+	}
+	return report
+}
+
+// udp имитирует проверку UDP: примерно каждый десятый прокси UDP не передаёт
+func (s *simulator) udp(proxyURL string, timeout time.Duration) *UDPReport {
+	r := s.rng(proxyURL + "#udp")
+	if r.Float64() < 0.1 {
+		return &UDPReport{Error: fmt.Sprintf("no UDP reply within %s", timeout)}
+	}
+	return &UDPReport{OK: true, RTT: s.latency(r).String()}
+}
+
+// handshake имитирует рукопожатие TLS с сервером прокси: у немногих серверов
+// сертификат выдан на другое имя, просрочен или самоподписан, часть
+// серверов TLS не поддерживает TLS 1.3, а единицы отвечают без TLS
+func (s *simulator) handshake(proxyURL, sni, security string) (*probe.TLSResult, error) {
+	r := s.rng(proxyURL + "#cert")
+	issuer := "CN=R11,O=Let's Encrypt,C=US"
+	leaf := probe.Certificate{
+		Subject:   "CN=" + sni,
+		Issuer:    issuer,
+		DNSNames:  []string{sni},
+		NotBefore: now().Add(-time.Duration(1+r.Intn(60)) * 24 * time.Hour),
+		NotAfter:  now().Add(time.Duration(1+r.Intn(89)) * 24 * time.Hour),
+	}
+	result := &probe.TLSResult{
+		Version:     "TLS 1.3",
+		VersionID:   tls.VersionTLS13,
+		CipherSuite: "TLS_AES_128_GCM_SHA256",
+		ALPN:        "h2",
+		NameMatch:   true,
+		Trusted:     true,
+	}
+	switch roll := r.Float64(); {
+	case roll < 0.05:
+		leaf.Subject, leaf.DNSNames = "CN=default.example.net", []string{"default.example.net"}
+		result.NameMatch, result.Trusted = false, false
+		result.VerifyError = fmt.Sprintf("x509: certificate is valid for default.example.net, not %s", sni)
+	case roll < 0.08:
+		leaf.NotAfter = now().Add(-time.Duration(1+r.Intn(30)) * 24 * time.Hour)
+		result.Expired, result.Trusted = true, false
+		result.VerifyError = "x509: certificate has expired or is not yet valid"
+	case roll < 0.11:
+		leaf.Issuer = leaf.Subject
+		result.Trusted = false
+		result.VerifyError = "x509: certificate signed by unknown authority"
+	}
+	switch roll := r.Float64(); {
+	case roll < 0.02 && security == "tls":
+		return nil, &probe.PlaintextError{Response: "HTTP/"}
+	case roll < 0.04:
+		result.Version, result.VersionID = "TLS 1.2", tls.VersionTLS12
+		result.CipherSuite = "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"
+	case roll < 0.05 && security == "tls":
+		result.Version, result.VersionID = "TLS 1.2", tls.VersionTLS12
+		result.CipherSuite, result.WeakCipher = "TLS_RSA_WITH_AES_128_CBC_SHA", true
+	}
+	result.Chain = []probe.Certificate{leaf}
+	if leaf.Issuer != leaf.Subject {
+		result.Chain = append(result.Chain, probe.Certificate{
+			Subject:   issuer,
+			Issuer:    "CN=ISRG Root X1,O=Internet Security Research Group,C=US",
+			NotBefore: now().Add(-365 * 24 * time.Hour),
+			NotAfter:  now().Add(2 * 365 * 24 * time.Hour),
+		})
+	}
+	return result, nil
+}
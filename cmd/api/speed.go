@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"projectx/proxytestlib/checker"
+)
+
+// defaultSpeedTestURL отдаёт ровно столько байт, сколько запрошено
+const defaultSpeedTestURL = "https://speed.cloudflare.com/__down?bytes={bytes}"
+
+// speedTestURL - файл для замера скорости (SPEED_TEST_URL). {bytes} в адресе
+// заменяется размером загрузки, больший файл загружается не полностью
+var speedTestURL = loadSpeedTestURL()
+
+// defaultSpeedTest - размер загрузки и ограничение времени замера из
+// SPEED_TEST_SIZE (байт) и SPEED_TEST_TIMEOUT (секунд)
+var defaultSpeedTest = speedTest{
+	size:    int64(envInt("SPEED_TEST_SIZE", 10*1000*1000)),
+	timeout: time.Duration(envInt("SPEED_TEST_TIMEOUT", 10)) * time.Second,
+}
+
+// speedLimiter ограничивает суммарную скорость замеров всех тестов
+// (SPEED_BANDWIDTH_LIMIT, байт в секунду) и число одновременных замеров
+// (SPEED_CONCURRENCY), чтобы параллельные замеры не забивали канал сервера и
+// не искажали результаты друг друга. nil - без ограничений
+var speedLimiter = checker.NewLimiter(checker.BandwidthLimit{
+	BytesPerSecond: int64(envInt("SPEED_BANDWIDTH_LIMIT", 0)),
+	MaxSpeedChecks: envInt("SPEED_CONCURRENCY", 0),
+})
+
+func loadSpeedTestURL() string {
+	if value := os.Getenv("SPEED_TEST_URL"); value != "" {
+		return value
+	}
+	return defaultSpeedTestURL
+}
+
+// speedTest - параметры замера скорости загрузки
+type speedTest struct {
+	size    int64
+	timeout time.Duration
+}
+
+// speedTestFor возвращает параметры замера с учётом полей запроса,
+// nil - замер не запрошен
+func speedTestFor(request TestRequest) (*speedTest, error) {
+	if !request.Speed && request.SpeedSize == 0 && request.SpeedTimeout == 0 {
+		return nil, nil
+	}
+	if request.SpeedSize < 0 || request.SpeedTimeout < 0 {
+		return nil, fmt.Errorf("speed_size and speed_timeout must not be negative")
+	}
+	test := defaultSpeedTest
+	if request.SpeedSize > 0 {
+		test.size = int64(request.SpeedSize)
+	}
+	if request.SpeedTimeout > 0 {
+		test.timeout = time.Duration(request.SpeedTimeout) * time.Second
+	}
+	return &test, nil
+}
+
+// speedResult - итог замера скорости
+type speedResult struct {
+	rate       float64 // МБ/с (10^6 байт)
+	downloaded int64
+	capped     bool // Загрузку притормаживал SPEED_BANDWIDTH_LIMIT, rate - нижняя оценка
+}
+
+// measureSpeed загружает файл через прокси и возвращает скорость и число
+// загруженных байт. Время установки соединения в замер не входит, как и
+// ожидание свободного места под замер; оно ограничено временем замера.
+// Если загрузка не уложилась в ограничение времени, скорость считается по
+// уже загруженной части
+func measureSpeed(proxyURL string, proxy *url.URL, test speedTest, usage *testUsage) (speedResult, error) {
+	if simulation != nil {
+		rate, downloaded, err := simulation.speed(proxyURL, test)
+		return speedResult{rate: rate, downloaded: downloaded}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+	release, err := speedLimiter.Acquire(ctx)
+	cancel()
+	if err != nil {
+		return speedResult{}, fmt.Errorf("speed test: no free slot within %s: %w", test.timeout, err)
+	}
+	defer release()
+
+	client := http.Client{
+		Timeout:   test.timeout,
+		Transport: countingTransport(proxy, usage),
+	}
+	resp, err := client.Get(strings.ReplaceAll(speedTestURL, "{bytes}", strconv.FormatInt(test.size, 10)))
+	if err != nil {
+		return speedResult{}, fmt.Errorf("speed test request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return speedResult{}, fmt.Errorf("speed test: unexpected status code %d", resp.StatusCode)
+	}
+
+	body := speedLimiter.Reader(resp.Request.Context(), resp.Body)
+	start := time.Now()
+	downloaded, err := io.CopyN(io.Discard, body, test.size)
+	elapsed := time.Since(start)
+	if downloaded == 0 || elapsed <= 0 {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return speedResult{}, fmt.Errorf("speed test download failed: %w", err)
+	}
+	return speedResult{
+		rate:       throughput(downloaded, elapsed),
+		downloaded: downloaded,
+		capped:     checker.Throttled(body) > 0,
+	}, nil
+}
+
+// throughput - скорость в МБ/с, округлённая до сотых
+func throughput(bytes int64, elapsed time.Duration) float64 {
+	return math.Round(float64(bytes)/elapsed.Seconds()/1e6*100) / 100
+}
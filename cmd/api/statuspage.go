@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statusPageHistorySize - сколько последних проверок показывает график
+const statusPageHistorySize = 288
+
+// statusPagePattern - допустимый адрес страницы статуса подписки
+var statusPagePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// StatusPoint - итог одной проверки подписки для страницы статуса
+type StatusPoint struct {
+	At    time.Time `json:"at"`
+	Up    int       `json:"up"`
+	Total int       `json:"total"`
+}
+
+// StatusPage - публичная сводка подписки без нод, ссылок и адреса подписки
+type StatusPage struct {
+	Name          string        `json:"name"`
+	Status        string        `json:"status"` // operational, degraded, down или unknown
+	Up            int           `json:"up"`
+	Total         int           `json:"total"`
+	LastCheck     *time.Time    `json:"last_check,omitempty"`
+	UptimePercent float64       `json:"uptime_percent"` // Доля рабочих нод по всем точкам графика
+	History       []StatusPoint `json:"history"`
+}
+
+// registerStatusPageRoutes подключает страницы статуса. Они не входят в
+// группу API, чтобы их можно было открыть наружу отдельно от него
+func registerStatusPageRoutes(r *gin.Engine) {
+	r.GET("/status/:slug", getStatusPage)
+}
+
+// validateStatusPage проверяет адрес страницы статуса, пустой - страница выключена
+func validateStatusPage(slug string) error {
+	if slug != "" && !statusPagePattern.MatchString(slug) {
+		return fmt.Errorf("status_page must be up to 64 letters, digits, '_' or '-'")
+	}
+	return nil
+}
+
+// statusPageTaken сообщает, занят ли адрес другой подпиской. Вызывается под mu
+func statusPageTaken(slug, exceptID string) bool {
+	if slug == "" {
+		return false
+	}
+	for id, sub := range subscriptions {
+		if id != exceptID && sub.StatusPage == slug {
+			return true
+		}
+	}
+	return false
+}
+
+// recordSubscriptionStatus добавляет итог завершённой проверки в график подписки
+func recordSubscriptionStatus(subscriptionID string, up, total int) {
+	if subscriptionID == "" {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	sub, exists := subscriptions[subscriptionID]
+	if !exists {
+		return
+	}
+	sub.Uptime = append(sub.Uptime, StatusPoint{At: now(), Up: up, Total: total})
+	if len(sub.Uptime) > statusPageHistorySize {
+		sub.Uptime = sub.Uptime[len(sub.Uptime)-statusPageHistorySize:]
+	}
+}
+
+// statusPage собирает сводку подписки. Вызывается под mu
+func (s *Subscription) statusPage() StatusPage {
+	page := StatusPage{
+		Name:    s.Name,
+		Status:  "unknown",
+		History: append([]StatusPoint{}, s.Uptime...),
+	}
+	if page.Name == "" {
+		page.Name = s.StatusPage
+	}
+
+	up, total := 0, 0
+	for _, point := range s.Uptime {
+		up += point.Up
+		total += point.Total
+	}
+	if total > 0 {
+		page.UptimePercent = float64(up) / float64(total) * 100
+	}
+
+	if len(s.Uptime) > 0 {
+		last := s.Uptime[len(s.Uptime)-1]
+		page.Up, page.Total, page.LastCheck = last.Up, last.Total, &last.At
+		switch {
+		case last.Total == 0:
+		case last.Up == last.Total:
+			page.Status = "operational"
+		case last.Up == 0:
+			page.Status = "down"
+		default:
+			page.Status = "degraded"
+		}
+	}
+	return page
+}
+
+// getStatusPage отдаёт страницу статуса подписки без авторизации: HTML или,
+// с format=json, JSON. Выключенная страница неотличима от несуществующей
+func getStatusPage(c *gin.Context) {
+	slug := c.Param("slug")
+
+	mu.Lock()
+	var page *StatusPage
+	if slug != "" {
+		for _, sub := range subscriptions {
+			if sub.StatusPage == slug {
+				p := sub.statusPage()
+				page = &p
+				break
+			}
+		}
+	}
+	mu.Unlock()
+
+	if page == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Status page not found"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=30")
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, page)
+		return
+	}
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := statusPageTemplate.Execute(c.Writer, statusPageView(*page)); err != nil {
+		c.Error(err)
+	}
+}
+
+// statusBar - столбец графика доступности
+type statusBar struct {
+	X, Y, Height float64
+	Color, Title string
+}
+
+// statusPageView подготавливает сводку к выводу в шаблон
+func statusPageView(page StatusPage) gin.H {
+	const width, height = 600.0, 60.0
+	bars := make([]statusBar, 0, len(page.History))
+	step := width / statusPageHistorySize
+	offset := width - step*float64(len(page.History))
+	for i, point := range page.History {
+		ratio := 0.0
+		if point.Total > 0 {
+			ratio = float64(point.Up) / float64(point.Total)
+		}
+		color := "#2da44e"
+		switch {
+		case ratio == 0:
+			color = "#cf222e"
+		case ratio < 1:
+			color = "#d4a72c"
+		}
+		barHeight := 4 + (height-4)*ratio
+		bars = append(bars, statusBar{
+			X:      offset + float64(i)*step,
+			Y:      height - barHeight,
+			Height: barHeight,
+			Color:  color,
+			Title:  fmt.Sprintf("%s: %d/%d", point.At.UTC().Format("2006-01-02 15:04 UTC"), point.Up, point.Total),
+		})
+	}
+
+	lastCheck := "never"
+	if page.LastCheck != nil {
+		lastCheck = page.LastCheck.UTC().Format("2006-01-02 15:04 UTC")
+	}
+	return gin.H{
+		"Page":      page,
+		"Bars":      bars,
+		"BarWidth":  step * 0.8,
+		"Uptime":    fmt.Sprintf("%.2f", page.UptimePercent),
+		"LastCheck": lastCheck,
+	}
+}
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="60">
+<title>{{.Page.Name}} status</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 640px; margin: 40px auto; padding: 0 20px; color: #1f2328; }
+.status { font-size: 1.4em; margin: 8px 0; }
+.operational { color: #2da44e; } .degraded { color: #d4a72c; } .down { color: #cf222e; } .unknown { color: #656d76; }
+.muted { color: #656d76; font-size: 0.9em; }
+svg { width: 100%; height: auto; background: #f6f8fa; border-radius: 4px; }
+</style>
+</head>
+<body>
+<h1>{{.Page.Name}}</h1>
+<div class="status {{.Page.Status}}">{{.Page.Status}}: {{.Page.Up}} of {{.Page.Total}} nodes up</div>
+<p class="muted">Uptime {{.Uptime}}% over the last {{len .Page.History}} checks. Last check: {{.LastCheck}}.</p>
+<svg viewBox="0 0 600 60" preserveAspectRatio="none" role="img" aria-label="Uptime history">
+{{- $w := .BarWidth}}{{range .Bars}}
+<rect x="{{.X}}" y="{{.Y}}" width="{{$w}}" height="{{.Height}}" fill="{{.Color}}"><title>{{.Title}}</title></rect>
+{{- end}}
+</svg>
+</body>
+</html>
+`))
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamChunkSize - сколько записей копируется под mu за раз. Между
+// порциями блокировка отпускается, а запись ждёт, пока клиент прочитает
+// предыдущие строки, поэтому медленный потребитель не держит mu и не
+// заставляет сервер накапливать весь ответ в памяти
+const streamChunkSize = 500
+
+// streamStatuses - разделы результата в порядке вывода
+var streamStatuses = []string{"working", "skipped", "failed"}
+
+// StreamRecord - строка NDJSON-потока: раздел результата и запись из него
+type StreamRecord struct {
+	Status string      `json:"status"` // working, skipped или failed
+	Proxy  interface{} `json:"proxy"`
+}
+
+// streamResults отдаёт результаты теста построчно в формате NDJSON: сначала
+// рабочие, затем пропущенные и неработающие прокси. status=working,failed
+// ограничивает вывод перечисленными разделами
+func streamResults(c *gin.Context) {
+	testID := c.Param("id")
+
+	selected := make(map[string]bool)
+	if value := c.Query("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			if status != "working" && status != "skipped" && status != "failed" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status", "details": "status must be a comma-separated list of working, skipped and failed"})
+				return
+			}
+			selected[status] = true
+		}
+	}
+
+	mu.Lock()
+	_, exists := results[testID]
+	mu.Unlock()
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Results not found", "test_id": testID})
+		return
+	}
+
+	lang := requestLanguage(c)
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	ctx := c.Request.Context()
+	for _, status := range streamStatuses {
+		if len(selected) > 0 && !selected[status] {
+			continue
+		}
+		for offset := 0; ; offset += streamChunkSize {
+			if ctx.Err() != nil {
+				return
+			}
+			chunk, ok := resultChunk(testID, status, offset, lang)
+			if !ok {
+				return
+			}
+			if len(chunk) == 0 {
+				break
+			}
+			for _, entry := range chunk {
+				if err := encoder.Encode(StreamRecord{Status: status, Proxy: entry}); err != nil {
+					return
+				}
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// resultChunk копирует под mu до streamChunkSize записей раздела начиная с
+// offset. false - результат удалён, пока шла отдача
+func resultChunk(testID, status string, offset int, lang string) ([]interface{}, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	result, exists := results[testID]
+	if !exists {
+		return nil, false
+	}
+
+	var chunk []interface{}
+	switch status {
+	case "working":
+		from, to := chunkBounds(len(result.WorkingProxies), offset)
+		for _, proxy := range result.WorkingProxies[from:to] {
+			chunk = append(chunk, proxy)
+		}
+	case "skipped":
+		from, to := chunkBounds(len(result.SkippedProxies), offset)
+		for _, proxy := range result.SkippedProxies[from:to] {
+			chunk = append(chunk, proxy)
+		}
+	case "failed":
+		from, to := chunkBounds(len(result.FailedProxies), offset)
+		for _, proxy := range localizeFailures(lang, result.FailedProxies[from:to]) {
+			chunk = append(chunk, proxy)
+		}
+	}
+	return chunk, true
+}
+
+// chunkBounds возвращает границы порции, начинающейся с offset, среди n записей
+func chunkBounds(n, offset int) (int, int) {
+	from, to := offset, offset+streamChunkSize
+	if from > n {
+		from = n
+	}
+	if to > n {
+		to = n
+	}
+	return from, to
+}
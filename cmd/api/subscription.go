@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"projectx/proxytestlib/importer"
+	"projectx/utils"
+)
+
+// subscriptionMaxSize - ограничение размера ответа подписки
+const subscriptionMaxSize = 10 << 20
+
+// fetchSubscription загружает подписку и возвращает ссылки на прокси.
+// Поддерживаются список ссылок (в base64 или открытым текстом), а также
+// YAML Clash и JSON sing-box
+func fetchSubscription(subscriptionURL string) ([]string, error) {
+	body, err := download(subscriptionURL, subscriptionMaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := subscriptionLinks(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("subscription contains no proxy links")
+	}
+	return links, nil
+}
+
+// fetchAllowedNetworks - внутренние сети, к которым download всё же может
+// обращаться (FETCH_ALLOWED_NETWORKS, адреса и CIDR через запятую)
+var fetchAllowedNetworks = loadFetchAllowedNetworks()
+
+// fetchDeniedNetworks - внутренние и служебные сети, которые не покрывают
+// проверки netip.Addr: вся 0.0.0.0/8, CGNAT (в облаках на нём часто
+// внутренние сервисы), служебные и зарезервированные диапазоны IPv4,
+// локальный NAT64 и устаревшие site-local адреса IPv6
+var fetchDeniedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("fec0::/10"),
+}
+
+// Адреса IPv6, в которые завёрнут адрес IPv4: он проверяется как обычный IPv4
+var (
+	nat64Network     = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFourNetwork = netip.MustParsePrefix("2002::/16")
+)
+
+func loadFetchAllowedNetworks() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(os.Getenv("FETCH_ALLOWED_NETWORKS"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if addr, err := netip.ParseAddr(item); err == nil {
+				prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			log.Printf("Invalid FETCH_ALLOWED_NETWORKS entry %q, skipping", item)
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// fetchClient загружает ресурсы по адресам из запросов. Соединения с
+// внутренними адресами (см. internalAddress) отклоняются при подключении, уже
+// после разрешения имени, поэтому их не обойти ни DNS, ни редиректом.
+// Прокси из окружения не используется: через него проверка не видела бы цель
+var fetchClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: guardFetchAddress}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		ForceAttemptHTTP2:   true,
+	},
+}
+
+// guardFetchAddress отклоняет подключение к внутреннему адресу, если его
+// сеть не разрешена в FETCH_ALLOWED_NETWORKS
+func guardFetchAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("unexpected dial address %s", address)
+	}
+	addr = addr.Unmap()
+	if !internalAddress(addr) {
+		return nil
+	}
+	for _, prefix := range fetchAllowedNetworks {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("address %s is internal, allow it with FETCH_ALLOWED_NETWORKS", addr)
+}
+
+// internalAddress сообщает, что addr - loopback, частный, link-local или
+// неуказанный адрес, адрес из fetchDeniedNetworks или такой адрес IPv4,
+// завёрнутый в NAT64 или 6to4
+func internalAddress(addr netip.Addr) bool {
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range fetchDeniedNetworks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if embedded, ok := embeddedIPv4(addr); ok {
+		return internalAddress(embedded)
+	}
+	return false
+}
+
+// embeddedIPv4 извлекает адрес IPv4 из адреса NAT64 (64:ff9b::/96) или
+// 6to4 (2002::/16)
+func embeddedIPv4(addr netip.Addr) (netip.Addr, bool) {
+	b := addr.As16()
+	switch {
+	case nat64Network.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[12:16])), true
+	case sixToFourNetwork.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[2:6])), true
+	}
+	return netip.Addr{}, false
+}
+
+// download загружает http(s)-ресурс не больше maxSize байт. Внутренние
+// адреса запрещены, см. fetchClient
+func download(rawURL string, maxSize int) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme: %s", u.Scheme)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Xray-Checker")
+	req.Header.Set("Accept", "*/*")
+
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", u.Host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(body) > maxSize {
+		return nil, fmt.Errorf("response is larger than %d bytes", maxSize)
+	}
+	return body, nil
+}
+
+// subscriptionLinks разбирает тело подписки
+func subscriptionLinks(body []byte) ([]string, error) {
+	content := strings.TrimSpace(string(body))
+
+	// Base64 в подписках часто разбит на строки
+	if decoded, err := utils.AutoDecode(strings.Join(strings.Fields(content), "")); err == nil {
+		content = strings.TrimSpace(string(decoded))
+	}
+
+	if importer.IsSingBox([]byte(content)) {
+		return importer.SingBoxLinks([]byte(content))
+	}
+	if strings.Contains(content, "proxies:") {
+		if links, err := importer.ClashLinks([]byte(content)); err == nil {
+			return links, nil
+		}
+	}
+
+	var links []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || !strings.Contains(line, "://") {
+			continue
+		}
+		links = append(links, line)
+	}
+	return links, nil
+}
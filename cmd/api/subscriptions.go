@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"projectx/proxytestlib/rewriter"
+)
+
+const (
+	// subscriptionMinInterval - не чаще раза в минуту, чтобы не нагружать провайдера
+	subscriptionMinInterval = 60
+	// subscriptionHistorySize - сколько последних обновлений хранится
+	subscriptionHistorySize = 20
+)
+
+// Subscription - сохранённая подписка. Планировщик обновляет её раз в interval
+// секунд, сравнивает набор нод с предыдущим и запускает проверку
+type Subscription struct {
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	URL           string                 `json:"url"`
+	Interval      int                    `json:"interval"`              // Секунд между обновлениями, 0 - только вручную
+	Timeout       int                    `json:"timeout"`               // Таймаут проверки одного прокси, секунд
+	CheckOnChange bool                   `json:"check_on_change"`       // Проверять, только если набор нод изменился
+	StatusPage    string                 `json:"status_page,omitempty"` // Адрес публичной страницы /status/<status_page>
+	Links         []string               `json:"links"`
+	LastRefresh   time.Time              `json:"last_refresh"`
+	LastError     string                 `json:"last_error,omitempty"`
+	LastTestID    string                 `json:"last_test_id,omitempty"`
+	History       []*SubscriptionRefresh `json:"history"` // Новые записи в конце
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+	Uptime        []StatusPoint          `json:"-"` // Итоги проверок для страницы статуса
+
+	refreshing bool
+}
+
+// SubscriptionRefresh - итог одного обновления подписки
+type SubscriptionRefresh struct {
+	At      time.Time `json:"at"`
+	Total   int       `json:"total"`
+	Added   []string  `json:"added"`
+	Removed []string  `json:"removed"`
+	TestID  string    `json:"test_id,omitempty"` // Запущенная проверка
+	Error   string    `json:"error,omitempty"`
+}
+
+// SubscriptionRequest - тело запроса на создание или изменение подписки
+type SubscriptionRequest struct {
+	Name          string `json:"name"`
+	URL           string `json:"url"`
+	Interval      int    `json:"interval"`
+	Timeout       int    `json:"timeout"`
+	CheckOnChange bool   `json:"check_on_change"`
+	StatusPage    string `json:"status_page"` // Пусто - без страницы статуса
+}
+
+var subscriptions = make(map[string]*Subscription)
+
+// registerSubscriptionRoutes подключает эндпоинты подписок к группе API
+func registerSubscriptionRoutes(api *gin.RouterGroup) {
+	api.POST("/subscriptions", createSubscription)
+	api.GET("/subscriptions", listSubscriptions)
+	api.GET("/subscriptions/:id", getSubscription)
+	api.PUT("/subscriptions/:id", updateSubscription)
+	api.DELETE("/subscriptions/:id", deleteSubscription)
+	api.POST("/subscriptions/:id/refresh", refreshSubscriptionNow)
+}
+
+// validate проверяет запрос и подставляет значения по умолчанию
+func (r *SubscriptionRequest) validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	if r.Interval < 0 || (r.Interval > 0 && r.Interval < subscriptionMinInterval) {
+		return fmt.Errorf("interval must be 0 or at least %d seconds", subscriptionMinInterval)
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = 30
+	}
+	return validateStatusPage(r.StatusPage)
+}
+
+// createSubscription сохраняет подписку и сразу выполняет первое обновление
+func createSubscription(c *gin.Context) {
+	var request SubscriptionRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if err := request.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription", "details": err.Error()})
+		return
+	}
+
+	sub := newSubscription(request)
+
+	mu.Lock()
+	if statusPageTaken(request.StatusPage, "") {
+		mu.Unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": "status_page is used by another subscription"})
+		return
+	}
+	subscriptions[sub.ID] = sub
+	mu.Unlock()
+
+	// Ошибка первой загрузки не мешает созданию: подписка будет обновлена по расписанию
+	refresh, _ := refreshSubscription(sub.ID)
+
+	mu.Lock()
+	body := gin.H{"subscription": sub.summary(), "refresh": refresh}
+	mu.Unlock()
+	c.JSON(http.StatusCreated, body)
+}
+
+// newSubscription создаёт подписку из проверенного запроса
+func newSubscription(request SubscriptionRequest) *Subscription {
+	now := now()
+	return &Subscription{
+		ID:            ids.NewID("sub"),
+		Name:          request.Name,
+		URL:           request.URL,
+		Interval:      request.Interval,
+		Timeout:       request.Timeout,
+		CheckOnChange: request.CheckOnChange,
+		StatusPage:    request.StatusPage,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+// listSubscriptions возвращает краткие сведения о всех подписках
+func listSubscriptions(c *gin.Context) {
+	mu.Lock()
+	list := make([]gin.H, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		list = append(list, sub.summary())
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i]["id"].(string) < list[j]["id"].(string) })
+	c.JSON(http.StatusOK, gin.H{"subscriptions": list})
+}
+
+// getSubscription возвращает подписку с текущими ссылками и историей обновлений
+func getSubscription(c *gin.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	sub, exists := subscriptions[c.Param("id")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// updateSubscription меняет параметры подписки. Смена URL не сбрасывает
+// текущие ссылки: разница будет видна при следующем обновлении
+func updateSubscription(c *gin.Context) {
+	var request SubscriptionRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if err := request.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription", "details": err.Error()})
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	sub, exists := subscriptions[c.Param("id")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+	if statusPageTaken(request.StatusPage, sub.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "status_page is used by another subscription"})
+		return
+	}
+	sub.Name = request.Name
+	sub.URL = request.URL
+	sub.Interval = request.Interval
+	sub.Timeout = request.Timeout
+	sub.CheckOnChange = request.CheckOnChange
+	sub.StatusPage = request.StatusPage
+	sub.UpdatedAt = now()
+	c.JSON(http.StatusOK, sub.summary())
+}
+
+// deleteSubscription удаляет подписку. Уже запущенные проверки не прерываются
+func deleteSubscription(c *gin.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, exists := subscriptions[c.Param("id")]; !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+	delete(subscriptions, c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Subscription deleted"})
+}
+
+// refreshSubscriptionNow обновляет подписку вне расписания
+func refreshSubscriptionNow(c *gin.Context) {
+	refresh, err := refreshSubscription(c.Param("id"))
+	switch {
+	case refresh == nil && err == nil:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+	case refresh == nil:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to load subscription", "details": err.Error(), "refresh": refresh})
+	default:
+		c.JSON(http.StatusOK, refresh)
+	}
+}
+
+// refreshSubscription загружает подписку, сравнивает ноды с предыдущей
+// загрузкой и запускает проверку. Ошибка загрузки записывается в историю.
+// Возвращает nil, nil, если подписки нет
+func refreshSubscription(id string) (*SubscriptionRefresh, error) {
+	mu.Lock()
+	sub, exists := subscriptions[id]
+	if !exists {
+		mu.Unlock()
+		return nil, nil
+	}
+	if sub.refreshing {
+		mu.Unlock()
+		return nil, fmt.Errorf("subscription %s is already being refreshed", id)
+	}
+	sub.refreshing = true
+	subscriptionURL := sub.URL
+	mu.Unlock()
+
+	links, err := fetchSubscription(subscriptionURL)
+
+	mu.Lock()
+	sub.refreshing = false
+	if subscriptions[id] != sub {
+		// Подписку удалили во время загрузки
+		mu.Unlock()
+		return nil, nil
+	}
+	refresh := &SubscriptionRefresh{At: now()}
+	sub.LastRefresh = refresh.At
+	sub.History = append(sub.History, refresh)
+	if len(sub.History) > subscriptionHistorySize {
+		sub.History = sub.History[len(sub.History)-subscriptionHistorySize:]
+	}
+	if err != nil {
+		sub.LastError = err.Error()
+		refresh.Error = err.Error()
+		mu.Unlock()
+		log.Printf("Subscription %s refresh failed: %v", id, err)
+		return refresh, err
+	}
+
+	first := sub.Links == nil
+	refresh.Added, refresh.Removed = diffLinks(sub.Links, links)
+	refresh.Total = len(links)
+	sub.Links = links
+	sub.LastError = ""
+	changed := first || len(refresh.Added) > 0 || len(refresh.Removed) > 0
+	name, timeout := sub.Name, sub.Timeout
+	check := !sub.CheckOnChange || changed
+	mu.Unlock()
+
+	log.Printf("Subscription %s refreshed: %d nodes, %d added, %d removed", id, len(links), len(refresh.Added), len(refresh.Removed))
+	if !check {
+		return refresh, nil
+	}
+
+	if name == "" {
+		name = "subscription " + id
+	}
+	test := launchTest(name, appendLinks(nil, links), len(links), timeout, testOptions{rules: rewriteRules, subscription: id})
+
+	mu.Lock()
+	refresh.TestID = test.ID
+	sub.LastTestID = test.ID
+	mu.Unlock()
+	return refresh, nil
+}
+
+// diffLinks сравнивает наборы нод. Нода определяется ссылкой без
+// фрагмента, поэтому переименование в подписке не считается заменой ноды
+func diffLinks(before, after []string) (added, removed []string) {
+	key := func(link string) string {
+		if i := strings.IndexByte(link, '#'); i >= 0 {
+			return link[:i]
+		}
+		return link
+	}
+
+	old := make(map[string]bool, len(before))
+	for _, link := range before {
+		old[key(link)] = true
+	}
+	current := make(map[string]bool, len(after))
+	for _, link := range after {
+		current[key(link)] = true
+		if !old[key(link)] {
+			added = append(added, rewriter.LinkName(link))
+		}
+	}
+	for _, link := range before {
+		if !current[key(link)] {
+			removed = append(removed, rewriter.LinkName(link))
+		}
+	}
+	return added, removed
+}
+
+// summary - сведения о подписке без списка ссылок и истории
+func (s *Subscription) summary() gin.H {
+	return gin.H{
+		"id":           s.ID,
+		"name":         s.Name,
+		"url":          s.URL,
+		"interval":     s.Interval,
+		"status_page":  s.StatusPage,
+		"size":         len(s.Links),
+		"last_refresh": s.LastRefresh.Format(time.RFC3339),
+		"last_error":   s.LastError,
+		"last_test_id": s.LastTestID,
+		"created_at":   s.CreatedAt.Format(time.RFC3339),
+		"updated_at":   s.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// startSubscriptionScheduler обновляет подписки, у которых задан interval
+func startSubscriptionScheduler() {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			var due []string
+			mu.Lock()
+			for id, sub := range subscriptions {
+				if sub.Interval <= 0 || sub.refreshing {
+					continue
+				}
+				if since(sub.LastRefresh) >= time.Duration(sub.Interval)*time.Second {
+					due = append(due, id)
+				}
+			}
+			mu.Unlock()
+
+			// Ошибки загрузки refreshSubscription пишет в лог и историю сам
+			for _, id := range due {
+				go refreshSubscription(id)
+			}
+		}
+	}()
+}
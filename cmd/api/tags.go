@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"projectx/proxytestlib/models"
+)
+
+// taggedConfig - элемент configs в виде объекта, когда ссылке нужны теги:
+//
+//	{"link": "vless://...", "tags": ["premium", "us-nodes"]}
+type taggedConfig struct {
+	Link string   `json:"link"`
+	Tags []string `json:"tags"`
+}
+
+// configEntry разбирает элемент configs: строку со ссылкой или taggedConfig.
+// К тегам объекта добавляются теги из параметра tags самой ссылки
+func configEntry(config json.RawMessage) (string, []string, error) {
+	var entry taggedConfig
+	if err := json.Unmarshal(config, &entry.Link); err != nil {
+		if err := json.Unmarshal(config, &entry); err != nil || entry.Link == "" {
+			return "", nil, fmt.Errorf("config must be a link or an object with link and tags")
+		}
+	}
+	return entry.Link, models.NormalizeTags(append(entry.Tags, linkTags(entry.Link)...)), nil
+}
+
+// linkTags возвращает теги из параметра tags ссылки. Ссылки VMess в base64
+// параметров не имеют, их теги задаются только объектом
+func linkTags(link string) []string {
+	_, rest, found := strings.Cut(link, "?")
+	if !found {
+		return nil
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	query, err := url.ParseQuery(rest)
+	if err != nil {
+		return nil
+	}
+	return models.ParseTags(query.Get("tags"))
+}
+
+// filterByTags оставляет конфиги, которые проходят фильтры include_tags и
+// exclude_tags. Конфиги, которые не удалось разобрать, отбрасываются
+func filterByTags(configs []json.RawMessage, include, exclude []string) []json.RawMessage {
+	var filtered []json.RawMessage
+	for _, config := range configs {
+		_, tags, err := configEntry(config)
+		if err == nil && models.MatchTags(tags, include, exclude) {
+			filtered = append(filtered, config)
+		}
+	}
+	return filtered
+}
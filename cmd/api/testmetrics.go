@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Метрики снимка одного теста. Метки прокси повторяют метки xray_proxy_*
+// долгоживущего сервера метрик, плюс test_id и link_id, который различает
+// прокси с одинаковыми протоколом, адресом и именем
+var (
+	snapshotProxyLabels = []string{"test_id", "protocol", "address", "name", "link_id"}
+
+	snapshotProxyStatus = prometheus.NewDesc("proxy_api_test_proxy_status",
+		"Outcome of the proxy check in the test (1: working, 0: failed)", snapshotProxyLabels, nil)
+	snapshotProxyLatency = prometheus.NewDesc("proxy_api_test_proxy_latency_ms",
+		"Latency of the check request through a working proxy in milliseconds", snapshotProxyLabels, nil)
+	snapshotProxySpeed = prometheus.NewDesc("proxy_api_test_proxy_download_bytes_per_second",
+		"Download throughput through a working proxy, if speed was measured", snapshotProxyLabels, nil)
+	snapshotProxyFailure = prometheus.NewDesc("proxy_api_test_proxy_failure",
+		"Failure category of a failed proxy, always 1", append(snapshotProxyLabels, "category"), nil)
+	snapshotProxies = prometheus.NewDesc("proxy_api_test_proxies",
+		"Number of proxies in the test by outcome", []string{"test_id", "status"}, nil)
+	snapshotSuccessRate = prometheus.NewDesc("proxy_api_test_success_ratio",
+		"Share of checked proxies that work, from 0 to 1", []string{"test_id"}, nil)
+	snapshotDuration = prometheus.NewDesc("proxy_api_test_duration_seconds",
+		"Time the test took", []string{"test_id"}, nil)
+)
+
+// testSnapshot отдаёт результат завершённого теста как метрики с отметками
+// времени: рабочие прокси и итоги - на время завершения теста, неработающие -
+// на время их отказа
+type testSnapshot struct {
+	result      TestResult
+	completedAt time.Time
+}
+
+// Describe ничего не сообщает: набор меток зависит от теста, а реестр
+// снимка живёт один запрос
+func (s *testSnapshot) Describe(chan<- *prometheus.Desc) {}
+
+func (s *testSnapshot) Collect(ch chan<- prometheus.Metric) {
+	testID := s.result.TestID
+	seen := make(map[string]int)
+	labels := func(link, protocol, server string, port int, name string) []string {
+		return []string{testID, protocol, net.JoinHostPort(server, strconv.Itoa(port)), name, linkID(link, seen)}
+	}
+	gauge := func(at time.Time, desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.NewMetricWithTimestamp(at, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...))
+	}
+
+	for _, proxy := range s.result.WorkingProxies {
+		values := labels(proxy.Link, proxy.Protocol, proxy.Server, proxy.Port, proxy.Name)
+		gauge(s.completedAt, snapshotProxyStatus, 1, values...)
+		if latency, err := time.ParseDuration(proxy.Latency); err == nil {
+			gauge(s.completedAt, snapshotProxyLatency, float64(latency)/float64(time.Millisecond), values...)
+		}
+		if proxy.Downloaded > 0 {
+			gauge(s.completedAt, snapshotProxySpeed, proxy.Throughput*1e6, values...)
+		}
+	}
+	for _, proxy := range s.result.FailedProxies {
+		values := labels(proxy.Link, proxy.Protocol, proxy.Server, proxy.Port, proxy.Name)
+		at := proxy.FailedAt
+		if at.IsZero() {
+			at = s.completedAt
+		}
+		gauge(at, snapshotProxyStatus, 0, values...)
+		gauge(at, snapshotProxyFailure, 1, append(values, proxy.Category)...)
+	}
+
+	gauge(s.completedAt, snapshotProxies, float64(s.result.Successful), testID, "working")
+	gauge(s.completedAt, snapshotProxies, float64(s.result.Failed), testID, "failed")
+	gauge(s.completedAt, snapshotProxies, float64(s.result.Skipped), testID, "skipped")
+	gauge(s.completedAt, snapshotSuccessRate, s.result.SuccessRate/100, testID)
+	if elapsed, err := time.ParseDuration(s.result.Elapsed); err == nil {
+		gauge(s.completedAt, snapshotDuration, elapsed.Seconds(), testID)
+	}
+}
+
+// linkID возвращает метку link_id: начало SHA-256 ссылки, без учётных данных
+// в открытом виде. Повтор той же ссылки, оставленный keep_duplicates,
+// получает суффикс -2, -3 и т.д., чтобы его серии не совпали с первой
+func linkID(link string, seen map[string]int) string {
+	sum := sha256.Sum256([]byte(link))
+	id := hex.EncodeToString(sum[:6])
+	seen[link]++
+	if n := seen[link]; n > 1 {
+		id += "-" + strconv.Itoa(n)
+	}
+	return id
+}
+
+// getTestMetrics возвращает исходы одного теста в формате OpenMetrics с
+// отметками времени. Так разовый запуск в CI передаёт результаты в
+// Prometheus-совместимые инструменты (promtool tsdb create-blocks-from
+// openmetrics, vmagent) без долгоживущего сервера метрик
+func getTestMetrics(c *gin.Context) {
+	testID := c.Param("id")
+	mu.Lock()
+	result, exists := results[testID]
+	if !exists {
+		mu.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Results not found", "test_id": testID})
+		return
+	}
+	snapshot := &testSnapshot{result: *result, completedAt: now()}
+	if test, ok := tests[testID]; ok && !test.CompletedAt.IsZero() {
+		snapshot.completedAt = test.CompletedAt
+	}
+	mu.Unlock()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(snapshot)
+	families, err := registry.Gather()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to collect metrics", "details": err.Error()})
+		return
+	}
+
+	format := expfmt.NewFormat(expfmt.TypeOpenMetrics)
+	c.Header("Content-Type", string(format))
+	encoder := expfmt.NewEncoder(c.Writer, format)
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		closer.Close()
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"projectx/proxytestlib/checker"
+)
+
+// defaultCheckURLs - адреса generate_204 разных компаний: если один
+// заблокирован в регионе, проверка идёт через следующий
+const defaultCheckURLs = "http://www.google.com/generate_204,http://cp.cloudflare.com/generate_204,http://www.gstatic.com/generate_204"
+
+// checkURLs - адреса проверочного запроса из CHECK_URLS через запятую в порядке
+// попыток. Каждый должен отвечать 204 без тела
+var checkURLs = loadCheckURLs()
+
+func loadCheckURLs() []string {
+	value := os.Getenv("CHECK_URLS")
+	if value == "" {
+		value = defaultCheckURLs
+	}
+	var urls []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			urls = append(urls, item)
+		}
+	}
+	return urls
+}
+
+// checkMaxHeaders - сколько заголовков проверочного запроса можно задать
+const checkMaxHeaders = 32
+
+// checkReservedHeaders - заголовки, которыми управляет HTTP-клиент: свои
+// значения сломали бы запрос
+var checkReservedHeaders = map[string]bool{
+	"Host":              true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// checkHeaderName - допустимое имя заголовка (token из RFC 9110)
+var checkHeaderName = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// checkSpec - адреса проверочного запроса, его заголовки и ответ, который
+// считается успехом
+type checkSpec struct {
+	urls   []string
+	header http.Header // nil - заголовки клиента Go, включая его User-Agent
+	expect checker.StatusExpectation
+}
+
+// defaultCheck - проверка по CHECK_URLS, которые отвечают 204
+var defaultCheck = &checkSpec{
+	urls:   checkURLs,
+	expect: checker.StatusExpectation{Codes: []checker.StatusRange{{Min: http.StatusNoContent, Max: http.StatusNoContent}}},
+}
+
+// newCheckSpec собирает проверку теста из полей check_url, expect_status,
+// expect_body, user_agent и check_headers. check_url заменяет CHECK_URLS, и
+// тогда по умолчанию успехом считается любой ответ 2xx, а не только 204.
+// user_agent заменяет User-Agent из check_headers. Без полей - defaultCheck
+func newCheckSpec(checkURL, expectStatus, expectBody, userAgent string, headers map[string]string) (*checkSpec, error) {
+	if checkURL == "" && expectStatus == "" && expectBody == "" && userAgent == "" && len(headers) == 0 {
+		return defaultCheck, nil
+	}
+	spec := &checkSpec{urls: defaultCheck.urls, expect: defaultCheck.expect}
+	if checkURL != "" {
+		u, err := url.Parse(checkURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("check_url must be an http(s) URL")
+		}
+		spec.urls = []string{checkURL}
+		spec.expect = checker.DefaultStatusExpectation
+	}
+	if expectStatus != "" {
+		codes, err := checker.ParseStatusCodes(expectStatus)
+		if err != nil {
+			return nil, err
+		}
+		spec.expect.Codes = codes
+	}
+	spec.expect.BodyContains = expectBody
+
+	if len(headers) > checkMaxHeaders {
+		return nil, fmt.Errorf("check_headers must contain at most %d headers", checkMaxHeaders)
+	}
+	if userAgent != "" || len(headers) > 0 {
+		spec.header = make(http.Header)
+	}
+	for name, value := range headers {
+		if !checkHeaderName.MatchString(name) {
+			return nil, fmt.Errorf("invalid header name %q", name)
+		}
+		if checkReservedHeaders[http.CanonicalHeaderKey(name)] {
+			return nil, fmt.Errorf("header %s cannot be set", http.CanonicalHeaderKey(name))
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return nil, fmt.Errorf("invalid value of header %s", http.CanonicalHeaderKey(name))
+		}
+		spec.header.Set(name, value)
+	}
+	if userAgent != "" {
+		if strings.ContainsAny(userAgent, "\r\n\x00") {
+			return nil, fmt.Errorf("invalid user_agent")
+		}
+		spec.header.Set("User-Agent", userAgent)
+	}
+	return spec, nil
+}
+
+// String описывает проверку для контрольной суммы кеша. Заголовки
+// перечисляются по имени, чтобы порядок в запросе не менял сумму
+func (s *checkSpec) String() string {
+	if s == nil {
+		s = defaultCheck
+	}
+	described := strings.Join(s.urls, ",") + " " + s.expect.String()
+	names := make([]string, 0, len(s.header))
+	for name := range s.header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		described += fmt.Sprintf(" %s=%q", name, s.header.Get(name))
+	}
+	return described
+}
+
+// checkURLErrors - ошибки всех адресов проверки, если ни один не ответил
+type checkURLErrors []error
+
+func (e checkURLErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("all %d check URLs failed: %s", len(e), strings.Join(messages, "; "))
+}
+
+func (e checkURLErrors) Unwrap() []error {
+	return e
+}
+
+// CheckTimings - из чего сложилась задержка проверочного запроса
+type CheckTimings struct {
+	Connect string `json:"connect"`       // Соединение с прокси и установка туннеля, включая TLS
+	TLS     string `json:"tls,omitempty"` // TLS-рукопожатие с проверочным адресом, только для https
+	TTFB    string `json:"ttfb"`          // От отправки запроса до первого байта ответа
+	Total   string `json:"total"`         // Весь запрос, включая чтение тела ответа
+	URL     string `json:"url"`           // Адрес из CHECK_URLS, который ответил
+}
+
+// checkTimings - замеры одного проверочного запроса. latency - время до
+// заголовков ответа, которое тест всегда сообщал как задержку прокси
+type checkTimings struct {
+	latency time.Duration
+	connect time.Duration
+	tls     time.Duration
+	ttfb    time.Duration
+	total   time.Duration
+	url     string
+}
+
+func (t checkTimings) report() *CheckTimings {
+	report := &CheckTimings{
+		Connect: t.connect.String(),
+		TTFB:    t.ttfb.String(),
+		Total:   t.total.String(),
+		URL:     t.url,
+	}
+	if t.tls > 0 {
+		report.TLS = t.tls.String()
+	}
+	return report
+}
+
+// traceCheck выполняет проверочный запрос через прокси, пробуя адреса
+// проверки по порядку до первого ожидаемого ответа (nil - defaultCheck).
+// Каждой попытке достаётся равная доля оставшегося времени, чтобы
+// недоступный адрес не съел его целиком. Трафик запросов учитывается в
+// usage, если он задан
+func traceCheck(proxy *url.URL, spec *checkSpec, timeout time.Duration, usage *testUsage) (checkTimings, error) {
+	if spec == nil {
+		spec = defaultCheck
+	}
+	deadline := time.Now().Add(timeout)
+	var errs checkURLErrors
+	for i, target := range spec.urls {
+		attempt := time.Until(deadline) / time.Duration(len(spec.urls)-i)
+		timings, err := traceRequest(target, proxy, spec, attempt, usage)
+		if err == nil {
+			return timings, nil
+		}
+		if len(spec.urls) == 1 {
+			return timings, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", target, err))
+	}
+	return checkTimings{}, errs
+}
+
+// traceRequest выполняет один проверочный запрос с заголовками проверки и
+// замеряет его этапы через httptrace
+func traceRequest(target string, proxy *url.URL, spec *checkSpec, timeout time.Duration, usage *testUsage) (checkTimings, error) {
+	client := spec.expect.Client(&http.Client{
+		Timeout:   timeout,
+		Transport: countingTransport(proxy, usage),
+	})
+
+	var (
+		timings                         = checkTimings{url: target}
+		getConn, tlsStart, wroteRequest time.Time
+	)
+	trace := &httptrace.ClientTrace{
+		GetConn:           func(string) { getConn = time.Now() },
+		GotConn:           func(httptrace.GotConnInfo) { timings.connect = time.Since(getConn) },
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			timings.tls = time.Since(tlsStart)
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { timings.ttfb = time.Since(wroteRequest) },
+	}
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return timings, err
+	}
+	for name, values := range spec.header {
+		req.Header[name] = values
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return timings, fmt.Errorf("failed to connect via proxy: %w", err)
+	}
+	defer resp.Body.Close()
+	timings.latency = time.Since(start)
+
+	// Страница блокировки с кодом 200 не должна сойти за рабочий прокси
+	head, err := io.ReadAll(io.LimitReader(resp.Body, blockPageLimit))
+	if err != nil {
+		return timings, fmt.Errorf("failed to read response: %w", err)
+	}
+	if blocked := detectBlockPage(target, resp, head); blocked != nil {
+		return timings, blocked
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	ok, mismatch, err := spec.expect.Check(resp)
+	if err != nil {
+		return timings, fmt.Errorf("failed to read response: %w", err)
+	}
+	if !ok {
+		return timings, errors.New(mismatch)
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	timings.total = time.Since(start)
+	return timings, nil
+}
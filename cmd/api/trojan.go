@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"projectx/parser"
+)
+
+// TrojanConfig содержит параметры для Trojan прокси
+type TrojanConfig struct {
+	Password      string
+	Address       string
+	Port          int
+	Network       string
+	TLS           bool
+	SNI           string
+	Fingerprint   string
+	AllowInsecure bool
+	Reality       bool
+	PublicKey     string // Для REALITY (pbk)
+	ShortID       string // Для REALITY (sid)
+	SpiderX       string // Для REALITY (spx)
+	Path          string
+	Host          string
+	ServiceName   string // Для gRPC
+	Mode          string // Для gRPC (multi или gun) и XHTTP
+	Seed          string // Для mKCP
+	HeaderType    string // Для mKCP
+	Fragment      string
+	Inferred      []string // Значения, подставленные по умолчанию, например порт
+}
+
+// ParseTrojanConfig парсит Trojan URL и возвращает TrojanConfig
+func ParseTrojanConfig(trojanURL string) (*TrojanConfig, error) {
+	u, err := url.Parse(trojanURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Trojan URL: %w", err)
+	}
+	if u.Scheme != "trojan" {
+		return nil, fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+
+	password := u.User.Username()
+	if password == "" {
+		return nil, fmt.Errorf("Trojan password not found in URL")
+	}
+
+	address, port, err := parser.SplitHostPort(u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Trojan address: %w", err)
+	}
+
+	query := u.Query()
+	security := query.Get("security")
+	config := &TrojanConfig{
+		Password:      password,
+		Address:       address,
+		Port:          port,
+		Fragment:      u.Fragment,
+		Network:       query.Get("type"),
+		TLS:           security != "none" && security != "reality", // Trojan без явного security=none всегда работает поверх TLS
+		Reality:       security == "reality",
+		PublicKey:     query.Get("pbk"),
+		ShortID:       query.Get("sid"),
+		SpiderX:       query.Get("spx"),
+		SNI:           query.Get("sni"),
+		Fingerprint:   query.Get("fp"),
+		AllowInsecure: parseBoolParam(query.Get("allowInsecure")),
+		Path:          query.Get("path"),
+		Host:          query.Get("host"),
+		ServiceName:   query.Get("serviceName"),
+		Mode:          query.Get("mode"),
+		Seed:          query.Get("seed"),
+		HeaderType:    query.Get("headerType"),
+	}
+	config.Network = normalizeNetwork(config.Network)
+	if config.Network == "" {
+		config.Network = "tcp"
+	}
+	if err := applyDefaultPort("trojan", security, config.Network, &config.Port, &config.Inferred); err != nil {
+		return nil, fmt.Errorf("invalid Trojan address: %w", err)
+	}
+	if config.SNI == "" {
+		config.SNI = config.Host
+	}
+	if config.SNI == "" {
+		config.SNI = config.Address
+	}
+	if err := applyRealityDefaults(config.Reality, config.PublicKey, &config.Fingerprint); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// applyRealityDefaults проверяет обязательный для REALITY публичный ключ и
+// подставляет отпечаток chrome, без которого Xray не устанавливает соединение
+func applyRealityDefaults(reality bool, publicKey string, fingerprint *string) error {
+	if !reality {
+		return nil
+	}
+	if publicKey == "" {
+		return fmt.Errorf("REALITY public key (pbk) not found in URL")
+	}
+	if *fingerprint == "" {
+		*fingerprint = "chrome"
+	}
+	return nil
+}
+
+// applyDefaultPort подставляет типичный для схемы порт, если в ссылке он не
+// указан или равен 0, и записывает подстановку в inferred
+func applyDefaultPort(protocol, security, network string, port *int, inferred *[]string) error {
+	if *port != 0 {
+		return nil
+	}
+	value, reason := parser.DefaultPort(protocol, security, network)
+	if value == 0 {
+		return fmt.Errorf("port not found in URL and no default for %s over %s", protocol, network)
+	}
+	*port = value
+	*inferred = append(*inferred, fmt.Sprintf("port=%d (%s)", value, reason))
+	return nil
+}
+
+// normalizeNetwork приводит устаревшее название транспорта splithttp к xhttp
+func normalizeNetwork(network string) string {
+	if network == "splithttp" {
+		return "xhttp"
+	}
+	return network
+}
+
+// parseBoolParam понимает значения вида 1/0 и true/false из параметров ссылки
+func parseBoolParam(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// trojanTemplate - шаблон конфигурации Xray для Trojan
+const trojanTemplate = `{
+    "log": {
+        "loglevel": "warning"
+    },
+    "inbounds": [
+        {
+            "port": {{inboundPort}},
+            "protocol": "socks",
+            "settings": {
+                "auth": "noauth",
+                "udp": true
+            }
+        }
+    ],
+    "outbounds": [
+        {
+            "protocol": "trojan",
+            "settings": {
+                "servers": [
+                    {
+                        "address": {{json .Address}},
+                        "port": {{.Port}},
+                        "password": {{json .Password}}
+                    }
+                ]
+            },
+            {{template "streamSettings" .}}
+        }
+    ]
+}`
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// udpCheckServer - DNS-сервер, которому через прокси отправляется запрос по UDP
+var udpCheckServer = loadUDPCheckServer()
+
+func loadUDPCheckServer() string {
+	if value := os.Getenv("UDP_CHECK_SERVER"); value != "" {
+		return value
+	}
+	return "1.1.1.1:53"
+}
+
+// udpCheckName - имя, которое запрашивается у DNS-сервера
+const udpCheckName = "example.com"
+
+// UDPReport - результат проверки UDP через прокси
+type UDPReport struct {
+	OK    bool   `json:"udp_ok"`
+	RTT   string `json:"rtt,omitempty"`   // Время от отправки запроса до ответа DNS
+	Error string `json:"error,omitempty"` // Почему UDP не работает
+}
+
+// checkUDP отправляет DNS-запрос через SOCKS5 UDP ASSOCIATE. Для ссылок
+// Xray это локальный socks inbound с включённым UDP, для socks-ссылок -
+// сам сервер. HTTP-прокси UDP не передают
+func checkUDP(proxyURL string, proxy *url.URL, timeout time.Duration, usage *testUsage) *UDPReport {
+	if simulation != nil {
+		return simulation.udp(proxyURL, timeout)
+	}
+	if proxy.Scheme != "socks5" {
+		return &UDPReport{Error: proxy.Scheme + " proxies do not carry UDP"}
+	}
+	rtt, err := socksUDPQuery(proxy, udpCheckServer, timeout, usage)
+	if err != nil {
+		return &UDPReport{Error: err.Error()}
+	}
+	return &UDPReport{OK: true, RTT: rtt.String()}
+}
+
+// socksUDPQuery открывает UDP-ассоциацию на SOCKS5-прокси и отправляет через
+// неё DNS-запрос к server. Управляющее соединение держится открытым, пока
+// ждём ответ: его закрытие завершает ассоциацию
+func socksUDPQuery(proxy *url.URL, server string, timeout time.Duration, usage *testUsage) (time.Duration, error) {
+	deadline := time.Now().Add(timeout)
+	control, err := net.DialTimeout("tcp", proxy.Host, timeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to proxy: %w", err)
+	}
+	defer control.Close()
+	control.SetDeadline(deadline)
+
+	if err := socksHandshake(control, proxy.User); err != nil {
+		return 0, err
+	}
+	// UDP ASSOCIATE без известного заранее адреса клиента
+	if _, err := control.Write([]byte{5, 3, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return 0, err
+	}
+	relay, err := readSocksReply(control)
+	if err != nil {
+		return 0, fmt.Errorf("UDP associate rejected: %w", err)
+	}
+	// Сервер, который слушает на всех адресах, отвечает 0.0.0.0
+	if relay.IP.IsUnspecified() {
+		host, _, _ := net.SplitHostPort(proxy.Host)
+		addrs, err := net.LookupIP(host)
+		if err != nil || len(addrs) == 0 {
+			return 0, fmt.Errorf("failed to resolve proxy %s: %v", host, err)
+		}
+		relay.IP = addrs[0]
+	}
+
+	target, err := net.ResolveUDPAddr("udp", server)
+	if err != nil {
+		return 0, err
+	}
+	conn, err := net.DialUDP("udp", nil, relay)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+
+	id := uint16(rand.Intn(1 << 16))
+	packet := append(socksUDPHeader(target), dnsQuery(id, udpCheckName)...)
+	start := time.Now()
+	if _, err := conn.Write(packet); err != nil {
+		return 0, err
+	}
+	usage.addBytes(len(packet))
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, fmt.Errorf("no UDP reply within %s", timeout)
+			}
+			return 0, err
+		}
+		usage.addBytes(n)
+		payload, err := stripSocksUDPHeader(buf[:n])
+		if err != nil {
+			continue
+		}
+		// Чужие и запоздавшие ответы пропускаются
+		if len(payload) >= 12 && binary.BigEndian.Uint16(payload) == id && payload[2]&0x80 != 0 {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// socksHandshake выбирает метод аутентификации: без неё или по логину и паролю
+func socksHandshake(conn net.Conn, user *url.Userinfo) error {
+	methods := []byte{5, 1, 0}
+	if user != nil {
+		methods = []byte{5, 2, 0, 2}
+	}
+	if _, err := conn.Write(methods); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("SOCKS handshake failed: %w", err)
+	}
+	switch {
+	case reply[0] != 5:
+		return fmt.Errorf("not a SOCKS5 proxy")
+	case reply[1] == 0:
+		return nil
+	case reply[1] == 2 && user != nil:
+		password, _ := user.Password()
+		name := user.Username()
+		if len(name) > 255 || len(password) > 255 {
+			return fmt.Errorf("SOCKS credentials are too long")
+		}
+		auth := append([]byte{1, byte(len(name))}, name...)
+		auth = append(append(auth, byte(len(password))), password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return fmt.Errorf("SOCKS authentication failed: %w", err)
+		}
+		if reply[1] != 0 {
+			return fmt.Errorf("SOCKS authentication rejected")
+		}
+		return nil
+	default:
+		return fmt.Errorf("no acceptable SOCKS authentication method")
+	}
+}
+
+// readSocksReply читает ответ на команду SOCKS5 и возвращает адрес из него
+func readSocksReply(conn net.Conn) (*net.UDPAddr, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[1] != 0 {
+		return nil, fmt.Errorf("SOCKS error code %d", header[1])
+	}
+	var host []byte
+	switch header[3] {
+	case 1:
+		host = make([]byte, net.IPv4len)
+	case 4:
+		host = make([]byte, net.IPv6len)
+	case 3:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return nil, err
+		}
+		host = make([]byte, size[0])
+	default:
+		return nil, fmt.Errorf("unknown SOCKS address type %d", header[3])
+	}
+	if _, err := io.ReadFull(conn, host); err != nil {
+		return nil, err
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return nil, err
+	}
+
+	addr := &net.UDPAddr{Port: int(binary.BigEndian.Uint16(port))}
+	if header[3] == 3 {
+		resolved, err := net.ResolveUDPAddr("udp", net.JoinHostPort(string(host), strconv.Itoa(addr.Port)))
+		if err != nil {
+			return nil, err
+		}
+		return resolved, nil
+	}
+	addr.IP = net.IP(host)
+	return addr, nil
+}
+
+// socksUDPHeader - заголовок датаграммы SOCKS5 с адресом назначения
+func socksUDPHeader(target *net.UDPAddr) []byte {
+	header := []byte{0, 0, 0}
+	if ip4 := target.IP.To4(); ip4 != nil {
+		header = append(append(header, 1), ip4...)
+	} else {
+		header = append(append(header, 4), target.IP.To16()...)
+	}
+	return binary.BigEndian.AppendUint16(header, uint16(target.Port))
+}
+
+// stripSocksUDPHeader отрезает заголовок SOCKS5 от полученной датаграммы
+func stripSocksUDPHeader(packet []byte) ([]byte, error) {
+	if len(packet) < 4 || packet[2] != 0 {
+		return nil, fmt.Errorf("invalid SOCKS UDP packet")
+	}
+	size := 0
+	switch packet[3] {
+	case 1:
+		size = net.IPv4len
+	case 4:
+		size = net.IPv6len
+	case 3:
+		if len(packet) < 5 {
+			return nil, fmt.Errorf("invalid SOCKS UDP packet")
+		}
+		size = 1 + int(packet[4])
+	default:
+		return nil, fmt.Errorf("unknown SOCKS address type %d", packet[3])
+	}
+	if len(packet) < 4+size+2 {
+		return nil, fmt.Errorf("invalid SOCKS UDP packet")
+	}
+	return packet[4+size+2:], nil
+}
+
+// dnsQuery собирает DNS-запрос записи A с рекурсией
+func dnsQuery(id uint16, name string) []byte {
+	query := binary.BigEndian.AppendUint16(nil, id)
+	query = append(query, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0) // RD, один вопрос
+	for _, label := range strings.Split(name, ".") {
+		query = append(append(query, byte(len(label))), label...)
+	}
+	return append(query, 0, 0, 1, 0, 1) // Конец имени, тип A, класс IN
+}
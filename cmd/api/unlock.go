@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unlockUserAgent - браузерный User-Agent: сервисы отдают клиентам без него
+// другие страницы, и по ним нельзя судить о доступности
+const unlockUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+// unlockMaxBody ограничивает размер страницы, которая читается для разбора
+const unlockMaxBody = 1 << 20
+
+// Статусы доступности сервиса через прокси
+const (
+	unlockAvailable = "unlocked"
+	unlockOriginals = "originals_only" // Netflix: открываются только собственные сериалы
+	unlockBlocked   = "blocked"
+	unlockError     = "error" // Сервис не ответил или ответ не удалось разобрать
+)
+
+// UnlockOutcome - доступность одного сервиса через прокси
+type UnlockOutcome struct {
+	Service string `json:"service"`
+	Status  string `json:"status"`           // unlocked, originals_only, blocked или error
+	Region  string `json:"region,omitempty"` // Страна, которую сервис определил по выходному IP
+	Error   string `json:"error,omitempty"`
+}
+
+// unlockService - проверка одного сервиса через HTTP-клиент с прокси
+type unlockService struct {
+	name  string
+	check func(client *http.Client) UnlockOutcome
+}
+
+var unlockServices = []unlockService{
+	{"netflix", checkNetflix},
+	{"youtube_premium", checkYouTubePremium},
+	{"chatgpt", checkChatGPT},
+}
+
+// checkUnlock проверяет через прокси доступность сервисов с региональными
+// ограничениями и блокировками по репутации IP. Сервисы проверяются
+// параллельно, каждый в пределах timeout
+func checkUnlock(proxyURL string, proxy *url.URL, timeout time.Duration, usage *testUsage) []UnlockOutcome {
+	outcomes := make([]UnlockOutcome, len(unlockServices))
+	if simulation != nil {
+		for i, service := range unlockServices {
+			outcomes[i] = simulation.unlock(proxyURL, service.name)
+		}
+		return outcomes
+	}
+
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: countingTransport(proxy, usage),
+	}
+	var wg sync.WaitGroup
+	for i, service := range unlockServices {
+		wg.Add(1)
+		go func(i int, service unlockService) {
+			defer wg.Done()
+			outcomes[i] = service.check(client)
+			outcomes[i].Service = service.name
+		}(i, service)
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// fetchPage загружает страницу с браузерным User-Agent и возвращает ответ
+// с прочитанным телом
+func fetchPage(client *http.Client, target string) (*http.Response, string, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", unlockUserAgent)
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, unlockMaxBody))
+	if err != nil {
+		return nil, "", err
+	}
+	return resp, string(body), nil
+}
+
+func unlockFailed(err error) UnlockOutcome {
+	return UnlockOutcome{Status: unlockError, Error: err.Error()}
+}
+
+// netflixRegion - код страны в пути страницы после редиректа, например /de/title/...
+var netflixRegion = regexp.MustCompile(`^/([a-z]{2})(?:-[a-z]{2})?/`)
+
+// checkNetflix открывает лицензионный фильм, который есть почти во всех
+// каталогах, и собственный сериал Netflix. Лицензионный открылся - каталог
+// полный, только собственный - IP опознан как прокси
+func checkNetflix(client *http.Client) UnlockOutcome {
+	licensed, _, err := fetchPage(client, "https://www.netflix.com/title/81280792")
+	if err != nil {
+		return unlockFailed(err)
+	}
+	outcome := UnlockOutcome{Status: unlockBlocked}
+	if match := netflixRegion.FindStringSubmatch(licensed.Request.URL.Path); match != nil {
+		outcome.Region = strings.ToUpper(match[1])
+	}
+
+	switch licensed.StatusCode {
+	case http.StatusOK:
+		outcome.Status = unlockAvailable
+		if outcome.Region == "" {
+			outcome.Region = "US"
+		}
+	case http.StatusNotFound:
+		original, _, err := fetchPage(client, "https://www.netflix.com/title/80018499")
+		if err != nil {
+			return unlockFailed(err)
+		}
+		if original.StatusCode == http.StatusOK {
+			outcome.Status = unlockOriginals
+		}
+	case http.StatusForbidden:
+	default:
+		return unlockFailed(fmt.Errorf("unexpected status code: %d", licensed.StatusCode))
+	}
+	return outcome
+}
+
+var youtubeRegion = regexp.MustCompile(`"(?:countryCode|GL)":"([A-Z]{2})"`)
+
+// checkYouTubePremium ищет на странице подписки сообщение о том, что Premium
+// в стране недоступен
+func checkYouTubePremium(client *http.Client) UnlockOutcome {
+	resp, body, err := fetchPage(client, "https://www.youtube.com/premium")
+	if err != nil {
+		return unlockFailed(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return unlockFailed(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
+	}
+
+	outcome := UnlockOutcome{Status: unlockAvailable}
+	if match := youtubeRegion.FindStringSubmatch(body); match != nil {
+		outcome.Region = match[1]
+	}
+	switch {
+	case strings.Contains(body, "Premium is not available in your country"):
+		outcome.Status = unlockBlocked
+	case !strings.Contains(body, "ad-free"):
+		return unlockFailed(fmt.Errorf("unrecognized premium page"))
+	}
+	return outcome
+}
+
+// chatGPTBlockedRegions - страны, где OpenAI не предоставляет сервис
+var chatGPTBlockedRegions = map[string]bool{
+	"BY": true, "CN": true, "CU": true, "HK": true, "IR": true,
+	"KP": true, "MO": true, "RU": true, "SY": true,
+}
+
+// checkChatGPT определяет страну выхода по трассировке Cloudflare и
+// спрашивает у API, поддерживается ли она. API отвечает unsupported_country
+// и для адресов, заблокированных по репутации
+func checkChatGPT(client *http.Client) UnlockOutcome {
+	_, trace, err := fetchPage(client, "https://chatgpt.com/cdn-cgi/trace")
+	if err != nil {
+		return unlockFailed(err)
+	}
+	outcome := UnlockOutcome{Status: unlockAvailable}
+	for _, line := range strings.Split(trace, "\n") {
+		if region, ok := strings.CutPrefix(line, "loc="); ok {
+			outcome.Region = strings.TrimSpace(region)
+		}
+	}
+
+	_, body, err := fetchPage(client, "https://api.openai.com/compliance/cookie_requirements")
+	if err != nil {
+		return unlockFailed(err)
+	}
+	if strings.Contains(body, "unsupported_country") || chatGPTBlockedRegions[outcome.Region] {
+		outcome.Status = unlockBlocked
+	}
+	return outcome
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"projectx/proxytestlib/models"
+)
+
+// testRequestFields - имена полей TestRequest в JSON, они же поля формы
+var testRequestFields = jsonFieldNames(reflect.TypeOf(TestRequest{}))
+
+// bindTestRequest читает запрос на запуск теста из JSON или из
+// multipart/form-data. В форме поля называются так же, как в JSON, поля-объекты
+// и массивы (configs, rewrite_rules, singbox, sample, content_targets)
+// передаются как JSON, а файлы со ссылками - в поле file (можно несколько).
+// Неизвестные поля формы - ошибка, чтобы опечатка не меняла тест молча:
+//
+//	curl -F file=@links.txt -F timeout=10 http://localhost:8080/api/v1/tests
+func bindTestRequest(c *gin.Context) (TestRequest, error) {
+	var request TestRequest
+	if c.ContentType() != "multipart/form-data" {
+		err := c.BindJSON(&request)
+		return request, err
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return request, fmt.Errorf("invalid multipart form: %w", err)
+	}
+	var unknown []string
+	for key := range form.Value {
+		if !testRequestFields[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	for key := range form.File {
+		if key != "file" {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return request, fmt.Errorf("unknown form fields: %s", strings.Join(unknown, ", "))
+	}
+
+	value := func(key string) string {
+		if values := form.Value[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	number := func(key string) (int, error) {
+		if value(key) == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(value(key))
+		if err != nil {
+			return 0, fmt.Errorf("%s must be a number", key)
+		}
+		return n, nil
+	}
+	flag := func(key string) bool {
+		enabled, _ := strconv.ParseBool(value(key))
+		return enabled
+	}
+	object := func(key string, target interface{}) error {
+		if value(key) == "" {
+			return nil
+		}
+		if err := json.Unmarshal([]byte(value(key)), target); err != nil {
+			return fmt.Errorf("%s must be JSON: %w", key, err)
+		}
+		return nil
+	}
+
+	request.Name = value("name")
+	request.Namespace = value("namespace")
+	request.URIs = value("uris")
+	request.Reference = value("reference")
+	request.Subscription = value("subscription_url")
+	request.ConfigFile = value("config_file")
+	request.ConfigChecksum = value("config_file_sha256")
+	request.CheckURL = value("check_url")
+	request.ExpectStatus = value("expect_status")
+	request.ExpectBody = value("expect_body")
+	request.LatencyMode = value("latency_mode")
+	request.UserAgent = value("user_agent")
+	request.Clash = value("clash")
+	for key, target := range map[string]interface{}{
+		"configs":         &request.Configs,
+		"rewrite_rules":   &request.RewriteRules,
+		"singbox":         &request.SingBox,
+		"sample":          &request.Sample,
+		"content_targets": &request.ContentTargets,
+	} {
+		if err := object(key, target); err != nil {
+			return request, err
+		}
+	}
+	if request.CheckHeaders, err = headerLines(form.Value["check_headers"]); err != nil {
+		return request, err
+	}
+	request.SkipGarbage = flag("skip_garbage")
+	request.Ping = flag("ping")
+	request.KeepDuplicates = flag("keep_duplicates")
+	request.ContentCheck = flag("content_check")
+	request.Speed = flag("speed")
+	request.UnlockCheck = flag("unlock_check")
+	request.ExitIP = flag("exit_ip")
+	request.Reputation = flag("reputation")
+	request.DNSLeak = flag("dns_leak")
+	request.UDPCheck = flag("udp_check")
+	request.CertCheck = flag("cert_check")
+	request.Preflight = flag("preflight")
+	request.TLSCheck = flag("tls_check")
+	request.UseCache = flag("use_cache")
+	request.IncludeTags = models.ParseTags(value("include_tags"))
+	request.ExcludeTags = models.ParseTags(value("exclude_tags"))
+	if request.ProxyCount, err = number("proxy_count"); err != nil {
+		return request, err
+	}
+	if request.Timeout, err = number("timeout"); err != nil {
+		return request, err
+	}
+	if request.Budget, err = number("budget"); err != nil {
+		return request, err
+	}
+	if request.SpeedSize, err = number("speed_size"); err != nil {
+		return request, err
+	}
+	if request.SpeedTimeout, err = number("speed_timeout"); err != nil {
+		return request, err
+	}
+	if request.Probes, err = number("probes"); err != nil {
+		return request, err
+	}
+
+	for _, header := range form.File["file"] {
+		file, err := header.Open()
+		if err != nil {
+			return request, fmt.Errorf("failed to open %s: %w", header.Filename, err)
+		}
+		body, err := io.ReadAll(io.LimitReader(file, subscriptionMaxSize+1))
+		file.Close()
+		if err != nil {
+			return request, fmt.Errorf("failed to read %s: %w", header.Filename, err)
+		}
+		if len(body) > subscriptionMaxSize {
+			return request, fmt.Errorf("%s is larger than %d bytes", header.Filename, subscriptionMaxSize)
+		}
+
+		// Файл может быть и экспортом подписки: base64, Clash или sing-box
+		links, err := subscriptionLinks(body)
+		if err != nil {
+			return request, fmt.Errorf("invalid %s: %w", header.Filename, err)
+		}
+		request.Configs = appendLinks(request.Configs, links)
+	}
+	return request, nil
+}
+
+// jsonFieldNames возвращает имена полей структуры из тегов json
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// uriLines разбирает список ссылок по одной на строку. Пустые строки и
+// комментарии с # пропускаются, остальные строки попадают в тест как есть,
+// чтобы опечатки были видны в отчёте о неработающих нодах
+func uriLines(text string) []string {
+	var links []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		links = append(links, line)
+	}
+	return links
+}
+
+// headerLines разбирает поля формы check_headers вида "Name: value". Поле
+// может повторяться, а в одном поле заголовки можно перечислить по строкам
+func headerLines(fields []string) (map[string]string, error) {
+	var headers map[string]string
+	for _, field := range fields {
+		for _, line := range strings.Split(field, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			name, value, found := strings.Cut(line, ":")
+			if !found {
+				return nil, fmt.Errorf("check_headers must be \"Name: value\" lines")
+			}
+			if headers == nil {
+				headers = make(map[string]string)
+			}
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return headers, nil
+}
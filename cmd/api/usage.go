@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultNamespace - пространство имён тестов, запущенных без namespace
+const defaultNamespace = "default"
+
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ResourceUsage - ресурсы, потраченные тестом. CPU и память считаются по
+// процессам Xray теста: сам API обслуживает все тесты сразу, и его время
+// между ними не делится
+type ResourceUsage struct {
+	RuntimeSeconds   float64 `json:"runtime_seconds"`
+	CPUSeconds       float64 `json:"cpu_seconds"`       // user + system процессов Xray
+	PeakMemoryBytes  int64   `json:"peak_memory_bytes"` // Наибольший RSS одного процесса Xray
+	BytesTransferred int64   `json:"bytes_transferred"` // Трафик проверочных запросов через прокси
+	XrayProcesses    int     `json:"xray_processes"`
+}
+
+// add суммирует usage, для памяти берётся максимум
+func (u *ResourceUsage) add(usage ResourceUsage) {
+	u.RuntimeSeconds += usage.RuntimeSeconds
+	u.CPUSeconds += usage.CPUSeconds
+	u.BytesTransferred += usage.BytesTransferred
+	u.XrayProcesses += usage.XrayProcesses
+	if usage.PeakMemoryBytes > u.PeakMemoryBytes {
+		u.PeakMemoryBytes = usage.PeakMemoryBytes
+	}
+}
+
+// NamespaceUsage - суммарные ресурсы тестов пространства имён с запуска сервера
+type NamespaceUsage struct {
+	Namespace string        `json:"namespace"`
+	Tests     int           `json:"tests"`
+	Usage     ResourceUsage `json:"usage"`
+	Quota     ResourceQuota `json:"quota"`
+}
+
+// ResourceQuota - лимиты на пространство имён, 0 - без ограничения.
+// Задаются переменными NAMESPACE_QUOTA_*
+type ResourceQuota struct {
+	CPUSeconds       int `json:"cpu_seconds,omitempty"`
+	BytesTransferred int `json:"bytes_transferred,omitempty"`
+	XrayProcesses    int `json:"xray_processes,omitempty"`
+}
+
+// exceeded возвращает описание первого исчерпанного лимита
+func (q ResourceQuota) exceeded(usage ResourceUsage) error {
+	switch {
+	case q.CPUSeconds > 0 && usage.CPUSeconds >= float64(q.CPUSeconds):
+		return fmt.Errorf("CPU quota of %d seconds exhausted", q.CPUSeconds)
+	case q.BytesTransferred > 0 && usage.BytesTransferred >= int64(q.BytesTransferred):
+		return fmt.Errorf("traffic quota of %d bytes exhausted", q.BytesTransferred)
+	case q.XrayProcesses > 0 && usage.XrayProcesses >= q.XrayProcesses:
+		return fmt.Errorf("quota of %d Xray processes exhausted", q.XrayProcesses)
+	}
+	return nil
+}
+
+// testUsage накапливает ресурсы одного теста. Методы безопасны для nil,
+// чтобы проверки вне тестов (пулы, A/B) ничего не учитывали
+type testUsage struct {
+	namespace string
+	bytes     atomic.Int64
+
+	mu    sync.Mutex
+	usage ResourceUsage
+}
+
+func (t *testUsage) addBytes(n int) {
+	if t != nil && n > 0 {
+		t.bytes.Add(int64(n))
+	}
+}
+
+func (t *testUsage) xrayStarted() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.usage.XrayProcesses++
+	t.mu.Unlock()
+}
+
+// xrayExited учитывает CPU и память завершившегося процесса Xray
+func (t *testUsage) xrayExited(state *os.ProcessState) {
+	if t == nil || state == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.usage.CPUSeconds += (state.UserTime() + state.SystemTime()).Seconds()
+	if peak := peakMemory(state); peak > t.usage.PeakMemoryBytes {
+		t.usage.PeakMemoryBytes = peak
+	}
+}
+
+// usageRegistry - учёт ресурсов идущих тестов и сумм по пространствам имён
+type usageRegistry struct {
+	mu         sync.Mutex
+	tests      map[string]*testUsage
+	namespaces map[string]*NamespaceUsage
+	quota      ResourceQuota
+}
+
+var usageMeter = &usageRegistry{
+	tests:      make(map[string]*testUsage),
+	namespaces: make(map[string]*NamespaceUsage),
+	quota: ResourceQuota{
+		CPUSeconds:       envInt("NAMESPACE_QUOTA_CPU_SECONDS", 0),
+		BytesTransferred: envInt("NAMESPACE_QUOTA_BYTES", 0),
+		XrayProcesses:    envInt("NAMESPACE_QUOTA_XRAY_PROCESSES", 0),
+	},
+}
+
+func (r *usageRegistry) begin(testID, namespace string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tests[testID] = &testUsage{namespace: namespace}
+}
+
+// test возвращает учёт идущего теста или nil
+func (r *usageRegistry) test(testID string) *testUsage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tests[testID]
+}
+
+// finish завершает учёт теста и добавляет его к пространству имён
+func (r *usageRegistry) finish(testID string, runtime time.Duration) ResourceUsage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.tests[testID]
+	if t == nil {
+		return ResourceUsage{RuntimeSeconds: runtime.Seconds()}
+	}
+	delete(r.tests, testID)
+
+	t.mu.Lock()
+	usage := t.usage
+	t.mu.Unlock()
+	usage.RuntimeSeconds = runtime.Seconds()
+	usage.BytesTransferred = t.bytes.Load()
+
+	ns := r.namespaceLocked(t.namespace)
+	ns.Tests++
+	ns.Usage.add(usage)
+	return usage
+}
+
+func (r *usageRegistry) namespaceLocked(namespace string) *NamespaceUsage {
+	ns, ok := r.namespaces[namespace]
+	if !ok {
+		ns = &NamespaceUsage{Namespace: namespace, Quota: r.quota}
+		r.namespaces[namespace] = ns
+	}
+	return ns
+}
+
+// checkQuota проверяет, что у пространства имён остались ресурсы на новый
+// тест. Лимит проверяется по завершённым тестам, поэтому идущий тест может
+// немного превысить его
+func (r *usageRegistry) checkQuota(namespace string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ns, ok := r.namespaces[namespace]; ok {
+		return r.quota.exceeded(ns.Usage)
+	}
+	return nil
+}
+
+// countingTransport возвращает транспорт HTTP-клиента через proxy, который
+// учитывает трафик в usage
+func countingTransport(proxy *url.URL, usage *testUsage) *http.Transport {
+	dialer := &net.Dialer{}
+	return &http.Transport{
+		Proxy: http.ProxyURL(proxy),
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil || usage == nil {
+				return conn, err
+			}
+			return &countingConn{Conn: conn, usage: usage}, nil
+		},
+	}
+}
+
+// countingConn считает байты, прошедшие через соединение в обе стороны
+type countingConn struct {
+	net.Conn
+	usage *testUsage
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.usage.addBytes(n)
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.usage.addBytes(n)
+	return n, err
+}
+
+// registerUsageRoutes регистрирует отчёты о потреблении ресурсов
+func registerUsageRoutes(api *gin.RouterGroup) {
+	api.GET("/usage", listUsage)
+	api.GET("/usage/:namespace", getUsage)
+}
+
+func listUsage(c *gin.Context) {
+	usageMeter.mu.Lock()
+	list := make([]NamespaceUsage, 0, len(usageMeter.namespaces))
+	for _, ns := range usageMeter.namespaces {
+		list = append(list, *ns)
+	}
+	usageMeter.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Namespace < list[j].Namespace })
+	c.JSON(http.StatusOK, gin.H{"namespaces": list})
+}
+
+func getUsage(c *gin.Context) {
+	namespace := c.Param("namespace")
+	usageMeter.mu.Lock()
+	ns, ok := usageMeter.namespaces[namespace]
+	var usage NamespaceUsage
+	if ok {
+		usage = *ns
+	}
+	usageMeter.mu.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,69 @@
+// Package testrun - общие для e2e-теста cmd/api, cmd/soak и cmd/loadgen вызовы API:
+// запуск теста и ожидание его завершения
+package testrun
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Start запускает тест ссылок links через POST /api/v1/tests и возвращает его ID.
+// timeout - таймаут проверки одной ссылки в секундах
+func Start(apiURL, name string, timeout int, links []string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"name":    name,
+		"timeout": timeout,
+		"configs": links,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.Post(apiURL+"/api/v1/tests", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to start test: %w", err)
+	}
+	var started struct {
+		TestID string `json:"test_id"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&started)
+	resp.Body.Close()
+	if err != nil || started.TestID == "" {
+		return "", fmt.Errorf("unexpected start response (status %d): %v", resp.StatusCode, err)
+	}
+	return started.TestID, nil
+}
+
+// Wait опрашивает статус теста каждые poll, пока он не станет completed или
+// failed, и возвращает этот статус. Ошибка - если за timeout тест не завершился
+func Wait(apiURL, testID string, timeout, poll time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		var status struct{ Status string }
+		if err := GetJSON(apiURL+"/api/v1/tests/"+testID, &status); err != nil {
+			return "", err
+		}
+		if status.Status == "completed" || status.Status == "failed" {
+			return status.Status, nil
+		}
+		time.Sleep(poll)
+	}
+	return "", fmt.Errorf("test %s did not complete within %s", testID, timeout)
+}
+
+// GetJSON декодирует в v ответ GET url со статусом 200
+func GetJSON(url string, v interface{}) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("GET %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"projectx/cmd/internal/testrun"
+)
+
+// runStats - итоги одного запущенного теста
+type runStats struct {
+	testID    string
+	startCall time.Duration // Время ответа POST /api/v1/tests
+	total     time.Duration // Время от запуска до статуса completed
+	err       error
+}
+
+func main() {
+	apiURL := flag.String("api", "http://localhost:8080", "Base URL of a running Proxy Test API")
+	tests := flag.Int("tests", 20, "Number of tests to start")
+	concurrency := flag.Int("concurrency", 5, "Number of tests running at the same time")
+	proxies := flag.Int("proxies", 50, "Number of synthetic links per test")
+	seed := flag.Int64("seed", 1, "Seed for generating synthetic links")
+	timeout := flag.Duration("timeout", 5*time.Minute, "Maximum time to wait for a single test")
+	poll := flag.Duration("poll", 500*time.Millisecond, "Status polling interval")
+	flag.Parse()
+
+	if *tests < 1 || *concurrency < 1 || *proxies < 1 {
+		log.Fatalf("tests, concurrency and proxies must be positive")
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	batches := make([][]string, *tests)
+	for i := range batches {
+		batches[i] = syntheticLinks(rng, i, *proxies)
+	}
+
+	log.Printf("Starting %d tests x %d links against %s (concurrency %d)", *tests, *proxies, *apiURL, *concurrency)
+
+	jobs := make(chan int)
+	stats := make([]runStats, *tests)
+	var wg sync.WaitGroup
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				stats[i] = runOne(*apiURL, fmt.Sprintf("loadgen-%d", i), batches[i], *timeout, *poll)
+			}
+		}()
+	}
+
+	start := time.Now()
+	for i := range batches {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report(stats, elapsed, *proxies)
+}
+
+// syntheticLinks генерирует воспроизводимый набор VLESS ссылок.
+// Адреса из TEST-NET диапазонов, поэтому без симуляции они никуда не ведут.
+func syntheticLinks(rng *rand.Rand, batch, count int) []string {
+	links := make([]string, count)
+	for i := range links {
+		uuid := fmt.Sprintf("%08x-%04x-4%03x-8%03x-%012x",
+			rng.Uint32(), rng.Intn(0x10000), rng.Intn(0x1000), rng.Intn(0x1000), rng.Int63n(1<<48))
+		links[i] = fmt.Sprintf("vless://%s@198.51.100.%d:%d?type=tcp&security=none#load-%d-%d",
+			uuid, 1+rng.Intn(254), 1024+rng.Intn(60000), batch, i)
+	}
+	return links
+}
+
+// runOne запускает тест и ждёт его завершения
+func runOne(apiURL, name string, links []string, timeout, poll time.Duration) runStats {
+	start := time.Now()
+	testID, err := testrun.Start(apiURL, name, 10, links)
+	stats := runStats{testID: testID, startCall: time.Since(start)}
+	if err != nil {
+		stats.err = err
+		return stats
+	}
+
+	status, err := testrun.Wait(apiURL, testID, timeout-stats.startCall, poll)
+	switch {
+	case err != nil:
+		stats.err = err
+	case status == "failed":
+		stats.err = fmt.Errorf("test %s failed", testID)
+	default:
+		stats.total = time.Since(start)
+	}
+	return stats
+}
+
+// report выводит сводку по прогону
+func report(stats []runStats, elapsed time.Duration, proxies int) {
+	var (
+		startCalls []time.Duration
+		totals     []time.Duration
+		failed     int
+	)
+	ids := make(map[string]int)
+	for _, s := range stats {
+		if s.testID != "" {
+			ids[s.testID]++
+		}
+		if s.err != nil {
+			log.Printf("❌ %v", s.err)
+			failed++
+			continue
+		}
+		startCalls = append(startCalls, s.startCall)
+		totals = append(totals, s.total)
+	}
+
+	duplicates := 0
+	for _, n := range ids {
+		if n > 1 {
+			duplicates += n - 1
+		}
+	}
+
+	completed := len(stats) - failed
+	log.Printf("Completed %d/%d tests in %s", completed, len(stats), elapsed.Round(time.Millisecond))
+	log.Printf("Throughput: %.2f tests/s, %.1f links/s",
+		float64(completed)/elapsed.Seconds(), float64(completed*proxies)/elapsed.Seconds())
+	log.Printf("POST /tests latency: %s", percentiles(startCalls))
+	log.Printf("Test duration:       %s", percentiles(totals))
+	if duplicates > 0 {
+		log.Printf("⚠️ %d tests received an already used test_id", duplicates)
+	}
+}
+
+// percentiles форматирует p50/p90/p99/max для набора длительностей
+func percentiles(values []time.Duration) string {
+	if len(values) == 0 {
+		return "n/a"
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	at := func(p float64) time.Duration {
+		return values[int(p*float64(len(values)-1))].Round(time.Millisecond)
+	}
+	return fmt.Sprintf("p50=%s p90=%s p99=%s max=%s", at(0.5), at(0.9), at(0.99), values[len(values)-1].Round(time.Millisecond))
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// manifest - файл monitors.yaml. Поля повторяют тело POST /api/v1/apply;
+// отсутствующий раздел сервер не трогает, пустой список удаляет все объекты вида
+type manifest struct {
+	Monitors      []monitor      `yaml:"monitors" json:"monitors"`
+	Pools         []pool         `yaml:"pools" json:"pools"`
+	Notifications []notification `yaml:"notifications" json:"notifications"`
+}
+
+// monitor - подписка с периодическим обновлением и проверкой
+type monitor struct {
+	Name          string `yaml:"name" json:"name"`
+	URL           string `yaml:"url" json:"url"`
+	Interval      int    `yaml:"interval" json:"interval"`
+	Timeout       int    `yaml:"timeout" json:"timeout"`
+	CheckOnChange bool   `yaml:"check_on_change" json:"check_on_change"`
+	StatusPage    string `yaml:"status_page" json:"status_page"`
+}
+
+type pool struct {
+	Name    string       `yaml:"name" json:"name"`
+	Configs []string     `yaml:"configs" json:"configs"`
+	Tags    []string     `yaml:"tags" json:"tags"`
+	Prune   *prunePolicy `yaml:"prune" json:"prune"`
+}
+
+type prunePolicy struct {
+	MaxFailures int      `yaml:"max_failures" json:"max_failures"`
+	Interval    int      `yaml:"interval" json:"interval"`
+	Timeout     int      `yaml:"timeout" json:"timeout"`
+	Grace       []string `yaml:"grace" json:"grace"`
+}
+
+// notification - контроллер Clash.Meta / sing-box, получающий результаты тестов
+type notification struct {
+	Name     string `yaml:"name" json:"name"`
+	URL      string `yaml:"url" json:"url"`
+	Secret   string `yaml:"secret" json:"secret"`
+	Group    string `yaml:"group" json:"group"`
+	Provider string `yaml:"provider" json:"provider"`
+}
+
+// action - действие плана из ответа сервера
+type action struct {
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	ID      string   `json:"id"`
+	Action  string   `json:"action"`
+	Changes []string `json:"changes"`
+}
+
+const usage = `Usage: proxcheck <command> [flags]
+
+Commands:
+  apply -f monitors.yaml   Create, update and delete monitors, pools and
+                           notifications so the server matches the file
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "apply":
+		if err := apply(os.Args[2:]); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+// apply отправляет манифест на сервер и печатает план
+func apply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	file := fs.String("f", "", "Manifest file, - for stdin")
+	apiURL := fs.String("api", envOr("PROXCHECK_API", "http://localhost:8080"), "Base URL of the Proxy Test API (env PROXCHECK_API)")
+	dryRun := fs.Bool("dry-run", false, "Only print the plan")
+	fs.Parse(args)
+	if *file == "" {
+		return fmt.Errorf("-f is required")
+	}
+
+	m, err := loadManifest(*file)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(struct {
+		manifest
+		DryRun bool `json:"dry_run"`
+	}{m, *dryRun})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(strings.TrimRight(*apiURL, "/")+"/api/v1/apply", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to apply manifest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Error   string         `json:"error"`
+		Details string         `json:"details"`
+		Summary map[string]int `json:"summary"`
+		Actions []action       `json:"actions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("unexpected response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", result.Error, result.Details)
+	}
+
+	symbols := map[string]string{"create": "+", "update": "~", "delete": "-", "unchanged": " "}
+	for _, a := range result.Actions {
+		line := fmt.Sprintf("%s %s %s", symbols[a.Action], a.Kind, a.Name)
+		if a.ID != "" {
+			line += " [" + a.ID + "]"
+		}
+		if len(a.Changes) > 0 {
+			line += " (" + strings.Join(a.Changes, ", ") + ")"
+		}
+		fmt.Println(line)
+	}
+
+	verb := "Applied"
+	if *dryRun {
+		verb = "Plan"
+	}
+	fmt.Printf("%s: %d to create, %d to update, %d to delete, %d unchanged.\n", verb,
+		result.Summary["create"], result.Summary["update"], result.Summary["delete"], result.Summary["unchanged"])
+	return nil
+}
+
+// envRef - ссылка ${VAR} на переменную окружения. Форма $VAR не
+// поддерживается: символ $ встречается в паролях внутри ссылок
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// loadManifest читает YAML-манифест. ${VAR} заменяются переменными окружения,
+// чтобы секреты не хранились в репозитории; неизвестные ключи - ошибка
+func loadManifest(path string) (manifest, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return manifest{}, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	data = envRef.ReplaceAllFunc(data, func(ref []byte) []byte {
+		return []byte(os.Getenv(string(envRef.FindSubmatch(ref)[1])))
+	})
+
+	var m manifest
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return manifest{}, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"projectx/cmd/internal/testrun"
+)
+
+// sample - снимок /api/v1/debug после завершения цикла проверок
+type sample struct {
+	Elapsed       time.Duration
+	RSS           float64
+	Goroutines    float64
+	FDs           float64
+	XrayProcesses float64
+	TempFiles     float64
+}
+
+// metric описывает отслеживаемую величину и допустимый рост в час
+type metric struct {
+	name      string
+	unit      string
+	value     func(s sample) float64
+	maxGrowth float64
+}
+
+func main() {
+	apiURL := flag.String("api", "http://localhost:8080", "Base URL of a running Proxy Test API")
+	duration := flag.Duration("duration", 4*time.Hour, "Total soak duration")
+	interval := flag.Duration("interval", 30*time.Second, "Pause between check cycles")
+	settle := flag.Duration("settle", 5*time.Second, "Wait after a cycle before sampling resources")
+	linksFile := flag.String("links", "", "File with share links, one per line (synthetic links if empty)")
+	proxies := flag.Int("proxies", 20, "Number of synthetic links per cycle")
+	warmup := flag.Int("warmup", 3, "Number of initial cycles excluded from trend analysis")
+	csvPath := flag.String("csv", "", "Write all samples to this CSV file")
+	maxRSS := flag.Float64("max-rss-growth", 32, "Allowed RSS growth, MB per hour")
+	maxGoroutines := flag.Float64("max-goroutine-growth", 20, "Allowed goroutine growth per hour")
+	maxFDs := flag.Float64("max-fd-growth", 10, "Allowed open FD growth per hour")
+	maxChildren := flag.Float64("max-process-growth", 1, "Allowed growth of running Xray processes per hour")
+	flag.Parse()
+
+	links, err := loadLinks(*linksFile, *proxies)
+	if err != nil {
+		log.Fatalf("Error loading links: %v", err)
+	}
+
+	metrics := []metric{
+		{"rss", "MB", func(s sample) float64 { return s.RSS / (1 << 20) }, *maxRSS},
+		{"goroutines", "", func(s sample) float64 { return s.Goroutines }, *maxGoroutines},
+		{"open_fds", "", func(s sample) float64 { return s.FDs }, *maxFDs},
+		{"xray_processes", "", func(s sample) float64 { return s.XrayProcesses }, *maxChildren},
+		{"temp_files", "", func(s sample) float64 { return s.TempFiles }, *maxChildren},
+	}
+
+	log.Printf("Soaking %s for %s with %d links per cycle", *apiURL, *duration, len(links))
+
+	var samples []sample
+	start := time.Now()
+	for cycle := 1; time.Since(start) < *duration; cycle++ {
+		if err := runCycle(*apiURL, cycle, links); err != nil {
+			log.Printf("⚠️ cycle %d: %v", cycle, err)
+		}
+		time.Sleep(*settle)
+
+		s, err := takeSample(*apiURL)
+		if err != nil {
+			log.Fatalf("❌ cycle %d: failed to sample resources: %v", cycle, err)
+		}
+		s.Elapsed = time.Since(start)
+		samples = append(samples, s)
+		log.Printf("cycle %d: rss=%.1fMB goroutines=%.0f fds=%.0f xray=%.0f temp_files=%.0f",
+			cycle, s.RSS/(1<<20), s.Goroutines, s.FDs, s.XrayProcesses, s.TempFiles)
+
+		time.Sleep(*interval)
+	}
+
+	if *csvPath != "" {
+		if err := writeCSV(*csvPath, samples); err != nil {
+			log.Printf("⚠️ failed to write %s: %v", *csvPath, err)
+		}
+	}
+
+	if len(samples) <= *warmup+1 {
+		log.Fatalf("Not enough samples for trend analysis: %d cycles, %d warmup", len(samples), *warmup)
+	}
+	analyzed := samples[*warmup:]
+
+	leaks := 0
+	for _, m := range metrics {
+		if m.value(analyzed[0]) < 0 {
+			log.Printf("➖ %s: not available on this platform", m.name)
+			continue
+		}
+		growth := slopePerHour(analyzed, m.value)
+		if growth > m.maxGrowth {
+			log.Printf("❌ %s grows by %.2f%s/h (allowed %.2f)", m.name, growth, m.unit, m.maxGrowth)
+			leaks++
+		} else {
+			log.Printf("✅ %s: %.2f%s/h", m.name, growth, m.unit)
+		}
+	}
+
+	if leaks > 0 {
+		log.Fatalf("%d resources trend upward", leaks)
+	}
+	log.Printf("No leaks detected over %d cycles", len(samples))
+}
+
+// slopePerHour - наклон линейной регрессии по методу наименьших квадратов
+func slopePerHour(samples []sample, value func(s sample) float64) float64 {
+	n := float64(len(samples))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.Elapsed.Hours()
+		y := value(s)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+// loadLinks читает ссылки из файла или генерирует ссылки на TEST-NET адреса,
+// которые гарантированно не отвечают, но проходят весь жизненный цикл Xray
+func loadLinks(path string, count int) ([]string, error) {
+	if path == "" {
+		links := make([]string, count)
+		for i := range links {
+			links[i] = fmt.Sprintf("vless://00000000-0000-4000-8000-%012d@192.0.2.%d:443?type=tcp&security=none#soak-%d",
+				i, 1+i%254, i)
+		}
+		return links, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var links []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			links = append(links, line)
+		}
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("no links in %s", path)
+	}
+	return links, scanner.Err()
+}
+
+// runCycle запускает один тест и ждёт его завершения
+func runCycle(apiURL string, cycle int, links []string) error {
+	testID, err := testrun.Start(apiURL, fmt.Sprintf("soak-%d", cycle), 10, links)
+	if err != nil {
+		return err
+	}
+	_, err = testrun.Wait(apiURL, testID, 10*time.Minute, time.Second)
+	return err
+}
+
+// takeSample читает счётчики ресурсов из /api/v1/debug
+func takeSample(apiURL string) (sample, error) {
+	var info struct {
+		Runtime struct {
+			Goroutines float64 `json:"goroutines"`
+		} `json:"runtime"`
+		Process struct {
+			RSS float64 `json:"rss_bytes"`
+			FDs float64 `json:"open_fds"`
+		} `json:"process"`
+		Resources struct {
+			XrayProcesses float64 `json:"xray_processes"`
+			TempFiles     float64 `json:"temp_files"`
+		} `json:"resources"`
+	}
+	if err := testrun.GetJSON(apiURL+"/api/v1/debug", &info); err != nil {
+		return sample{}, err
+	}
+	return sample{
+		RSS:           info.Process.RSS,
+		Goroutines:    info.Runtime.Goroutines,
+		FDs:           info.Process.FDs,
+		XrayProcesses: info.Resources.XrayProcesses,
+		TempFiles:     info.Resources.TempFiles,
+	}, nil
+}
+
+func writeCSV(path string, samples []sample) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"elapsed_seconds", "rss_bytes", "goroutines", "open_fds", "xray_processes", "temp_files"})
+	for _, s := range samples {
+		w.Write([]string{
+			strconv.FormatFloat(s.Elapsed.Seconds(), 'f', 0, 64),
+			strconv.FormatFloat(s.RSS, 'f', 0, 64),
+			strconv.FormatFloat(s.Goroutines, 'f', 0, 64),
+			strconv.FormatFloat(s.FDs, 'f', 0, 64),
+			strconv.FormatFloat(s.XrayProcesses, 'f', 0, 64),
+			strconv.FormatFloat(s.TempFiles, 'f', 0, 64),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -1,12 +1,44 @@
 package main
 
 import (
+	"context"
 	"log"
-	"xray-checker/config"
+	"os"
+
+	"projectx/proxytestlib/config"
+	"projectx/proxytestlib/monitor"
+	"projectx/proxytestlib/service"
+)
+
+const (
+	serviceName = "xray-checker"
+	version     = "v1.0.0"
 )
 
 func main() {
-	log.Println("Xray Checker starting...")
-	config.Parse("v1.0.0") // Parse CLI arguments and environment variables
-	log.Println("Xray Checker started.")
-}
\ No newline at end of file
+	config.Parse(version) // Parse CLI arguments and environment variables
+
+	if action := config.CLIConfig.Service; action != "" {
+		args := service.StripServiceFlag(os.Args[1:])
+		if action == service.ActionInstallTask {
+			args = append(args, "--run-once")
+		}
+
+		taskInterval := config.CLIConfig.Proxy.CheckInterval / 60
+		if taskInterval < 1 {
+			taskInterval = 1
+		}
+
+		if err := service.Handle(action, serviceName, "Xray Checker: A Prometheus exporter for monitoring Xray proxies", taskInterval, args); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	if err := service.Run(serviceName, func(ctx context.Context) error {
+		log.Println("Xray Checker starting...")
+		return monitor.Run(ctx, version)
+	}); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// SplitHostPort splits the host:port part of a share link. IPv6 literals
+// must be bracketed, as in [2001:db8::1]:443, and are returned without the
+// brackets; host names are normalized with NormalizeHost. A missing or empty
+// port is returned as 0, callers pick a default with DefaultPort.
+func SplitHostPort(hostport string) (string, int, error) {
+	host, portValue, err := net.SplitHostPort(hostport)
+	if err != nil {
+		if !missingPort(hostport) {
+			return "", 0, fmt.Errorf("invalid server address format: %s", hostport)
+		}
+		host, portValue = hostport, ""
+	}
+	port := 0
+	if portValue != "" {
+		port, err = strconv.Atoi(portValue)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid port number: %v", err)
+		}
+	}
+	host, err = NormalizeHost(host)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, port, nil
+}
+
+// NormalizeHost strips the brackets of IPv6 literals and converts
+// internationalized domain names to punycode, which Xray and the resolver
+// expect. ASCII host names are returned unchanged.
+func NormalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if net.ParseIP(host) != nil || isASCII(host) {
+		return host, nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid internationalized host name %q: %v", host, err)
+	}
+	return ascii, nil
+}
+
+// missingPort reports whether hostport is a bare host name or a bracketed
+// IPv6 literal without a port.
+func missingPort(hostport string) bool {
+	if strings.HasPrefix(hostport, "[") {
+		return strings.HasSuffix(hostport, "]")
+	}
+	return hostport != "" && !strings.Contains(hostport, ":")
+}
+
+// DefaultPort returns the port a link without one most likely uses and the
+// reason for the choice, or 0 when the scheme has no typical port.
+func DefaultPort(protocol, security, network string) (int, string) {
+	switch {
+	case security == "tls" || security == "reality":
+		return 443, security
+	case protocol == "trojan" && security != "none":
+		return 443, "trojan runs over TLS"
+	case network == "ws" || network == "httpupgrade" || network == "xhttp":
+		return 80, network + " without tls"
+	case protocol == "http":
+		return 80, "http proxy"
+	case protocol == "socks":
+		return 1080, "socks proxy"
+	case protocol == "ssh":
+		return 22, "ssh"
+	}
+	return 0, ""
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"projectx/proxytestlib/models"
+)
+
+// ParseProxyURLLenient parses a link like ParseProxyURL and then fills in
+// transport and security parameters the link omits. Every inferred value is
+// listed in ProxyConfig.Inferred.
+func ParseProxyURLLenient(proxyURL string) (*models.ProxyConfig, error) {
+	config, err := ParseProxyURL(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Inferred = append(config.Inferred, InferTransport(config)...)
+	if len(config.Inferred) > 0 {
+		log.Printf("Inferred parameters for %s: %v", config.Name, config.Inferred)
+	}
+
+	return config, nil
+}
+
+// InferTransport applies per-protocol defaults to parameters missing from a
+// share link and returns a description of each value it set.
+func InferTransport(config *models.ProxyConfig) []string {
+	var inferred []string
+	set := func(field *string, value, name, reason string) {
+		*field = value
+		inferred = append(inferred, fmt.Sprintf("%s=%s (%s)", name, value, reason))
+	}
+
+	if config.Protocol == "shadowsocks" {
+		return nil
+	}
+
+	if config.Type == "" {
+		switch {
+		case config.Settings["serviceName"] != "":
+			set(&config.Type, "grpc", "type", "serviceName present")
+			config.ServiceName = config.Settings["serviceName"]
+			config.MultiMode = config.Settings["multiMode"] == "true" || config.Settings["mode"] == "multi"
+		case config.Path != "":
+			set(&config.Type, "ws", "type", "path present")
+		default:
+			set(&config.Type, "tcp", "type", "no transport parameters")
+		}
+	}
+
+	if config.Security == "" {
+		switch {
+		case config.PublicKey != "":
+			set(&config.Security, "reality", "security", "pbk present")
+		case config.Protocol == "trojan":
+			set(&config.Security, "tls", "security", "trojan runs over TLS")
+		case config.SNI != "":
+			set(&config.Security, "tls", "security", "sni present")
+		case config.Port == 443 || config.Port == 8443:
+			set(&config.Security, "tls", "security", fmt.Sprintf("port %d", config.Port))
+		}
+	}
+
+	if (config.Security == "tls" || config.Security == "reality") && config.SNI == "" {
+		if config.Host != "" {
+			set(&config.SNI, config.Host, "sni", "host parameter")
+		} else if net.ParseIP(config.Server) == nil {
+			set(&config.SNI, config.Server, "sni", "server address")
+		}
+	}
+
+	if config.Security == "reality" && config.Fingerprint == "" {
+		set(&config.Fingerprint, "chrome", "fp", "required by reality")
+	}
+
+	return inferred
+}
+
+// inferPort sets the default port of a link that omits it and records the
+// inferred value in ProxyConfig.Inferred.
+func inferPort(config *models.ProxyConfig) error {
+	port, reason := DefaultPort(config.Protocol, config.Security, config.Type)
+	if port == 0 {
+		return fmt.Errorf("missing port and no default for %s over %s", config.Protocol, transportName(config.Type))
+	}
+	config.Port = port
+	config.Inferred = append(config.Inferred, fmt.Sprintf("port=%d (%s)", port, reason))
+	return nil
+}
+
+func transportName(network string) string {
+	if network == "" {
+		return "tcp"
+	}
+	return network
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"projectx/proxytestlib/models"
+	"projectx/utils"
+)
+
+// UnsupportedError marks a link that was parsed correctly but describes a
+// proxy the checker cannot run, as opposed to a malformed link.
+type UnsupportedError struct {
+	Protocol string
+	Reason   string // Machine-readable: protocol, obfs or cipher
+	Value    string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("unsupported %s %s: %s", e.Protocol, e.Reason, e.Value)
+}
+
+// xraySSCiphers are the Shadowsocks ciphers Xray core still implements.
+// SSR subscriptions mostly use stream ciphers such as aes-256-cfb, which
+// were removed.
+var xraySSCiphers = map[string]bool{
+	"aes-128-gcm":                   true,
+	"aes-256-gcm":                   true,
+	"chacha20-poly1305":             true,
+	"chacha20-ietf-poly1305":        true,
+	"xchacha20-poly1305":            true,
+	"xchacha20-ietf-poly1305":       true,
+	"2022-blake3-aes-128-gcm":       true,
+	"2022-blake3-aes-256-gcm":       true,
+	"2022-blake3-chacha20-poly1305": true,
+	"none":                          true,
+	"plain":                         true,
+}
+
+// ParseSSRConfig parses a ShadowsocksR link:
+// ssr://base64(host:port:protocol:method:obfs:base64(password)/?remarks=base64(...)).
+// ShadowsocksR with the "origin" protocol and "plain" obfs is wire-compatible
+// with Shadowsocks and is returned as a Shadowsocks config. Anything else is
+// reported with an *UnsupportedError.
+func ParseSSRConfig(u *url.URL) (*models.ProxyConfig, error) {
+	decoded, err := utils.AutoDecode(u.Host + u.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding SSR link: %v", err)
+	}
+
+	body, rawQuery, _ := strings.Cut(string(decoded), "/?")
+	body = strings.TrimSuffix(body, "/")
+
+	// The host may be an IPv6 address, so fields are taken from the right
+	fields := strings.Split(body, ":")
+	if len(fields) < 6 {
+		return nil, fmt.Errorf("invalid SSR link format")
+	}
+	n := len(fields)
+	host, err := NormalizeHost(strings.Join(fields[:n-5], ":"))
+	if err != nil {
+		return nil, err
+	}
+	port, protocol, method, obfs, encodedPassword := fields[n-5], fields[n-4], fields[n-3], fields[n-2], fields[n-1]
+
+	password, err := utils.AutoDecode(encodedPassword)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding SSR password: %v", err)
+	}
+
+	config := &models.ProxyConfig{
+		Protocol: "shadowsocks",
+		Server:   host,
+		Method:   strings.ToLower(method),
+		Password: string(password),
+		Settings: map[string]string{"origin": "ssr"},
+	}
+
+	query, _ := url.ParseQuery(rawQuery)
+	if remarks := query.Get("remarks"); remarks != "" {
+		if name, err := utils.AutoDecode(remarks); err == nil {
+			config.Name = string(name)
+		}
+	}
+	if config.Name == "" {
+		config.Name = net.JoinHostPort(host, port)
+	}
+
+	config.Port, err = strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port number: %v", err)
+	}
+	if config.Port == 0 || config.Port == 1 {
+		return nil, fmt.Errorf("skipping port: %d", config.Port)
+	}
+
+	if protocol != "origin" {
+		return nil, &UnsupportedError{Protocol: "ssr", Reason: "protocol", Value: protocol}
+	}
+	if obfs != "plain" {
+		return nil, &UnsupportedError{Protocol: "ssr", Reason: "obfs", Value: obfs}
+	}
+	if !xraySSCiphers[config.Method] {
+		return nil, &UnsupportedError{Protocol: "ssr", Reason: "cipher", Value: config.Method}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
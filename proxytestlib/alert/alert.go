@@ -0,0 +1,279 @@
+package alert
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"projectx/proxytestlib/checker"
+	"projectx/proxytestlib/config"
+)
+
+// maxLines is the number of proxies listed in one message, the rest are
+// summarized as "... and N more".
+const maxLines = 30
+
+// maxPending bounds the lines kept for a channel that is rate limited or
+// failing, the oldest are dropped first.
+const maxPending = 1000
+
+// Channel delivers alert messages, e.g. to a Telegram chat.
+type Channel interface {
+	Name() string
+	Send(text string) error
+}
+
+// Policy controls how a channel is notified.
+type Policy struct {
+	// RateLimit is the maximum number of messages per hour, 0 for no limit.
+	// Lines that do not fit are sent with the next allowed message.
+	RateLimit int
+	// EscalateAfter notifies the channel only about proxies still down this
+	// long, and about their recovery. 0 notifies about every transition.
+	EscalateAfter time.Duration
+}
+
+type line struct {
+	online bool
+	text   string
+}
+
+type route struct {
+	channel   Channel
+	policy    Policy
+	sent      []time.Time
+	pending   []line
+	limited   bool
+	escalated map[string]bool // Stable IDs reported to the channel as down
+}
+
+type proxyState struct {
+	name   string
+	online bool
+	since  time.Time
+}
+
+// Notifier turns check cycles into alerts. All status changes of one cycle
+// are grouped into a single message per channel, and a proxy seen for the
+// first time is not reported as a change.
+type Notifier struct {
+	instance string
+	clock    checker.Clock
+
+	mu     sync.Mutex
+	routes []*route
+	states map[string]*proxyState
+}
+
+func NewNotifier(instance string) *Notifier {
+	return &Notifier{
+		instance: instance,
+		clock:    checker.SystemClock{},
+		states:   make(map[string]*proxyState),
+	}
+}
+
+// SetClock replaces the clock used for rate limits and escalation delays,
+// nil restores the system clock.
+func (n *Notifier) SetClock(clock checker.Clock) {
+	if clock == nil {
+		clock = checker.SystemClock{}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.clock = clock
+}
+
+// AddChannel registers a channel notified according to policy.
+func (n *Notifier) AddChannel(channel Channel, policy Policy) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.routes = append(n.routes, &route{channel: channel, policy: policy, escalated: make(map[string]bool)})
+}
+
+// HandleCycle processes the results of one check cycle. It matches the
+// signature of checker.ProxyChecker.OnCycle; delivery errors are logged.
+func (n *Notifier) HandleCycle(results []checker.CycleResult) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := n.clock.Now()
+	var changes []line
+	current := make(map[string]bool, len(results))
+	for _, result := range results {
+		id := result.Proxy.StableID
+		current[id] = true
+		state, ok := n.states[id]
+		if !ok {
+			n.states[id] = &proxyState{name: result.Proxy.Name, online: result.Online, since: now}
+			continue
+		}
+		state.name = result.Proxy.Name
+		if state.online == result.Online {
+			continue
+		}
+		if result.Online {
+			changes = append(changes, line{true, fmt.Sprintf("%s: up after %s", state.name, formatDuration(now.Sub(state.since)))})
+		} else {
+			changes = append(changes, line{false, fmt.Sprintf("%s: down", state.name)})
+		}
+		state.online = result.Online
+		state.since = now
+	}
+	for id := range n.states {
+		if !current[id] {
+			delete(n.states, id)
+		}
+	}
+
+	for _, r := range n.routes {
+		if r.policy.EscalateAfter == 0 {
+			r.queue(changes)
+		} else {
+			r.queue(n.escalations(r, now))
+		}
+		r.flush(n.header(r.pending), now)
+	}
+}
+
+// escalations returns proxies down for longer than the escalation delay of
+// the route and the recovery of proxies escalated earlier.
+func (n *Notifier) escalations(r *route, now time.Time) []line {
+	ids := make([]string, 0, len(n.states))
+	for id := range n.states {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return n.states[ids[i]].name < n.states[ids[j]].name })
+
+	var lines []line
+	for _, id := range ids {
+		state := n.states[id]
+		down := now.Sub(state.since)
+		switch {
+		case !state.online && !r.escalated[id] && down >= r.policy.EscalateAfter:
+			r.escalated[id] = true
+			lines = append(lines, line{false, fmt.Sprintf("%s: down for %s", state.name, formatDuration(down))})
+		case state.online && r.escalated[id]:
+			delete(r.escalated, id)
+			lines = append(lines, line{true, fmt.Sprintf("%s: up again", state.name)})
+		}
+	}
+	for id := range r.escalated {
+		if _, ok := n.states[id]; !ok {
+			delete(r.escalated, id)
+		}
+	}
+	return lines
+}
+
+func (r *route) queue(lines []line) {
+	r.pending = append(r.pending, lines...)
+	if len(r.pending) > maxPending {
+		r.pending = r.pending[len(r.pending)-maxPending:]
+	}
+}
+
+// flush sends the pending lines as one message if the rate limit allows.
+func (r *route) flush(header string, now time.Time) {
+	if len(r.pending) == 0 {
+		return
+	}
+	if r.policy.RateLimit > 0 {
+		recent := r.sent[:0]
+		for _, at := range r.sent {
+			if now.Sub(at) < time.Hour {
+				recent = append(recent, at)
+			}
+		}
+		r.sent = recent
+		if len(r.sent) >= r.policy.RateLimit {
+			if !r.limited {
+				log.Printf("Alerts to %s rate limited (%d messages per hour), held back: %d", r.channel.Name(), r.policy.RateLimit, len(r.pending))
+				r.limited = true
+			}
+			return
+		}
+	}
+
+	if err := r.channel.Send(format(header, r.pending)); err != nil {
+		log.Printf("Error sending alert to %s: %v", r.channel.Name(), err)
+		return
+	}
+	r.sent = append(r.sent, now)
+	r.pending = nil
+	r.limited = false
+}
+
+func (n *Notifier) header(lines []line) string {
+	down, up := 0, 0
+	for _, l := range lines {
+		if l.online {
+			up++
+		} else {
+			down++
+		}
+	}
+	title := "Xray Checker"
+	if n.instance != "" {
+		title += " " + n.instance
+	}
+	var parts []string
+	if down > 0 {
+		parts = append(parts, fmt.Sprintf("%d down", down))
+	}
+	if up > 0 {
+		parts = append(parts, fmt.Sprintf("%d up", up))
+	}
+	return title + ": " + strings.Join(parts, ", ")
+}
+
+func format(header string, lines []line) string {
+	var b strings.Builder
+	b.WriteString(header)
+	for i, l := range lines {
+		if i == maxLines {
+			fmt.Fprintf(&b, "\n... and %d more", len(lines)-maxLines)
+			break
+		}
+		mark := "🔴"
+		if l.online {
+			mark = "🟢"
+		}
+		fmt.Fprintf(&b, "\n%s %s", mark, l.text)
+	}
+	return b.String()
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+}
+
+// NotifierFromConfig returns a notifier for the alert channels of the CLI
+// configuration, or nil when no channel is configured. Register it with
+// checker.OnCycle(notifier.HandleCycle).
+func NotifierFromConfig() *Notifier {
+	cfg := config.CLIConfig.Alert
+	notifier := NewNotifier(config.CLIConfig.Metrics.Instance)
+	if cfg.TelegramToken != "" && cfg.TelegramChatID != "" {
+		notifier.AddChannel(NewTelegram(cfg.TelegramToken, cfg.TelegramChatID), Policy{
+			RateLimit:     cfg.TelegramRateLimit,
+			EscalateAfter: time.Duration(cfg.TelegramEscalate) * time.Second,
+		})
+	}
+	if cfg.WebhookURL != "" {
+		notifier.AddChannel(NewWebhook(cfg.WebhookURL), Policy{
+			RateLimit:     cfg.WebhookRateLimit,
+			EscalateAfter: time.Duration(cfg.WebhookEscalate) * time.Second,
+		})
+	}
+	if len(notifier.routes) == 0 {
+		return nil
+	}
+	return notifier
+}
@@ -0,0 +1,77 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// Telegram sends alerts through the Bot API to one chat.
+type Telegram struct {
+	token  string
+	chatID string
+}
+
+func NewTelegram(token, chatID string) *Telegram {
+	return &Telegram{token: token, chatID: chatID}
+}
+
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+func (t *Telegram) Send(text string) error {
+	return postJSON("https://api.telegram.org/bot"+t.token+"/sendMessage", map[string]interface{}{
+		"chat_id":                  t.chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+}
+
+// Webhook posts alerts as {"text": "..."}, the payload accepted by Slack,
+// Mattermost and Rocket.Chat incoming webhooks.
+type Webhook struct {
+	url string
+}
+
+func NewWebhook(endpoint string) *Webhook {
+	return &Webhook{url: endpoint}
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+func (w *Webhook) Send(text string) error {
+	return postJSON(w.url, map[string]string{"text": text})
+}
+
+func postJSON(endpoint string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The URL of a Telegram request contains the bot token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP status %d: %s", resp.StatusCode, bytes.TrimSpace(reply))
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package checker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+
+	"projectx/proxytestlib/config"
+)
+
+// TargetAuth holds the credentials sent to a protected check target. They are
+// added only to requests for the host of the check URL, so a redirect or the
+// confirmation URL on another host never receives them.
+type TargetAuth struct {
+	BearerToken string
+	Username    string
+	Password    string
+	Headers     http.Header
+}
+
+func (a TargetAuth) empty() bool {
+	return a.BearerToken == "" && a.Username == "" && a.Password == "" && len(a.Headers) == 0
+}
+
+// apply sets the credentials on req. Bearer token and basic auth replace an
+// Authorization header from Headers.
+func (a TargetAuth) apply(req *http.Request) {
+	for name, values := range a.Headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if a.Username != "" || a.Password != "" {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	if a.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+a.BearerToken)
+	}
+}
+
+// ParseHeaders parses "Name: value" lines. Empty lines and lines starting
+// with # are skipped.
+func ParseHeaders(data []byte) (http.Header, error) {
+	headers := make(http.Header)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("line %d: expected \"Name: value\"", line)
+		}
+		headers.Add(textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value))
+	}
+	return headers, scanner.Err()
+}
+
+// TargetAuthFromConfig returns the check target credentials of the CLI
+// configuration, reading the headers file if one is set.
+func TargetAuthFromConfig() (TargetAuth, error) {
+	cfg := config.CLIConfig.Proxy
+	auth := TargetAuth{
+		BearerToken: cfg.AuthToken,
+		Username:    cfg.AuthUser,
+		Password:    cfg.AuthPassword,
+	}
+	if cfg.HeadersFile != "" {
+		data, err := os.ReadFile(cfg.HeadersFile)
+		if err != nil {
+			return TargetAuth{}, fmt.Errorf("failed to read check headers file: %v", err)
+		}
+		if auth.Headers, err = ParseHeaders(data); err != nil {
+			return TargetAuth{}, fmt.Errorf("invalid check headers file %s: %v", cfg.HeadersFile, err)
+		}
+	}
+	return auth, nil
+}
+
+// SetTargetAuth sets the credentials sent to the check URL of later checks.
+func (pc *ProxyChecker) SetTargetAuth(auth TargetAuth) {
+	pc.targetAuth = auth
+}
+
+// authorize adds the credentials to req if it is for the check target host.
+func (pc *ProxyChecker) authorize(req *http.Request) *http.Request {
+	if pc.targetAuth.empty() || !sameHost(req.URL, pc.targetURL()) {
+		return req
+	}
+	req = req.Clone(req.Context())
+	pc.targetAuth.apply(req)
+	return req
+}
+
+func sameHost(u *url.URL, target string) bool {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == parsed.Scheme && strings.EqualFold(u.Host, parsed.Host)
+}
+
+// authTransport authorizes requests before passing them to the proxy
+// transport. Redirects go through it as well, so credentials follow a
+// redirect only within the check target host.
+type authTransport struct {
+	pc   *ProxyChecker
+	next http.RoundTripper
+}
+
+func (t authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(t.pc.authorize(req))
+}
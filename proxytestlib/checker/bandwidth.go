@@ -0,0 +1,151 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"projectx/proxytestlib/config"
+)
+
+// DefaultBandwidthBurst is the burst of a BandwidthLimit without one: the
+// bytes one read may take at once before the rate applies.
+const DefaultBandwidthBurst = 64 << 10
+
+// BandwidthLimit caps the traffic of speed checks (check-method=download,
+// upload and speedtest) across all proxies, so checks running at the same
+// time do not saturate the uplink and distort each other's throughput.
+type BandwidthLimit struct {
+	BytesPerSecond int64 // Aggregate rate of the check payloads, 0 for no limit
+	Burst          int   // Bytes passed at once above the rate, 0 for DefaultBandwidthBurst
+	MaxSpeedChecks int   // Speed checks running at the same time, 0 for no limit
+}
+
+// BandwidthLimitFromConfig returns the bandwidth limit of the CLI
+// configuration.
+func BandwidthLimitFromConfig() BandwidthLimit {
+	cfg := config.CLIConfig.Proxy
+	return BandwidthLimit{
+		BytesPerSecond: cfg.BandwidthLimit,
+		MaxSpeedChecks: cfg.SpeedWorkers,
+	}
+}
+
+// Limiter enforces a BandwidthLimit with a token bucket shared by every
+// reader it wraps and a semaphore of speed check slots. A nil Limiter
+// limits nothing.
+type Limiter struct {
+	rate  *rate.Limiter
+	burst int
+	slots chan struct{}
+}
+
+// NewLimiter returns a limiter for limit, or nil if limit caps nothing.
+func NewLimiter(limit BandwidthLimit) *Limiter {
+	if limit.BytesPerSecond <= 0 && limit.MaxSpeedChecks <= 0 {
+		return nil
+	}
+	l := &Limiter{}
+	if limit.BytesPerSecond > 0 {
+		l.burst = limit.Burst
+		if l.burst <= 0 {
+			l.burst = DefaultBandwidthBurst
+		}
+		l.rate = rate.NewLimiter(rate.Limit(limit.BytesPerSecond), l.burst)
+	}
+	if limit.MaxSpeedChecks > 0 {
+		l.slots = make(chan struct{}, limit.MaxSpeedChecks)
+	}
+	return l
+}
+
+// Acquire waits for a free speed check slot and returns the function that
+// frees it. The wait ends early with the error of ctx.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil || l.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// acquireWithin waits at most timeout for a free speed check slot, so a
+// check does not block forever while all slots are taken. A timeout of 0
+// waits without limit, like the check it bounds.
+func (l *Limiter) acquireWithin(timeout time.Duration) (func(), error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	release, err := l.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("no free speed check slot within %s: %v", timeout, err)
+	}
+	return release, nil
+}
+
+// Reader returns r throttled by the shared token bucket. Every read waits
+// until the bucket holds the bytes it returned; a read fails with the error
+// of ctx if it ends first.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil || l.rate == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, limiter: l}
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *Limiter
+	waited  time.Duration
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// The bucket never holds more than burst bytes
+	if len(p) > lr.limiter.burst {
+		p = p[:lr.limiter.burst]
+	}
+	n, err := lr.r.Read(p)
+	if n == 0 {
+		return n, err
+	}
+	reservation := lr.limiter.rate.ReserveN(time.Now(), n)
+	if delay := reservation.Delay(); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			lr.waited += delay
+		case <-lr.ctx.Done():
+			reservation.Cancel()
+			return n, lr.ctx.Err()
+		}
+	}
+	return n, err
+}
+
+// Throttled returns how long reads through r waited for the token bucket.
+// r must come from Reader; any other reader was never throttled. Throughput
+// measured over a throttled reader is capped by the limit, not the proxy.
+func Throttled(r io.Reader) time.Duration {
+	if lr, ok := r.(*limitedReader); ok {
+		return lr.waited
+	}
+	return 0
+}
+
+// SetBandwidthLimit caps the aggregate traffic and the number of concurrent
+// speed checks. The zero BandwidthLimit removes the caps.
+func (pc *ProxyChecker) SetBandwidthLimit(limit BandwidthLimit) {
+	pc.limiter = NewLimiter(limit)
+}
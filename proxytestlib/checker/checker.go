@@ -1,15 +1,17 @@
 package checker
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"projectx/proxytestlib/geoip"
 	"projectx/proxytestlib/metrics"
 	"projectx/proxytestlib/models"
 )
@@ -17,40 +19,258 @@ import (
 type ProxyChecker struct {
 	proxies         []*models.ProxyConfig
 	startPort       int
+	inbound         models.Inbound
 	ipCheck         string
 	currentIP       string
 	httpClient      *http.Client
+	transport       TransportOptions
+	targetAuth      TargetAuth
+	retry           RetryPolicy
+	attempts        sync.Map // attempts used by the last check
 	currentMetrics  sync.Map
 	latencyMetrics  sync.Map
+	confidence      sync.Map
+	indeterminate   sync.Map
+	speeds          sync.Map // throughput measured by the last speedtest check
+	metricLabels    sync.Map
 	ipInitialized   bool
+	ipMu            sync.Mutex // guards currentIP and ipInitialized
 	ipCheckTimeout  int
 	genMethodURL    string
+	statusExpect    StatusExpectation
 	downloadURL     string
 	downloadTimeout int
 	downloadMinSize int64
+	uploadURL       string
+	uploadSize      int64
+	uploadTimeout   int
+	speedTest       SpeedTest
+	limiter         *Limiter // bandwidth and concurrency cap of download, upload and speedtest checks, nil for none
 	checkMethod     string
+	core            InboundResolver // nil: Xray inbounds from startPort and inbound
 	instance        string
+	workers         int
+	metricsMode     string
+	confirmFlips    bool
+	confirmURL      string
+	targetDown      atomic.Bool
+	targetMu        sync.Mutex // serializes target probes
+	targetProbedAt  time.Time
+	onCycle         []func([]CycleResult)
+	geo             *geoip.Resolver
+	restartedAt     time.Time
+	clock           Clock
+	recoveryGrace   time.Duration
+	recovering      sync.Map // metric keys that have not passed a check since the last core restart
+	recovery        sync.Map // time to recover after the last core restart
+	mu              sync.RWMutex
 }
 
+// targetHealthTTL is how long a target probe answers for failed proxy
+// checks, so a round with many failures probes the target a few times at
+// most instead of once per failure.
+const targetHealthTTL = 10 * time.Second
+
+// DefaultRecoveryGrace is how long after an Xray core restart failed checks
+// are attributed to the restart rather than to the proxy.
+const DefaultRecoveryGrace = 30 * time.Second
+
+// Confidence levels recorded with every proxy status.
+const (
+	ConfidenceConfirmed   = 1.0 // same as the previous check, or change confirmed by a re-check
+	ConfidenceSingleCheck = 0.5 // first check, or change accepted without a re-check
+	ConfidenceUnconfirmed = 0.0 // change rejected by the re-check, previous status kept
+)
+
 func NewProxyChecker(proxies []*models.ProxyConfig, startPort int, ipCheckURL string, ipCheckTimeout int, genMethodURL string, downloadURL string, downloadTimeout int, downloadMinSize int64, checkMethod string, instance string) *ProxyChecker {
 	return &ProxyChecker{
 		proxies:   proxies,
 		startPort: startPort,
+		inbound:   models.DefaultInbound,
 		ipCheck:   ipCheckURL,
 		httpClient: &http.Client{
 			Timeout: time.Second * time.Duration(ipCheckTimeout),
 		},
 		ipCheckTimeout:  ipCheckTimeout,
 		genMethodURL:    genMethodURL,
+		statusExpect:    DefaultStatusExpectation,
 		downloadURL:     downloadURL,
 		downloadTimeout: downloadTimeout,
 		downloadMinSize: downloadMinSize,
+		uploadURL:       DefaultUploadURL,
+		uploadSize:      DefaultUploadSize,
+		uploadTimeout:   DefaultUploadTimeout,
+		speedTest:       DefaultSpeedTest,
 		checkMethod:     checkMethod,
 		instance:        instance,
+		workers:         1,
+		metricsMode:     metrics.ModeProxy,
+		confirmFlips:    true,
+		recoveryGrace:   DefaultRecoveryGrace,
+		transport:       DefaultTransportOptions,
+		retry:           DefaultRetryPolicy,
+		clock:           SystemClock{},
+	}
+}
+
+// SetConfirmation controls re-checking a proxy whose status differs from the
+// previous check before the change is recorded. If confirmURL is set, the
+// re-check requests it and expects a 2xx response instead of repeating the
+// configured check method.
+func (pc *ProxyChecker) SetConfirmation(enabled bool, confirmURL string) {
+	pc.confirmFlips = enabled
+	pc.confirmURL = confirmURL
+}
+
+// SetMetricsMode switches between per-proxy series (metrics.ModeProxy) and
+// series aggregated by protocol, country and provider (metrics.ModeAggregate).
+func (pc *ProxyChecker) SetMetricsMode(mode string) {
+	if mode != metrics.ModeAggregate {
+		mode = metrics.ModeProxy
+	}
+	pc.metricsMode = mode
+}
+
+func (pc *ProxyChecker) perProxyMetrics() bool {
+	return pc.metricsMode != metrics.ModeAggregate
+}
+
+// SetGeoIP sets the resolver used for the country of proxies whose names
+// carry no flag emoji. nil disables the lookup.
+func (pc *ProxyChecker) SetGeoIP(resolver *geoip.Resolver) {
+	pc.geo = resolver
+}
+
+// SetInbound sets the inbounds the checker connects through. It must match
+// the inbound settings the Xray config was generated with.
+func (pc *ProxyChecker) SetInbound(inbound models.Inbound) {
+	pc.inbound = inbound
+}
+
+// SetRecoveryGrace sets how long after an Xray core restart a failed check is
+// reported as indeterminate instead of an outage. 0 counts every failure.
+func (pc *ProxyChecker) SetRecoveryGrace(grace time.Duration) {
+	pc.recoveryGrace = grace
+}
+
+// MarkCoreRestart records that the shared Xray core was restarted. Until a
+// proxy passes its first check afterwards, failures within the recovery grace
+// period are indeterminate, and the time of that first success is exposed as
+// the proxy's time to recover.
+func (pc *ProxyChecker) MarkCoreRestart() {
+	pc.mu.Lock()
+	pc.restartedAt = pc.clock.Now()
+	for _, proxy := range pc.proxies {
+		pc.recovering.Store(metricKeyFor(proxy), true)
+		pc.recovery.Delete(metricKeyFor(proxy))
+	}
+	pc.mu.Unlock()
+
+	metrics.RecordCoreRestart(pc.instance)
+}
+
+// lastRestart returns the time of the last core restart, zero if none.
+func (pc *ProxyChecker) lastRestart() time.Time {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return pc.restartedAt
+}
+
+// trackRecovery updates the recovery state of a proxy after a check and
+// reports whether a failed check falls into the grace period after a core
+// restart.
+func (pc *ProxyChecker) trackRecovery(proxy *models.ProxyConfig, metricKey string, success bool) bool {
+	if _, ok := pc.recovering.Load(metricKey); !ok {
+		return false
 	}
+
+	sinceRestart := pc.clock.Now().Sub(pc.lastRestart())
+	if success {
+		pc.recovering.Delete(metricKey)
+		pc.recovery.Store(metricKey, sinceRestart)
+		log.Printf("%s | Recovered %s after Xray restart", proxy.Name, sinceRestart.Round(time.Millisecond))
+		if pc.perProxyMetrics() {
+			metrics.RecordProxyRecovery(
+				proxy.Protocol,
+				fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
+				proxy.Name,
+				sinceRestart,
+				pc.instance,
+			)
+		}
+		return false
+	}
+
+	if sinceRestart < pc.recoveryGrace {
+		return true
+	}
+	// Still failing after the grace period: a genuine outage, not the restart
+	pc.recovering.Delete(metricKey)
+	return false
+}
+
+// CycleResult is the status of one proxy after a CheckAllProxies cycle.
+type CycleResult struct {
+	Proxy   *models.ProxyConfig
+	Online  bool
+	Latency time.Duration
+	// Attempts used by the check, above 1 if it was retried. An online
+	// proxy with Attempts above 1 passed on a retry.
+	Attempts int
 }
 
+// OnCycle registers a function called with the results of every completed
+// CheckAllProxies cycle. Functions are called in registration order. Cycles
+// skipped because the check target is down are not reported.
+func (pc *ProxyChecker) OnCycle(fn func([]CycleResult)) {
+	pc.onCycle = append(pc.onCycle, fn)
+}
+
+// InboundResolver returns the proxy URL through which the checker reaches a
+// proxy, or an error if the engine cannot carry it. The engines of the core
+// package implement it.
+type InboundResolver interface {
+	InboundAddr(proxy *models.ProxyConfig) (*url.URL, error)
+}
+
+// SetCore makes the checker reach proxies through the inbounds of core
+// instead of the Xray inbounds set with SetInbound. Proxies the core cannot
+// carry are reported as indeterminate instead of down.
+func (pc *ProxyChecker) SetCore(core InboundResolver) {
+	pc.core = core
+}
+
+// inboundAddr returns the proxy URL of the check client for proxy.
+func (pc *ProxyChecker) inboundAddr(proxy *models.ProxyConfig) (*url.URL, error) {
+	if pc.core != nil {
+		return pc.core.InboundAddr(proxy)
+	}
+	if proxy.DirectDial() {
+		// Plain SOCKS5/HTTP proxies are used as the client proxy directly
+		return proxy.DirectURL(), nil
+	}
+	if !proxy.SupportedByXray() {
+		return nil, fmt.Errorf("%s is not supported by Xray core", proxy.Protocol)
+	}
+	return pc.inbound.URL(pc.startPort + proxy.Index), nil
+}
+
+// SetWorkers sets how many proxies CheckAllProxies checks at the same time.
+// Values below 1 fall back to sequential checking.
+func (pc *ProxyChecker) SetWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	pc.workers = workers
+}
+
+// GetCurrentIP returns the IP of the host without a proxy, requested once
+// and cached. Concurrent checks wait for the first request instead of
+// repeating it.
 func (pc *ProxyChecker) GetCurrentIP() (string, error) {
+	pc.ipMu.Lock()
+	defer pc.ipMu.Unlock()
+
 	if pc.ipInitialized && pc.currentIP != "" {
 		return pc.currentIP, nil
 	}
@@ -71,112 +291,387 @@ func (pc *ProxyChecker) GetCurrentIP() (string, error) {
 	return pc.currentIP, nil
 }
 
-func (pc *ProxyChecker) CheckProxy(proxy *models.ProxyConfig) {
+// proxyLabels is the label set a proxy's series are exported under.
+type proxyLabels struct {
+	protocol string
+	address  string
+	name     string
+}
+
+func labelsFor(proxy *models.ProxyConfig) proxyLabels {
+	return proxyLabels{
+		protocol: proxy.Protocol,
+		address:  fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
+		name:     proxy.Name,
+	}
+}
+
+func metricKeyFor(proxy *models.ProxyConfig) string {
 	if proxy.StableID == "" {
 		proxy.StableID = proxy.GenerateStableID()
 	}
 
-	metricKey := fmt.Sprintf("%s|%s:%d|%s|%s",
+	return fmt.Sprintf("%s|%s:%d|%s|%s",
 		proxy.Protocol,
 		proxy.Server,
 		proxy.Port,
 		proxy.Name,
 		proxy.StableID,
 	)
+}
+
+func (pc *ProxyChecker) CheckProxy(proxy *models.ProxyConfig) {
+	metricKey := metricKeyFor(proxy)
+	pc.metricLabels.Store(metricKey, labelsFor(proxy))
+
+	proxyURLParsed, err := pc.inboundAddr(proxy)
+	if err != nil {
+		log.Printf("%s | Indeterminate | %v", proxy.Name, err)
+		pc.setIndeterminate(proxy, metricKey, true)
+		return
+	}
 
 	setFailedStatus := func() {
-		metrics.RecordProxyStatus(
-			proxy.Protocol,
-			fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
-			proxy.Name,
-			0,
-			pc.instance,
-		)
+		if pc.perProxyMetrics() {
+			metrics.RecordProxyStatus(
+				proxy.Protocol,
+				fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
+				proxy.Name,
+				0,
+				pc.instance,
+			)
+		}
 		pc.currentMetrics.Store(metricKey, false)
 	}
 
 	setFailedLatency := func() {
-		metrics.RecordProxyLatency(
-			proxy.Protocol,
-			fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
-			proxy.Name,
-			time.Duration(0),
-			pc.instance,
-		)
+		if pc.perProxyMetrics() {
+			metrics.RecordProxyLatency(
+				proxy.Protocol,
+				fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
+				proxy.Name,
+				time.Duration(0),
+				pc.instance,
+			)
+		}
 		pc.latencyMetrics.Store(metricKey, time.Duration(0))
 	}
 
-	proxyURL := fmt.Sprintf("socks5://127.0.0.1:%d", pc.startPort+proxy.Index)
-	proxyURLParsed, err := url.Parse(proxyURL)
-	if err != nil {
-		log.Printf("Error parsing proxy URL %s: %v", proxyURL, err)
-		setFailedStatus()
-		setFailedLatency()
-
-		return
-	}
-
 	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy:             http.ProxyURL(proxyURLParsed),
-			DisableKeepAlives: true,
-		},
-		Timeout: time.Second * time.Duration(pc.ipCheckTimeout),
+		Transport: pc.newTransport(proxyURLParsed),
+		Timeout:   time.Second * time.Duration(pc.ipCheckTimeout),
 	}
+	defer client.CloseIdleConnections()
 
-	var checkSuccess bool
-	var checkErr error
-	var logMessage string
-
-	start := time.Now()
-
-	if pc.checkMethod == "ip" {
-		checkSuccess, logMessage, checkErr = pc.checkByIP(client)
-	} else if pc.checkMethod == "status" {
-		checkSuccess, logMessage, checkErr = pc.checkByGen(client)
-	} else if pc.checkMethod == "download" {
-		checkSuccess, logMessage, checkErr = pc.checkByDownload(client)
-	} else {
+	if pc.checkMethod != "ip" && pc.checkMethod != "status" && pc.checkMethod != "download" && pc.checkMethod != "upload" && pc.checkMethod != "speedtest" {
 		log.Printf("Invalid check method: %s", pc.checkMethod)
 		return
 	}
 
-	latency := time.Since(start)
+	var (
+		upload       uploadResult
+		speed        SpeedResult
+		checkSuccess bool
+		logMessage   string
+		checkErr     error
+		latency      time.Duration
+		attempt      int
+	)
+	for attempt = 1; ; attempt++ {
+		start := time.Now()
+		checkSuccess, logMessage, checkErr = pc.runCheck(client, &upload, &speed)
+		latency = time.Since(start)
+		if checkErr == nil || attempt > pc.retry.Retries {
+			break
+		}
+		delay := pc.retry.delay(attempt)
+		log.Printf("%s | Error | %v | Retry %d/%d in %s", proxy.Name, checkErr, attempt, pc.retry.Retries, delay.Round(time.Millisecond))
+		time.Sleep(delay)
+	}
+	pc.attempts.Store(metricKey, attempt)
+	if pc.perProxyMetrics() {
+		metrics.RecordProxyCheckAttempts(
+			proxy.Protocol,
+			fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
+			proxy.Name,
+			attempt,
+			pc.instance,
+		)
+	}
 
+	retried := ""
+	if attempt > 1 {
+		retried = fmt.Sprintf(" | Attempt %d", attempt)
+	}
 	if checkErr != nil {
-		log.Printf("%s | Error | %v", proxy.Name, checkErr)
-		setFailedStatus()
-		setFailedLatency()
+		log.Printf("%s | Error | %v%s", proxy.Name, checkErr, retried)
+	} else if !checkSuccess {
+		log.Printf("%s | Failed | %s | Latency: %s%s", proxy.Name, logMessage, latency, retried)
+	} else {
+		log.Printf("%s | Success | %s | Latency: %s%s", proxy.Name, logMessage, latency, retried)
+	}
 
+	if pc.trackRecovery(proxy, metricKey, checkErr == nil && checkSuccess) {
+		log.Printf("%s | Indeterminate | Xray core restarted %s ago", proxy.Name, pc.clock.Now().Sub(pc.lastRestart()).Round(time.Second))
+		pc.setIndeterminate(proxy, metricKey, true)
 		return
 	}
 
-	if !checkSuccess {
-		log.Printf("%s | Failed | %s | Latency: %s", proxy.Name, logMessage, latency)
-		setFailedStatus()
-		setFailedLatency()
-	} else {
-		log.Printf("%s | Success | %s | Latency: %s", proxy.Name, logMessage, latency)
-		metrics.RecordProxyStatus(
+	if (checkErr != nil || !checkSuccess) && !pc.targetUp() {
+		// A failure while the check target itself is down says nothing about the proxy
+		log.Printf("%s | Indeterminate | check target %s is unreachable", proxy.Name, pc.targetURL())
+		pc.setIndeterminate(proxy, metricKey, true)
+		return
+	}
+	pc.setIndeterminate(proxy, metricKey, false)
+
+	success, confidence := pc.confirmStatus(proxy, metricKey, client, checkErr == nil && checkSuccess)
+	pc.confidence.Store(metricKey, confidence)
+	if pc.perProxyMetrics() {
+		metrics.RecordProxyConfidence(
 			proxy.Protocol,
 			fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
 			proxy.Name,
-			1,
+			confidence,
 			pc.instance,
 		)
-		metrics.RecordProxyLatency(
+	}
+
+	if pc.checkMethod == "upload" && pc.perProxyMetrics() && (!success || (checkErr == nil && checkSuccess)) {
+		// A failed upload kept as success by the re-check leaves the last measured speed
+		metrics.RecordProxyUploadSpeed(
 			proxy.Protocol,
 			fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
 			proxy.Name,
-			latency,
+			upload.bytesPerSecond,
 			pc.instance,
 		)
+		metrics.RecordProxySpeedCapped(
+			proxy.Protocol,
+			fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
+			proxy.Name,
+			upload.capped,
+			pc.instance,
+		)
+	}
+	if pc.checkMethod == "speedtest" && (!success || (checkErr == nil && checkSuccess)) {
+		pc.speeds.Store(metricKey, speed)
+		if pc.perProxyMetrics() {
+			metrics.RecordProxySpeedtest(
+				proxy.Protocol,
+				fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
+				proxy.Name,
+				speed.DownloadMbps,
+				speed.UploadMbps,
+				pc.instance,
+			)
+			metrics.RecordProxySpeedCapped(
+				proxy.Protocol,
+				fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
+				proxy.Name,
+				speed.Capped,
+				pc.instance,
+			)
+		}
+	}
+
+	if !success {
+		setFailedStatus()
+		setFailedLatency()
+	} else {
+		if confidence == ConfidenceUnconfirmed {
+			// The proxy failed once but the re-check did not confirm it, keep the last latency
+			if previous, ok := pc.latencyMetrics.Load(metricKey); ok {
+				latency = previous.(time.Duration)
+			}
+		}
+		if pc.perProxyMetrics() {
+			metrics.RecordProxyStatus(
+				proxy.Protocol,
+				fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
+				proxy.Name,
+				1,
+				pc.instance,
+			)
+			metrics.RecordProxyLatency(
+				proxy.Protocol,
+				fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
+				proxy.Name,
+				latency,
+				pc.instance,
+			)
+		}
 
 		pc.latencyMetrics.Store(metricKey, latency)
 		pc.currentMetrics.Store(metricKey, true)
 	}
 }
 
+// setIndeterminate records whether the last check of the proxy was
+// inconclusive. It also runs before the first check of a proxy, so it
+// registers the labels that removeStaleMetrics deletes.
+func (pc *ProxyChecker) setIndeterminate(proxy *models.ProxyConfig, metricKey string, indeterminate bool) {
+	pc.metricLabels.Store(metricKey, labelsFor(proxy))
+	pc.indeterminate.Store(metricKey, indeterminate)
+	if pc.perProxyMetrics() {
+		metrics.RecordProxyIndeterminate(
+			proxy.Protocol,
+			fmt.Sprintf("%s:%d", proxy.Server, proxy.Port),
+			proxy.Name,
+			indeterminate,
+			pc.instance,
+		)
+	}
+}
+
+// targetURL returns the URL the configured check method requests.
+func (pc *ProxyChecker) targetURL() string {
+	switch pc.checkMethod {
+	case "status":
+		return pc.genMethodURL
+	case "download":
+		return pc.downloadURL
+	case "upload":
+		return pc.uploadURL
+	case "speedtest":
+		return pc.speedTest.Server
+	default:
+		return pc.ipCheck
+	}
+}
+
+// CheckTargetHealth requests the check URL directly, without a proxy, and
+// remembers whether it is reachable. Any response below 500 counts as up.
+func (pc *ProxyChecker) CheckTargetHealth() bool {
+	pc.targetMu.Lock()
+	defer pc.targetMu.Unlock()
+	return pc.probeTarget()
+}
+
+// targetUp reports whether the check target is reachable, probing it only
+// if the last probe is older than targetHealthTTL. Failed checks running at
+// the same time wait for a single probe.
+func (pc *ProxyChecker) targetUp() bool {
+	pc.targetMu.Lock()
+	defer pc.targetMu.Unlock()
+	if !pc.targetProbedAt.IsZero() && pc.clock.Now().Sub(pc.targetProbedAt) < targetHealthTTL {
+		return !pc.targetDown.Load()
+	}
+	return pc.probeTarget()
+}
+
+// probeTarget is CheckTargetHealth without the lock.
+func (pc *ProxyChecker) probeTarget() bool {
+	target := pc.targetURL()
+
+	up := false
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	var resp *http.Response
+	if err == nil {
+		resp, err = pc.httpClient.Do(pc.authorize(req))
+	}
+	if err == nil {
+		resp.Body.Close()
+		up = resp.StatusCode < 500
+	}
+
+	if wasDown := pc.targetDown.Swap(!up); wasDown == up {
+		if up {
+			log.Printf("Check target %s is reachable again, resuming checks", target)
+		} else {
+			log.Printf("Check target %s is unreachable (%v), proxy results are indeterminate until it recovers", target, err)
+		}
+	}
+	pc.targetProbedAt = pc.clock.Now()
+	metrics.RecordCheckTargetUp(target, up, pc.instance)
+	return up
+}
+
+// RunTargetWatchdog checks the target every interval until ctx is done.
+func (pc *ProxyChecker) RunTargetWatchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pc.CheckTargetHealth()
+		}
+	}
+}
+
+// GetProxyIndeterminate reports whether the last check of the proxy was
+// skipped because the check target was unreachable.
+func (pc *ProxyChecker) GetProxyIndeterminate(name string) (bool, error) {
+	for _, proxy := range pc.GetProxies() {
+		if proxy.Name != name {
+			continue
+		}
+		indeterminate, ok := pc.indeterminate.Load(metricKeyFor(proxy))
+		if !ok {
+			return false, fmt.Errorf("metric not found")
+		}
+		return indeterminate.(bool), nil
+	}
+	return false, fmt.Errorf("proxy not found")
+}
+
+// runCheck runs the configured check method. The upload method stores its
+// result in upload and the speedtest method in speed; both may be nil.
+func (pc *ProxyChecker) runCheck(client *http.Client, upload *uploadResult, speed *SpeedResult) (bool, string, error) {
+	switch pc.checkMethod {
+	case "ip":
+		return pc.checkByIP(client)
+	case "status":
+		return pc.checkByGen(client)
+	case "upload":
+		return pc.checkByUpload(client, upload)
+	case "speedtest":
+		return pc.checkBySpeedtest(client, speed)
+	default:
+		return pc.checkByDownload(client)
+	}
+}
+
+// confirmStatus compares a check result with the previous status of the proxy.
+// A change is re-checked once; if the re-check disagrees, the previous status
+// is kept and reported with ConfidenceUnconfirmed.
+func (pc *ProxyChecker) confirmStatus(proxy *models.ProxyConfig, metricKey string, client *http.Client, success bool) (bool, float64) {
+	previous, ok := pc.currentMetrics.Load(metricKey)
+	if !ok {
+		return success, ConfidenceSingleCheck
+	}
+	if previous.(bool) == success {
+		return success, ConfidenceConfirmed
+	}
+	if !pc.confirmFlips {
+		return success, ConfidenceSingleCheck
+	}
+
+	var recheckSuccess bool
+	var logMessage string
+	var err error
+	if pc.confirmURL != "" {
+		recheckSuccess, logMessage, err = pc.checkByURL(client, pc.confirmURL, DefaultStatusExpectation)
+	} else {
+		recheckSuccess, logMessage, err = pc.runCheck(client, nil, nil)
+	}
+	if err != nil {
+		recheckSuccess = false
+		logMessage = err.Error()
+	}
+
+	if recheckSuccess != success {
+		log.Printf("%s | Status change not confirmed by re-check | %s", proxy.Name, logMessage)
+		return previous.(bool), ConfidenceUnconfirmed
+	}
+
+	log.Printf("%s | Status change confirmed by re-check", proxy.Name)
+	return success, ConfidenceConfirmed
+}
+
 func (pc *ProxyChecker) checkByIP(client *http.Client) (bool, string, error) {
 	resp, err := client.Get(pc.ipCheck)
 	if err != nil {
@@ -189,43 +684,86 @@ func (pc *ProxyChecker) checkByIP(client *http.Client) (bool, string, error) {
 		return false, "", err
 	}
 
+	currentIP, err := pc.GetCurrentIP()
+	if err != nil {
+		return false, "", err
+	}
 	proxyIP := string(body)
-	logMessage := fmt.Sprintf("Source IP: %s | Proxy IP: %s", pc.currentIP, proxyIP)
-	return proxyIP != pc.currentIP, logMessage, nil
+	logMessage := fmt.Sprintf("Source IP: %s | Proxy IP: %s", currentIP, proxyIP)
+	return proxyIP != currentIP, logMessage, nil
 }
 
 func (pc *ProxyChecker) checkByGen(client *http.Client) (bool, string, error) {
-	resp, err := client.Get(pc.genMethodURL)
+	return pc.checkByURL(client, pc.genMethodURL, pc.statusExpect)
+}
+
+func (pc *ProxyChecker) checkByURL(client *http.Client, checkURL string, expect StatusExpectation) (bool, string, error) {
+	resp, err := expect.Client(client).Get(checkURL)
 	if err != nil {
 		return false, "", err
 	}
 	defer resp.Body.Close()
 
+	ok, mismatch, err := expect.Check(resp)
+	if err != nil {
+		return false, "", err
+	}
 	logMessage := fmt.Sprintf("Status: %d", resp.StatusCode)
-	return resp.StatusCode >= 200 && resp.StatusCode < 300, logMessage, nil
+	if !ok {
+		logMessage += fmt.Sprintf(" | Expected %s, %s", expect, mismatch)
+	}
+	return ok, logMessage, nil
 }
 
 func (pc *ProxyChecker) ClearMetrics() {
-	pc.currentMetrics.Range(func(key, _ interface{}) bool {
+	pc.removeStaleMetrics(nil, nil)
+}
+
+// removeStaleMetrics deletes the series of every tracked proxy whose key is
+// not in keepKeys. Label sets still used by a kept proxy are left in place,
+// since two configs may share protocol, address and name.
+func (pc *ProxyChecker) removeStaleMetrics(keepKeys map[string]bool, keepLabels map[proxyLabels]bool) {
+	pc.metricLabels.Range(func(key, value interface{}) bool {
 		metricKey := key.(string)
-		parts := strings.Split(metricKey, "|")
-		if len(parts) >= 3 {
-			metrics.DeleteProxyStatus(parts[0], parts[1], parts[2], pc.instance)
-			metrics.DeleteProxyLatency(parts[0], parts[1], parts[2], pc.instance)
+		if keepKeys[metricKey] {
+			return true
+		}
+
+		labels := value.(proxyLabels)
+		if !keepLabels[labels] {
+			metrics.DeleteProxySeries(labels.protocol, labels.address, labels.name, pc.instance)
 		}
-		pc.currentMetrics.Delete(key)
-		return true
-	})
 
-	pc.latencyMetrics.Range(func(key, _ interface{}) bool {
+		pc.metricLabels.Delete(key)
+		pc.currentMetrics.Delete(key)
 		pc.latencyMetrics.Delete(key)
+		pc.confidence.Delete(key)
+		pc.indeterminate.Delete(key)
+		pc.speeds.Delete(key)
+		pc.recovering.Delete(key)
+		pc.recovery.Delete(key)
+		pc.attempts.Delete(key)
 		return true
 	})
 }
 
+// UpdateProxies replaces the monitored proxy set. Series of proxies that were
+// removed or renamed are deleted; unchanged proxies keep their last values.
 func (pc *ProxyChecker) UpdateProxies(newProxies []*models.ProxyConfig) {
-	pc.ClearMetrics()
+	keepKeys := make(map[string]bool, len(newProxies))
+	keepLabels := make(map[proxyLabels]bool, len(newProxies))
+	for _, proxy := range newProxies {
+		keepKeys[metricKeyFor(proxy)] = true
+		keepLabels[labelsFor(proxy)] = true
+	}
+
+	pc.removeStaleMetrics(keepKeys, keepLabels)
+
+	pc.mu.Lock()
 	pc.proxies = newProxies
+	pc.mu.Unlock()
+
+	metrics.RecordProxiesTracked(len(newProxies), pc.instance)
 }
 
 func (pc *ProxyChecker) CheckAllProxies() {
@@ -234,26 +772,145 @@ func (pc *ProxyChecker) CheckAllProxies() {
 		return
 	}
 
-	for _, proxy := range pc.proxies {
-		pc.CheckProxy(proxy)
+	proxies := pc.GetProxies()
+	metrics.RecordProxiesTracked(len(proxies), pc.instance)
+
+	if !pc.CheckTargetHealth() {
+		log.Printf("Skipping check of %d proxies: check target %s is unreachable", len(proxies), pc.targetURL())
+		for _, proxy := range proxies {
+			pc.setIndeterminate(proxy, metricKeyFor(proxy), true)
+		}
+		return
+	}
+
+	// StableIDs are assigned up front so workers never write shared fields.
+	for _, proxy := range proxies {
+		if proxy.StableID == "" {
+			proxy.StableID = proxy.GenerateStableID()
+		}
+	}
+
+	workers := pc.workers
+	if workers > len(proxies) {
+		workers = len(proxies)
+	}
+
+	jobs := make(chan *models.ProxyConfig)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for proxy := range jobs {
+				pc.CheckProxy(proxy)
+			}
+		}()
+	}
+
+	for _, proxy := range proxies {
+		jobs <- proxy
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	if !pc.perProxyMetrics() {
+		pc.recordGroupStats(proxies)
+	}
+
+	if len(pc.onCycle) > 0 {
+		results := make([]CycleResult, 0, len(proxies))
+		for _, proxy := range proxies {
+			result := CycleResult{Proxy: proxy}
+			metricKey := metricKeyFor(proxy)
+			if status, ok := pc.currentMetrics.Load(metricKey); ok {
+				result.Online = status.(bool)
+			}
+			if latency, ok := pc.latencyMetrics.Load(metricKey); ok {
+				result.Latency = latency.(time.Duration)
+			}
+			if attempts, ok := pc.attempts.Load(metricKey); ok {
+				result.Attempts = attempts.(int)
+			}
+			results = append(results, result)
+		}
+		for _, fn := range pc.onCycle {
+			fn(results)
+		}
 	}
 }
 
+type proxyGroup struct {
+	protocol string
+	country  string
+	provider string
+}
+
+type groupStats struct {
+	up           int
+	total        int
+	totalLatency time.Duration
+}
+
+func (pc *ProxyChecker) recordGroupStats(proxies []*models.ProxyConfig) {
+	groups := make(map[proxyGroup]*groupStats)
+
+	for _, proxy := range proxies {
+		key := proxyGroup{
+			protocol: proxy.Protocol,
+			country:  pc.countryOf(proxy),
+			provider: proxy.GetProvider(),
+		}
+		if key.country == "" {
+			key.country = "unknown"
+		}
+		if key.provider == "" {
+			key.provider = "unknown"
+		}
+
+		stats, ok := groups[key]
+		if !ok {
+			stats = &groupStats{}
+			groups[key] = stats
+		}
+		stats.total++
+
+		metricKey := metricKeyFor(proxy)
+		if status, ok := pc.currentMetrics.Load(metricKey); ok && status.(bool) {
+			stats.up++
+			if latency, ok := pc.latencyMetrics.Load(metricKey); ok {
+				stats.totalLatency += latency.(time.Duration)
+			}
+		}
+	}
+
+	metrics.ResetGroupStats()
+	for key, stats := range groups {
+		var avgLatency time.Duration
+		if stats.up > 0 {
+			avgLatency = stats.totalLatency / time.Duration(stats.up)
+		}
+		metrics.RecordGroupStats(key.protocol, key.country, key.provider, stats.up, stats.total, avgLatency, pc.instance)
+	}
+}
+
+// countryOf returns the country from the flag emoji in the proxy name, or
+// from GeoIP of the server address.
+func (pc *ProxyChecker) countryOf(proxy *models.ProxyConfig) string {
+	if country := proxy.GetCountry(); country != "" || pc.geo == nil {
+		return country
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return pc.geo.Country(ctx, proxy.Server)
+}
+
 func (pc *ProxyChecker) GetProxyStatus(name string) (bool, time.Duration, error) {
 	var metricKey string
-	for _, proxy := range pc.proxies {
+	for _, proxy := range pc.GetProxies() {
 		if proxy.Name == name {
-			if proxy.StableID == "" {
-				proxy.StableID = proxy.GenerateStableID()
-			}
-
-			metricKey = fmt.Sprintf("%s|%s:%d|%s|%s",
-				proxy.Protocol,
-				proxy.Server,
-				proxy.Port,
-				proxy.Name,
-				proxy.StableID,
-			)
+			metricKey = metricKeyFor(proxy)
 			break
 		}
 	}
@@ -275,8 +932,55 @@ func (pc *ProxyChecker) GetProxyStatus(name string) (bool, time.Duration, error)
 	return status.(bool), latency.(time.Duration), nil
 }
 
+// GetProxyConfidence returns the confidence of the last recorded status.
+func (pc *ProxyChecker) GetProxyConfidence(name string) (float64, error) {
+	for _, proxy := range pc.GetProxies() {
+		if proxy.Name != name {
+			continue
+		}
+		confidence, ok := pc.confidence.Load(metricKeyFor(proxy))
+		if !ok {
+			return 0, fmt.Errorf("metric not found")
+		}
+		return confidence.(float64), nil
+	}
+	return 0, fmt.Errorf("proxy not found")
+}
+
+// GetProxyRecovery returns how long the proxy took to pass its first check
+// after the last Xray core restart.
+func (pc *ProxyChecker) GetProxyRecovery(name string) (time.Duration, error) {
+	for _, proxy := range pc.GetProxies() {
+		if proxy.Name != name {
+			continue
+		}
+		recovery, ok := pc.recovery.Load(metricKeyFor(proxy))
+		if !ok {
+			return 0, fmt.Errorf("proxy has not recovered since the last restart")
+		}
+		return recovery.(time.Duration), nil
+	}
+	return 0, fmt.Errorf("proxy not found")
+}
+
+// GetProxyAttempts returns how many attempts the last check of the proxy
+// used; above 1 means it was retried.
+func (pc *ProxyChecker) GetProxyAttempts(name string) (int, error) {
+	for _, proxy := range pc.GetProxies() {
+		if proxy.Name != name {
+			continue
+		}
+		attempts, ok := pc.attempts.Load(metricKeyFor(proxy))
+		if !ok {
+			return 0, fmt.Errorf("metric not found")
+		}
+		return attempts.(int), nil
+	}
+	return 0, fmt.Errorf("proxy not found")
+}
+
 func (pc *ProxyChecker) GetProxyByStableID(stableID string) (*models.ProxyConfig, bool) {
-	for _, proxy := range pc.proxies {
+	for _, proxy := range pc.GetProxies() {
 		if proxy.StableID == "" {
 			proxy.StableID = proxy.GenerateStableID()
 		}
@@ -289,6 +993,8 @@ func (pc *ProxyChecker) GetProxyByStableID(stableID string) (*models.ProxyConfig
 }
 
 func (pc *ProxyChecker) GetProxies() []*models.ProxyConfig {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
 	return pc.proxies
 }
 
@@ -297,6 +1003,12 @@ func (pc *ProxyChecker) checkByDownload(client *http.Client) (bool, string, erro
 		return false, "Download URL not configured", fmt.Errorf("download URL not configured")
 	}
 
+	release, err := pc.limiter.acquireWithin(time.Second * time.Duration(pc.downloadTimeout))
+	if err != nil {
+		return false, "", err
+	}
+	defer release()
+
 	downloadClient := &http.Client{
 		Transport: client.Transport,
 		Timeout:   time.Second * time.Duration(pc.downloadTimeout),
@@ -307,6 +1019,7 @@ func (pc *ProxyChecker) checkByDownload(client *http.Client) (bool, string, erro
 		return false, "", err
 	}
 	defer resp.Body.Close()
+	body := pc.limiter.Reader(resp.Request.Context(), resp.Body)
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return false, fmt.Sprintf("HTTP status: %d", resp.StatusCode), nil
@@ -314,9 +1027,10 @@ func (pc *ProxyChecker) checkByDownload(client *http.Client) (bool, string, erro
 
 	totalBytes := int64(0)
 	buffer := make([]byte, 8192)
+	start := time.Now()
 
 	for {
-		n, err := resp.Body.Read(buffer)
+		n, err := body.Read(buffer)
 		if n > 0 {
 			totalBytes += int64(n)
 			if totalBytes >= pc.downloadMinSize {
@@ -341,6 +1055,12 @@ func (pc *ProxyChecker) checkByDownload(client *http.Client) (bool, string, erro
 
 	success := totalBytes >= pc.downloadMinSize
 	logMessage := fmt.Sprintf("Downloaded: %d bytes (min: %d)", totalBytes, pc.downloadMinSize)
+	if elapsed := time.Since(start); elapsed > 0 {
+		logMessage += fmt.Sprintf(", %.2f MB/s", float64(totalBytes)/elapsed.Seconds()/1e6)
+		if Throttled(body) > 0 {
+			logMessage += " (capped by bandwidth limit)"
+		}
+	}
 
 	return success, logMessage, nil
 }
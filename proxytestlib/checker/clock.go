@@ -0,0 +1,25 @@
+package checker
+
+import "time"
+
+// Clock returns the current time. The checker reads it for the recovery
+// window after core restarts, so tests can move through that window without
+// waiting. Latencies are always measured with the real clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the real clock used by default.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SetClock replaces the clock of the checker, nil restores SystemClock.
+func (pc *ProxyChecker) SetClock(clock Clock) {
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	pc.clock = clock
+}
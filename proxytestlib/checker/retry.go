@@ -0,0 +1,60 @@
+package checker
+
+import (
+	"math/rand"
+	"time"
+
+	"projectx/proxytestlib/config"
+)
+
+// RetryPolicy repeats a check that failed with an error, such as a timeout
+// or a reset connection, before the proxy is marked down. A check that got
+// an answer, e.g. a wrong status code, is not retried.
+type RetryPolicy struct {
+	Retries    int           // Additional attempts, 0 disables retries
+	Backoff    time.Duration // Delay before the first retry, doubled for each next one
+	MaxBackoff time.Duration // Upper bound of the delay, 0 for no bound
+	Jitter     float64       // Random share of the delay added or removed, 0 to 1
+}
+
+// DefaultRetryPolicy checks every proxy once per cycle.
+var DefaultRetryPolicy = RetryPolicy{}
+
+// RetryPolicyFromConfig returns the retry policy of the CLI configuration.
+func RetryPolicyFromConfig() RetryPolicy {
+	cfg := config.CLIConfig.Proxy
+	return RetryPolicy{
+		Retries:    cfg.Retries,
+		Backoff:    time.Duration(cfg.RetryBackoff) * time.Millisecond,
+		MaxBackoff: time.Duration(cfg.RetryMaxBackoff) * time.Millisecond,
+		Jitter:     cfg.RetryJitter,
+	}
+}
+
+// SetRetry replaces the retry policy of later checks.
+func (pc *ProxyChecker) SetRetry(policy RetryPolicy) {
+	if policy.Retries < 0 {
+		policy.Retries = 0
+	}
+	if policy.Jitter < 0 {
+		policy.Jitter = 0
+	} else if policy.Jitter > 1 {
+		policy.Jitter = 1
+	}
+	pc.retry = policy
+}
+
+// delay returns the wait before retry number n, starting at 1.
+func (p RetryPolicy) delay(n int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < n && (p.MaxBackoff == 0 || delay < p.MaxBackoff); i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if p.Jitter > 0 && delay > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	}
+	return delay
+}
@@ -0,0 +1,241 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"projectx/proxytestlib/config"
+)
+
+// Speed test providers of check-method=speedtest.
+const (
+	SpeedTestCloudflare = "cloudflare"
+	SpeedTestLibreSpeed = "librespeed"
+)
+
+// Defaults of the speedtest check method.
+const (
+	DefaultSpeedTestServer       = "https://speed.cloudflare.com"
+	DefaultSpeedTestDownloadSize = 5 << 20
+	DefaultSpeedTestUploadSize   = 2 << 20
+	DefaultSpeedTestTimeout      = 30
+)
+
+// SpeedTest configures check-method=speedtest: a short download and upload
+// through the proxy against a Cloudflare speed endpoint or a LibreSpeed
+// server.
+type SpeedTest struct {
+	Provider     string // SpeedTestCloudflare or SpeedTestLibreSpeed
+	Server       string // Base URL of the server, DefaultSpeedTestServer for Cloudflare if empty
+	DownloadSize int64  // Bytes to download, rounded up to whole MiB for LibreSpeed
+	UploadSize   int64  // Bytes to upload
+	Timeout      int    // Seconds for each of the two transfers
+}
+
+// DefaultSpeedTest measures against the public Cloudflare endpoint.
+var DefaultSpeedTest = SpeedTest{
+	Provider:     SpeedTestCloudflare,
+	Server:       DefaultSpeedTestServer,
+	DownloadSize: DefaultSpeedTestDownloadSize,
+	UploadSize:   DefaultSpeedTestUploadSize,
+	Timeout:      DefaultSpeedTestTimeout,
+}
+
+// SpeedResult is the throughput measured by the last speedtest check.
+type SpeedResult struct {
+	DownloadMbps float64
+	UploadMbps   float64
+	Capped       bool // A transfer was slowed down by the bandwidth limit, so its speed is a lower bound
+}
+
+// SpeedTestFromConfig returns the speed test of the CLI configuration.
+func SpeedTestFromConfig() (SpeedTest, error) {
+	cfg := config.CLIConfig.Proxy
+	test := SpeedTest{
+		Provider:     cfg.SpeedProvider,
+		Server:       cfg.SpeedServer,
+		DownloadSize: cfg.SpeedDownSize,
+		UploadSize:   cfg.SpeedUpSize,
+		Timeout:      cfg.SpeedTimeout,
+	}
+	return test, test.validate()
+}
+
+func (t SpeedTest) validate() error {
+	switch t.Provider {
+	case SpeedTestCloudflare:
+	case SpeedTestLibreSpeed:
+		if t.Server == "" {
+			return fmt.Errorf("speed test provider %s requires a server URL", t.Provider)
+		}
+	default:
+		return fmt.Errorf("unknown speed test provider %q", t.Provider)
+	}
+	if t.DownloadSize <= 0 || t.UploadSize <= 0 || t.Timeout <= 0 {
+		return fmt.Errorf("speed test sizes and timeout must be positive")
+	}
+	return nil
+}
+
+// SetSpeedTest configures check-method=speedtest.
+func (pc *ProxyChecker) SetSpeedTest(test SpeedTest) error {
+	if err := test.validate(); err != nil {
+		return err
+	}
+	if test.Server == "" {
+		test.Server = DefaultSpeedTestServer
+	}
+	test.Server = strings.TrimSuffix(test.Server, "/")
+	pc.speedTest = test
+	return nil
+}
+
+// GetProxySpeed returns the throughput measured by the last speedtest check
+// of the proxy.
+func (pc *ProxyChecker) GetProxySpeed(name string) (SpeedResult, error) {
+	for _, proxy := range pc.GetProxies() {
+		if proxy.Name != name {
+			continue
+		}
+		speed, ok := pc.speeds.Load(metricKeyFor(proxy))
+		if !ok {
+			return SpeedResult{}, fmt.Errorf("metric not found")
+		}
+		return speed.(SpeedResult), nil
+	}
+	return SpeedResult{}, fmt.Errorf("proxy not found")
+}
+
+// downloadURL returns the endpoint that sends at least size bytes.
+func (t SpeedTest) downloadURL() string {
+	if t.Provider == SpeedTestLibreSpeed {
+		// garbage.php sends ckSize chunks of 1 MiB
+		chunks := (t.DownloadSize + 1<<20 - 1) >> 20
+		return fmt.Sprintf("%s/backend/garbage.php?ckSize=%d", t.Server, chunks)
+	}
+	return fmt.Sprintf("%s/__down?bytes=%d", t.Server, t.DownloadSize)
+}
+
+// uploadURL returns the endpoint that accepts and discards a POST body.
+func (t SpeedTest) uploadURL() string {
+	if t.Provider == SpeedTestLibreSpeed {
+		return t.Server + "/backend/empty.php"
+	}
+	return t.Server + "/__up"
+}
+
+// checkBySpeedtest downloads and then uploads through the proxy and stores
+// the throughput of both in speed. Download speed is measured from the
+// first response byte, upload speed until the response headers arrive. The
+// check fails if either transfer fails; the speed of the other is still
+// stored.
+func (pc *ProxyChecker) checkBySpeedtest(client *http.Client, speed *SpeedResult) (bool, string, error) {
+	timeout := time.Second * time.Duration(pc.speedTest.Timeout)
+	release, err := pc.limiter.acquireWithin(timeout)
+	if err != nil {
+		return false, "", err
+	}
+	defer release()
+
+	var result SpeedResult
+	if speed != nil {
+		defer func() { *speed = result }()
+	}
+	transferClient := &http.Client{Transport: client.Transport}
+
+	downloaded, elapsed, capped, err := pc.speedtestDownload(transferClient, timeout)
+	if err != nil {
+		return false, "", fmt.Errorf("speedtest download: %v", err)
+	}
+	result.DownloadMbps = mbps(downloaded, elapsed)
+	result.Capped = capped
+
+	elapsed, capped, err = pc.speedtestUpload(transferClient, timeout)
+	if err != nil {
+		return false, "", fmt.Errorf("speedtest upload: %v", err)
+	}
+	result.UploadMbps = mbps(pc.speedTest.UploadSize, elapsed)
+	result.Capped = result.Capped || capped
+
+	logMessage := fmt.Sprintf("Speedtest (%s): down %.2f Mbps, up %.2f Mbps", pc.speedTest.Provider, result.DownloadMbps, result.UploadMbps)
+	if result.Capped {
+		logMessage += " (capped by bandwidth limit)"
+	}
+	return true, logMessage, nil
+}
+
+// speedtestDownload reads up to DownloadSize bytes and reports whether the
+// bandwidth limit slowed it down. A transfer cut short by the timeout counts
+// with the bytes received so far.
+func (pc *ProxyChecker) speedtestDownload(client *http.Client, timeout time.Duration) (int64, time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pc.speedTest.downloadURL(), nil)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, 0, false, fmt.Errorf("HTTP status: %d", resp.StatusCode)
+	}
+
+	body := pc.limiter.Reader(ctx, resp.Body)
+	start := time.Now()
+	downloaded, err := io.CopyN(io.Discard, body, pc.speedTest.DownloadSize)
+	elapsed := time.Since(start)
+	if downloaded == 0 || elapsed <= 0 {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, 0, false, err
+	}
+	return downloaded, elapsed, Throttled(body) > 0, nil
+}
+
+// speedtestUpload POSTs UploadSize random bytes, so compression on the path
+// cannot inflate the result, and reports whether the bandwidth limit slowed
+// it down.
+func (pc *ProxyChecker) speedtestUpload(client *http.Client, timeout time.Duration) (time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	payload := pc.limiter.Reader(ctx, io.LimitReader(rand.New(rand.NewSource(time.Now().UnixNano())), pc.speedTest.UploadSize))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pc.speedTest.uploadURL(), payload)
+	if err != nil {
+		return 0, false, err
+	}
+	req.ContentLength = pc.speedTest.UploadSize
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	elapsed := time.Since(start)
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, false, fmt.Errorf("HTTP status: %d", resp.StatusCode)
+	}
+	return elapsed, Throttled(payload) > 0, nil
+}
+
+// mbps converts bytes transferred in elapsed to megabits per second.
+func mbps(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / elapsed.Seconds() / 1e6
+}
@@ -0,0 +1,155 @@
+package checker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"projectx/proxytestlib/config"
+)
+
+// statusBodyLimit is how much of the response body is searched for
+// StatusExpectation.BodyContains.
+const statusBodyLimit = 1 << 20
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct {
+	Min, Max int
+}
+
+// StatusExpectation is the response check-method=status accepts from a
+// working proxy: a status code in one of Codes and, if BodyContains is set,
+// a body containing it.
+type StatusExpectation struct {
+	Codes        []StatusRange
+	BodyContains string
+}
+
+// DefaultStatusExpectation accepts any 2xx response.
+var DefaultStatusExpectation = StatusExpectation{Codes: []StatusRange{{Min: 200, Max: 299}}}
+
+// ParseStatusCodes parses a comma-separated list of status codes and
+// ranges: "204", "200-299,301,302" or "2xx".
+func ParseStatusCodes(spec string) ([]StatusRange, error) {
+	var codes []StatusRange
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var r StatusRange
+		var err error
+		switch {
+		case len(item) == 3 && strings.HasSuffix(strings.ToLower(item), "xx"):
+			r.Min, err = strconv.Atoi(item[:1])
+			r.Min *= 100
+			r.Max = r.Min + 99
+		case strings.Contains(item, "-"):
+			low, high, _ := strings.Cut(item, "-")
+			if r.Min, err = strconv.Atoi(strings.TrimSpace(low)); err == nil {
+				r.Max, err = strconv.Atoi(strings.TrimSpace(high))
+			}
+		default:
+			r.Min, err = strconv.Atoi(item)
+			r.Max = r.Min
+		}
+		if err != nil || r.Min < 100 || r.Max > 599 || r.Min > r.Max {
+			return nil, fmt.Errorf("invalid status code or range %q", item)
+		}
+		codes = append(codes, r)
+	}
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("no status codes in %q", spec)
+	}
+	return codes, nil
+}
+
+// String formats the expectation for logs, such as "200-299 with body \"ok\"".
+func (e StatusExpectation) String() string {
+	parts := make([]string, 0, len(e.Codes))
+	for _, r := range e.Codes {
+		if r.Min == r.Max {
+			parts = append(parts, strconv.Itoa(r.Min))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", r.Min, r.Max))
+		}
+	}
+	s := strings.Join(parts, ",")
+	if e.BodyContains != "" {
+		s += fmt.Sprintf(" with body %q", e.BodyContains)
+	}
+	return s
+}
+
+// MatchStatus reports whether code is one of the expected codes.
+func (e StatusExpectation) MatchStatus(code int) bool {
+	for _, r := range e.Codes {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpectsRedirect reports whether a 3xx code is expected. Such a response
+// is only seen if the client does not follow redirects.
+func (e StatusExpectation) ExpectsRedirect() bool {
+	for _, r := range e.Codes {
+		if r.Min < 400 && r.Max >= 300 {
+			return true
+		}
+	}
+	return false
+}
+
+// Client returns client, or a copy of it that does not follow redirects if
+// a 3xx code is expected.
+func (e StatusExpectation) Client(client *http.Client) *http.Client {
+	if !e.ExpectsRedirect() {
+		return client
+	}
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &noRedirect
+}
+
+// Check reports whether resp is the expected response. The body is read only
+// if BodyContains is set, up to the first megabyte; the caller still closes it.
+// The returned message describes a mismatch.
+func (e StatusExpectation) Check(resp *http.Response) (bool, string, error) {
+	if !e.MatchStatus(resp.StatusCode) {
+		return false, fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil
+	}
+	if e.BodyContains == "" {
+		return true, "", nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, statusBodyLimit))
+	if err != nil {
+		return false, "", err
+	}
+	if !bytes.Contains(body, []byte(e.BodyContains)) {
+		return false, fmt.Sprintf("unexpected response body: no %q", e.BodyContains), nil
+	}
+	return true, "", nil
+}
+
+// StatusExpectationFromConfig returns the expected response of the CLI
+// configuration.
+func StatusExpectationFromConfig() (StatusExpectation, error) {
+	cfg := config.CLIConfig.Proxy
+	codes, err := ParseStatusCodes(cfg.StatusCodes)
+	if err != nil {
+		return StatusExpectation{}, fmt.Errorf("invalid proxy-status-codes: %v", err)
+	}
+	return StatusExpectation{Codes: codes, BodyContains: cfg.StatusBody}, nil
+}
+
+// SetStatusExpectation sets the response check-method=status accepts.
+func (pc *ProxyChecker) SetStatusExpectation(expect StatusExpectation) {
+	pc.statusExpect = expect
+}
@@ -0,0 +1,106 @@
+package checker
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"projectx/proxytestlib/config"
+)
+
+// TransportOptions tunes the HTTP client that checks run through a proxy.
+type TransportOptions struct {
+	DisableKeepAlives  bool
+	MaxIdleConns       int    // 0 means no limit
+	TLSMinVersion      uint16 // 0 keeps the Go default
+	DisableCompression bool
+	// FreshTransport builds a new transport for every request, so the
+	// re-check and the download check never reuse a connection of the
+	// first check and each latency includes the connection setup.
+	FreshTransport bool
+}
+
+// DefaultTransportOptions matches the transport used before the options
+// were configurable.
+var DefaultTransportOptions = TransportOptions{DisableKeepAlives: true}
+
+// ParseTLSVersion converts "1.0" to "1.3" to a tls.Version* constant, an
+// empty string to 0.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", version)
+}
+
+// TransportOptionsFromConfig returns the transport options of the CLI
+// configuration.
+func TransportOptionsFromConfig() (TransportOptions, error) {
+	cfg := config.CLIConfig.Proxy
+	tlsMin, err := ParseTLSVersion(cfg.TLSMinVersion)
+	if err != nil {
+		return TransportOptions{}, err
+	}
+	return TransportOptions{
+		DisableKeepAlives:  !cfg.KeepAlives,
+		MaxIdleConns:       cfg.MaxIdleConns,
+		TLSMinVersion:      tlsMin,
+		DisableCompression: cfg.NoCompression,
+		FreshTransport:     cfg.FreshTransport,
+	}, nil
+}
+
+// SetTransport replaces the options used for clients of later checks.
+func (pc *ProxyChecker) SetTransport(opts TransportOptions) {
+	pc.transport = opts
+}
+
+// newTransport returns the round tripper for checks through proxyURL.
+func (pc *ProxyChecker) newTransport(proxyURL *url.URL) http.RoundTripper {
+	transport := pc.proxyTransport(proxyURL)
+	if pc.targetAuth.empty() {
+		return transport
+	}
+	return authTransport{pc: pc, next: transport}
+}
+
+func (pc *ProxyChecker) proxyTransport(proxyURL *url.URL) http.RoundTripper {
+	opts := pc.transport
+	build := func() *http.Transport {
+		transport := &http.Transport{
+			Proxy:              http.ProxyURL(proxyURL),
+			DisableKeepAlives:  opts.DisableKeepAlives,
+			MaxIdleConns:       opts.MaxIdleConns,
+			DisableCompression: opts.DisableCompression,
+		}
+		if opts.TLSMinVersion != 0 {
+			transport.TLSClientConfig = &tls.Config{MinVersion: opts.TLSMinVersion}
+		}
+		return transport
+	}
+	if opts.FreshTransport {
+		return freshTransport(build)
+	}
+	return build()
+}
+
+// freshTransport sends every request through a transport of its own.
+// Keep-alives are disabled, the connection of a discarded transport would
+// otherwise stay idle until it times out.
+type freshTransport func() *http.Transport
+
+func (build freshTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := build()
+	transport.DisableKeepAlives = true
+	return transport.RoundTrip(req)
+}
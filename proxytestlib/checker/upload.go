@@ -0,0 +1,88 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Defaults of the upload check method.
+const (
+	DefaultUploadURL     = "https://speed.cloudflare.com/__up"
+	DefaultUploadSize    = 1 << 20
+	DefaultUploadTimeout = 60
+)
+
+// SetUpload configures check-method=upload: the endpoint that accepts the
+// POSTed payload, the payload size in bytes and the timeout in seconds.
+func (pc *ProxyChecker) SetUpload(uploadURL string, size int64, timeout int) {
+	pc.uploadURL = uploadURL
+	pc.uploadSize = size
+	pc.uploadTimeout = timeout
+}
+
+// uploadResult is the throughput measured by an upload check.
+type uploadResult struct {
+	bytesPerSecond float64
+	capped         bool // The payload was slowed down by the bandwidth limit
+}
+
+// checkByUpload POSTs uploadSize random bytes through the proxy and expects
+// a 2xx response. The throughput in bytes per second is stored in result; it
+// is measured until the response headers arrive, so it includes the
+// connection setup.
+func (pc *ProxyChecker) checkByUpload(client *http.Client, result *uploadResult) (bool, string, error) {
+	if pc.uploadURL == "" {
+		return false, "Upload URL not configured", fmt.Errorf("upload URL not configured")
+	}
+
+	timeout := time.Second * time.Duration(pc.uploadTimeout)
+	release, err := pc.limiter.acquireWithin(timeout)
+	if err != nil {
+		return false, "", err
+	}
+	defer release()
+
+	uploadClient := &http.Client{
+		Transport: client.Transport,
+		Timeout:   timeout,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Random bytes, so compression on the path cannot inflate the result
+	payload := pc.limiter.Reader(ctx, io.LimitReader(rand.New(rand.NewSource(time.Now().UnixNano())), pc.uploadSize))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pc.uploadURL, payload)
+	if err != nil {
+		return false, "", err
+	}
+	req.ContentLength = pc.uploadSize
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	start := time.Now()
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	elapsed := time.Since(start)
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Sprintf("HTTP status: %d", resp.StatusCode), nil
+	}
+
+	bytesPerSecond := float64(pc.uploadSize) / elapsed.Seconds()
+	capped := Throttled(payload) > 0
+	if result != nil {
+		*result = uploadResult{bytesPerSecond: bytesPerSecond, capped: capped}
+	}
+	logMessage := fmt.Sprintf("Uploaded: %d bytes in %s, %.2f MB/s", pc.uploadSize, elapsed.Round(time.Millisecond), bytesPerSecond/1e6)
+	if capped {
+		logMessage += " (capped by bandwidth limit)"
+	}
+	return true, logMessage, nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"log"
+	"runtime/debug"
+)
+
+const (
+	ProfileDefault = "default"
+	ProfileLowMem  = "lowmem"
+)
+
+// Defaults of the lowmem profile, tuned for routers and Raspberry Pi boards
+// with 256-512 MB of RAM. The monitor always checks all proxies through one
+// shared core and keeps only the current metric values of each proxy, so the
+// profile bounds what is left: concurrent checks, core logging and the Go
+// heap.
+const (
+	lowMemMaxWorkers  = 2
+	lowMemGCPercent   = 50
+	lowMemMemoryLimit = 96 << 20
+)
+
+// ApplyProfile adjusts CLIConfig and the Go runtime for the selected profile.
+func ApplyProfile() {
+	if CLIConfig.Profile != ProfileLowMem {
+		return
+	}
+
+	if CLIConfig.Proxy.CheckWorkers > lowMemMaxWorkers || CLIConfig.Proxy.CheckWorkers < 1 {
+		CLIConfig.Proxy.CheckWorkers = lowMemMaxWorkers
+	}
+	CLIConfig.Xray.LogLevel = "none"
+
+	debug.SetGCPercent(lowMemGCPercent)
+	debug.SetMemoryLimit(lowMemMemoryLimit)
+
+	log.Printf("Low-memory profile enabled: %d workers, %d MB heap limit",
+		CLIConfig.Proxy.CheckWorkers, lowMemMemoryLimit>>20)
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client talks to the Clash REST API. Clash.Meta serves it on its
+// external-controller address and sing-box on experimental.clash_api.
+type Client struct {
+	baseURL    string
+	secret     string
+	httpClient *http.Client
+}
+
+// Group is a proxy group (selector) as reported by the controller.
+type Group struct {
+	Name string   `json:"name"`
+	Type string   `json:"type"`
+	Now  string   `json:"now"`
+	All  []string `json:"all"`
+}
+
+func NewClient(baseURL, secret string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		secret:     secret,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// Group returns the members and current selection of a proxy group.
+func (c *Client) Group(name string) (*Group, error) {
+	body, err := c.do(http.MethodGet, "/proxies/"+url.PathEscape(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	var group Group
+	if err := json.Unmarshal(body, &group); err != nil {
+		return nil, fmt.Errorf("error parsing group %s: %v", name, err)
+	}
+	return &group, nil
+}
+
+// Select switches a selector group to the named proxy.
+func (c *Client) Select(group, proxy string) error {
+	payload, _ := json.Marshal(map[string]string{"name": proxy})
+	_, err := c.do(http.MethodPut, "/proxies/"+url.PathEscape(group), payload)
+	return err
+}
+
+// UpdateProvider makes the controller re-fetch a proxy provider. Only
+// Clash.Meta has proxy providers; sing-box answers with an error.
+func (c *Client) UpdateProvider(name string) error {
+	_, err := c.do(http.MethodPut, "/providers/proxies/"+url.PathEscape(name), nil)
+	return err
+}
+
+func (c *Client) do(method, path string, payload []byte) ([]byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.secret != "" {
+		req.Header.Set("Authorization", "Bearer "+c.secret)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("%s %s: %d %s", method, path, resp.StatusCode, apiErr.Message)
+		}
+		return nil, fmt.Errorf("%s %s: unexpected status code: %d", method, path, resp.StatusCode)
+	}
+	return body, nil
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+
+	"projectx/proxytestlib/checker"
+	"projectx/proxytestlib/config"
+	"projectx/proxytestlib/models"
+	"projectx/proxytestlib/runner"
+	"projectx/proxytestlib/xray"
+)
+
+// Names of the engines, as accepted by New and the backend option.
+const (
+	NameXray    = "xray"
+	NameSingBox = "sing-box"
+	NameDirect  = "direct"
+)
+
+// Core is a proxy engine the checker sends traffic through. A new engine
+// implements Core and is added to New; the checker only ever calls
+// InboundAddr.
+type Core interface {
+	// GenerateConfig writes the engine config for proxies, which the next
+	// Start uses. Proxies the engine cannot carry are left out.
+	GenerateConfig(proxies []*models.ProxyConfig) error
+	Start() error
+	Stop() error
+	// InboundAddr returns the proxy URL through which proxy is reached, or
+	// an error if the engine cannot carry it.
+	InboundAddr(proxy *models.ProxyConfig) (*url.URL, error)
+}
+
+// Options are the settings shared by the engines that run local inbounds.
+type Options struct {
+	ConfigFile  string
+	StartPort   int
+	LogLevel    string
+	Inbound     models.Inbound
+	SingBoxPath string
+}
+
+// New returns the named engine.
+func New(name string, opts Options) (Core, error) {
+	switch name {
+	case "", NameXray:
+		return &xrayCore{opts: opts, runner: runner.NewXrayRunner(opts.ConfigFile)}, nil
+	case NameSingBox:
+		return &singBoxCore{opts: opts, runner: runner.NewSingBoxRunner(opts.ConfigFile, opts.SingBoxPath)}, nil
+	case NameDirect:
+		return directCore{}, nil
+	default:
+		return nil, fmt.Errorf("unknown core %q, expected %s, %s or %s", name, NameXray, NameSingBox, NameDirect)
+	}
+}
+
+// FromConfig returns the engine selected in the CLI configuration, writing
+// its config to configFile.
+func FromConfig(configFile string) (Core, error) {
+	cfg := config.CLIConfig.Xray
+	return New(cfg.Backend, Options{
+		ConfigFile:  configFile,
+		StartPort:   cfg.StartPort,
+		LogLevel:    cfg.LogLevel,
+		Inbound:     xray.InboundFromConfig(),
+		SingBoxPath: cfg.SingBoxPath,
+	})
+}
+
+// Reload restarts core with newConfigs after a subscription change and hands
+// them to the checker. Ports of unchanged proxies are kept.
+func Reload(core Core, newConfigs []*models.ProxyConfig, currentConfigs *[]*models.ProxyConfig, proxyChecker *checker.ProxyChecker) error {
+	log.Println("Found changes in subscription, updating configuration...")
+
+	xray.PrepareProxyConfigs(newConfigs)
+	xray.AssignPortsFromConfig(newConfigs, *currentConfigs)
+
+	if err := core.GenerateConfig(newConfigs); err != nil {
+		return fmt.Errorf("error generating new core config: %v", err)
+	}
+	if err := core.Stop(); err != nil {
+		return fmt.Errorf("error stopping core: %v", err)
+	}
+	if err := core.Start(); err != nil {
+		return fmt.Errorf("error starting core with new config: %v", err)
+	}
+
+	proxyChecker.SetCore(core)
+	proxyChecker.UpdateProxies(newConfigs)
+	proxyChecker.MarkCoreRestart()
+
+	*currentConfigs = newConfigs
+
+	log.Println("Configuration updated successfully")
+	return nil
+}
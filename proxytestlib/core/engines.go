@@ -0,0 +1,95 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"projectx/proxytestlib/models"
+	"projectx/proxytestlib/runner"
+	"projectx/proxytestlib/singbox"
+	"projectx/proxytestlib/xray"
+)
+
+// writeConfig saves a generated config where the runners read it.
+func writeConfig(data []byte, filename string) error {
+	if err := os.WriteFile(runner.ConfigPath(filename), data, 0644); err != nil {
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+	return nil
+}
+
+// xrayCore runs Xray embedded in the process. Plain SOCKS5 and HTTP proxies
+// bypass it and are dialed directly.
+type xrayCore struct {
+	opts   Options
+	runner *runner.XrayRunner
+}
+
+func (c *xrayCore) GenerateConfig(proxies []*models.ProxyConfig) error {
+	data, err := xray.GenerateConfigFor(proxies, c.opts.StartPort, c.opts.LogLevel, c.opts.Inbound)
+	if err != nil {
+		return err
+	}
+	return writeConfig(data, c.opts.ConfigFile)
+}
+
+func (c *xrayCore) Start() error { return c.runner.Start() }
+
+func (c *xrayCore) Stop() error { return c.runner.Stop() }
+
+func (c *xrayCore) InboundAddr(proxy *models.ProxyConfig) (*url.URL, error) {
+	if proxy.DirectDial() {
+		return proxy.DirectURL(), nil
+	}
+	if !proxy.SupportedByXray() {
+		return nil, fmt.Errorf("%s is not supported by Xray core", proxy.Protocol)
+	}
+	return c.opts.Inbound.URL(c.opts.StartPort + proxy.Index), nil
+}
+
+// singBoxCore runs an external sing-box binary with the same inbound layout
+// as Xray.
+type singBoxCore struct {
+	opts   Options
+	runner *runner.SingBoxRunner
+}
+
+func (c *singBoxCore) GenerateConfig(proxies []*models.ProxyConfig) error {
+	data, err := singbox.GenerateConfig(proxies, c.opts.StartPort, c.opts.LogLevel, c.opts.Inbound)
+	if err != nil {
+		return err
+	}
+	return writeConfig(data, c.opts.ConfigFile)
+}
+
+func (c *singBoxCore) Start() error { return c.runner.Start() }
+
+func (c *singBoxCore) Stop() error { return c.runner.Stop() }
+
+func (c *singBoxCore) InboundAddr(proxy *models.ProxyConfig) (*url.URL, error) {
+	if proxy.DirectDial() {
+		return proxy.DirectURL(), nil
+	}
+	if !proxy.SupportedBySingBox() {
+		return nil, fmt.Errorf("%s over %s is not supported by sing-box", proxy.Protocol, proxy.GetTransportType())
+	}
+	return c.opts.Inbound.URL(c.opts.StartPort + proxy.Index), nil
+}
+
+// directCore runs no engine: only plain SOCKS5 and HTTP proxies, which the
+// checker dials itself, can be checked.
+type directCore struct{}
+
+func (directCore) GenerateConfig([]*models.ProxyConfig) error { return nil }
+
+func (directCore) Start() error { return nil }
+
+func (directCore) Stop() error { return nil }
+
+func (directCore) InboundAddr(proxy *models.ProxyConfig) (*url.URL, error) {
+	if !proxy.DirectDial() {
+		return nil, fmt.Errorf("%s needs a proxy core, the direct engine only checks socks and http proxies", proxy.Protocol)
+	}
+	return proxy.DirectURL(), nil
+}
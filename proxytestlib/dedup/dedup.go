@@ -0,0 +1,74 @@
+package dedup
+
+import (
+	"strconv"
+	"strings"
+
+	"projectx/proxytestlib/models"
+)
+
+// Duplicate is a proxy dropped in favour of an earlier one with the same key.
+type Duplicate struct {
+	Proxy *models.ProxyConfig
+	Of    *models.ProxyConfig
+}
+
+// Key returns the canonical identity of a proxy: protocol, server, port,
+// credentials and transport. The remark and client-only options such as
+// fingerprint, ALPN or allowInsecure are not part of the key, so the same
+// node published under different names by merged subscriptions collapses.
+func Key(pc *models.ProxyConfig) string {
+	parts := []string{
+		pc.Protocol,
+		strings.ToLower(strings.TrimSuffix(pc.Server, ".")),
+		strconv.Itoa(pc.Port),
+	}
+
+	switch pc.Protocol {
+	case "vless", "vmess":
+		parts = append(parts, strings.ToLower(pc.UUID))
+	case "tuic":
+		parts = append(parts, strings.ToLower(pc.UUID), pc.Password)
+	case "trojan", "hysteria2":
+		parts = append(parts, pc.Password)
+	case "shadowsocks":
+		parts = append(parts, strings.ToLower(pc.Method), pc.Password, pc.Plugin, pc.PluginOpts)
+	case "socks", "http", "ssh":
+		parts = append(parts, pc.Username, pc.Password)
+	}
+
+	path := pc.Path
+	if path == "" {
+		path = "/"
+	}
+	parts = append(parts,
+		pc.GetTransportType(),
+		path,
+		strings.ToLower(pc.Host),
+		pc.ServiceName,
+		pc.Seed, // mKCP seed works like a password
+		pc.GetSecurityType(),
+		strings.ToLower(pc.SNI),
+		pc.PublicKey,
+	)
+	return strings.Join(parts, "|")
+}
+
+// Dedup keeps the first proxy of every key, preserving order, and returns
+// the dropped ones together with the proxy they duplicate.
+func Dedup(proxies []*models.ProxyConfig) ([]*models.ProxyConfig, []Duplicate) {
+	seen := make(map[string]*models.ProxyConfig, len(proxies))
+	kept := make([]*models.ProxyConfig, 0, len(proxies))
+	var duplicates []Duplicate
+
+	for _, proxy := range proxies {
+		key := Key(proxy)
+		if first, ok := seen[key]; ok {
+			duplicates = append(duplicates, Duplicate{Proxy: proxy, Of: first})
+			continue
+		}
+		seen[key] = proxy
+		kept = append(kept, proxy)
+	}
+	return kept, duplicates
+}
@@ -0,0 +1,63 @@
+package geoip
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"projectx/proxytestlib/config"
+)
+
+// NewFromSpec builds a resolver from a comma-separated provider list
+// ("mmdb,ip-api,ipinfo"). The mmdb provider reads mmdbPaths, or the default
+// locations when it is empty, and is left out when no database is found, so
+// the same settings work with and without the files. Returns nil when no
+// provider remains.
+func NewFromSpec(spec, mmdbPaths, ipinfoToken string, ttl time.Duration) (*Resolver, error) {
+	var providers []Provider
+	for _, name := range strings.Split(spec, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "mmdb":
+			paths := splitList(mmdbPaths)
+			if len(paths) == 0 {
+				paths = findMMDB()
+			}
+			if len(paths) == 0 {
+				continue
+			}
+			db, err := OpenMMDB(paths...)
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, db)
+		case "ip-api":
+			providers = append(providers, NewIPAPI())
+		case "ipinfo":
+			providers = append(providers, NewIPInfo(ipinfoToken))
+		default:
+			return nil, fmt.Errorf("unknown GeoIP provider: %s", name)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, nil
+	}
+	return NewResolver(ttl, providers...), nil
+}
+
+// ResolverFromConfig returns a resolver for the GeoIP settings of the CLI
+// configuration, or nil when no provider is available.
+func ResolverFromConfig() (*Resolver, error) {
+	cfg := config.CLIConfig.GeoIP
+	return NewFromSpec(cfg.Providers, cfg.MMDBPath, cfg.IPInfoToken, time.Duration(cfg.CacheTTL)*time.Second)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
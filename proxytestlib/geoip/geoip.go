@@ -0,0 +1,207 @@
+// Package geoip looks up the location and network of IP addresses through
+// pluggable providers: MaxMind databases on disk, which work offline, and the
+// ip-api.com and ipinfo.io web services. A Resolver queries them in order,
+// caches answers and backs off from rate-limited services, so callers only
+// lose geo data, never a check, when every provider is unavailable.
+package geoip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for addresses a provider has no data for, and for
+// private and reserved addresses, which are never sent to web services.
+var ErrNotFound = errors.New("address not found")
+
+// Info is the location and network of an IP address. Providers fill in what
+// they know; CountryCode is an ISO 3166-1 alpha-2 code.
+type Info struct {
+	IP          string `json:"ip"`
+	CountryCode string `json:"country_code,omitempty"`
+	Country     string `json:"country,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         int    `json:"asn,omitempty"`
+	Org         string `json:"org,omitempty"`
+	Hosting     bool   `json:"hosting,omitempty"` // Reported as a hosting provider by the data source
+	Provider    string `json:"provider"`
+}
+
+// Provider looks up a single IP address.
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, ip net.IP) (*Info, error)
+}
+
+// RateLimitError is returned by web services that refuse further requests
+// for a while.
+type RateLimitError struct {
+	Provider   string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded, retry in %s", e.Provider, e.RetryAfter)
+}
+
+const (
+	defaultBackoff = time.Minute
+	negativeTTL    = 5 * time.Minute // Addresses no provider answered for
+	cacheSize      = 10000
+)
+
+type cacheEntry struct {
+	info    *Info
+	expires time.Time
+}
+
+// Resolver queries providers in order until one answers and caches the
+// result for ttl. Safe for concurrent use.
+type Resolver struct {
+	providers []Provider
+	ttl       time.Duration
+
+	mu      sync.Mutex
+	cache   map[string]cacheEntry
+	backoff map[string]time.Time // Provider name -> end of its rate limit
+}
+
+func NewResolver(ttl time.Duration, providers ...Provider) *Resolver {
+	return &Resolver{
+		providers: providers,
+		ttl:       ttl,
+		cache:     make(map[string]cacheEntry),
+		backoff:   make(map[string]time.Time),
+	}
+}
+
+// Providers returns the names of the configured providers in query order.
+func (r *Resolver) Providers() []string {
+	names := make([]string, 0, len(r.providers))
+	for _, p := range r.providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// Lookup returns the location of ip from the first provider that knows it.
+// Providers that fail or are rate limited are skipped; the error of the last
+// one is returned when none answers.
+func (r *Resolver) Lookup(ctx context.Context, ip net.IP) (*Info, error) {
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address")
+	}
+	key := ip.String()
+
+	r.mu.Lock()
+	entry, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		if entry.info == nil {
+			return nil, ErrNotFound
+		}
+		return entry.info, nil
+	}
+
+	if !isPublic(ip) {
+		return nil, ErrNotFound
+	}
+
+	err := ErrNotFound
+	for _, p := range r.providers {
+		if r.backedOff(p.Name()) {
+			continue
+		}
+		info, lookupErr := p.Lookup(ctx, ip)
+		if lookupErr == nil {
+			info.IP = key
+			info.Provider = p.Name()
+			r.store(key, info, r.ttl)
+			return info, nil
+		}
+		var rateLimit *RateLimitError
+		if errors.As(lookupErr, &rateLimit) {
+			r.backOff(p.Name(), rateLimit.RetryAfter)
+		}
+		if !errors.Is(lookupErr, ErrNotFound) {
+			err = lookupErr
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		r.store(key, nil, negativeTTL)
+	}
+	return nil, err
+}
+
+// LookupHost resolves host, a domain name or an IP address, and looks up its
+// first address.
+func (r *Resolver) LookupHost(ctx context.Context, host string) (*Info, error) {
+	host = strings.Trim(host, "[]")
+	if ip := net.ParseIP(host); ip != nil {
+		return r.Lookup(ctx, ip)
+	}
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %v", host, err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	return r.Lookup(ctx, addrs[0])
+}
+
+// Country returns the country code of host, or an empty string when it cannot
+// be determined.
+func (r *Resolver) Country(ctx context.Context, host string) string {
+	info, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return ""
+	}
+	return info.CountryCode
+}
+
+func (r *Resolver) backedOff(provider string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Now().Before(r.backoff[provider])
+}
+
+func (r *Resolver) backOff(provider string, d time.Duration) {
+	if d <= 0 {
+		d = defaultBackoff
+	}
+	r.mu.Lock()
+	r.backoff[provider] = time.Now().Add(d)
+	r.mu.Unlock()
+}
+
+func (r *Resolver) store(key string, info *Info, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.cache) >= cacheSize {
+		now := time.Now()
+		for k, e := range r.cache {
+			if now.After(e.expires) {
+				delete(r.cache, k)
+			}
+		}
+		if len(r.cache) >= cacheSize {
+			r.cache = make(map[string]cacheEntry)
+		}
+	}
+	r.cache[key] = cacheEntry{info: info, expires: time.Now().Add(ttl)}
+}
+
+func isPublic(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
@@ -0,0 +1,418 @@
+package geoip
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+)
+
+// metadataMarker starts the metadata section at the end of a MaxMind DB file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// MMDB looks up addresses in MaxMind DB files such as GeoLite2-Country,
+// GeoLite2-City and GeoLite2-ASN, or the compatible DB-IP and IPinfo
+// databases. Fields found in several files are taken from the first one.
+type MMDB struct {
+	readers []*mmdbReader
+}
+
+// OpenMMDB loads the database files into memory.
+func OpenMMDB(paths ...string) (*MMDB, error) {
+	db := &MMDB{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading MaxMind database: %v", err)
+		}
+		reader, err := newMMDBReader(data)
+		if err != nil {
+			return nil, fmt.Errorf("error opening MaxMind database %s: %v", path, err)
+		}
+		db.readers = append(db.readers, reader)
+	}
+	return db, nil
+}
+
+func (db *MMDB) Name() string { return "mmdb" }
+
+func (db *MMDB) Lookup(_ context.Context, ip net.IP) (*Info, error) {
+	info := &Info{}
+	found := false
+	for _, reader := range db.readers {
+		record, err := reader.lookup(ip)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			continue
+		}
+		found = true
+		fillInfo(info, record)
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return info, nil
+}
+
+// fillInfo copies the fields of a GeoIP2/GeoLite2 record that are not set
+// yet.
+func fillInfo(info *Info, record map[string]interface{}) {
+	country, _ := record["country"].(map[string]interface{})
+	if country == nil {
+		country, _ = record["registered_country"].(map[string]interface{})
+	}
+	if info.CountryCode == "" {
+		info.CountryCode, _ = country["iso_code"].(string)
+	}
+	if info.Country == "" {
+		info.Country = englishName(country)
+	}
+	if info.City == "" {
+		city, _ := record["city"].(map[string]interface{})
+		info.City = englishName(city)
+	}
+	if info.ASN == 0 {
+		if asn, ok := record["autonomous_system_number"].(uint64); ok {
+			info.ASN = int(asn)
+		}
+	}
+	if info.Org == "" {
+		info.Org, _ = record["autonomous_system_organization"].(string)
+	}
+	// GeoIP2 Anonymous IP databases
+	if hosting, ok := record["is_hosting_provider"].(bool); ok && hosting {
+		info.Hosting = true
+	}
+}
+
+func englishName(record map[string]interface{}) string {
+	names, _ := record["names"].(map[string]interface{})
+	name, _ := names["en"].(string)
+	return name
+}
+
+// mmdbReader implements the MaxMind DB format, version 2:
+// https://maxmind.github.io/MaxMind-DB/
+type mmdbReader struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint // Node of ::/96, where IPv4 addresses start in IPv6 trees
+}
+
+func newMMDBReader(file []byte) (*mmdbReader, error) {
+	start := bytes.LastIndex(file, metadataMarker)
+	if start < 0 {
+		return nil, fmt.Errorf("metadata not found")
+	}
+	metaSection := file[start+len(metadataMarker):]
+	value, _, err := (&mmdbDecoder{buf: metaSection}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	meta, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata")
+	}
+
+	r := &mmdbReader{
+		nodeCount:  metaUint(meta, "node_count"),
+		recordSize: metaUint(meta, "record_size"),
+		ipVersion:  metaUint(meta, "ip_version"),
+	}
+	if version := metaUint(meta, "binary_format_major_version"); version != 2 {
+		return nil, fmt.Errorf("unsupported format version %d", version)
+	}
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(start) {
+		return nil, fmt.Errorf("search tree exceeds the file")
+	}
+	r.tree = file[:treeSize]
+	r.data = file[treeSize+16 : start]
+
+	if r.ipVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+func metaUint(meta map[string]interface{}, key string) uint {
+	value, _ := meta[key].(uint64)
+	return uint(value)
+}
+
+// lookup returns the record of ip, or nil if the database has none.
+func (r *mmdbReader) lookup(ip net.IP) (map[string]interface{}, error) {
+	node := uint(0)
+	bits := ip.To4()
+	if bits != nil {
+		node = r.ipv4Start
+	} else {
+		if r.ipVersion == 4 {
+			return nil, nil
+		}
+		bits = ip.To16()
+	}
+
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := (bits[i/8] >> (7 - uint(i%8))) & 1
+		node = r.record(node, uint(bit))
+	}
+	if node <= r.nodeCount {
+		return nil, nil
+	}
+
+	offset := node - r.nodeCount - 16
+	value, _, err := (&mmdbDecoder{buf: r.data}).decode(offset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record: %v", err)
+	}
+	record, _ := value.(map[string]interface{})
+	return record, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (r *mmdbReader) record(node, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		b := r.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(r.tree[node*8+bit*4:]))
+	}
+}
+
+// mmdbDecoder decodes the data section. Pointers are offsets in buf.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// decode returns the value at offset and the offset following it.
+func (d *mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	return d.decodeDepth(offset, 0)
+}
+
+func (d *mmdbDecoder) decodeDepth(offset uint, depth int) (interface{}, uint, error) {
+	if depth > 32 {
+		return nil, 0, fmt.Errorf("data nested too deeply")
+	}
+	ctrl, offset, err := d.byte(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	kind := uint(ctrl >> 5)
+
+	if kind == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decodeDepth(pointer, depth+1)
+		return value, next, err
+	}
+
+	if kind == typeExtended {
+		var ext byte
+		if ext, offset, err = d.byte(offset); err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + uint(ext)
+	}
+
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var key, value interface{}
+			if key, offset, err = d.decodeDepth(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			if value, offset, err = d.decodeDepth(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is not a string")
+			}
+			m[name] = value
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			var value interface{}
+			if value, offset, err = d.decodeDepth(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("value exceeds the data section")
+	}
+	raw := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch kind {
+	case typeString:
+		return string(raw), next, nil
+	case typeBytes, typeUint128:
+		return append([]byte(nil), raw...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid integer size %d", size)
+		}
+		var value uint64
+		for _, b := range raw {
+			value = value<<8 | uint64(b)
+		}
+		return value, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid integer size %d", size)
+		}
+		var value uint32
+		for _, b := range raw {
+			value = value<<8 | uint32(b)
+		}
+		return int64(int32(value)), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+	}
+}
+
+func (d *mmdbDecoder) byte(offset uint) (byte, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, fmt.Errorf("unexpected end of data")
+	}
+	return d.buf[offset], offset + 1, nil
+}
+
+func (d *mmdbDecoder) bytes(offset, n uint) (uint, uint, error) {
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, fmt.Errorf("unexpected end of data")
+	}
+	var value uint
+	for _, b := range d.buf[offset : offset+n] {
+		value = value<<8 | uint(b)
+	}
+	return value, offset + n, nil
+}
+
+func (d *mmdbDecoder) size(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1f)
+	switch size {
+	case 29:
+		value, next, err := d.bytes(offset, 1)
+		return 29 + value, next, err
+	case 30:
+		value, next, err := d.bytes(offset, 2)
+		return 285 + value, next, err
+	case 31:
+		value, next, err := d.bytes(offset, 3)
+		return 65821 + value, next, err
+	}
+	return size, offset, nil
+}
+
+func (d *mmdbDecoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3)&0x3 + 1
+	value, next, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	prefix := uint(ctrl & 0x7)
+	switch n {
+	case 1:
+		return prefix<<8 | value, next, nil
+	case 2:
+		return (prefix<<16 | value) + 2048, next, nil
+	case 3:
+		return (prefix<<24 | value) + 526336, next, nil
+	default:
+		return value, next, nil
+	}
+}
+
+// defaultMMDBPaths are where geoipupdate and distribution packages install
+// the free databases.
+var defaultMMDBPaths = []string{
+	"/usr/share/GeoIP",
+	"/var/lib/GeoIP",
+	"/usr/local/share/GeoIP",
+}
+
+// findMMDB returns the .mmdb files in the default locations.
+func findMMDB() []string {
+	var found []string
+	for _, dir := range defaultMMDBPaths {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".mmdb") {
+				found = append(found, dir+"/"+entry.Name())
+			}
+		}
+	}
+	return found
+}
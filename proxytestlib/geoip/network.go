@@ -0,0 +1,67 @@
+package geoip
+
+import "strings"
+
+// Network types returned by NetworkType.
+const (
+	NetworkDatacenter  = "datacenter"
+	NetworkResidential = "residential"
+)
+
+// hostingASNs are autonomous systems of large cloud and hosting providers
+// whose organization names do not give them away.
+var hostingASNs = map[int]bool{
+	8075:   true, // Microsoft
+	8560:   true, // IONOS
+	9009:   true, // M247
+	12876:  true, // Scaleway
+	13335:  true, // Cloudflare
+	14061:  true, // DigitalOcean
+	14618:  true, // Amazon
+	15169:  true, // Google
+	16276:  true, // OVH
+	16509:  true, // Amazon
+	20473:  true, // Vultr (Choopa)
+	24940:  true, // Hetzner
+	28753:  true, // Leaseweb
+	31898:  true, // Oracle
+	45102:  true, // Alibaba
+	47583:  true, // Hostinger
+	49505:  true, // Selectel
+	51167:  true, // Contabo
+	60068:  true, // Datacamp (CDN77)
+	60781:  true, // Leaseweb
+	63949:  true, // Akamai (Linode)
+	132203: true, // Tencent
+	396982: true, // Google Cloud
+}
+
+// hostingKeywords appear in the organization names of hosting providers.
+var hostingKeywords = []string{
+	"hosting", "cloud", "datacenter", "data center", "server", "vps",
+	"colocation", "dedicated",
+}
+
+// NetworkType guesses whether info describes a hosting provider network
+// (NetworkDatacenter) or an access network of an ISP (NetworkResidential).
+// The data source's own hosting flag is trusted first, then a list of cloud
+// ASNs and keywords in the organization name. An empty string is returned
+// when there is no ASN or organization to judge by.
+func NetworkType(info *Info) string {
+	if info == nil {
+		return ""
+	}
+	if info.Hosting || hostingASNs[info.ASN] {
+		return NetworkDatacenter
+	}
+	org := strings.ToLower(info.Org)
+	for _, keyword := range hostingKeywords {
+		if strings.Contains(org, keyword) {
+			return NetworkDatacenter
+		}
+	}
+	if info.ASN == 0 && org == "" {
+		return ""
+	}
+	return NetworkResidential
+}
@@ -0,0 +1,164 @@
+package geoip
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPAPI looks up addresses through the free ip-api.com endpoint, limited to
+// 45 requests per minute from one address.
+type IPAPI struct {
+	Client *http.Client
+
+	mu      sync.Mutex
+	resetAt time.Time // End of an exhausted rate limit window
+}
+
+func NewIPAPI() *IPAPI {
+	return &IPAPI{Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *IPAPI) Name() string { return "ip-api" }
+
+func (p *IPAPI) Lookup(ctx context.Context, ip net.IP) (*Info, error) {
+	p.mu.Lock()
+	wait := time.Until(p.resetAt)
+	p.mu.Unlock()
+	if wait > 0 {
+		return nil, &RateLimitError{Provider: p.Name(), RetryAfter: wait}
+	}
+
+	endpoint := "http://ip-api.com/json/" + ip.String() + "?fields=status,message,countryCode,country,city,as,org,hosting"
+	var resp struct {
+		Status      string `json:"status"`
+		Message     string `json:"message"`
+		CountryCode string `json:"countryCode"`
+		Country     string `json:"country"`
+		City        string `json:"city"`
+		AS          string `json:"as"`
+		Org         string `json:"org"`
+		Hosting     bool   `json:"hosting"`
+	}
+	header, err := getJSON(ctx, p.Client, p.Name(), endpoint, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// X-Rl is the number of requests left in the window, X-Ttl the seconds
+	// until it resets; stop before the service starts refusing.
+	if header.Get("X-Rl") == "0" {
+		ttl, _ := strconv.Atoi(header.Get("X-Ttl"))
+		p.mu.Lock()
+		p.resetAt = time.Now().Add(time.Duration(ttl) * time.Second)
+		p.mu.Unlock()
+	}
+
+	if resp.Status != "success" {
+		if resp.Message == "private range" || resp.Message == "reserved range" {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("ip-api lookup failed: %s", resp.Message)
+	}
+
+	asn, org := splitAS(resp.AS)
+	if resp.Org != "" && org == "" {
+		org = resp.Org
+	}
+	return &Info{
+		CountryCode: resp.CountryCode,
+		Country:     resp.Country,
+		City:        resp.City,
+		ASN:         asn,
+		Org:         org,
+		Hosting:     resp.Hosting,
+	}, nil
+}
+
+// IPInfo looks up addresses through ipinfo.io. Without a token the service
+// allows about 1000 requests a day.
+type IPInfo struct {
+	Token  string
+	Client *http.Client
+}
+
+func NewIPInfo(token string) *IPInfo {
+	return &IPInfo{Token: token, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *IPInfo) Name() string { return "ipinfo" }
+
+func (p *IPInfo) Lookup(ctx context.Context, ip net.IP) (*Info, error) {
+	header := http.Header{}
+	if p.Token != "" {
+		header.Set("Authorization", "Bearer "+p.Token)
+	}
+	var resp struct {
+		Country string `json:"country"`
+		City    string `json:"city"`
+		Org     string `json:"org"`
+		Bogon   bool   `json:"bogon"`
+	}
+	if _, err := getJSON(ctx, p.Client, p.Name(), "https://ipinfo.io/"+url.PathEscape(ip.String())+"/json", header, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Bogon {
+		return nil, ErrNotFound
+	}
+	asn, org := splitAS(resp.Org)
+	return &Info{CountryCode: resp.Country, City: resp.City, ASN: asn, Org: org}, nil
+}
+
+// getJSON requests endpoint and decodes a JSON response into v. HTTP 429 is
+// reported as a RateLimitError honouring Retry-After.
+func getJSON(ctx context.Context, client *http.Client, provider, endpoint string, header http.Header, v interface{}) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %v", provider, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return nil, &RateLimitError{Provider: provider, RetryAfter: time.Duration(retryAfter) * time.Second}
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s returned status %d", provider, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("error parsing %s response: %v", provider, err)
+	}
+	return resp.Header, nil
+}
+
+// splitAS splits "AS13335 Cloudflare, Inc." into the number and the
+// organization.
+func splitAS(value string) (int, string) {
+	number, org, _ := strings.Cut(value, " ")
+	if !strings.HasPrefix(number, "AS") {
+		return 0, value
+	}
+	asn, err := strconv.Atoi(strings.TrimPrefix(number, "AS"))
+	if err != nil {
+		return 0, value
+	}
+	return asn, org
+}
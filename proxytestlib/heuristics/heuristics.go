@@ -0,0 +1,111 @@
+package heuristics
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"projectx/proxytestlib/models"
+)
+
+// Finding lists why a proxy looks like dead weight.
+type Finding struct {
+	Proxy   *models.ProxyConfig
+	Reasons []string
+}
+
+// infoMarkers appear in the names of fake nodes that only advertise
+// subscription expiry or remaining traffic.
+var infoMarkers = []string{
+	"expire", "expiry", "expiration", "traffic left", "remaining",
+	"到期", "过期", "剩余流量", "套餐",
+	"истекает", "осталось",
+}
+
+// adMarkers are free-node aggregators and channels commonly stamped into
+// node names of recycled public proxies.
+var adMarkers = []string{
+	"t.me/", "telegram", "tg@", "youtube.com", "youtu.be",
+	"freefq", "v2rayfree", "free-ss", "freenode", "proxypool",
+	"openproxylist", "mattkaydiary", "vpnfree", "getafreenode",
+}
+
+var urlPattern = regexp.MustCompile(`(?i)https?://|www\.`)
+
+// Inspect returns a finding for every proxy that matches at least one
+// heuristic. Proxies are expected in subscription order: of several nodes
+// sharing a server and port, the first one is not flagged.
+func Inspect(proxies []*models.ProxyConfig) []Finding {
+	var findings []Finding
+	seen := make(map[string]*models.ProxyConfig)
+
+	for _, proxy := range proxies {
+		var reasons []string
+
+		endpoint := fmt.Sprintf("%s:%d", strings.ToLower(proxy.Server), proxy.Port)
+		if first, ok := seen[endpoint]; ok {
+			reasons = append(reasons, fmt.Sprintf("duplicate of %q (%s)", first.Name, endpoint))
+		} else {
+			seen[endpoint] = proxy
+		}
+
+		reasons = append(reasons, inspectProxy(proxy)...)
+		if len(reasons) > 0 {
+			findings = append(findings, Finding{Proxy: proxy, Reasons: reasons})
+		}
+	}
+
+	return findings
+}
+
+// Filter splits proxies into the ones worth checking and the flagged ones.
+func Filter(proxies []*models.ProxyConfig) ([]*models.ProxyConfig, []Finding) {
+	findings := Inspect(proxies)
+	flagged := make(map[*models.ProxyConfig]bool, len(findings))
+	for _, finding := range findings {
+		flagged[finding.Proxy] = true
+	}
+
+	kept := make([]*models.ProxyConfig, 0, len(proxies)-len(findings))
+	for _, proxy := range proxies {
+		if !flagged[proxy] {
+			kept = append(kept, proxy)
+		}
+	}
+	return kept, findings
+}
+
+func inspectProxy(proxy *models.ProxyConfig) []string {
+	var reasons []string
+	name := strings.ToLower(proxy.Name)
+	server := strings.ToLower(proxy.Server)
+
+	for _, marker := range infoMarkers {
+		if strings.Contains(name, marker) || strings.HasPrefix(server, marker) {
+			reasons = append(reasons, fmt.Sprintf("subscription info node (%q)", marker))
+			break
+		}
+	}
+
+	for _, marker := range adMarkers {
+		if strings.Contains(name, marker) {
+			reasons = append(reasons, fmt.Sprintf("advertising in name (%q)", marker))
+			break
+		}
+	}
+	if urlPattern.MatchString(proxy.Name) {
+		reasons = append(reasons, "URL in name")
+	}
+
+	if ip := net.ParseIP(proxy.Server); ip != nil && (ip.IsLoopback() || ip.IsUnspecified()) {
+		reasons = append(reasons, fmt.Sprintf("placeholder address %s", proxy.Server))
+	}
+
+	// CDN-fronted ws+tls nodes listen on 443 or the CDN's high HTTPS ports
+	if proxy.Type == "ws" && proxy.Security == "tls" && proxy.Port < 1024 && proxy.Port != 443 {
+		reasons = append(reasons, fmt.Sprintf("ws+tls on unusual port %d", proxy.Port))
+	}
+
+	return reasons
+}
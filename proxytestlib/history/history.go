@@ -0,0 +1,291 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"projectx/parser"
+	"projectx/proxytestlib/models"
+)
+
+// Supported result formats of other tools.
+const (
+	// FormatXrayChecker is a Prometheus query or query_range response with the
+	// xray_proxy_status and xray_proxy_latency_ms series of xray-checker.
+	FormatXrayChecker = "xray-checker"
+	// FormatLiteSpeedTest is the JSON written by LiteSpeedTest and the v2ray
+	// ping tools built on it: {"nodes": [{"remarks", "link", "ping", "isok"}]}.
+	FormatLiteSpeedTest = "litespeedtest"
+)
+
+// Entry is the result of one check of a proxy.
+type Entry struct {
+	StableID  string    `json:"stable_id,omitempty"`
+	Name      string    `json:"name"`
+	Protocol  string    `json:"protocol,omitempty"`
+	Server    string    `json:"server,omitempty"`
+	Port      int       `json:"port,omitempty"`
+	At        time.Time `json:"at"`
+	Online    bool      `json:"online"`
+	LatencyMs int64     `json:"latency_ms,omitempty"`
+	Source    string    `json:"source,omitempty"`
+}
+
+// Detect returns the format of data, or an empty string if it is not
+// recognized.
+func Detect(data []byte) string {
+	var probe struct {
+		Data *struct {
+			ResultType string `json:"resultType"`
+		} `json:"data"`
+		Nodes json.RawMessage `json:"nodes"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return ""
+	}
+	switch {
+	case probe.Data != nil && (probe.Data.ResultType == "matrix" || probe.Data.ResultType == "vector"):
+		return FormatXrayChecker
+	case len(probe.Nodes) > 0:
+		return FormatLiteSpeedTest
+	}
+	return ""
+}
+
+// Parse converts results of another tool into entries. at is the check time
+// for formats without timestamps; an empty format is detected.
+func Parse(format string, data []byte, at time.Time) ([]Entry, error) {
+	if format == "" {
+		format = Detect(data)
+	}
+	switch format {
+	case FormatXrayChecker:
+		return parsePrometheus(data)
+	case FormatLiteSpeedTest:
+		return parseLiteSpeedTest(data, at)
+	case "":
+		return nil, fmt.Errorf("unrecognized results format")
+	default:
+		return nil, fmt.Errorf("unsupported results format: %s", format)
+	}
+}
+
+type prometheusResponse struct {
+	Data struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []json.Number     `json:"value"`  // vector
+			Values [][]json.Number   `json:"values"` // matrix
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// parsePrometheus joins status and latency samples of the same series and
+// timestamp. Series without a status sample count as online when their
+// latency is positive, which is how xray-checker reports latency.
+func parsePrometheus(data []byte) ([]Entry, error) {
+	var resp prometheusResponse
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&resp); err != nil {
+		return nil, fmt.Errorf("error parsing Prometheus response: %v", err)
+	}
+
+	type sample struct {
+		status, latency *float64
+	}
+	series := make(map[string]map[string]string)
+	samples := make(map[string]map[int64]*sample)
+
+	for _, result := range resp.Data.Result {
+		metric := result.Metric["__name__"]
+		if metric != "xray_proxy_status" && metric != "xray_proxy_latency_ms" {
+			continue
+		}
+		key := result.Metric["protocol"] + "|" + result.Metric["address"] + "|" + result.Metric["name"]
+		series[key] = result.Metric
+		if samples[key] == nil {
+			samples[key] = make(map[int64]*sample)
+		}
+
+		values := result.Values
+		if result.Value != nil {
+			values = [][]json.Number{result.Value}
+		}
+		for _, pair := range values {
+			if len(pair) != 2 {
+				continue
+			}
+			ts, err1 := pair[0].Float64()
+			value, err2 := strconv.ParseFloat(pair[1].String(), 64)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			at := int64(ts * 1000)
+			s := samples[key][at]
+			if s == nil {
+				s = &sample{}
+				samples[key][at] = s
+			}
+			if metric == "xray_proxy_status" {
+				s.status = &value
+			} else {
+				s.latency = &value
+			}
+		}
+	}
+
+	var entries []Entry
+	for key, byTime := range samples {
+		labels := series[key]
+		server, port := splitAddress(labels["address"])
+		for at, s := range byTime {
+			entry := Entry{
+				Name:     labels["name"],
+				Protocol: labels["protocol"],
+				Server:   server,
+				Port:     port,
+				At:       time.UnixMilli(at).UTC(),
+				Source:   FormatXrayChecker,
+			}
+			if s.latency != nil {
+				entry.LatencyMs = int64(*s.latency)
+			}
+			if s.status != nil {
+				entry.Online = *s.status == 1
+			} else {
+				entry.Online = entry.LatencyMs > 0
+			}
+			if !entry.Online {
+				entry.LatencyMs = 0
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+type liteSpeedTestNode struct {
+	Remarks  string          `json:"remarks"`
+	Protocol string          `json:"protocol"`
+	Link     string          `json:"link"`
+	Ping     json.RawMessage `json:"ping"` // "123" or 123
+	IsOk     bool            `json:"isok"`
+}
+
+func parseLiteSpeedTest(data []byte, at time.Time) ([]Entry, error) {
+	var output struct {
+		Nodes []liteSpeedTestNode `json:"nodes"`
+	}
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("error parsing LiteSpeedTest output: %v", err)
+	}
+
+	entries := make([]Entry, 0, len(output.Nodes))
+	for _, node := range output.Nodes {
+		entry := Entry{
+			Name:     node.Remarks,
+			Protocol: node.Protocol,
+			At:       at.UTC(),
+			Source:   FormatLiteSpeedTest,
+		}
+		if node.Link != "" {
+			if config, err := parser.ParseProxyURL(node.Link); err == nil {
+				entry.StableID = config.GenerateStableID()
+				entry.Protocol = config.Protocol
+				entry.Server = config.Server
+				entry.Port = config.Port
+				if entry.Name == "" {
+					entry.Name = config.Name
+				}
+			}
+		}
+		ping, _ := strconv.ParseInt(strings.Trim(string(node.Ping), `"`), 10, 64)
+		entry.Online = node.IsOk && ping > 0
+		if entry.Online {
+			entry.LatencyMs = ping
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// MapStableIDs assigns StableIDs to entries that have none by matching them
+// against known proxies: first by protocol, server and port, then by name when
+// that is ambiguous or unknown. Entries matching several proxies stay
+// unmapped. Returns the number of entries with a StableID.
+func MapStableIDs(entries []Entry, proxies []*models.ProxyConfig) int {
+	byAddress := make(map[string][]*models.ProxyConfig)
+	byName := make(map[string][]*models.ProxyConfig)
+	for _, proxy := range proxies {
+		key := addressKey(proxy.Protocol, proxy.Server, proxy.Port)
+		byAddress[key] = append(byAddress[key], proxy)
+		byName[proxy.Name] = append(byName[proxy.Name], proxy)
+	}
+
+	mapped := 0
+	for i := range entries {
+		entry := &entries[i]
+		if entry.StableID == "" {
+			candidates := byAddress[addressKey(entry.Protocol, entry.Server, entry.Port)]
+			if len(candidates) != 1 {
+				candidates = filterByName(candidates, entry.Name)
+			}
+			if len(candidates) == 0 && entry.Server == "" {
+				candidates = byName[entry.Name]
+			}
+			if len(candidates) == 1 {
+				entry.StableID = stableID(candidates[0])
+			}
+		}
+		if entry.StableID != "" {
+			mapped++
+		}
+	}
+	return mapped
+}
+
+func filterByName(proxies []*models.ProxyConfig, name string) []*models.ProxyConfig {
+	var matched []*models.ProxyConfig
+	for _, proxy := range proxies {
+		if proxy.Name == name {
+			matched = append(matched, proxy)
+		}
+	}
+	return matched
+}
+
+func stableID(proxy *models.ProxyConfig) string {
+	if proxy.StableID == "" {
+		proxy.StableID = proxy.GenerateStableID()
+	}
+	return proxy.StableID
+}
+
+func addressKey(protocol, server string, port int) string {
+	return fmt.Sprintf("%s|%s|%d", protocol, strings.ToLower(server), port)
+}
+
+// splitAddress splits the address label, host:port or a bare host.
+func splitAddress(address string) (string, int) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return address, 0
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+func sortEntries(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+}
@@ -0,0 +1,278 @@
+package importer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"projectx/proxytestlib/models"
+)
+
+// clashFile covers both full Clash configs and proxy provider files: the
+// importer only reads the proxies section.
+type clashFile struct {
+	Proxies []clashProxy `yaml:"proxies"`
+}
+
+type clashProxy struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Server   string `yaml:"server"`
+	Port     int    `yaml:"port"`
+	UUID     string `yaml:"uuid"`
+	AlterID  int    `yaml:"alterId"`
+	Password string `yaml:"password"`
+	Username string `yaml:"username"`
+	Cipher   string `yaml:"cipher"`
+	Flow     string `yaml:"flow"`
+
+	Network        string   `yaml:"network"`
+	TLS            bool     `yaml:"tls"`
+	ServerName     string   `yaml:"servername"`
+	SNI            string   `yaml:"sni"`
+	SkipCertVerify bool     `yaml:"skip-cert-verify"`
+	Fingerprint    string   `yaml:"client-fingerprint"`
+	ALPN           []string `yaml:"alpn"`
+
+	WSOpts struct {
+		Path    string            `yaml:"path"`
+		Headers map[string]string `yaml:"headers"`
+	} `yaml:"ws-opts"`
+	GRPCOpts struct {
+		ServiceName string `yaml:"grpc-service-name"`
+	} `yaml:"grpc-opts"`
+	RealityOpts struct {
+		PublicKey string `yaml:"public-key"`
+		ShortID   string `yaml:"short-id"`
+	} `yaml:"reality-opts"`
+
+	Plugin     string                 `yaml:"plugin"`
+	PluginOpts map[string]interface{} `yaml:"plugin-opts"`
+}
+
+// ParseClash converts the proxies section of a Clash config or provider file
+// into proxy configurations. Entries that cannot be converted are logged and
+// skipped.
+func ParseClash(data []byte) ([]*models.ProxyConfig, error) {
+	links, err := ClashLinks(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseLinks(links, "Clash"), nil
+}
+
+// ClashLinks converts the proxies section of a Clash config or provider file
+// into share links, so they go through the same parsing as subscription links.
+func ClashLinks(data []byte) ([]string, error) {
+	var file clashFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing Clash YAML: %v", err)
+	}
+	if len(file.Proxies) == 0 {
+		return nil, fmt.Errorf("no proxies section in Clash YAML")
+	}
+
+	links := make([]string, 0, len(file.Proxies))
+	for i, proxy := range file.Proxies {
+		link, err := proxy.link()
+		if err != nil {
+			log.Printf("Skipping Clash proxy %d (%s): %v", i+1, proxy.Name, err)
+			continue
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+func (p *clashProxy) link() (string, error) {
+	if p.Server == "" || p.Port == 0 {
+		return "", fmt.Errorf("server and port are required")
+	}
+
+	u := &url.URL{
+		Host:     net.JoinHostPort(p.Server, strconv.Itoa(p.Port)),
+		Fragment: p.Name,
+	}
+	query := url.Values{}
+
+	switch p.Type {
+	case "vless":
+		u.Scheme = "vless"
+		u.User = url.User(p.UUID)
+		query.Set("encryption", "none")
+		if p.Flow != "" {
+			query.Set("flow", p.Flow)
+		}
+		p.transport(query, false)
+	case "trojan":
+		u.Scheme = "trojan"
+		u.User = url.User(p.Password)
+		p.transport(query, true)
+	case "vmess":
+		return p.vmess()
+	case "ss":
+		u.Scheme = "ss"
+		u.User = url.User(base64.RawURLEncoding.EncodeToString([]byte(p.Cipher + ":" + p.Password)))
+		if p.Plugin != "" {
+			plugin, err := p.sip003Plugin()
+			if err != nil {
+				return "", err
+			}
+			query.Set("plugin", plugin)
+		}
+	case "socks5", "http":
+		u.Scheme = p.Type
+		if p.Type == "http" && p.TLS {
+			u.Scheme = "https"
+		}
+		if p.Username != "" || p.Password != "" {
+			u.User = url.UserPassword(p.Username, p.Password)
+		}
+	default:
+		return "", fmt.Errorf("unsupported Clash proxy type: %s", p.Type)
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// transport adds the transport and security parameters shared by vless and
+// trojan. Clash trojan proxies always use TLS.
+func (p *clashProxy) transport(query url.Values, alwaysTLS bool) {
+	network := p.Network
+	if network == "" {
+		network = "tcp"
+	}
+	query.Set("type", network)
+
+	switch network {
+	case "ws":
+		if p.WSOpts.Path != "" {
+			query.Set("path", p.WSOpts.Path)
+		}
+		if host := p.wsHost(); host != "" {
+			query.Set("host", host)
+		}
+	case "grpc":
+		query.Set("serviceName", p.GRPCOpts.ServiceName)
+	}
+
+	sni := p.SNI
+	if sni == "" {
+		sni = p.ServerName
+	}
+
+	switch {
+	case p.RealityOpts.PublicKey != "":
+		query.Set("security", "reality")
+		query.Set("pbk", p.RealityOpts.PublicKey)
+		if p.RealityOpts.ShortID != "" {
+			query.Set("sid", p.RealityOpts.ShortID)
+		}
+	case p.TLS || alwaysTLS:
+		query.Set("security", "tls")
+	default:
+		query.Set("security", "none")
+	}
+
+	if sni != "" {
+		query.Set("sni", sni)
+	}
+	if p.Fingerprint != "" {
+		query.Set("fp", p.Fingerprint)
+	}
+	if p.SkipCertVerify {
+		query.Set("allowInsecure", "true")
+	}
+	if len(p.ALPN) > 0 {
+		query.Set("alpn", strings.Join(p.ALPN, ","))
+	}
+}
+
+func (p *clashProxy) vmess() (string, error) {
+	network := p.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	fields := map[string]interface{}{
+		"v":    "2",
+		"ps":   p.Name,
+		"add":  p.Server,
+		"port": p.Port,
+		"id":   p.UUID,
+		"aid":  p.AlterID,
+		"net":  network,
+		"path": p.WSOpts.Path,
+		"host": p.wsHost(),
+	}
+	if network == "grpc" {
+		fields["serviceName"] = p.GRPCOpts.ServiceName
+	}
+	if p.TLS {
+		fields["tls"] = "tls"
+		sni := p.ServerName
+		if sni == "" {
+			sni = p.SNI
+		}
+		if sni != "" {
+			fields["sni"] = sni
+		}
+		if p.Fingerprint != "" {
+			fields["fp"] = p.Fingerprint
+		}
+		if len(p.ALPN) > 0 {
+			fields["alpn"] = strings.Join(p.ALPN, ",")
+		}
+	}
+	return vmessLink(fields)
+}
+
+// sip003Plugin converts Clash plugin and plugin-opts into the SIP003 plugin
+// parameter of an ss:// link.
+func (p *clashProxy) sip003Plugin() (string, error) {
+	opt := func(key string) string {
+		if value, ok := p.PluginOpts[key]; ok {
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+
+	switch p.Plugin {
+	case "obfs":
+		parts := []string{"obfs-local", "obfs=" + opt("mode")}
+		if host := opt("host"); host != "" {
+			parts = append(parts, "obfs-host="+host)
+		}
+		return strings.Join(parts, ";"), nil
+	case "v2ray-plugin":
+		parts := []string{"v2ray-plugin", "mode=" + opt("mode")}
+		if host := opt("host"); host != "" {
+			parts = append(parts, "host="+host)
+		}
+		if path := opt("path"); path != "" {
+			parts = append(parts, "path="+path)
+		}
+		if opt("tls") == "true" {
+			parts = append(parts, "tls")
+		}
+		return strings.Join(parts, ";"), nil
+	default:
+		return "", fmt.Errorf("unsupported Shadowsocks plugin: %s", p.Plugin)
+	}
+}
+
+func (p *clashProxy) wsHost() string {
+	for key, value := range p.WSOpts.Headers {
+		if strings.EqualFold(key, "host") {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,35 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"projectx/parser"
+	"projectx/proxytestlib/models"
+)
+
+// parseLinks parses converted links, logging and skipping the ones the
+// parser rejects.
+func parseLinks(links []string, source string) []*models.ProxyConfig {
+	configs := make([]*models.ProxyConfig, 0, len(links))
+	for _, link := range links {
+		config, err := parser.ParseProxyURL(link)
+		if err != nil {
+			log.Printf("Skipping %s proxy %s: %v", source, link, err)
+			continue
+		}
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+// vmessLink encodes v2rayN style vmess JSON fields into a vmess:// link.
+func vmessLink(fields map[string]interface{}) (string, error) {
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("error encoding VMess config: %v", err)
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(encoded), nil
+}
@@ -0,0 +1,327 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"projectx/proxytestlib/models"
+)
+
+// singBoxConfig accepts a full sing-box config or a bare object with an
+// outbounds array.
+type singBoxConfig struct {
+	Outbounds []singBoxOutbound `json:"outbounds"`
+}
+
+type singBoxOutbound struct {
+	Type       string `json:"type"`
+	Tag        string `json:"tag"`
+	Server     string `json:"server"`
+	ServerPort int    `json:"server_port"`
+	UUID       string `json:"uuid"`
+	Flow       string `json:"flow"`
+	AlterID    int    `json:"alter_id"`
+	Password   string `json:"password"`
+	Username   string `json:"username"`
+	Method     string `json:"method"`
+	Plugin     string `json:"plugin"`
+	PluginOpts string `json:"plugin_opts"`
+
+	CongestionControl string `json:"congestion_control"`
+	UDPRelayMode      string `json:"udp_relay_mode"`
+
+	Obfs *struct {
+		Type     string `json:"type"`
+		Password string `json:"password"`
+	} `json:"obfs"` // hysteria2
+
+	User       string   `json:"user"` // ssh
+	PrivateKey string   `json:"private_key"`
+	HostKey    []string `json:"host_key"`
+
+	TLS *struct {
+		Enabled    bool     `json:"enabled"`
+		ServerName string   `json:"server_name"`
+		Insecure   bool     `json:"insecure"`
+		ALPN       []string `json:"alpn"`
+		UTLS       *struct {
+			Enabled     bool   `json:"enabled"`
+			Fingerprint string `json:"fingerprint"`
+		} `json:"utls"`
+		Reality *struct {
+			Enabled   bool   `json:"enabled"`
+			PublicKey string `json:"public_key"`
+			ShortID   string `json:"short_id"`
+		} `json:"reality"`
+	} `json:"tls"`
+
+	Transport *struct {
+		Type        string            `json:"type"`
+		Path        string            `json:"path"`
+		Headers     map[string]string `json:"headers"`
+		Host        json.RawMessage   `json:"host"` // string for httpupgrade, array for http
+		ServiceName string            `json:"service_name"`
+	} `json:"transport"`
+}
+
+// singBoxSkipped are outbound types that route traffic rather than proxy it.
+var singBoxSkipped = map[string]bool{
+	"direct": true, "block": true, "dns": true, "selector": true, "urltest": true,
+}
+
+// ParseSingBox converts the outbounds of a sing-box config into proxy
+// configurations. Outbounds that cannot be converted are logged and skipped.
+func ParseSingBox(data []byte) ([]*models.ProxyConfig, error) {
+	links, err := SingBoxLinks(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseLinks(links, "sing-box"), nil
+}
+
+// SingBoxLinks converts the outbounds of a sing-box config into share links.
+func SingBoxLinks(data []byte) ([]string, error) {
+	var config singBoxConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing sing-box config: %v", err)
+	}
+	if len(config.Outbounds) == 0 {
+		return nil, fmt.Errorf("no outbounds in sing-box config")
+	}
+
+	links := make([]string, 0, len(config.Outbounds))
+	for i, outbound := range config.Outbounds {
+		if singBoxSkipped[outbound.Type] {
+			continue
+		}
+		link, err := outbound.link()
+		if err != nil {
+			log.Printf("Skipping sing-box outbound %d (%s): %v", i+1, outbound.Tag, err)
+			continue
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// IsSingBox reports whether data looks like a sing-box config: a JSON object
+// whose outbounds use sing-box "type" and "server_port" fields rather than
+// Xray "protocol" and "settings".
+func IsSingBox(data []byte) bool {
+	var probe struct {
+		Outbounds []map[string]json.RawMessage `json:"outbounds"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	for _, outbound := range probe.Outbounds {
+		if _, ok := outbound["server_port"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *singBoxOutbound) link() (string, error) {
+	if o.Server == "" || o.ServerPort == 0 {
+		return "", fmt.Errorf("server and server_port are required")
+	}
+
+	u := &url.URL{
+		Host:     net.JoinHostPort(o.Server, strconv.Itoa(o.ServerPort)),
+		Fragment: o.Tag,
+	}
+	query := url.Values{}
+
+	switch o.Type {
+	case "vless":
+		u.Scheme = "vless"
+		u.User = url.User(o.UUID)
+		query.Set("encryption", "none")
+		if o.Flow != "" {
+			query.Set("flow", o.Flow)
+		}
+		o.transport(query)
+	case "trojan":
+		u.Scheme = "trojan"
+		u.User = url.User(o.Password)
+		o.transport(query)
+	case "vmess":
+		return o.vmess()
+	case "shadowsocks":
+		u.Scheme = "ss"
+		u.User = url.User(base64.RawURLEncoding.EncodeToString([]byte(o.Method + ":" + o.Password)))
+		if o.Plugin != "" {
+			plugin := o.Plugin
+			if o.PluginOpts != "" {
+				plugin += ";" + o.PluginOpts
+			}
+			query.Set("plugin", plugin)
+		}
+	case "tuic":
+		u.Scheme = "tuic"
+		u.User = url.UserPassword(o.UUID, o.Password)
+		if o.CongestionControl != "" {
+			query.Set("congestion_control", o.CongestionControl)
+		}
+		if o.UDPRelayMode != "" {
+			query.Set("udp_relay_mode", o.UDPRelayMode)
+		}
+		o.transport(query)
+	case "hysteria2":
+		u.Scheme = "hysteria2"
+		u.User = url.User(o.Password)
+		if o.Obfs != nil && o.Obfs.Type != "" {
+			query.Set("obfs", o.Obfs.Type)
+			query.Set("obfs-password", o.Obfs.Password)
+		}
+		if tls := o.TLS; tls != nil {
+			if tls.ServerName != "" {
+				query.Set("sni", tls.ServerName)
+			}
+			if tls.Insecure {
+				query.Set("insecure", "1")
+			}
+			if len(tls.ALPN) > 0 {
+				query.Set("alpn", strings.Join(tls.ALPN, ","))
+			}
+		}
+	case "ssh":
+		u.Scheme = "ssh"
+		u.User = url.User(o.User)
+		if o.Password != "" {
+			u.User = url.UserPassword(o.User, o.Password)
+		}
+		if o.PrivateKey != "" {
+			query.Set("private_key", o.PrivateKey)
+		}
+		if len(o.HostKey) > 0 {
+			query.Set("host_key", strings.Join(o.HostKey, ","))
+		}
+	case "socks", "http":
+		u.Scheme = o.Type
+		if o.Type == "socks" {
+			u.Scheme = "socks5"
+		} else if o.TLS != nil && o.TLS.Enabled {
+			u.Scheme = "https"
+		}
+		if o.Username != "" || o.Password != "" {
+			u.User = url.UserPassword(o.Username, o.Password)
+		}
+	default:
+		return "", fmt.Errorf("unsupported sing-box outbound type: %s", o.Type)
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// transport adds transport and TLS parameters. sing-box has no "tcp"
+// transport: a missing transport block means plain TCP.
+func (o *singBoxOutbound) transport(query url.Values) {
+	query.Set("type", "tcp")
+	if t := o.Transport; t != nil {
+		switch t.Type {
+		case "grpc":
+			query.Set("type", "grpc")
+			query.Set("serviceName", t.ServiceName)
+		case "ws", "httpupgrade", "http":
+			query.Set("type", t.Type)
+			if t.Path != "" {
+				query.Set("path", t.Path)
+			}
+			if host := o.host(); host != "" {
+				query.Set("host", host)
+			}
+		default:
+			query.Set("type", t.Type)
+		}
+	}
+
+	tls := o.TLS
+	if tls == nil || !tls.Enabled {
+		query.Set("security", "none")
+		return
+	}
+
+	if tls.Reality != nil && tls.Reality.Enabled {
+		query.Set("security", "reality")
+		query.Set("pbk", tls.Reality.PublicKey)
+		if tls.Reality.ShortID != "" {
+			query.Set("sid", tls.Reality.ShortID)
+		}
+	} else {
+		query.Set("security", "tls")
+	}
+	if tls.ServerName != "" {
+		query.Set("sni", tls.ServerName)
+	}
+	if tls.UTLS != nil && tls.UTLS.Enabled && tls.UTLS.Fingerprint != "" {
+		query.Set("fp", tls.UTLS.Fingerprint)
+	}
+	if tls.Insecure {
+		query.Set("allowInsecure", "true")
+	}
+	if len(tls.ALPN) > 0 {
+		query.Set("alpn", strings.Join(tls.ALPN, ","))
+	}
+}
+
+func (o *singBoxOutbound) vmess() (string, error) {
+	query := url.Values{}
+	o.transport(query)
+
+	fields := map[string]interface{}{
+		"v":    "2",
+		"ps":   o.Tag,
+		"add":  o.Server,
+		"port": o.ServerPort,
+		"id":   o.UUID,
+		"aid":  o.AlterID,
+		"net":  query.Get("type"),
+		"path": query.Get("path"),
+		"host": query.Get("host"),
+	}
+	if query.Get("type") == "grpc" {
+		fields["serviceName"] = query.Get("serviceName")
+	}
+	if query.Get("security") == "tls" {
+		fields["tls"] = "tls"
+		if sni := query.Get("sni"); sni != "" {
+			fields["sni"] = sni
+		}
+		if fp := query.Get("fp"); fp != "" {
+			fields["fp"] = fp
+		}
+		if alpn := query.Get("alpn"); alpn != "" {
+			fields["alpn"] = alpn
+		}
+	}
+	return vmessLink(fields)
+}
+
+// host returns the transport Host header, or the first host of an http
+// transport.
+func (o *singBoxOutbound) host() string {
+	for key, value := range o.Transport.Headers {
+		if strings.EqualFold(key, "host") {
+			return value
+		}
+	}
+
+	var host string
+	if json.Unmarshal(o.Transport.Host, &host) == nil {
+		return host
+	}
+	var hosts []string
+	if json.Unmarshal(o.Transport.Host, &hosts) == nil && len(hosts) > 0 {
+		return hosts[0]
+	}
+	return ""
+}
@@ -21,10 +21,30 @@ type RemoteWriteConfig struct {
 	Timeout  time.Duration
 }
 
+const (
+	ModeProxy     = "proxy"
+	ModeAggregate = "aggregate"
+)
+
 var (
-	proxyStatus   *prometheus.GaugeVec
-	proxyLatency  *prometheus.GaugeVec
-	defaultLabels = []string{"protocol", "address", "name"}
+	proxyStatus        *prometheus.GaugeVec
+	proxyLatency       *prometheus.GaugeVec
+	proxyConfidence    *prometheus.GaugeVec
+	proxyIndeterminate *prometheus.GaugeVec
+	proxyRecovery      *prometheus.GaugeVec
+	proxyUploadSpeed   *prometheus.GaugeVec
+	proxySpeedtestDown *prometheus.GaugeVec
+	proxySpeedtestUp   *prometheus.GaugeVec
+	proxySpeedCapped   *prometheus.GaugeVec
+	proxyAttempts      *prometheus.GaugeVec
+	coreRestarts       *prometheus.CounterVec
+	targetUp           *prometheus.GaugeVec
+	proxiesTracked     *prometheus.GaugeVec
+	groupUp            *prometheus.GaugeVec
+	groupTotal         *prometheus.GaugeVec
+	groupLatency       *prometheus.GaugeVec
+	defaultLabels      = []string{"protocol", "address", "name"}
+	aggregateLabels    = []string{"protocol", "country", "provider"}
 )
 
 func InitMetrics(instance string) {
@@ -48,6 +68,133 @@ func InitMetrics(instance string) {
 		},
 		labels,
 	)
+
+	proxyConfidence = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxy_status_confidence",
+			Help: "Confidence of the reported proxy status (1: confirmed, 0.5: single check, 0: state change not confirmed by re-check)",
+		},
+		labels,
+	)
+
+	proxyIndeterminate = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxy_indeterminate",
+			Help: "1 if the last check of the proxy was inconclusive because the check target was unreachable",
+		},
+		labels,
+	)
+
+	proxyRecovery = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxy_recovery_seconds",
+			Help: "Time from the last Xray core restart until the proxy passed its first check",
+		},
+		labels,
+	)
+
+	proxyUploadSpeed = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxy_upload_bytes_per_second",
+			Help: "Upload throughput measured by check-method=upload, 0 if failed",
+		},
+		labels,
+	)
+
+	proxySpeedtestDown = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxy_speedtest_download_mbps",
+			Help: "Download throughput in megabits per second measured by check-method=speedtest, 0 if failed",
+		},
+		labels,
+	)
+
+	proxySpeedtestUp = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxy_speedtest_upload_mbps",
+			Help: "Upload throughput in megabits per second measured by check-method=speedtest, 0 if failed",
+		},
+		labels,
+	)
+
+	proxySpeedCapped = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxy_speed_capped",
+			Help: "1 if the last upload or speedtest measurement was slowed down by the bandwidth limit, so it is a lower bound",
+		},
+		labels,
+	)
+
+	proxyAttempts = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxy_check_attempts",
+			Help: "Attempts used by the last check, above 1 if it was retried",
+		},
+		labels,
+	)
+
+	var trackedLabels []string
+	if instance != "" {
+		trackedLabels = []string{"instance"}
+	}
+
+	proxiesTracked = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxies_tracked",
+			Help: "Number of proxies currently tracked by the checker",
+		},
+		trackedLabels,
+	)
+
+	coreRestarts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "xray_core_restarts_total",
+			Help: "Number of Xray core restarts, e.g. after subscription updates",
+		},
+		trackedLabels,
+	)
+
+	targetLabels := []string{"url"}
+	if instance != "" {
+		targetLabels = append(targetLabels, "instance")
+	}
+
+	targetUp = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_check_target_up",
+			Help: "Whether the check URL is reachable directly, without a proxy (1: reachable, 0: unreachable)",
+		},
+		targetLabels,
+	)
+
+	groupLabels := aggregateLabels
+	if instance != "" {
+		groupLabels = append(groupLabels, "instance")
+	}
+
+	groupUp = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxy_group_up",
+			Help: "Number of working proxies per protocol, country and provider",
+		},
+		groupLabels,
+	)
+
+	groupTotal = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxy_group_total",
+			Help: "Number of checked proxies per protocol, country and provider",
+		},
+		groupLabels,
+	)
+
+	groupLatency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "xray_proxy_group_latency_ms",
+			Help: "Average latency of working proxies per protocol, country and provider in milliseconds",
+		},
+		groupLabels,
+	)
 }
 
 func GetProxyStatusMetric() *prometheus.GaugeVec {
@@ -58,6 +205,61 @@ func GetProxyLatencyMetric() *prometheus.GaugeVec {
 	return proxyLatency
 }
 
+func GetProxyConfidenceMetric() *prometheus.GaugeVec {
+	return proxyConfidence
+}
+
+func GetProxyIndeterminateMetric() *prometheus.GaugeVec {
+	return proxyIndeterminate
+}
+
+func GetCheckTargetUpMetric() *prometheus.GaugeVec {
+	return targetUp
+}
+
+func GetProxyRecoveryMetric() *prometheus.GaugeVec {
+	return proxyRecovery
+}
+
+func GetCoreRestartsMetric() *prometheus.CounterVec {
+	return coreRestarts
+}
+
+func GetProxiesTrackedMetric() *prometheus.GaugeVec {
+	return proxiesTracked
+}
+
+func GetGroupMetrics() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{groupUp, groupTotal, groupLatency}
+}
+
+func RecordGroupStats(protocol, country, provider string, up, total int, avgLatency time.Duration, instance string) {
+	values := []string{protocol, country, provider}
+	if instance != "" {
+		values = append(values, instance)
+	}
+
+	groupUp.WithLabelValues(values...).Set(float64(up))
+	groupTotal.WithLabelValues(values...).Set(float64(total))
+	groupLatency.WithLabelValues(values...).Set(float64(avgLatency.Milliseconds()))
+}
+
+// ResetGroupStats drops all aggregate series so groups that disappeared
+// between check cycles are not exported anymore.
+func ResetGroupStats() {
+	groupUp.Reset()
+	groupTotal.Reset()
+	groupLatency.Reset()
+}
+
+func RecordProxiesTracked(count int, instance string) {
+	if instance != "" {
+		proxiesTracked.WithLabelValues(instance).Set(float64(count))
+	} else {
+		proxiesTracked.WithLabelValues().Set(float64(count))
+	}
+}
+
 func RecordProxyStatus(protocol, address, name string, value float64, instance string) {
 	if instance != "" {
 		proxyStatus.WithLabelValues(protocol, address, name, instance).Set(value)
@@ -74,6 +276,92 @@ func RecordProxyLatency(protocol, address, name string, value time.Duration, ins
 	}
 }
 
+func RecordProxyConfidence(protocol, address, name string, value float64, instance string) {
+	if instance != "" {
+		proxyConfidence.WithLabelValues(protocol, address, name, instance).Set(value)
+	} else {
+		proxyConfidence.WithLabelValues(protocol, address, name).Set(value)
+	}
+}
+
+func RecordProxyIndeterminate(protocol, address, name string, indeterminate bool, instance string) {
+	value := 0.0
+	if indeterminate {
+		value = 1
+	}
+	if instance != "" {
+		proxyIndeterminate.WithLabelValues(protocol, address, name, instance).Set(value)
+	} else {
+		proxyIndeterminate.WithLabelValues(protocol, address, name).Set(value)
+	}
+}
+
+func RecordProxyRecovery(protocol, address, name string, value time.Duration, instance string) {
+	if instance != "" {
+		proxyRecovery.WithLabelValues(protocol, address, name, instance).Set(value.Seconds())
+	} else {
+		proxyRecovery.WithLabelValues(protocol, address, name).Set(value.Seconds())
+	}
+}
+
+func RecordProxyUploadSpeed(protocol, address, name string, bytesPerSecond float64, instance string) {
+	if instance != "" {
+		proxyUploadSpeed.WithLabelValues(protocol, address, name, instance).Set(bytesPerSecond)
+	} else {
+		proxyUploadSpeed.WithLabelValues(protocol, address, name).Set(bytesPerSecond)
+	}
+}
+
+func RecordProxySpeedtest(protocol, address, name string, downloadMbps, uploadMbps float64, instance string) {
+	if instance != "" {
+		proxySpeedtestDown.WithLabelValues(protocol, address, name, instance).Set(downloadMbps)
+		proxySpeedtestUp.WithLabelValues(protocol, address, name, instance).Set(uploadMbps)
+	} else {
+		proxySpeedtestDown.WithLabelValues(protocol, address, name).Set(downloadMbps)
+		proxySpeedtestUp.WithLabelValues(protocol, address, name).Set(uploadMbps)
+	}
+}
+
+func RecordProxySpeedCapped(protocol, address, name string, capped bool, instance string) {
+	value := 0.0
+	if capped {
+		value = 1
+	}
+	if instance != "" {
+		proxySpeedCapped.WithLabelValues(protocol, address, name, instance).Set(value)
+	} else {
+		proxySpeedCapped.WithLabelValues(protocol, address, name).Set(value)
+	}
+}
+
+func RecordProxyCheckAttempts(protocol, address, name string, attempts int, instance string) {
+	if instance != "" {
+		proxyAttempts.WithLabelValues(protocol, address, name, instance).Set(float64(attempts))
+	} else {
+		proxyAttempts.WithLabelValues(protocol, address, name).Set(float64(attempts))
+	}
+}
+
+func RecordCoreRestart(instance string) {
+	if instance != "" {
+		coreRestarts.WithLabelValues(instance).Inc()
+	} else {
+		coreRestarts.WithLabelValues().Inc()
+	}
+}
+
+func RecordCheckTargetUp(url string, up bool, instance string) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+	if instance != "" {
+		targetUp.WithLabelValues(url, instance).Set(value)
+	} else {
+		targetUp.WithLabelValues(url).Set(value)
+	}
+}
+
 func DeleteProxyStatus(protocol, address, name string, instance string) {
 	if instance != "" {
 		proxyStatus.DeleteLabelValues(protocol, address, name, instance)
@@ -90,6 +378,26 @@ func DeleteProxyLatency(protocol, address, name string, instance string) {
 	}
 }
 
+// proxyMetrics returns every metric family labelled per proxy.
+func proxyMetrics() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{
+		proxyStatus, proxyLatency, proxyConfidence, proxyIndeterminate, proxyRecovery,
+		proxyUploadSpeed, proxySpeedtestDown, proxySpeedtestUp, proxySpeedCapped, proxyAttempts,
+	}
+}
+
+// DeleteProxySeries deletes the series of a proxy from every per-proxy
+// metric family.
+func DeleteProxySeries(protocol, address, name string, instance string) {
+	values := []string{protocol, address, name}
+	if instance != "" {
+		values = append(values, instance)
+	}
+	for _, vec := range proxyMetrics() {
+		vec.DeleteLabelValues(values...)
+	}
+}
+
 func ParseURL(remoteWriteURL string) (*RemoteWriteConfig, error) {
 	if remoteWriteURL == "" {
 		return nil, nil
@@ -176,4 +484,4 @@ func GetPushURL(url string) string {
 	}
 
 	return cfg.URL
-}
\ No newline at end of file
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+)
+
+// Inbound describes the local inbounds Xray opens for every checked proxy.
+// Credentials are required when Listen is not a loopback address, since the
+// inbounds are then reachable by anyone who can reach the host.
+type Inbound struct {
+	Listen   string
+	Protocol string // socks or http
+	User     string
+	Password string
+}
+
+// DefaultInbound is an unauthenticated SOCKS inbound on loopback.
+var DefaultInbound = Inbound{Listen: "127.0.0.1", Protocol: "socks"}
+
+// Authenticated reports whether the inbound requires credentials.
+func (in Inbound) Authenticated() bool {
+	return in.User != "" || in.Password != ""
+}
+
+// Loopback reports whether the inbound only accepts local connections.
+func (in Inbound) Loopback() bool {
+	if in.Listen == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(in.Listen)
+	return ip != nil && ip.IsLoopback()
+}
+
+// URL returns the proxy URL a local client uses to reach the inbound on
+// port. Wildcard listen addresses are reached through loopback.
+func (in Inbound) URL(port int) *url.URL {
+	host := in.Listen
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	u := &url.URL{Scheme: "socks5", Host: net.JoinHostPort(host, strconv.Itoa(port))}
+	if in.Protocol == "http" {
+		u.Scheme = "http"
+	}
+	if in.Authenticated() {
+		u.User = url.UserPassword(in.User, in.Password)
+	}
+	return u
+}
@@ -4,6 +4,9 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
@@ -15,8 +18,10 @@ type ProxyConfig struct {
 	Security      string
 	Type          string
 	UUID          string
+	Username      string
 	Flow          string
 	HeaderType    string
+	Seed          string
 	Path          string
 	Host          string
 	SNI           string
@@ -27,6 +32,10 @@ type ProxyConfig struct {
 	ExtraXhttp    string
 	Password      string
 	Method        string
+	Plugin        string
+	PluginOpts    string
+	Congestion    string
+	UDPRelayMode  string
 	Level         int
 	AlterId       int
 	VMessAid      int
@@ -39,37 +48,8 @@ type ProxyConfig struct {
 	Index         int
 	Settings      map[string]string
 	StableID      string
-}
-
-func (pc *ProxyConfig) Validate() error {
-	if pc.Protocol == "" {
-		return fmt.Errorf("protocol is required")
-	}
-	if pc.Server == "" {
-		return fmt.Errorf("server is required")
-	}
-	if pc.Port <= 0 || pc.Port > 65535 {
-		return fmt.Errorf("invalid port number: %d", pc.Port)
-	}
-
-	switch pc.Protocol {
-	case "vless", "vmess":
-		if pc.UUID == "" {
-			return fmt.Errorf("UUID is required for %s", pc.Protocol)
-		}
-	case "trojan":
-		if pc.Password == "" {
-			return fmt.Errorf("password is required for Trojan")
-		}
-	case "shadowsocks":
-		if pc.Password == "" || pc.Method == "" {
-			return fmt.Errorf("password and method are required for Shadowsocks")
-		}
-	default:
-		return fmt.Errorf("unsupported protocol: %s", pc.Protocol)
-	}
-
-	return nil
+	Inferred      []string
+	Tags          []string // Groups from the "tags" link parameter, e.g. premium or us-nodes
 }
 
 func (pc *ProxyConfig) GenerateStableID() string {
@@ -81,17 +61,21 @@ func (pc *ProxyConfig) GenerateStableID() string {
 	idComponents = append(idComponents, fmt.Sprintf("%d", pc.Port))
 
 	switch pc.Protocol {
-	case "vless", "vmess":
+	case "vless", "vmess", "tuic":
 		if pc.UUID != "" {
 			idComponents = append(idComponents, pc.UUID)
 		}
-	case "trojan", "shadowsocks":
+	case "trojan", "shadowsocks", "hysteria2":
 		if pc.Password != "" {
 			idComponents = append(idComponents, pc.Password)
 		}
 		if pc.Protocol == "shadowsocks" && pc.Method != "" {
 			idComponents = append(idComponents, pc.Method)
 		}
+	case "ssh":
+		if pc.Username != "" {
+			idComponents = append(idComponents, pc.Username)
+		}
 	}
 
 	if pc.SNI != "" {
@@ -164,6 +148,34 @@ func (pc *ProxyConfig) HasHTTPUpgradeSettings() bool {
 	return pc.Type == "httpupgrade"
 }
 
+// kcpTunables are the mKCP kcpSettings fields that links carry as query
+// parameters with the same name.
+var kcpTunables = []string{"mtu", "tti", "uplinkCapacity", "downlinkCapacity", "readBufferSize", "writeBufferSize"}
+
+// GetKCPSettings returns the kcpSettings object for mKCP transports. Tunables
+// missing from the link are left to the Xray defaults.
+func (pc *ProxyConfig) GetKCPSettings() map[string]interface{} {
+	headerType := pc.HeaderType
+	if headerType == "" {
+		headerType = "none"
+	}
+	settings := map[string]interface{}{
+		"header": map[string]string{"type": headerType},
+	}
+	if pc.Seed != "" {
+		settings["seed"] = pc.Seed
+	}
+	for _, key := range kcpTunables {
+		if value, err := strconv.ParseUint(pc.Settings[key], 10, 32); err == nil {
+			settings[key] = value
+		}
+	}
+	if congestion, err := strconv.ParseBool(pc.Settings["congestion"]); err == nil {
+		settings["congestion"] = congestion
+	}
+	return settings
+}
+
 func (pc *ProxyConfig) GetServiceName() string {
 	if pc.ServiceName == "" {
 		return "GunService"
@@ -176,4 +188,91 @@ func (pc *ProxyConfig) GetALPNSettings() []string {
 		return []string{"h2", "http/1.1"}
 	}
 	return pc.ALPN
-}
\ No newline at end of file
+}
+
+// SupportedByXray reports whether Xray core has an outbound for the protocol.
+// TUIC, Hysteria2 and SSH nodes are parsed and tracked but need the sing-box
+// backend to be checked.
+func (pc *ProxyConfig) SupportedByXray() bool {
+	return pc.Protocol != "tuic" && pc.Protocol != "hysteria2" && pc.Protocol != "ssh"
+}
+
+// SupportedBySingBox reports whether sing-box has an outbound for the
+// protocol and transport. sing-box implements neither XHTTP nor mKCP, nor
+// the HTTP header obfuscation of raw TCP; Shadowsocks plugins are passed to
+// sing-box as they are.
+func (pc *ProxyConfig) SupportedBySingBox() bool {
+	if pc.Protocol == "shadowsocks" {
+		return true
+	}
+	switch pc.GetTransportType() {
+	case "xhttp", "kcp":
+		return false
+	case "tcp":
+		return pc.HeaderType != "http"
+	}
+	return true
+}
+
+// OverUDP reports whether the proxy carries traffic over UDP (TUIC,
+// Hysteria2, mKCP or QUIC transport), so its server cannot be probed with a
+// TCP connection.
+func (pc *ProxyConfig) OverUDP() bool {
+	return pc.Protocol == "tuic" || pc.Protocol == "hysteria2" || pc.Type == "kcp" || pc.Type == "quic"
+}
+
+// DirectDial reports whether the proxy is a plain SOCKS5 or HTTP proxy that
+// is checked by dialing it directly, without Xray.
+func (pc *ProxyConfig) DirectDial() bool {
+	return pc.Protocol == "socks" || pc.Protocol == "http"
+}
+
+// DirectURL returns the URL to use as the HTTP client proxy for DirectDial
+// proxies.
+func (pc *ProxyConfig) DirectURL() *url.URL {
+	u := &url.URL{
+		Scheme: "socks5",
+		Host:   net.JoinHostPort(pc.Server, strconv.Itoa(pc.Port)),
+	}
+	if pc.Protocol == "http" {
+		u.Scheme = "http"
+		if pc.Security == "tls" {
+			u.Scheme = "https"
+		}
+	}
+	if pc.Username != "" || pc.Password != "" {
+		u.User = url.UserPassword(pc.Username, pc.Password)
+	}
+	return u
+}
+
+// GetCountry returns the ISO country code of the first flag emoji in the
+// proxy name, which is how most subscriptions label node locations.
+func (pc *ProxyConfig) GetCountry() string {
+	var letters []rune
+	for _, r := range pc.Name {
+		if r >= 0x1F1E6 && r <= 0x1F1FF {
+			letters = append(letters, 'A'+(r-0x1F1E6))
+			if len(letters) == 2 {
+				return string(letters)
+			}
+			continue
+		}
+		letters = letters[:0]
+	}
+	return ""
+}
+
+// GetProvider returns the registered domain of the server address, or an
+// empty string for IP addresses.
+func (pc *ProxyConfig) GetProvider() string {
+	if pc.Server == "" || net.ParseIP(pc.Server) != nil {
+		return ""
+	}
+
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(pc.Server), "."), ".")
+	if len(labels) <= 2 {
+		return strings.Join(labels, ".")
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
@@ -0,0 +1,284 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ShareURI encodes the proxy as a share link that the parser and common
+// clients (v2rayN, NekoBox, Clash.Meta subscriptions) import. Parameters the
+// parser inferred are written explicitly.
+func (pc *ProxyConfig) ShareURI() (string, error) {
+	switch pc.Protocol {
+	case "vless":
+		return pc.standardURI(pc.UUID), nil
+	case "trojan":
+		return pc.standardURI(pc.Password), nil
+	case "vmess":
+		return pc.vmessURI()
+	case "shadowsocks":
+		return pc.shadowsocksURI(), nil
+	case "tuic":
+		return pc.tuicURI(), nil
+	case "hysteria2":
+		return pc.hysteria2URI(), nil
+	case "ssh":
+		return pc.sshURI(), nil
+	case "socks", "http":
+		return pc.directURI(), nil
+	default:
+		return "", fmt.Errorf("cannot encode %s proxy as a share link", pc.Protocol)
+	}
+}
+
+// standardURI builds vless:// and trojan:// links, which share the
+// scheme://credential@host:port?params#name layout.
+func (pc *ProxyConfig) standardURI(credential string) string {
+	u := &url.URL{
+		Scheme:   pc.Protocol,
+		User:     url.User(credential),
+		Host:     net.JoinHostPort(pc.Server, strconv.Itoa(pc.Port)),
+		RawQuery: pc.transportQuery().Encode(),
+		Fragment: pc.Name,
+	}
+	return u.String()
+}
+
+// transportQuery returns the transport and security parameters of vless and
+// trojan links.
+func (pc *ProxyConfig) transportQuery() url.Values {
+	query := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	query.Set("type", pc.GetTransportType())
+	query.Set("security", pc.GetSecurityType())
+	set("flow", pc.Flow)
+	set("headerType", pc.HeaderType)
+	set("path", pc.Path)
+	set("host", pc.Host)
+	set("sni", pc.SNI)
+	set("fp", pc.Fingerprint)
+	set("pbk", pc.PublicKey)
+	set("sid", pc.ShortID)
+	if len(pc.ALPN) > 0 {
+		query.Set("alpn", strings.Join(pc.ALPN, ","))
+	}
+	if pc.AllowInsecure {
+		query.Set("allowInsecure", "true")
+	}
+	if pc.Level > 0 {
+		query.Set("level", strconv.Itoa(pc.Level))
+	}
+	if len(pc.Tags) > 0 {
+		query.Set("tags", strings.Join(pc.Tags, ","))
+	}
+
+	switch pc.Type {
+	case "xhttp":
+		set("mode", pc.Mode)
+		if pc.ExtraXhttp != "" {
+			query.Set("extra", strconv.Quote(pc.ExtraXhttp))
+		}
+	case "grpc":
+		set("serviceName", pc.ServiceName)
+		if pc.MultiMode {
+			query.Set("multiMode", "true")
+			query.Set("mode", "multi")
+		}
+		if pc.IdleTimeout > 0 {
+			query.Set("idleTimeout", strconv.Itoa(pc.IdleTimeout))
+		}
+		if pc.WindowsSize > 0 {
+			query.Set("windowSize", strconv.Itoa(pc.WindowsSize))
+		}
+	case "kcp":
+		set("seed", pc.Seed)
+		for _, key := range append(kcpTunables, "congestion") {
+			set(key, pc.Settings[key])
+		}
+	}
+	return query
+}
+
+// vmessURI builds a v2rayN vmess:// link: base64 of a JSON object. gRPC
+// service names and mKCP seeds go to "path", as v2rayN exports them.
+func (pc *ProxyConfig) vmessURI() (string, error) {
+	fields := map[string]interface{}{
+		"v":    "2",
+		"ps":   pc.Name,
+		"add":  pc.Server,
+		"port": pc.Port,
+		"id":   pc.UUID,
+		"aid":  pc.GetAlterId(),
+		"scy":  "auto",
+		"net":  pc.GetTransportType(),
+		"type": "none",
+		"host": pc.Host,
+		"path": pc.Path,
+		"tls":  "",
+	}
+	if pc.Security == "tls" {
+		fields["tls"] = "tls"
+		fields["sni"] = pc.SNI
+		fields["fp"] = pc.Fingerprint
+		if len(pc.ALPN) > 0 {
+			fields["alpn"] = strings.Join(pc.ALPN, ",")
+		}
+	}
+	if pc.HeaderType != "" {
+		fields["type"] = pc.HeaderType
+	}
+	switch pc.Type {
+	case "grpc":
+		fields["path"] = pc.ServiceName
+		fields["serviceName"] = pc.ServiceName
+		if pc.MultiMode {
+			fields["type"] = "multi"
+			fields["multiMode"] = true
+		}
+	case "kcp":
+		fields["path"] = pc.Seed
+	}
+	if pc.Level > 0 {
+		fields["level"] = pc.Level
+	}
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("error encoding VMess config: %v", err)
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(encoded), nil
+}
+
+// shadowsocksURI builds a SIP002 link with base64url method:password
+// userinfo and the SIP003 plugin, if any.
+func (pc *ProxyConfig) shadowsocksURI() string {
+	u := &url.URL{
+		Scheme:   "ss",
+		User:     url.User(base64.RawURLEncoding.EncodeToString([]byte(pc.Method + ":" + pc.Password))),
+		Host:     net.JoinHostPort(pc.Server, strconv.Itoa(pc.Port)),
+		Fragment: pc.Name,
+	}
+	if pc.Plugin != "" {
+		plugin := pc.Plugin
+		if pc.PluginOpts != "" {
+			plugin += ";" + pc.PluginOpts
+		}
+		u.Path = "/"
+		u.RawQuery = url.Values{"plugin": {plugin}}.Encode()
+	}
+	if len(pc.Tags) > 0 {
+		query := u.Query()
+		query.Set("tags", strings.Join(pc.Tags, ","))
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+func (pc *ProxyConfig) tuicURI() string {
+	query := url.Values{}
+	if pc.Congestion != "" {
+		query.Set("congestion_control", pc.Congestion)
+	}
+	if pc.UDPRelayMode != "" {
+		query.Set("udp_relay_mode", pc.UDPRelayMode)
+	}
+	if pc.SNI != "" {
+		query.Set("sni", pc.SNI)
+	}
+	if len(pc.ALPN) > 0 {
+		query.Set("alpn", strings.Join(pc.ALPN, ","))
+	}
+	if pc.AllowInsecure {
+		query.Set("allow_insecure", "1")
+	}
+	if len(pc.Tags) > 0 {
+		query.Set("tags", strings.Join(pc.Tags, ","))
+	}
+	u := &url.URL{
+		Scheme:   "tuic",
+		User:     url.UserPassword(pc.UUID, pc.Password),
+		Host:     net.JoinHostPort(pc.Server, strconv.Itoa(pc.Port)),
+		RawQuery: query.Encode(),
+		Fragment: pc.Name,
+	}
+	return u.String()
+}
+
+// hysteria2URI keeps the obfuscation and other parameters of the original
+// link, which are stored in Settings.
+func (pc *ProxyConfig) hysteria2URI() string {
+	query := url.Values{}
+	for _, key := range []string{"obfs", "obfs-password", "pinSHA256"} {
+		if value := pc.Settings[key]; value != "" {
+			query.Set(key, value)
+		}
+	}
+	if pc.SNI != "" {
+		query.Set("sni", pc.SNI)
+	}
+	if len(pc.ALPN) > 0 {
+		query.Set("alpn", strings.Join(pc.ALPN, ","))
+	}
+	if pc.AllowInsecure {
+		query.Set("insecure", "1")
+	}
+	if len(pc.Tags) > 0 {
+		query.Set("tags", strings.Join(pc.Tags, ","))
+	}
+	u := &url.URL{
+		Scheme:   "hysteria2",
+		User:     url.User(pc.Password),
+		Host:     net.JoinHostPort(pc.Server, strconv.Itoa(pc.Port)),
+		RawQuery: query.Encode(),
+		Fragment: pc.Name,
+	}
+	return u.String()
+}
+
+func (pc *ProxyConfig) sshURI() string {
+	query := url.Values{}
+	for _, key := range []string{"private_key", "host_key"} {
+		if value := pc.Settings[key]; value != "" {
+			query.Set(key, value)
+		}
+	}
+	if len(pc.Tags) > 0 {
+		query.Set("tags", strings.Join(pc.Tags, ","))
+	}
+	user := url.User(pc.Username)
+	if pc.Password != "" {
+		user = url.UserPassword(pc.Username, pc.Password)
+	}
+	u := &url.URL{
+		Scheme:   "ssh",
+		User:     user,
+		Host:     net.JoinHostPort(pc.Server, strconv.Itoa(pc.Port)),
+		RawQuery: query.Encode(),
+		Fragment: pc.Name,
+	}
+	return u.String()
+}
+
+// directURI builds socks:// links with v2rayN base64 user:password, and
+// http(s):// links with plain credentials.
+func (pc *ProxyConfig) directURI() string {
+	u := pc.DirectURL()
+	if pc.Protocol == "socks" {
+		u.Scheme = "socks"
+		if pc.Username != "" || pc.Password != "" {
+			u.User = url.User(base64.RawURLEncoding.EncodeToString([]byte(pc.Username + ":" + pc.Password)))
+		}
+	}
+	u.Fragment = pc.Name
+	return u.String()
+}
@@ -0,0 +1,61 @@
+package models
+
+import "encoding/json"
+
+// SourceType is the kind of subscription source, detected from its prefix.
+type SourceType string
+
+const (
+	SourceTypeURL    SourceType = "url"    // http(s) subscription
+	SourceTypeBase64 SourceType = "base64" // Share links, plain or base64-encoded
+	SourceTypeFile   SourceType = "file"   // file:// path to an Xray or sing-box JSON config
+	SourceTypeFolder SourceType = "folder" // folder:// path to a directory of JSON configs
+)
+
+// XrayConfig is the part of an Xray JSON config that file sources import
+// proxies from.
+type XrayConfig struct {
+	Outbounds []XrayOutbound `json:"outbounds"`
+}
+
+// XrayOutbound is an outbound of an Xray JSON config. Settings are decoded
+// per protocol.
+type XrayOutbound struct {
+	Tag            string          `json:"tag"`
+	Protocol       string          `json:"protocol"`
+	Settings       json.RawMessage `json:"settings"`
+	StreamSettings *StreamSettings `json:"streamSettings,omitempty"`
+}
+
+// StreamSettings holds the transport and security of an Xray outbound.
+type StreamSettings struct {
+	Network             string               `json:"network"`
+	Security            string               `json:"security"`
+	TLSSettings         *TLSSettings         `json:"tlsSettings,omitempty"`
+	RealitySettings     *RealitySettings     `json:"realitySettings,omitempty"`
+	WSSettings          *WSSettings          `json:"wsSettings,omitempty"`
+	HTTPUpgradeSettings *HTTPUpgradeSettings `json:"httpupgradeSettings,omitempty"`
+}
+
+type TLSSettings struct {
+	ServerName    string `json:"serverName"`
+	AllowInsecure bool   `json:"allowInsecure"`
+}
+
+type RealitySettings struct {
+	ServerName  string `json:"serverName"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"publicKey"`
+	ShortID     string `json:"shortId"`
+}
+
+type WSSettings struct {
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+}
+
+type HTTPUpgradeSettings struct {
+	Path    string            `json:"path"`
+	Host    string            `json:"host"`
+	Headers map[string]string `json:"headers"`
+}
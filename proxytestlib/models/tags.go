@@ -0,0 +1,56 @@
+package models
+
+import "strings"
+
+// ParseTags splits a comma-separated tag list, as in the "tags" parameter of
+// a share link. Tags are trimmed and lowercased; empty and repeated tags are
+// dropped.
+func ParseTags(value string) []string {
+	return NormalizeTags(strings.Split(value, ","))
+}
+
+// NormalizeTags trims and lowercases tags and drops empty and repeated ones.
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// MatchTags reports whether a proxy with the given tags passes the filters:
+// it must carry at least one of the include tags, if any are given, and none
+// of the exclude tags. Tags are compared case-insensitively.
+func MatchTags(tags, include, exclude []string) bool {
+	has := make(map[string]bool, len(tags))
+	for _, tag := range NormalizeTags(tags) {
+		has[tag] = true
+	}
+	for _, tag := range NormalizeTags(exclude) {
+		if has[tag] {
+			return false
+		}
+	}
+	include = NormalizeTags(include)
+	if len(include) == 0 {
+		return true
+	}
+	for _, tag := range include {
+		if has[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesTags reports whether the proxy passes the include and exclude
+// filters, see MatchTags.
+func (pc *ProxyConfig) MatchesTags(include, exclude []string) bool {
+	return MatchTags(pc.Tags, include, exclude)
+}
@@ -0,0 +1,220 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidationError describes a field that makes a proxy unusable or that Xray
+// would reject, with a hint on how to fix the share link.
+type ValidationError struct {
+	Field   string // Share link parameter, e.g. "port" or "pbk"
+	Value   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+	}
+	return fmt.Sprintf("invalid %s %q: %s", e.Field, e.Value, e.Message)
+}
+
+func invalid(field, value, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Field: field, Value: value, Message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	uuidPattern     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hostnamePattern = regexp.MustCompile(`^[\p{L}\p{N}_]([\p{L}\p{N}_-]*[\p{L}\p{N}_])?(\.[\p{L}\p{N}_]([\p{L}\p{N}_-]*[\p{L}\p{N}_])?)*\.?$`)
+
+	transports = oneOf("tcp", "raw", "ws", "grpc", "http", "h2", "xhttp", "httpupgrade", "kcp", "quic")
+	securities = oneOf("none", "tls", "reality")
+	flows      = oneOf("xtls-rprx-vision", "xtls-rprx-vision-udp443")
+	// Fingerprints uTLS implements; Xray refuses to start with any other
+	fingerprints   = oneOf("chrome", "firefox", "safari", "ios", "android", "edge", "360", "qq", "random", "randomized", "randomizednoalpn", "unsafe")
+	alpns          = oneOf("h2", "http/1.1", "h3")
+	kcpHeaders     = oneOf("none", "srtp", "utp", "wechat-video", "dtls", "wireguard", "dns")
+	tcpHeaders     = oneOf("none", "http")
+	xhttpModes     = oneOf("auto", "packet-up", "stream-up", "stream-one")
+	ss2022KeySizes = map[string]int{
+		"2022-blake3-aes-128-gcm":       16,
+		"2022-blake3-aes-256-gcm":       32,
+		"2022-blake3-chacha20-poly1305": 32,
+	}
+)
+
+func oneOf(values ...string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// Validate checks the config before an Xray config is generated from it and
+// returns a *ValidationError for the first problem found. Parameters that
+// lenient parsing can infer, such as the transport or the SNI, may be empty.
+func (pc *ProxyConfig) Validate() error {
+	if pc.Protocol == "" {
+		return invalid("protocol", "", "missing")
+	}
+	if err := validateServer(pc.Server); err != nil {
+		return err
+	}
+	if pc.Port <= 0 || pc.Port > 65535 {
+		return invalid("port", strconv.Itoa(pc.Port), "must be between 1 and 65535")
+	}
+
+	if err := pc.validateCredentials(); err != nil {
+		return err
+	}
+	if pc.Protocol == "vless" || pc.Protocol == "vmess" || pc.Protocol == "trojan" {
+		return pc.validateTransport()
+	}
+	return nil
+}
+
+func validateServer(server string) error {
+	if server == "" {
+		return invalid("server", "", "missing")
+	}
+	if net.ParseIP(server) != nil {
+		return nil
+	}
+	if len(server) > 253 || !hostnamePattern.MatchString(server) {
+		return invalid("server", server, "not a valid hostname or IP address")
+	}
+	return nil
+}
+
+func (pc *ProxyConfig) validateCredentials() error {
+	switch pc.Protocol {
+	case "vless", "vmess":
+		// Xray maps IDs of up to 30 bytes that are not UUIDs to UUIDv5
+		if pc.UUID == "" {
+			return invalid("uuid", "", "missing, %s requires a UUID", pc.Protocol)
+		}
+		if !uuidPattern.MatchString(pc.UUID) && (len(pc.UUID) > 30 || strings.ContainsAny(pc.UUID, " \t")) {
+			return invalid("uuid", pc.UUID, "expected xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx or a custom ID of up to 30 bytes")
+		}
+	case "trojan":
+		if pc.Password == "" {
+			return invalid("password", "", "missing, Trojan requires a password")
+		}
+	case "shadowsocks":
+		if pc.Method == "" {
+			return invalid("method", "", "missing, Shadowsocks requires a cipher")
+		}
+		if pc.Password == "" {
+			return invalid("password", "", "missing, Shadowsocks requires a password")
+		}
+		if size, ok := ss2022KeySizes[pc.Method]; ok {
+			return validateSS2022Key(pc.Method, pc.Password, size)
+		}
+	case "tuic":
+		if !uuidPattern.MatchString(pc.UUID) {
+			return invalid("uuid", pc.UUID, "TUIC requires a UUID in the form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx")
+		}
+		if pc.Password == "" {
+			return invalid("password", "", "missing, TUIC requires a password")
+		}
+	case "hysteria2":
+		if pc.Password == "" {
+			return invalid("password", "", "missing, Hysteria2 requires a password")
+		}
+	case "ssh":
+		if pc.Username == "" {
+			return invalid("username", "", "missing, SSH requires a user name")
+		}
+		if pc.Password == "" && pc.Settings["private_key"] == "" {
+			return invalid("password", "", "missing, SSH requires a password or a private_key")
+		}
+	case "socks", "http":
+	default:
+		return invalid("protocol", pc.Protocol, "unsupported protocol")
+	}
+	return nil
+}
+
+// validateSS2022Key checks the base64 PSK of Shadowsocks 2022. Multi-user
+// servers use "server key:user key", every key must have the cipher's size.
+func validateSS2022Key(method, password string, size int) error {
+	for _, key := range strings.Split(password, ":") {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(decoded) != size {
+			return invalid("password", "", "%s requires a base64-encoded %d-byte key, generate one with `openssl rand -base64 %d`", method, size, size)
+		}
+	}
+	return nil
+}
+
+func (pc *ProxyConfig) validateTransport() error {
+	if pc.Type != "" && !transports[pc.Type] {
+		return invalid("type", pc.Type, "unknown transport, expected one of tcp, ws, grpc, http, xhttp, httpupgrade, kcp, quic")
+	}
+	if pc.Security != "" && !securities[pc.Security] {
+		return invalid("security", pc.Security, "expected none, tls or reality")
+	}
+
+	switch pc.Type {
+	case "tcp", "raw":
+		if pc.HeaderType != "" && !tcpHeaders[pc.HeaderType] {
+			return invalid("headerType", pc.HeaderType, "TCP supports none or http")
+		}
+	case "kcp":
+		if pc.HeaderType != "" && !kcpHeaders[pc.HeaderType] {
+			return invalid("headerType", pc.HeaderType, "mKCP supports none, srtp, utp, wechat-video, dtls, wireguard or dns")
+		}
+	case "xhttp":
+		if pc.Mode != "" && !xhttpModes[pc.Mode] {
+			return invalid("mode", pc.Mode, "XHTTP supports auto, packet-up, stream-up or stream-one")
+		}
+	}
+
+	if pc.Flow != "" {
+		if pc.Protocol != "vless" {
+			return invalid("flow", pc.Flow, "flow is only supported by VLESS")
+		}
+		if !flows[pc.Flow] {
+			return invalid("flow", pc.Flow, "expected xtls-rprx-vision")
+		}
+		if pc.Type != "" && pc.Type != "tcp" && pc.Type != "raw" {
+			return invalid("flow", pc.Flow, "XTLS Vision requires type=tcp, got type=%s", pc.Type)
+		}
+		if pc.Security == "none" {
+			return invalid("flow", pc.Flow, "XTLS Vision requires security=tls or security=reality")
+		}
+	}
+
+	// Besides the presets, Xray accepts uTLS names such as hellochrome_120
+	fp := strings.ToLower(pc.Fingerprint)
+	if fp != "" && !fingerprints[fp] && !strings.HasPrefix(fp, "hello") {
+		return invalid("fp", pc.Fingerprint, "unknown uTLS fingerprint, use chrome, firefox, safari, ios, android, edge or random")
+	}
+	for _, alpn := range pc.ALPN {
+		if !alpns[strings.TrimSpace(alpn)] {
+			return invalid("alpn", strings.Join(pc.ALPN, ","), "expected a comma-separated list of h2, http/1.1 and h3")
+		}
+	}
+
+	if pc.Security == "reality" {
+		if pc.PublicKey == "" {
+			return invalid("pbk", "", "missing, REALITY requires the server's public key")
+		}
+		if key, err := base64.RawURLEncoding.DecodeString(pc.PublicKey); err != nil || len(key) != 32 {
+			return invalid("pbk", pc.PublicKey, "expected a 43-character base64url X25519 public key")
+		}
+		if pc.ShortID != "" {
+			if _, err := hex.DecodeString(pc.ShortID); err != nil || len(pc.ShortID) > 16 {
+				return invalid("sid", pc.ShortID, "expected up to 16 hex digits of even length")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package monitor
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"projectx/proxytestlib/alert"
+	"projectx/proxytestlib/checker"
+	"projectx/proxytestlib/config"
+	"projectx/proxytestlib/core"
+	"projectx/proxytestlib/geoip"
+	"projectx/proxytestlib/metrics"
+	"projectx/proxytestlib/models"
+	"projectx/proxytestlib/mqtt"
+	"projectx/proxytestlib/xray"
+	"projectx/subscription"
+)
+
+// configFile is the name of the generated core config, resolved by
+// runner.ConfigPath.
+const configFile = "xray_config.json"
+
+// Run is the monitoring mode: it loads the subscription, starts the proxy
+// core, checks every proxy each check interval and serves the metrics until
+// ctx is cancelled. Subscription changes are applied by regenerating the core
+// config, with stable ports keeping the inbound of unchanged proxies. With
+// --run-once it checks once, pushes the metrics and returns.
+func Run(ctx context.Context, version string) error {
+	metrics.InitMetrics(config.CLIConfig.Metrics.Instance)
+
+	proxyCore, err := core.FromConfig(configFile)
+	if err != nil {
+		return err
+	}
+	proxies, err := subscription.InitializeConfiguration(proxyCore, version)
+	if err != nil {
+		return err
+	}
+	if err := proxyCore.Start(); err != nil {
+		return fmt.Errorf("error starting core: %v", err)
+	}
+	defer proxyCore.Stop()
+
+	proxyChecker, err := newChecker(*proxies, proxyCore)
+	if err != nil {
+		return err
+	}
+
+	pushConfig, err := metrics.ParseURL(config.CLIConfig.Metrics.PushURL)
+	if err != nil {
+		return fmt.Errorf("invalid metrics push URL: %v", err)
+	}
+
+	if config.CLIConfig.RunOnce {
+		runCycle(proxyChecker, pushConfig)
+		return nil
+	}
+
+	server := metricsServer()
+	go func() {
+		log.Printf("Metrics server listening on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Metrics server error: %v", err)
+		}
+	}()
+	defer server.Close()
+
+	if interval := config.CLIConfig.Proxy.TargetInterval; interval > 0 {
+		go proxyChecker.RunTargetWatchdog(ctx, time.Duration(interval)*time.Second)
+	}
+
+	checkTicker := time.NewTicker(time.Duration(config.CLIConfig.Proxy.CheckInterval) * time.Second)
+	defer checkTicker.Stop()
+
+	var updates <-chan time.Time
+	if config.CLIConfig.Subscription.Update {
+		updateTicker := time.NewTicker(time.Duration(config.CLIConfig.Subscription.UpdateInterval) * time.Second)
+		defer updateTicker.Stop()
+		updates = updateTicker.C
+	}
+
+	runCycle(proxyChecker, pushConfig)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-checkTicker.C:
+			runCycle(proxyChecker, pushConfig)
+		case <-updates:
+			updateSubscription(proxyCore, proxies, proxyChecker, version)
+		}
+	}
+}
+
+// newChecker returns a checker for proxies configured from the CLI
+// configuration.
+func newChecker(proxies []*models.ProxyConfig, proxyCore core.Core) (*checker.ProxyChecker, error) {
+	cfg := config.CLIConfig
+	pc := checker.NewProxyChecker(
+		proxies,
+		cfg.Xray.StartPort,
+		cfg.Proxy.IpCheckUrl,
+		cfg.Proxy.Timeout,
+		cfg.Proxy.StatusCheckUrl,
+		cfg.Proxy.DownloadUrl,
+		cfg.Proxy.DownloadTimeout,
+		cfg.Proxy.DownloadMinSize,
+		cfg.Proxy.CheckMethod,
+		cfg.Metrics.Instance,
+	)
+	pc.SetCore(proxyCore)
+	pc.SetWorkers(cfg.Proxy.CheckWorkers)
+	pc.SetInbound(xray.InboundFromConfig())
+	pc.SetMetricsMode(cfg.Metrics.Mode)
+	pc.SetConfirmation(cfg.Proxy.ConfirmChanges, cfg.Proxy.ConfirmUrl)
+	pc.SetRecoveryGrace(time.Duration(cfg.Proxy.RecoveryGrace) * time.Second)
+	pc.SetRetry(checker.RetryPolicyFromConfig())
+	pc.SetUpload(cfg.Proxy.UploadUrl, cfg.Proxy.UploadSize, cfg.Proxy.UploadTimeout)
+	pc.SetBandwidthLimit(checker.BandwidthLimitFromConfig())
+
+	if publisher := mqtt.PublisherFromConfig(); publisher != nil {
+		pc.OnCycle(publisher.PublishCycle)
+	}
+	if notifier := alert.NotifierFromConfig(); notifier != nil {
+		pc.OnCycle(notifier.HandleCycle)
+	}
+
+	transport, err := checker.TransportOptionsFromConfig()
+	if err != nil {
+		return nil, err
+	}
+	pc.SetTransport(transport)
+
+	auth, err := checker.TargetAuthFromConfig()
+	if err != nil {
+		return nil, err
+	}
+	pc.SetTargetAuth(auth)
+
+	expect, err := checker.StatusExpectationFromConfig()
+	if err != nil {
+		return nil, err
+	}
+	pc.SetStatusExpectation(expect)
+
+	if cfg.Proxy.CheckMethod == "speedtest" {
+		test, err := checker.SpeedTestFromConfig()
+		if err != nil {
+			return nil, err
+		}
+		if err := pc.SetSpeedTest(test); err != nil {
+			return nil, err
+		}
+	}
+
+	resolver, err := geoip.ResolverFromConfig()
+	if err != nil {
+		return nil, err
+	}
+	if resolver != nil {
+		pc.SetGeoIP(resolver)
+	}
+
+	return pc, nil
+}
+
+// runCycle checks all proxies and pushes the metrics if a push URL is set.
+func runCycle(pc *checker.ProxyChecker, pushConfig *metrics.RemoteWriteConfig) {
+	log.Println("Starting proxy check iteration...")
+	pc.CheckAllProxies()
+	log.Println("Proxy check iteration completed.")
+
+	if pushConfig == nil {
+		return
+	}
+	registry, ok := prometheus.DefaultRegisterer.(*prometheus.Registry)
+	if !ok {
+		return
+	}
+	if err := metrics.PushMetrics(pushConfig, registry); err != nil {
+		log.Printf("Error pushing metrics: %v", err)
+	}
+}
+
+// updateSubscription reloads the core if the subscription changed. Errors
+// keep the current proxies running.
+func updateSubscription(proxyCore core.Core, current *[]*models.ProxyConfig, pc *checker.ProxyChecker, version string) {
+	newConfigs, err := subscription.ReadFromSource(config.CLIConfig.Subscription.URL, version)
+	if err != nil {
+		log.Printf("Error checking subscription updates: %v", err)
+		return
+	}
+	if xray.IsConfigsEqual(*current, newConfigs) {
+		return
+	}
+	if err := core.Reload(proxyCore, newConfigs, current, pc); err != nil {
+		log.Printf("Error updating configuration: %v", err)
+	}
+}
+
+// metricsServer returns the server of the metrics endpoint, behind basic
+// auth if the metrics are protected.
+func metricsServer() *http.Server {
+	cfg := config.CLIConfig.Metrics
+	var handler http.Handler = promhttp.Handler()
+	if cfg.Protected {
+		handler = basicAuth(handler, cfg.Username, cfg.Password)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(strings.TrimSuffix(cfg.BasePath, "/")+"/metrics", handler)
+	return &http.Server{
+		Addr:              net.JoinHostPort(cfg.Host, cfg.Port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+func basicAuth(next http.Handler, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,158 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Client is a minimal MQTT 3.1.1 client that only publishes with QoS 0.
+// The checker publishes once per cycle, so a connection is opened for each
+// batch of messages instead of being kept alive between cycles.
+type Client struct {
+	conn net.Conn
+	w    *bufio.Writer
+}
+
+// connackCodes are the CONNACK return codes defined by MQTT 3.1.1.
+var connackCodes = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Dial connects to a broker given as mqtt://[user:pass@]host[:1883] or
+// mqtts://[user:pass@]host[:8883].
+func Dial(brokerURL, clientID string, timeout time.Duration) (*Client, error) {
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT URL: %v", err)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "mqtt", "tcp":
+		conn, err = dialer.Dial("tcp", hostPort(u, "1883"))
+	case "mqtts", "ssl", "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostPort(u, "8883"), &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported MQTT URL scheme: %s", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to MQTT broker: %v", err)
+	}
+
+	c := &Client{conn: conn, w: bufio.NewWriter(conn)}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := c.connect(u, clientID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+func (c *Client) connect(u *url.URL, clientID string) error {
+	var flags byte = 0x02 // clean session
+	var payload []byte
+	payload = appendString(payload, clientID)
+	if u.User != nil {
+		flags |= 0x80
+		payload = appendString(payload, u.User.Username())
+		if password, ok := u.User.Password(); ok {
+			flags |= 0x40
+			payload = appendString(payload, password)
+		}
+	}
+
+	var packet []byte
+	packet = appendString(packet, "MQTT")
+	packet = append(packet, 4, flags, 0, 60) // protocol level 4, keep alive 60s
+	packet = append(packet, payload...)
+	if err := c.writePacket(0x10, packet); err != nil {
+		return err
+	}
+
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, connack); err != nil {
+		return fmt.Errorf("error reading CONNACK: %v", err)
+	}
+	if connack[0] != 0x20 {
+		return fmt.Errorf("unexpected packet type 0x%x instead of CONNACK", connack[0])
+	}
+	if code := connack[3]; code != 0 {
+		reason, ok := connackCodes[code]
+		if !ok {
+			reason = fmt.Sprintf("code %d", code)
+		}
+		return fmt.Errorf("MQTT broker refused connection: %s", reason)
+	}
+	return nil
+}
+
+// Publish sends a QoS 0 message. Retained messages are kept by the broker
+// and delivered to clients that subscribe later.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	var header byte = 0x30
+	if retain {
+		header |= 0x01
+	}
+	packet := appendString(nil, topic)
+	packet = append(packet, payload...)
+	return c.writePacket(header, packet)
+}
+
+// SetDeadline limits how long the remaining publishes may take.
+func (c *Client) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// Close sends DISCONNECT and closes the connection.
+func (c *Client) Close() error {
+	c.writePacket(0xE0, nil)
+	return c.conn.Close()
+}
+
+func (c *Client) writePacket(header byte, body []byte) error {
+	c.w.WriteByte(header)
+	c.w.Write(remainingLength(len(body)))
+	c.w.Write(body)
+	if err := c.w.Flush(); err != nil {
+		return fmt.Errorf("error writing MQTT packet: %v", err)
+	}
+	return nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+// remainingLength encodes a packet length as the MQTT variable byte integer.
+func remainingLength(n int) []byte {
+	var out []byte
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		out = append(out, digit)
+		if n == 0 {
+			return out
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"projectx/proxytestlib/checker"
+	"projectx/proxytestlib/config"
+)
+
+// Publisher publishes proxy states after every check cycle and announces
+// them to Home Assistant through MQTT discovery.
+//
+// Topics, with the default prefix:
+//
+//	xray-checker/status                 online, retained
+//	xray-checker/<stable id>/state      {"status":"up","latency_ms":87,...}, retained
+//	homeassistant/binary_sensor/...     discovery of the up/down sensor
+//	homeassistant/sensor/...            discovery of the latency sensor
+type Publisher struct {
+	brokerURL       string
+	clientID        string
+	topicPrefix     string
+	discoveryPrefix string // Empty disables discovery
+	instance        string
+
+	mu        sync.Mutex
+	published map[string]bool // Stable IDs with retained state topics
+}
+
+// proxyState is the retained payload of a proxy state topic.
+type proxyState struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Name      string `json:"name"`
+	Protocol  string `json:"protocol"`
+	Server    string `json:"server"`
+	Port      int    `json:"port"`
+	CheckedAt string `json:"checked_at"`
+}
+
+func NewPublisher(brokerURL, clientID, topicPrefix, discoveryPrefix, instance string) *Publisher {
+	return &Publisher{
+		brokerURL:       brokerURL,
+		clientID:        clientID,
+		topicPrefix:     strings.TrimRight(topicPrefix, "/"),
+		discoveryPrefix: strings.TrimRight(discoveryPrefix, "/"),
+		instance:        instance,
+		published:       make(map[string]bool),
+	}
+}
+
+// PublishCycle publishes the results of one check cycle. It matches the
+// signature of checker.ProxyChecker.OnCycle; errors are logged.
+func (p *Publisher) PublishCycle(results []checker.CycleResult) {
+	if err := p.publish(results); err != nil {
+		log.Printf("Error publishing to MQTT: %v", err)
+	}
+}
+
+func (p *Publisher) publish(results []checker.CycleResult) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	client, err := Dial(p.brokerURL, p.clientID, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if err := client.Publish(p.availabilityTopic(), []byte("online"), true); err != nil {
+		return err
+	}
+
+	current := make(map[string]bool, len(results))
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, result := range results {
+		id := result.Proxy.StableID
+		current[id] = true
+
+		if p.discoveryPrefix != "" && !p.published[id] {
+			if err := p.announce(client, result); err != nil {
+				return err
+			}
+		}
+
+		state := proxyState{
+			Status:    "down",
+			Name:      result.Proxy.Name,
+			Protocol:  result.Proxy.Protocol,
+			Server:    result.Proxy.Server,
+			Port:      result.Proxy.Port,
+			CheckedAt: now,
+		}
+		if result.Online {
+			state.Status = "up"
+			state.LatencyMs = result.Latency.Milliseconds()
+		}
+		payload, _ := json.Marshal(state)
+		if err := client.Publish(p.stateTopic(id), payload, true); err != nil {
+			return err
+		}
+		p.published[id] = true
+	}
+
+	// Empty retained payloads remove entities of proxies gone from the subscription
+	for id := range p.published {
+		if current[id] {
+			continue
+		}
+		topics := []string{p.stateTopic(id)}
+		if p.discoveryPrefix != "" {
+			topics = append(topics, p.discoveryTopic("binary_sensor", id), p.discoveryTopic("sensor", id))
+		}
+		for _, topic := range topics {
+			if err := client.Publish(topic, nil, true); err != nil {
+				return err
+			}
+		}
+		delete(p.published, id)
+	}
+	return nil
+}
+
+// announce publishes Home Assistant discovery configs for the up/down and
+// latency sensors of a proxy, grouped under one device per checker instance.
+func (p *Publisher) announce(client *Client, result checker.CycleResult) error {
+	id := result.Proxy.StableID
+	device := map[string]interface{}{
+		"identifiers":  []string{p.objectID("")},
+		"name":         p.deviceName(),
+		"manufacturer": "Xray Checker",
+	}
+
+	status := map[string]interface{}{
+		"name":                  result.Proxy.Name,
+		"unique_id":             p.objectID(id) + "_status",
+		"object_id":             p.objectID(id) + "_status",
+		"state_topic":           p.stateTopic(id),
+		"value_template":        "{{ value_json.status }}",
+		"payload_on":            "up",
+		"payload_off":           "down",
+		"device_class":          "connectivity",
+		"availability_topic":    p.availabilityTopic(),
+		"json_attributes_topic": p.stateTopic(id),
+		"device":                device,
+	}
+	latency := map[string]interface{}{
+		"name":                result.Proxy.Name + " latency",
+		"unique_id":           p.objectID(id) + "_latency",
+		"object_id":           p.objectID(id) + "_latency",
+		"state_topic":         p.stateTopic(id),
+		"value_template":      "{{ value_json.latency_ms }}",
+		"unit_of_measurement": "ms",
+		"device_class":        "duration",
+		"state_class":         "measurement",
+		"availability_topic":  p.availabilityTopic(),
+		"device":              device,
+	}
+
+	for component, config := range map[string]map[string]interface{}{"binary_sensor": status, "sensor": latency} {
+		payload, _ := json.Marshal(config)
+		if err := client.Publish(p.discoveryTopic(component, id), payload, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) availabilityTopic() string {
+	return p.topicPrefix + "/status"
+}
+
+func (p *Publisher) stateTopic(id string) string {
+	return fmt.Sprintf("%s/%s/state", p.topicPrefix, id)
+}
+
+func (p *Publisher) discoveryTopic(component, id string) string {
+	return fmt.Sprintf("%s/%s/%s/config", p.discoveryPrefix, component, p.objectID(id))
+}
+
+// objectID builds Home Assistant object IDs, which allow only [a-zA-Z0-9_-].
+func (p *Publisher) objectID(id string) string {
+	parts := []string{"xray_checker"}
+	if p.instance != "" {
+		parts = append(parts, p.instance)
+	}
+	if id != "" {
+		parts = append(parts, id)
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.Join(parts, "_"))
+}
+
+func (p *Publisher) deviceName() string {
+	if p.instance != "" {
+		return "Xray Checker " + p.instance
+	}
+	return "Xray Checker"
+}
+
+// PublisherFromConfig returns a publisher for the MQTT settings of the CLI
+// configuration, or nil when no broker is configured. Register it with
+// checker.OnCycle(publisher.PublishCycle).
+func PublisherFromConfig() *Publisher {
+	cfg := config.CLIConfig.MQTT
+	if cfg.URL == "" {
+		return nil
+	}
+	return NewPublisher(cfg.URL, cfg.ClientID, cfg.TopicPrefix, cfg.DiscoveryPrefix, config.CLIConfig.Metrics.Instance)
+}
@@ -0,0 +1,202 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// Probe types recorded with every ping result.
+const (
+	ICMP = "icmp"
+	TCP  = "tcp"
+)
+
+// Result is a round-trip time and the probe that measured it.
+type Result struct {
+	RTT  time.Duration
+	Type string
+}
+
+var (
+	icmpOnce     sync.Once
+	icmpNetwork  string // "udp4" (unprivileged ping socket) or "ip4:icmp" (raw socket)
+	icmpDisabled atomic.Bool
+	icmpSeq      atomic.Uint32
+)
+
+// detectICMP picks the first ICMP socket type the process may open.
+// Unprivileged containers usually have neither: no CAP_NET_RAW and a
+// net.ipv4.ping_group_range that excludes the process group.
+func detectICMP() {
+	for _, network := range []string{"udp4", "ip4:icmp"} {
+		conn, err := icmp.ListenPacket(network, "0.0.0.0")
+		if err == nil {
+			conn.Close()
+			icmpNetwork = network
+			return
+		}
+	}
+	log.Printf("ICMP sockets are not available, ping falls back to TCP connect probes")
+}
+
+// ICMPAvailable reports whether ICMP echo can be used on this host.
+func ICMPAvailable() bool {
+	icmpOnce.Do(detectICMP)
+	return icmpNetwork != "" && !icmpDisabled.Load()
+}
+
+// Ping measures the round-trip time to host. ICMP echo is used when the
+// host allows it; otherwise, and for servers that drop ICMP, the time to
+// establish a TCP connection to port is measured instead. The probe type
+// used is returned in the result.
+func Ping(host string, port int, timeout time.Duration) (Result, error) {
+	if ICMPAvailable() {
+		rtt, err := pingICMP(host, timeout)
+		if err == nil {
+			return Result{RTT: rtt, Type: ICMP}, nil
+		}
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+			// Socket opened but sending is forbidden, e.g. by seccomp
+			if !icmpDisabled.Swap(true) {
+				log.Printf("ICMP echo is not permitted (%v), ping falls back to TCP connect probes", err)
+			}
+		}
+	}
+
+	rtt, err := pingTCP(host, port, timeout)
+	if err != nil {
+		return Result{Type: TCP}, err
+	}
+	return Result{RTT: rtt, Type: TCP}, nil
+}
+
+// DialTCP opens and closes a TCP connection to host:port to see whether the
+// server accepts connections at all. The dial error is returned unwrapped so
+// callers can tell a refused connection from a timeout.
+func DialTCP(host string, port int, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func pingTCP(host string, port int, timeout time.Duration) (time.Duration, error) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	ip, err := resolve(host, timeout)
+	if err == nil {
+		// Resolve first so DNS time is not counted
+		address = net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return 0, fmt.Errorf("tcp probe failed: %v", err)
+	}
+	rtt := time.Since(start)
+	conn.Close()
+	return rtt, nil
+}
+
+func pingICMP(host string, timeout time.Duration) (time.Duration, error) {
+	ip, err := resolve(host, timeout)
+	if err != nil {
+		return 0, err
+	}
+	if ip.To4() == nil {
+		return 0, fmt.Errorf("icmp probe supports IPv4 only")
+	}
+
+	conn, err := icmp.ListenPacket(icmpNetwork, "0.0.0.0")
+	if err != nil {
+		return 0, fmt.Errorf("error opening icmp socket: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	id := os.Getpid() & 0xffff
+	seq := int(icmpSeq.Add(1) & 0xffff)
+	request := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("xray-checker")},
+	}
+	data, err := request.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if icmpNetwork == "udp4" {
+		dst = &net.UDPAddr{IP: ip}
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(data, dst); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, fmt.Errorf("icmp probe failed: %v", err)
+		}
+		reply, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		// The kernel rewrites the ID of unprivileged ping sockets
+		if !ok || echo.Seq != seq || (icmpNetwork != "udp4" && echo.ID != id) {
+			continue
+		}
+		if !peerIP(peer).Equal(ip) {
+			continue
+		}
+		return time.Since(start), nil
+	}
+}
+
+func resolve(host string, timeout time.Duration) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			return addr.IP, nil
+		}
+	}
+	return addrs[0].IP, nil
+}
+
+func peerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Certificate summarizes one certificate of a presented chain.
+type Certificate struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dns_names,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// TLSResult is what a server presented during a TLS handshake.
+type TLSResult struct {
+	Version     string        // Negotiated protocol version, such as "TLS 1.3"
+	VersionID   uint16        // Negotiated protocol version as tls.VersionTLS13 and the like
+	CipherSuite string        // Negotiated cipher suite
+	WeakCipher  bool          // The cipher suite is one of tls.InsecureCipherSuites
+	ALPN        string        // Negotiated application protocol
+	Chain       []Certificate // Leaf first, as sent by the server
+	NameMatch   bool          // The leaf is valid for the server name
+	Expired     bool          // The leaf is outside its validity period
+	Trusted     bool          // The chain verifies against the system roots for the server name
+	VerifyError string        // Why the chain did not verify
+}
+
+// PlaintextError is returned by InspectTLS when the server answered the
+// handshake with something other than TLS, such as an HTTP response.
+type PlaintextError struct {
+	Response string // First bytes of the answer
+}
+
+func (e *PlaintextError) Error() string {
+	return fmt.Sprintf("server answered without TLS: %q", e.Response)
+}
+
+// inspectCipherSuites offers every TLS 1.2 cipher suite Go implements,
+// including insecure ones, so a server preferring a weak one is seen.
+var inspectCipherSuites = func() []uint16 {
+	var ids []uint16
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		ids = append(ids, suite.ID)
+	}
+	return ids
+}()
+
+// InspectTLS performs a TLS handshake with host:port using serverName as SNI
+// and reports the version, cipher suite and certificate chain the server
+// chose. Versions down to TLS 1.0 and insecure cipher suites are offered, so
+// a server that settles for them is reported rather than rejected. The
+// handshake does not fail on an invalid chain either: verification is done
+// afterwards so a mismatched, expired or self-signed certificate can be
+// described.
+func InspectTLS(host string, port int, serverName string, alpn []string, timeout time.Duration) (*TLSResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{},
+		Config: &tls.Config{
+			ServerName:         serverName,
+			NextProtos:         alpn,
+			InsecureSkipVerify: true,
+			MinVersion:         tls.VersionTLS10,
+			CipherSuites:       inspectCipherSuites,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		var headerErr tls.RecordHeaderError
+		if errors.As(err, &headerErr) {
+			return nil, &PlaintextError{Response: string(headerErr.RecordHeader[:])}
+		}
+		return nil, fmt.Errorf("tls handshake failed: %v", err)
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("server presented no certificate")
+	}
+	result := &TLSResult{
+		Version:     tls.VersionName(state.Version),
+		VersionID:   state.Version,
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		Chain:       make([]Certificate, 0, len(state.PeerCertificates)),
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		if suite.ID == state.CipherSuite {
+			result.WeakCipher = true
+		}
+	}
+	for _, cert := range state.PeerCertificates {
+		result.Chain = append(result.Chain, Certificate{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			DNSNames:  cert.DNSNames,
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		})
+	}
+
+	leaf := state.PeerCertificates[0]
+	now := time.Now()
+	result.Expired = now.Before(leaf.NotBefore) || now.After(leaf.NotAfter)
+	// Without a name, as for IP-only links, there is nothing to match
+	result.NameMatch = serverName == "" || leaf.VerifyHostname(serverName) == nil
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: serverName, Intermediates: intermediates})
+	if err != nil {
+		result.VerifyError = err.Error()
+	} else {
+		result.Trusted = true
+	}
+	return result, nil
+}
@@ -0,0 +1,44 @@
+package reputation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NewFromSpec builds a checker from a comma-separated provider list
+// ("list,ipqualityscore,abuseipdb"). Web services need their API keys and
+// the list provider a file. Returns nil when the list is empty.
+func NewFromSpec(spec, ipqsKey, abuseIPDBKey, listPath string, ttl time.Duration) (*Checker, error) {
+	var providers []Provider
+	for _, name := range strings.Split(spec, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "ipqualityscore":
+			if ipqsKey == "" {
+				return nil, fmt.Errorf("ipqualityscore provider needs an API key")
+			}
+			providers = append(providers, NewIPQualityScore(ipqsKey))
+		case "abuseipdb":
+			if abuseIPDBKey == "" {
+				return nil, fmt.Errorf("abuseipdb provider needs an API key")
+			}
+			providers = append(providers, NewAbuseIPDB(abuseIPDBKey))
+		case "list":
+			if listPath == "" {
+				return nil, fmt.Errorf("list provider needs a list file")
+			}
+			list, err := LoadLocalList(listPath)
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, list)
+		default:
+			return nil, fmt.Errorf("unknown reputation provider: %s", name)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, nil
+	}
+	return NewChecker(ttl, providers...), nil
+}
@@ -0,0 +1,107 @@
+package reputation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type listEntry struct {
+	network *net.IPNet
+	risk    int
+}
+
+// LocalList scores addresses by a file of known addresses and networks, one
+// per line: "203.0.113.7", "198.51.100.0/24 60". The risk after the address
+// defaults to 100; text after # is a comment. The most specific entry wins,
+// so "0.0.0.0/0 0" at the end of a blocklist scores everything else as
+// clean. Addresses the list does not cover are passed to the next provider.
+type LocalList struct {
+	entries []listEntry
+}
+
+// LoadLocalList reads a list file.
+func LoadLocalList(path string) (*LocalList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening reputation list: %v", err)
+	}
+	defer file.Close()
+
+	list := &LocalList{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		entry, err := parseListEntry(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		list.entries = append(list.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading reputation list: %v", err)
+	}
+	return list, nil
+}
+
+func parseListEntry(fields []string) (listEntry, error) {
+	if len(fields) > 2 {
+		return listEntry{}, fmt.Errorf("expected an address and an optional risk, got %q", strings.Join(fields, " "))
+	}
+	entry := listEntry{risk: 100}
+	if strings.Contains(fields[0], "/") {
+		_, network, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return listEntry{}, err
+		}
+		entry.network = network
+	} else {
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			return listEntry{}, fmt.Errorf("invalid address %q", fields[0])
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		entry.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	if len(fields) == 2 {
+		risk, err := strconv.Atoi(fields[1])
+		if err != nil || risk < 0 || risk > 100 {
+			return listEntry{}, fmt.Errorf("risk must be a number from 0 to 100, got %q", fields[1])
+		}
+		entry.risk = risk
+	}
+	return entry, nil
+}
+
+func (l *LocalList) Name() string { return "list" }
+
+func (l *LocalList) Lookup(ctx context.Context, ip net.IP) (*Score, error) {
+	var (
+		best    *listEntry
+		bestLen = -1
+	)
+	for i := range l.entries {
+		entry := &l.entries[i]
+		if !entry.network.Contains(ip) {
+			continue
+		}
+		if ones, _ := entry.network.Mask.Size(); ones > bestLen {
+			best, bestLen = entry, ones
+		}
+	}
+	if best == nil {
+		return nil, ErrNotFound
+	}
+	return &Score{Risk: best.risk}, nil
+}
@@ -0,0 +1,195 @@
+// Package reputation scores how likely an IP address is to be treated as
+// abusive by the sites a proxy is used for. Scores come from pluggable
+// providers: the IPQualityScore and AbuseIPDB web services and a local list
+// of addresses and networks. A Checker queries them in order and caches the
+// answers, so repeated checks of a subscription do not burn API quotas.
+package reputation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a provider has no score for an address. Web
+// services are never asked about private and reserved addresses.
+var ErrNotFound = errors.New("address not found")
+
+// Risk levels returned by Level.
+const (
+	LevelLow    = "low"
+	LevelMedium = "medium"
+	LevelHigh   = "high"
+)
+
+// Score is the reputation of an IP address. Risk goes from 0 (clean) to 100
+// (certainly abusive); providers with their own scale are mapped onto it.
+type Score struct {
+	IP       string `json:"ip"`
+	Risk     int    `json:"risk"`
+	Level    string `json:"level"`
+	Proxy    bool   `json:"proxy,omitempty"`   // Known proxy, VPN or hosting exit
+	Tor      bool   `json:"tor,omitempty"`     // Tor exit node
+	Reports  int    `json:"reports,omitempty"` // Abuse reports counted by the provider
+	Provider string `json:"provider"`
+}
+
+// Level maps a risk onto LevelLow, LevelMedium or LevelHigh. 75 is the
+// threshold IPQualityScore recommends for suspicious addresses.
+func Level(risk int) string {
+	switch {
+	case risk >= 75:
+		return LevelHigh
+	case risk >= 25:
+		return LevelMedium
+	default:
+		return LevelLow
+	}
+}
+
+// Provider scores a single IP address.
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, ip net.IP) (*Score, error)
+}
+
+// RateLimitError is returned by web services that refuse further requests
+// for a while.
+type RateLimitError struct {
+	Provider   string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded, retry in %s", e.Provider, e.RetryAfter)
+}
+
+const (
+	defaultBackoff = time.Minute
+	negativeTTL    = 5 * time.Minute // Addresses no provider scored
+	cacheSize      = 10000
+)
+
+type cacheEntry struct {
+	score   *Score
+	expires time.Time
+}
+
+// Checker queries providers in order until one scores the address and
+// caches the result for ttl. Safe for concurrent use.
+type Checker struct {
+	providers []Provider
+	ttl       time.Duration
+
+	mu      sync.Mutex
+	cache   map[string]cacheEntry
+	backoff map[string]time.Time // Provider name -> end of its rate limit
+}
+
+func NewChecker(ttl time.Duration, providers ...Provider) *Checker {
+	return &Checker{
+		providers: providers,
+		ttl:       ttl,
+		cache:     make(map[string]cacheEntry),
+		backoff:   make(map[string]time.Time),
+	}
+}
+
+// Providers returns the names of the configured providers in query order.
+func (c *Checker) Providers() []string {
+	names := make([]string, 0, len(c.providers))
+	for _, p := range c.providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// Lookup returns the score of ip from the first provider that knows it.
+// Providers that fail or are rate limited are skipped; the error of the last
+// one is returned when none answers.
+func (c *Checker) Lookup(ctx context.Context, ip net.IP) (*Score, error) {
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address")
+	}
+	key := ip.String()
+
+	c.mu.Lock()
+	entry, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		if entry.score == nil {
+			return nil, ErrNotFound
+		}
+		return entry.score, nil
+	}
+
+	err := ErrNotFound
+	for _, p := range c.providers {
+		if c.backedOff(p.Name()) {
+			continue
+		}
+		score, lookupErr := p.Lookup(ctx, ip)
+		if lookupErr == nil {
+			score.IP = key
+			score.Level = Level(score.Risk)
+			score.Provider = p.Name()
+			c.store(key, score, c.ttl)
+			return score, nil
+		}
+		var rateLimit *RateLimitError
+		if errors.As(lookupErr, &rateLimit) {
+			c.backOff(p.Name(), rateLimit.RetryAfter)
+		}
+		if !errors.Is(lookupErr, ErrNotFound) {
+			err = lookupErr
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		c.store(key, nil, negativeTTL)
+	}
+	return nil, err
+}
+
+func (c *Checker) backedOff(provider string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().Before(c.backoff[provider])
+}
+
+func (c *Checker) backOff(provider string, d time.Duration) {
+	if d <= 0 {
+		d = defaultBackoff
+	}
+	c.mu.Lock()
+	c.backoff[provider] = time.Now().Add(d)
+	c.mu.Unlock()
+}
+
+func (c *Checker) store(key string, score *Score, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.cache) >= cacheSize {
+		now := time.Now()
+		for k, e := range c.cache {
+			if now.After(e.expires) {
+				delete(c.cache, k)
+			}
+		}
+		if len(c.cache) >= cacheSize {
+			c.cache = make(map[string]cacheEntry)
+		}
+	}
+	c.cache[key] = cacheEntry{score: score, expires: time.Now().Add(ttl)}
+}
+
+func isPublic(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
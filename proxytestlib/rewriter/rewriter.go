@@ -0,0 +1,268 @@
+package rewriter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"projectx/proxytestlib/models"
+	"projectx/utils"
+)
+
+// Match selects the links a rule applies to. Empty fields match everything.
+type Match struct {
+	Protocol string `json:"protocol"` // link scheme: vless, vmess, trojan, ss
+	Provider string `json:"provider"` // server domain or any of its parent domains
+	Server   string `json:"server"`   // exact server address
+	Country  string `json:"country"`  // ISO code from the flag emoji in the name
+	Name     string `json:"name"`     // regular expression on the node name
+
+	nameRe *regexp.Regexp
+}
+
+// Rule sets or deletes share link parameters of every matching link.
+type Rule struct {
+	Match  Match             `json:"match"`
+	Set    map[string]string `json:"set"`
+	Delete []string          `json:"delete"`
+}
+
+// vmessKeys maps share link query parameters to vmess JSON fields that are
+// named differently.
+var vmessKeys = map[string]string{
+	"type":     "net",
+	"security": "tls",
+}
+
+// LoadRules reads a JSON array of rules from path.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rewrite rules: %v", err)
+	}
+	return ParseRules(data)
+}
+
+// ParseRules decodes and validates a JSON array of rules.
+func ParseRules(data []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("error parsing rewrite rules: %v", err)
+	}
+
+	for i := range rules {
+		if len(rules[i].Set) == 0 && len(rules[i].Delete) == 0 {
+			return nil, fmt.Errorf("rewrite rule %d has neither set nor delete", i+1)
+		}
+		if err := rules[i].Match.Compile(); err != nil {
+			return nil, fmt.Errorf("rewrite rule %d: %v", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// Apply rewrites a share link with every matching rule, in order. It returns
+// the link unchanged if no rule matches.
+func Apply(link string, rules []Rule) (string, bool, error) {
+	if len(rules) == 0 {
+		return link, false, nil
+	}
+
+	if strings.HasPrefix(link, "vmess://") {
+		return applyVMess(link, rules)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return link, false, fmt.Errorf("error parsing link: %v", err)
+	}
+
+	query := u.Query()
+	changed := false
+	for _, rule := range rules {
+		if !rule.Match.matches(u.Scheme, u.Hostname(), u.Fragment) {
+			continue
+		}
+		for key, value := range rule.Set {
+			query.Set(key, value)
+		}
+		for _, key := range rule.Delete {
+			query.Del(key)
+		}
+		changed = true
+	}
+
+	if !changed {
+		return link, false, nil
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), true, nil
+}
+
+func applyVMess(link string, rules []Rule) (string, bool, error) {
+	fields, err := decodeVMess(link)
+	if err != nil {
+		return link, false, err
+	}
+
+	server, _ := fields["add"].(string)
+	name, _ := fields["ps"].(string)
+
+	changed := false
+	for _, rule := range rules {
+		if !rule.Match.matches("vmess", server, name) {
+			continue
+		}
+		for key, value := range rule.Set {
+			if alias, ok := vmessKeys[key]; ok {
+				key = alias
+			}
+			fields[key] = value
+		}
+		for _, key := range rule.Delete {
+			if alias, ok := vmessKeys[key]; ok {
+				key = alias
+			}
+			delete(fields, key)
+		}
+		changed = true
+	}
+
+	if !changed {
+		return link, false, nil
+	}
+
+	rewritten, err := encodeVMess(fields)
+	if err != nil {
+		return link, false, err
+	}
+	return rewritten, true, nil
+}
+
+// LinkName returns the node name of a share link: the URL fragment, or the
+// "ps" field of a vmess link.
+func LinkName(link string) string {
+	if strings.HasPrefix(link, "vmess://") {
+		fields, err := decodeVMess(link)
+		if err != nil {
+			return ""
+		}
+		name, _ := fields["ps"].(string)
+		return name
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return u.Fragment
+}
+
+// SetLinkName returns the link with its node name replaced.
+func SetLinkName(link, name string) (string, error) {
+	if strings.HasPrefix(link, "vmess://") {
+		fields, err := decodeVMess(link)
+		if err != nil {
+			return link, err
+		}
+		fields["ps"] = name
+		return encodeVMess(fields)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return link, fmt.Errorf("error parsing link: %v", err)
+	}
+	u.Fragment = name
+	u.RawFragment = ""
+	return u.String(), nil
+}
+
+func decodeVMess(link string) (map[string]interface{}, error) {
+	decoded, err := utils.AutoDecode(strings.TrimPrefix(link, "vmess://"))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding VMess link: %v", err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(decoded, &fields); err != nil {
+		return nil, fmt.Errorf("error parsing VMess config: %v", err)
+	}
+	return fields, nil
+}
+
+func encodeVMess(fields map[string]interface{}) (string, error) {
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("error encoding VMess config: %v", err)
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(encoded), nil
+}
+
+// Compile prepares the name pattern. ParseRules compiles every rule; a Match
+// built in code must be compiled before use.
+func (m *Match) Compile() error {
+	m.nameRe = nil
+	if m.Name == "" {
+		return nil
+	}
+	re, err := regexp.Compile(m.Name)
+	if err != nil {
+		return fmt.Errorf("invalid name pattern: %v", err)
+	}
+	m.nameRe = re
+	return nil
+}
+
+// MatchesLink reports whether the match selects a share link.
+func (m Match) MatchesLink(link string) bool {
+	if strings.HasPrefix(link, "vmess://") {
+		fields, err := decodeVMess(link)
+		if err != nil {
+			return false
+		}
+		server, _ := fields["add"].(string)
+		name, _ := fields["ps"].(string)
+		return m.matches("vmess", server, name)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return m.matches(u.Scheme, u.Hostname(), u.Fragment)
+}
+
+func (m Match) matches(scheme, server, name string) bool {
+	if m.Protocol != "" && !strings.EqualFold(m.Protocol, scheme) &&
+		!(strings.EqualFold(m.Protocol, "shadowsocks") && scheme == "ss") {
+		return false
+	}
+
+	server = strings.ToLower(strings.TrimSuffix(server, "."))
+	if m.Server != "" && !strings.EqualFold(m.Server, server) {
+		return false
+	}
+	if m.Provider != "" {
+		provider := strings.ToLower(m.Provider)
+		if server != provider && !strings.HasSuffix(server, "."+provider) {
+			return false
+		}
+	}
+
+	if m.Country != "" {
+		proxy := models.ProxyConfig{Name: name}
+		if !strings.EqualFold(m.Country, proxy.GetCountry()) {
+			return false
+		}
+	}
+	if m.nameRe != nil && !m.nameRe.MatchString(name) {
+		return false
+	}
+
+	return true
+}
@@ -17,13 +17,15 @@ type XrayRunner struct {
 }
 
 func NewXrayRunner(configFile string) *XrayRunner {
+	termuxOnce.Do(applyTermuxDefaults)
+
 	return &XrayRunner{
 		configFile: configFile,
 	}
 }
 
 func (r *XrayRunner) Start() error {
-	configBytes, err := os.ReadFile(r.configFile)
+	configBytes, err := os.ReadFile(ConfigPath(r.configFile))
 	if err != nil {
 		return fmt.Errorf("error reading config file: %v", err)
 	}
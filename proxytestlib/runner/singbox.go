@@ -0,0 +1,154 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// singBoxStartupWait is how long a started sing-box must stay up before
+// Start reports success. Config errors make it exit well within this time.
+const singBoxStartupWait = 500 * time.Millisecond
+
+// singBoxStopTimeout is how long Stop waits for sing-box to exit after an
+// interrupt before killing it.
+const singBoxStopTimeout = 5 * time.Second
+
+// SingBoxRunner runs an external sing-box binary with a generated config.
+type SingBoxRunner struct {
+	binary     string
+	configFile string
+	cmd        *exec.Cmd
+	exited     chan struct{}
+	stderr     *outputBuffer
+	mu         sync.Mutex
+}
+
+// NewSingBoxRunner returns a runner for configFile. binary is the sing-box
+// executable, looked up in PATH when it has no directory.
+func NewSingBoxRunner(configFile, binary string) *SingBoxRunner {
+	termuxOnce.Do(applyTermuxDefaults)
+
+	if binary == "" {
+		binary = "sing-box"
+	}
+	return &SingBoxRunner{
+		binary:     binary,
+		configFile: configFile,
+	}
+}
+
+func (r *SingBoxRunner) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path, err := exec.LookPath(r.binary)
+	if err != nil {
+		return fmt.Errorf("error finding sing-box: %v", err)
+	}
+
+	configFile := ConfigPath(r.configFile)
+	if out, err := exec.Command(path, "check", "-c", configFile).CombinedOutput(); err != nil {
+		return fmt.Errorf("error checking sing-box config: %v: %s", err, bytes.TrimSpace(out))
+	}
+
+	r.stderr = &outputBuffer{}
+	cmd := exec.Command(path, "run", "-c", configFile)
+	cmd.Stderr = r.stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting sing-box: %v", err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	// sing-box reports listen errors by exiting right away
+	select {
+	case <-exited:
+		return fmt.Errorf("sing-box exited on start: %s", r.stderr)
+	case <-time.After(singBoxStartupWait):
+	}
+
+	r.cmd = cmd
+	r.exited = exited
+	log.Println("sing-box instance started successfully")
+
+	return nil
+}
+
+func (r *SingBoxRunner) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cmd == nil {
+		return nil
+	}
+	cmd, exited := r.cmd, r.exited
+	r.cmd, r.exited = nil, nil
+
+	select {
+	case <-exited:
+		log.Printf("sing-box had already exited: %s", r.stderr)
+		return nil
+	default:
+	}
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		cmd.Process.Kill()
+	}
+	select {
+	case <-exited:
+	case <-time.After(singBoxStopTimeout):
+		if err := cmd.Process.Kill(); err != nil {
+			return fmt.Errorf("error stopping sing-box: %v", err)
+		}
+		<-exited
+	}
+	log.Println("sing-box instance stopped successfully")
+	return nil
+}
+
+// IsRunning reports whether sing-box was started and has not exited since.
+func (r *SingBoxRunner) IsRunning() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cmd == nil {
+		return false
+	}
+	select {
+	case <-r.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// outputBuffer keeps the start of the sing-box stderr, which holds the
+// reason of a failure, and can be read while sing-box writes to it.
+type outputBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf.Len() < 64<<10 {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (b *outputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(bytes.TrimSpace(b.buf.Bytes()))
+}
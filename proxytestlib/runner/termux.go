@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var termuxOnce sync.Once
+
+// IsTermux reports whether the process runs inside Termux on Android.
+func IsTermux() bool {
+	if os.Getenv("TERMUX_VERSION") != "" {
+		return true
+	}
+	return strings.HasPrefix(os.Getenv("PREFIX"), "/data/data/com.termux")
+}
+
+// ConfigPath returns where a relative config file is written and read. Inside
+// Termux the working directory is often shared storage mounted noexec or
+// read-only, so files go to $PREFIX/var/lib/xray-checker instead.
+func ConfigPath(filename string) string {
+	if !IsTermux() || filepath.IsAbs(filename) {
+		return filename
+	}
+
+	dir := filepath.Join(os.Getenv("PREFIX"), "var", "lib", "xray-checker")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Error creating %s, falling back to working directory: %v", dir, err)
+		return filename
+	}
+	return filepath.Join(dir, filename)
+}
+
+// applyTermuxDefaults works around what Android lacks compared to a regular
+// Linux host: there is no /etc/resolv.conf, so Go's resolver would query
+// localhost, and geoip/geosite assets installed by `pkg install xray` live
+// under $PREFIX/share/xray. Raw ICMP sockets are not available either, so
+// checks only ever use TCP.
+func applyTermuxDefaults() {
+	if !IsTermux() {
+		return
+	}
+
+	prefix := os.Getenv("PREFIX")
+
+	if os.Getenv("XRAY_LOCATION_ASSET") == "" {
+		assetDir := filepath.Join(prefix, "share", "xray")
+		if _, err := os.Stat(assetDir); err == nil {
+			os.Setenv("XRAY_LOCATION_ASSET", assetDir)
+		}
+	}
+
+	nameserver := readNameserver(filepath.Join(prefix, "etc", "resolv.conf"))
+	if nameserver == "" {
+		nameserver = "1.1.1.1"
+	}
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: 5 * time.Second}
+			return d.DialContext(ctx, network, net.JoinHostPort(nameserver, "53"))
+		},
+	}
+
+	log.Printf("Termux detected: using nameserver %s and data directory under %s", nameserver, prefix)
+}
+
+func readNameserver(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+const (
+	ActionInstall       = "install"
+	ActionUninstall     = "uninstall"
+	ActionInstallTask   = "install-task"
+	ActionUninstallTask = "uninstall-task"
+)
+
+// RunFunc is the body of the monitor. It must return once ctx is cancelled.
+type RunFunc func(ctx context.Context) error
+
+// Handle performs one of the install/uninstall actions. args are passed to the
+// executable when the service or task starts it.
+func Handle(action, name, description string, taskInterval int, args []string) error {
+	switch action {
+	case ActionInstall:
+		return Install(name, description, args)
+	case ActionUninstall:
+		return Uninstall(name)
+	case ActionInstallTask:
+		return InstallTask(name, taskInterval, args)
+	case ActionUninstallTask:
+		return UninstallTask(name)
+	default:
+		return fmt.Errorf("unknown service action: %s", action)
+	}
+}
+
+// StripServiceFlag removes --service flags from args so the installed service
+// does not try to install itself again on start.
+func StripServiceFlag(args []string) []string {
+	var result []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--service" {
+			i++
+			continue
+		}
+		if strings.HasPrefix(arg, "--service=") {
+			continue
+		}
+		result = append(result, arg)
+	}
+	return result
+}
+
+func runInteractive(run RunFunc) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return run(ctx)
+}
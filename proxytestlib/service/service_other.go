@@ -0,0 +1,28 @@
+//go:build !windows
+
+package service
+
+import "fmt"
+
+var errNotWindows = fmt.Errorf("service management is only supported on Windows")
+
+// Run executes run in the foreground until SIGINT or SIGTERM.
+func Run(name string, run RunFunc) error {
+	return runInteractive(run)
+}
+
+func Install(name, description string, args []string) error {
+	return errNotWindows
+}
+
+func Uninstall(name string) error {
+	return errNotWindows
+}
+
+func InstallTask(name string, intervalMinutes int, args []string) error {
+	return errNotWindows
+}
+
+func UninstallTask(name string) error {
+	return errNotWindows
+}
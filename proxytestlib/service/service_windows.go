@@ -0,0 +1,211 @@
+//go:build windows
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Run executes run under the service control manager when started as a
+// Windows service, logging to the Windows event log, and in the foreground
+// otherwise.
+func Run(name string, run RunFunc) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("error detecting service mode: %v", err)
+	}
+	if !isService {
+		return runInteractive(run)
+	}
+
+	elog, err := eventlog.Open(name)
+	if err != nil {
+		return fmt.Errorf("error opening event log: %v", err)
+	}
+	defer elog.Close()
+
+	log.SetFlags(0)
+	log.SetOutput(&eventLogWriter{elog: elog})
+
+	return svc.Run(name, &handler{run: run})
+}
+
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w *eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\r\n")
+	if strings.Contains(strings.ToLower(msg), "error") {
+		return len(p), w.elog.Error(1, msg)
+	}
+	return len(p), w.elog.Info(1, msg)
+}
+
+type handler struct {
+	run RunFunc
+}
+
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+
+	changes <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.run(ctx)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case err := <-done:
+			changes <- svc.Status{State: svc.StopPending}
+			if err != nil {
+				log.Printf("Service stopped with error: %v", err)
+				return true, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				cancel()
+				select {
+				case <-done:
+				case <-time.After(30 * time.Second):
+					log.Printf("Service did not stop within 30s")
+				}
+				return false, 0
+			}
+		}
+	}
+}
+
+// Install registers the current executable as an automatically started
+// service and creates its event log source.
+func Install(name, description string, args []string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("error locating executable: %v", err)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("error connecting to service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", name)
+	}
+
+	s, err := m.CreateService(name, exePath, mgr.Config{
+		DisplayName: name,
+		Description: description,
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("error creating service: %v", err)
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("error installing event log source: %v", err)
+	}
+
+	log.Printf("Service %s installed", name)
+	return nil
+}
+
+// Uninstall stops and removes the service and its event log source.
+func Uninstall(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("error connecting to service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+
+	if _, err := s.Control(svc.Stop); err != nil && err != windows.ERROR_SERVICE_NOT_ACTIVE {
+		log.Printf("Error stopping service %s: %v", name, err)
+	}
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("error deleting service: %v", err)
+	}
+
+	if err := eventlog.Remove(name); err != nil {
+		return fmt.Errorf("error removing event log source: %v", err)
+	}
+
+	log.Printf("Service %s uninstalled", name)
+	return nil
+}
+
+// InstallTask creates a Scheduled Task that starts the executable every
+// intervalMinutes. It is meant to be combined with --run-once on hosts where
+// installing a service is not allowed.
+func InstallTask(name string, intervalMinutes int, args []string) error {
+	if intervalMinutes <= 0 {
+		return fmt.Errorf("invalid task interval: %d", intervalMinutes)
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("error locating executable: %v", err)
+	}
+
+	command := syscall.EscapeArg(exePath)
+	for _, arg := range args {
+		command += " " + syscall.EscapeArg(arg)
+	}
+
+	out, err := exec.Command("schtasks", "/Create", "/F",
+		"/TN", name,
+		"/SC", "MINUTE",
+		"/MO", fmt.Sprintf("%d", intervalMinutes),
+		"/TR", command,
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error creating scheduled task: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	log.Printf("Scheduled task %s installed", name)
+	return nil
+}
+
+func UninstallTask(name string) error {
+	out, err := exec.Command("schtasks", "/Delete", "/F", "/TN", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error deleting scheduled task: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	log.Printf("Scheduled task %s uninstalled", name)
+	return nil
+}
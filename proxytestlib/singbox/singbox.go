@@ -0,0 +1,244 @@
+package singbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"projectx/proxytestlib/models"
+)
+
+// Config is the part of the sing-box configuration the checker generates:
+// one local inbound per proxy, routed to the outbound of that proxy.
+type Config struct {
+	Log       map[string]interface{}   `json:"log"`
+	Inbounds  []map[string]interface{} `json:"inbounds"`
+	Outbounds []map[string]interface{} `json:"outbounds"`
+	Route     map[string]interface{}   `json:"route"`
+}
+
+// logLevels maps Xray log levels to sing-box ones, so both backends share
+// the xray-log-level option.
+var logLevels = map[string]string{
+	"debug":   "debug",
+	"info":    "info",
+	"warning": "warn",
+	"error":   "error",
+}
+
+// GenerateConfig returns a sing-box config with the same layout as the Xray
+// config: proxy i gets an inbound on startPort+Index, so the checker reaches
+// proxies the same way with either backend. Proxies that are dialed
+// directly, that sing-box cannot speak or that fail validation are skipped.
+func GenerateConfig(proxies []*models.ProxyConfig, startPort int, logLevel string, inbound models.Inbound) ([]byte, error) {
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("no valid proxy configurations found")
+	}
+	if !inbound.Loopback() && !inbound.Authenticated() {
+		return nil, fmt.Errorf("inbounds on %s would be open to anyone: set XRAY_INBOUND_USER and XRAY_INBOUND_PASSWORD", inbound.Listen)
+	}
+
+	config := Config{
+		Log:   map[string]interface{}{"disabled": true},
+		Route: map[string]interface{}{},
+	}
+	if level, ok := logLevels[logLevel]; ok {
+		config.Log = map[string]interface{}{"level": level, "timestamp": true}
+	}
+
+	var rules []map[string]interface{}
+	for _, proxy := range proxies {
+		if proxy.DirectDial() {
+			continue
+		}
+		if !proxy.SupportedBySingBox() {
+			log.Printf("Skipping %s in sing-box config: %s over %s is not supported by sing-box", proxy.Name, proxy.Protocol, proxy.GetTransportType())
+			continue
+		}
+		if err := proxy.Validate(); err != nil {
+			log.Printf("Skipping %s in sing-box config: %v", proxy.Name, err)
+			continue
+		}
+		outbound, err := Outbound(proxy)
+		if err != nil {
+			log.Printf("Skipping %s in sing-box config: %v", proxy.Name, err)
+			continue
+		}
+
+		inTag := "in-" + strconv.Itoa(proxy.Index)
+		outTag := "out-" + strconv.Itoa(proxy.Index)
+		outbound["tag"] = outTag
+		config.Inbounds = append(config.Inbounds, localInbound(inbound, inTag, startPort+proxy.Index))
+		config.Outbounds = append(config.Outbounds, outbound)
+		rules = append(rules, map[string]interface{}{"inbound": []string{inTag}, "outbound": outTag})
+	}
+	if len(config.Outbounds) == 0 {
+		return nil, fmt.Errorf("no proxy configurations supported by sing-box")
+	}
+
+	// Every inbound has a rule, so the default outbound is never used
+	config.Route["rules"] = rules
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding sing-box config: %v", err)
+	}
+	return data, nil
+}
+
+func localInbound(inbound models.Inbound, tag string, port int) map[string]interface{} {
+	protocol := inbound.Protocol
+	if protocol != "http" {
+		protocol = "socks"
+	}
+	in := map[string]interface{}{
+		"type":        protocol,
+		"tag":         tag,
+		"listen":      inbound.Listen,
+		"listen_port": port,
+	}
+	if inbound.Authenticated() {
+		in["users"] = []map[string]string{{"username": inbound.User, "password": inbound.Password}}
+	}
+	return in
+}
+
+// Outbound converts a proxy into a sing-box outbound without a tag.
+func Outbound(proxy *models.ProxyConfig) (map[string]interface{}, error) {
+	out := map[string]interface{}{
+		"type":        proxy.Protocol,
+		"server":      proxy.Server,
+		"server_port": proxy.Port,
+	}
+
+	switch proxy.Protocol {
+	case "vless":
+		out["uuid"] = proxy.UUID
+		if proxy.Flow != "" {
+			out["flow"] = proxy.Flow
+		}
+	case "vmess":
+		out["uuid"] = proxy.UUID
+		out["security"] = proxy.GetVMessSecurity()
+		out["alter_id"] = proxy.GetAlterId()
+	case "trojan":
+		out["password"] = proxy.Password
+	case "shadowsocks":
+		out["method"] = proxy.Method
+		out["password"] = proxy.Password
+		switch proxy.Plugin {
+		case "":
+		case "obfs-local", "simple-obfs":
+			out["plugin"] = "obfs-local"
+			out["plugin_opts"] = proxy.PluginOpts
+		case "v2ray-plugin", "xray-plugin":
+			out["plugin"] = "v2ray-plugin"
+			out["plugin_opts"] = proxy.PluginOpts
+		default:
+			return nil, fmt.Errorf("shadowsocks plugin %s is not supported by sing-box", proxy.Plugin)
+		}
+		// The plugin carries the transport and TLS
+		return out, nil
+	case "tuic":
+		out["uuid"] = proxy.UUID
+		out["password"] = proxy.Password
+		if proxy.Congestion != "" {
+			out["congestion_control"] = proxy.Congestion
+		}
+		if proxy.UDPRelayMode != "" {
+			out["udp_relay_mode"] = proxy.UDPRelayMode
+		}
+	case "hysteria2":
+		out["password"] = proxy.Password
+		if obfs := proxy.Settings["obfs"]; obfs != "" {
+			out["obfs"] = map[string]string{"type": obfs, "password": proxy.Settings["obfs-password"]}
+		}
+	case "ssh":
+		out["user"] = proxy.Username
+		if proxy.Password != "" {
+			out["password"] = proxy.Password
+		}
+		if key := proxy.Settings["private_key"]; key != "" {
+			out["private_key"] = key
+		}
+		if hostKeys := proxy.Settings["host_key"]; hostKeys != "" {
+			out["host_key"] = strings.Split(hostKeys, ",")
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("%s is not supported by sing-box", proxy.Protocol)
+	}
+
+	if tls := tlsOptions(proxy); tls != nil {
+		out["tls"] = tls
+	}
+	if transport := transportOptions(proxy); transport != nil {
+		out["transport"] = transport
+	}
+	return out, nil
+}
+
+// tlsOptions returns the tls block of outbounds with TLS or REALITY
+// security. REALITY only works with a uTLS fingerprint in sing-box.
+func tlsOptions(proxy *models.ProxyConfig) map[string]interface{} {
+	if proxy.Security != "tls" && proxy.Security != "reality" {
+		return nil
+	}
+	tls := map[string]interface{}{"enabled": true}
+	if proxy.SNI != "" {
+		tls["server_name"] = proxy.SNI
+	}
+	if proxy.AllowInsecure {
+		tls["insecure"] = true
+	}
+	if len(proxy.ALPN) > 0 {
+		tls["alpn"] = proxy.ALPN
+	}
+	fingerprint := proxy.Fingerprint
+	if proxy.Security == "reality" {
+		if fingerprint == "" {
+			fingerprint = "chrome"
+		}
+		tls["reality"] = map[string]interface{}{
+			"enabled":    true,
+			"public_key": proxy.PublicKey,
+			"short_id":   proxy.ShortID,
+		}
+	}
+	if fingerprint != "" {
+		tls["utls"] = map[string]interface{}{"enabled": true, "fingerprint": fingerprint}
+	}
+	return tls
+}
+
+// transportOptions returns the V2Ray transport of vless, vmess and trojan
+// outbounds, nil for plain TCP.
+func transportOptions(proxy *models.ProxyConfig) map[string]interface{} {
+	switch proxy.GetTransportType() {
+	case "ws":
+		transport := map[string]interface{}{"type": "ws", "path": proxy.Path}
+		if proxy.Host != "" {
+			transport["headers"] = map[string]string{"Host": proxy.Host}
+		}
+		return transport
+	case "httpupgrade":
+		transport := map[string]interface{}{"type": "httpupgrade", "path": proxy.Path}
+		if proxy.Host != "" {
+			transport["host"] = proxy.Host
+		}
+		return transport
+	case "http", "h2":
+		transport := map[string]interface{}{"type": "http", "path": proxy.Path}
+		if proxy.Host != "" {
+			transport["host"] = strings.Split(proxy.Host, ",")
+		}
+		return transport
+	case "grpc":
+		return map[string]interface{}{"type": "grpc", "service_name": proxy.GetServiceName()}
+	case "quic":
+		return map[string]interface{}{"type": "quic"}
+	}
+	return nil
+}
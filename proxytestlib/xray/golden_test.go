@@ -0,0 +1,201 @@
+package xray_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"projectx/parser"
+	"projectx/proxytestlib/models"
+	"projectx/proxytestlib/singbox"
+	"projectx/proxytestlib/xray"
+)
+
+// The golden files are shared with the API server tests in cmd/api.
+//
+//	go test ./proxytestlib/xray -run Golden [-update]
+var update = flag.Bool("update", false, "Rewrite golden files instead of comparing")
+
+const (
+	goldenDir       = "../../testdata/golden"
+	goldenStartPort = 10000
+	goldenLogLevel  = "none"
+)
+
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// fixture is a line of links.txt or singbox.txt: the golden file name and
+// the share link.
+type fixture struct {
+	name    string
+	link    string
+	singbox bool // From singbox.txt: compares the sing-box config instead of the Xray one
+}
+
+// TestGolden compares the Xray configs generated for testdata/golden/links.txt
+// and the sing-box configs for singbox.txt with the golden files.
+func TestGolden(t *testing.T) {
+	fixtures := readFixtures(t, filepath.Join(goldenDir, "links.txt"), false)
+	fixtures = append(fixtures, readFixtures(t, filepath.Join(goldenDir, "singbox.txt"), true)...)
+
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			path, got := render(f)
+
+			// A link rebuilt from the parsed config must render the same config
+			if link, ok := shareLink(f); ok {
+				if _, again := render(fixture{name: f.name, link: link, singbox: f.singbox}); !bytes.Equal(again, got) {
+					t.Errorf("share link does not round-trip: %s\n%s", link, diffLines(string(got), string(again)))
+				}
+			}
+
+			if *update {
+				if err := os.WriteFile(path, got, 0644); err != nil {
+					t.Fatalf("error writing %s: %v", path, err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("missing golden file %s (run with -update): %v", path, err)
+			}
+			if !bytes.Equal(want, got) {
+				t.Errorf("output differs from %s\n%s", path, diffLines(string(want), string(got)))
+			}
+		})
+	}
+}
+
+// readFixtures reads "name link" lines, skipping empty lines and # comments.
+func readFixtures(t *testing.T, path string, singbox bool) []fixture {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("error reading fixtures: %v", err)
+	}
+	defer file.Close()
+
+	var fixtures []fixture
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			t.Fatalf("invalid fixture line in %s: %s", path, line)
+		}
+		name := unsafeChars.ReplaceAllString(parts[0], "_")
+		if seen[name] {
+			t.Fatalf("duplicate fixture name in %s: %s", path, name)
+		}
+		seen[name] = true
+		fixtures = append(fixtures, fixture{name: name, link: strings.TrimSpace(parts[1]), singbox: singbox})
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("error reading fixtures: %v", err)
+	}
+	return fixtures
+}
+
+// parseFunc returns the parser of the fixture: fixtures prefixed with
+// lenient- are parsed with inference of missing parameters.
+func parseFunc(f fixture) func(string) (*models.ProxyConfig, error) {
+	if strings.HasPrefix(f.name, "lenient-") {
+		return parser.ParseProxyURLLenient
+	}
+	return parser.ParseProxyURL
+}
+
+// render returns the golden file path and the expected content: the Xray
+// config (sing-box for singbox.txt fixtures) of a valid link or the error
+// text of an invalid one.
+func render(f fixture) (string, []byte) {
+	ext := ".xray"
+	if f.singbox {
+		ext = ".sing-box"
+	}
+
+	// Errors of Xray fixtures stay in <name>.error, as before sing-box support
+	errorPath := filepath.Join(goldenDir, f.name+".error")
+	if f.singbox {
+		errorPath = filepath.Join(goldenDir, f.name+ext+".error")
+	}
+
+	config, err := parseFunc(f)(f.link)
+	if err != nil {
+		return errorPath, []byte(err.Error() + "\n")
+	}
+
+	proxies := []*models.ProxyConfig{config}
+	xray.PrepareProxyConfigs(proxies)
+
+	var raw []byte
+	if f.singbox {
+		raw, err = singbox.GenerateConfig(proxies, goldenStartPort, goldenLogLevel, models.DefaultInbound)
+	} else {
+		raw, err = xray.GenerateConfig(proxies, goldenStartPort, goldenLogLevel)
+	}
+	if err != nil {
+		return errorPath, []byte(err.Error() + "\n")
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, raw, "", "  "); err != nil {
+		return errorPath, []byte(err.Error() + "\n")
+	}
+	out.WriteByte('\n')
+	return filepath.Join(goldenDir, f.name+ext+".json"), out.Bytes()
+}
+
+// shareLink rebuilds the share link of the fixture from its parsed config;
+// false if the link does not parse.
+func shareLink(f fixture) (string, bool) {
+	config, err := parseFunc(f)(f.link)
+	if err != nil {
+		return "", false
+	}
+	link, err := config.ShareURI()
+	if err != nil {
+		return "", false
+	}
+	return link, true
+}
+
+// diffLines lists the first differing lines.
+func diffLines(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+
+	var sb strings.Builder
+	shown := 0
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w == g {
+			continue
+		}
+		fmt.Fprintf(&sb, "  line %d:\n    - %s\n    + %s\n", i+1, w, g)
+		shown++
+		if shown == 10 {
+			sb.WriteString("  ...\n")
+			break
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+package xray
+
+import (
+	"hash/fnv"
+	"log"
+	"sort"
+
+	"projectx/proxytestlib/config"
+	"projectx/proxytestlib/models"
+)
+
+// AssignStablePorts replaces the positional Index of prepared proxies with a
+// port offset derived from their StableID, so a proxy keeps its inbound port
+// while other nodes are added or removed. Proxies present in previous keep
+// their offset; new proxies take the hashed offset or, on a collision, the
+// next free one within portRange. New proxies are placed in StableID order,
+// so the result does not depend on the order of the subscription.
+//
+// If portRange cannot hold all proxies the positional indexes are kept.
+func AssignStablePorts(proxies, previous []*models.ProxyConfig, portRange int) {
+	if len(proxies) > portRange {
+		log.Printf("Stable ports disabled: %d proxies do not fit into a range of %d ports", len(proxies), portRange)
+		return
+	}
+
+	kept := make(map[string]int, len(previous))
+	for _, proxy := range previous {
+		if proxy.StableID != "" && proxy.Index < portRange {
+			kept[proxy.StableID] = proxy.Index
+		}
+	}
+
+	taken := make(map[int]bool, len(proxies))
+	var placed []*models.ProxyConfig
+	for _, proxy := range proxies {
+		if offset, ok := kept[proxy.StableID]; ok && !taken[offset] {
+			proxy.Index = offset
+			taken[offset] = true
+			continue
+		}
+		placed = append(placed, proxy)
+	}
+
+	sort.SliceStable(placed, func(i, j int) bool { return placed[i].StableID < placed[j].StableID })
+	for _, proxy := range placed {
+		offset := portOffset(proxy.StableID, portRange)
+		for taken[offset] {
+			offset = (offset + 1) % portRange
+		}
+		proxy.Index = offset
+		taken[offset] = true
+	}
+}
+
+// AssignPortsFromConfig applies stable port assignment if it is enabled in
+// the CLI configuration.
+func AssignPortsFromConfig(proxies, previous []*models.ProxyConfig) {
+	if config.CLIConfig.Xray.StablePorts {
+		AssignStablePorts(proxies, previous, config.CLIConfig.Xray.PortRange)
+	}
+}
+
+func portOffset(stableID string, portRange int) int {
+	h := fnv.New32a()
+	h.Write([]byte(stableID))
+	return int(h.Sum32() % uint32(portRange))
+}
@@ -9,7 +9,6 @@ import (
 	"os"
 	"text/template"
 
-	"projectx/proxytestlib/checker"
 	"projectx/proxytestlib/config"
 	"projectx/proxytestlib/models"
 	"projectx/proxytestlib/runner"
@@ -22,17 +21,66 @@ type TemplateData struct {
 	Proxies      []*models.ProxyConfig
 	StartPort    int
 	XrayLogLevel string
+	Inbound      models.Inbound
 }
 
-func generateConfig(proxies []*models.ProxyConfig, startPort int, xrayLogLevel string) ([]byte, error) {
+// InboundFromConfig returns the per-proxy inbound settings from the CLI
+// configuration, defaulting to an unauthenticated SOCKS inbound on loopback.
+func InboundFromConfig() models.Inbound {
+	inbound := models.DefaultInbound
+	if listen := config.CLIConfig.Xray.Listen; listen != "" {
+		inbound.Listen = listen
+	}
+	if protocol := config.CLIConfig.Xray.InboundProtocol; protocol != "" {
+		inbound.Protocol = protocol
+	}
+	inbound.User = config.CLIConfig.Xray.InboundUser
+	inbound.Password = config.CLIConfig.Xray.InboundPassword
+	return inbound
+}
+
+func GenerateConfig(proxies []*models.ProxyConfig, startPort int, xrayLogLevel string) ([]byte, error) {
+	return GenerateConfigFor(proxies, startPort, xrayLogLevel, InboundFromConfig())
+}
+
+// GenerateConfigFor returns the Xray config for proxies with the given
+// per-proxy inbound settings instead of those of the CLI configuration.
+func GenerateConfigFor(proxies []*models.ProxyConfig, startPort int, xrayLogLevel string, inbound models.Inbound) ([]byte, error) {
 	if len(proxies) == 0 {
 		return nil, fmt.Errorf("no valid proxy configurations found")
 	}
 
+	supported := make([]*models.ProxyConfig, 0, len(proxies))
+	for _, proxy := range proxies {
+		if proxy.DirectDial() {
+			continue
+		}
+		if !proxy.SupportedByXray() {
+			log.Printf("Skipping %s in Xray config: %s is not supported by Xray core", proxy.Name, proxy.Protocol)
+			continue
+		}
+		if err := proxy.Validate(); err != nil {
+			log.Printf("Skipping %s in Xray config: %v", proxy.Name, err)
+			continue
+		}
+		supported = append(supported, proxy)
+	}
+	if len(supported) == 0 {
+		if proxies[0].DirectDial() {
+			return nil, fmt.Errorf("no proxy configurations for Xray: %s proxies are checked directly", proxies[0].Protocol)
+		}
+		return nil, fmt.Errorf("no proxy configurations supported by Xray core: %s requires the sing-box backend", proxies[0].Protocol)
+	}
+
+	if !inbound.Loopback() && !inbound.Authenticated() {
+		return nil, fmt.Errorf("inbounds on %s would be open to anyone: set XRAY_INBOUND_USER and XRAY_INBOUND_PASSWORD", inbound.Listen)
+	}
+
 	data := TemplateData{
-		Proxies:      proxies,
+		Proxies:      supported,
 		StartPort:    startPort,
 		XrayLogLevel: xrayLogLevel,
+		Inbound:      inbound,
 	}
 
 	funcMap := template.FuncMap{
@@ -68,7 +116,7 @@ func generateConfig(proxies []*models.ProxyConfig, startPort int, xrayLogLevel s
 }
 
 func saveConfig(config []byte, filename string) error {
-	if err := os.WriteFile(filename, config, 0644); err != nil {
+	if err := os.WriteFile(runner.ConfigPath(filename), config, 0644); err != nil {
 		return fmt.Errorf("error writing config file: %v", err)
 	}
 	return nil
@@ -84,8 +132,10 @@ func PrepareProxyConfigs(proxies []*models.ProxyConfig) {
 	}
 }
 
+// GenerateAndSaveConfig writes the Xray config for proxies to filename. The
+// monitor goes through core.Core, which also covers the other engines.
 func GenerateAndSaveConfig(proxies []*models.ProxyConfig, startPort int, filename string, xrayLogLevel string) error {
-	configBytes, err := generateConfig(proxies, startPort, xrayLogLevel)
+	configBytes, err := GenerateConfig(proxies, startPort, xrayLogLevel)
 	if err != nil {
 		return fmt.Errorf("error generating config: %v", err)
 	}
@@ -97,36 +147,6 @@ func GenerateAndSaveConfig(proxies []*models.ProxyConfig, startPort int, filenam
 	return nil
 }
 
-func UpdateConfiguration(newConfigs []*models.ProxyConfig, currentConfigs *[]*models.ProxyConfig,
-	xrayRunner *runner.XrayRunner, proxyChecker *checker.ProxyChecker) error {
-
-	log.Println("Found changes in subscription, updating configuration...")
-
-	PrepareProxyConfigs(newConfigs)
-
-	configFile := "xray_config.json"
-	if err := GenerateAndSaveConfig(newConfigs, config.CLIConfig.Xray.StartPort, configFile, config.CLIConfig.Xray.LogLevel); err != nil {
-		return fmt.Errorf("error generating new Xray config: %v", err)
-	}
-
-	if err := xrayRunner.Stop(); err != nil {
-		return fmt.Errorf("error stopping Xray: %v", err)
-	}
-
-	if err := xrayRunner.Start(); err != nil {
-		return fmt.Errorf("error starting Xray with new config: %v", err)
-	}
-
-	proxyChecker.UpdateProxies(newConfigs)
-
-	*currentConfigs = newConfigs
-
-
-
-	log.Println("Configuration updated successfully")
-	return nil
-}
-
 func IsConfigsEqual(old, new []*models.ProxyConfig) bool {
 	if len(old) != len(new) {
 		return false
@@ -1,7 +1,9 @@
 package subscription
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,14 +13,22 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
-	"xray-checker/config"
-	"xray-checker/models"
-	"xray-checker/parser"
-	"xray-checker/utils"
-	"xray-checker/xray"
+
+	"projectx/parser"
+	"projectx/proxytestlib/config"
+	"projectx/proxytestlib/core"
+	"projectx/proxytestlib/dedup"
+	"projectx/proxytestlib/heuristics"
+	"projectx/proxytestlib/importer"
+	"projectx/proxytestlib/models"
+	"projectx/proxytestlib/rewriter"
+	"projectx/proxytestlib/xray"
+	"projectx/utils"
 )
 
-func InitializeConfiguration(configFile string, version string) (*[]*models.ProxyConfig, error) {
+// InitializeConfiguration reads the subscription and writes the config of
+// proxyCore for it. Stable ports are assigned if they are enabled.
+func InitializeConfiguration(proxyCore core.Core, version string) (*[]*models.ProxyConfig, error) {
 	configs, err := ReadFromSource(config.CLIConfig.Subscription.URL, version)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing subscription: %v", err)
@@ -26,8 +36,9 @@ func InitializeConfiguration(configFile string, version string) (*[]*models.Prox
 	proxyConfigs := &configs
 
 	xray.PrepareProxyConfigs(*proxyConfigs)
-	if err := xray.GenerateAndSaveConfig(*proxyConfigs, config.CLIConfig.Xray.StartPort, configFile, config.CLIConfig.Xray.LogLevel); err != nil {
-		return nil, fmt.Errorf("error generating Xray config: %v", err)
+	xray.AssignPortsFromConfig(*proxyConfigs, nil)
+	if err := proxyCore.GenerateConfig(*proxyConfigs); err != nil {
+		return nil, fmt.Errorf("error generating core config: %v", err)
 	}
 
 	return proxyConfigs, nil
@@ -84,7 +95,22 @@ func readFromFile(filepath string) ([]*models.ProxyConfig, error) {
 	}
 	defer file.Close()
 
-	return parseXrayConfig(file)
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	if importer.IsSingBox(data) {
+		configs, err := importer.ParseSingBox(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(configs) == 0 {
+			return nil, fmt.Errorf("no valid proxy configurations found")
+		}
+		return configs, nil
+	}
+
+	return parseXrayConfig(bytes.NewReader(data))
 }
 
 func readFromFolder(folderPath string) ([]*models.ProxyConfig, error) {
@@ -120,13 +146,32 @@ func readFromFolder(folderPath string) ([]*models.ProxyConfig, error) {
 func parseProxyLinks(links []string) ([]*models.ProxyConfig, error) {
 	var configs []*models.ProxyConfig
 
+	parse := parser.ParseProxyURL
+	if config.CLIConfig.Proxy.LenientParsing {
+		parse = parser.ParseProxyURLLenient
+	}
+
+	var rules []rewriter.Rule
+	if path := config.CLIConfig.Proxy.RewriteRules; path != "" {
+		var err error
+		if rules, err = rewriter.LoadRules(path); err != nil {
+			return nil, err
+		}
+	}
+
 	for _, link := range links {
 		link = strings.TrimSpace(link)
 		if link == "" || link == "False" {
 			continue
 		}
 
-		config, err := parser.ParseProxyURL(link)
+		if rewritten, changed, err := rewriter.Apply(link, rules); err != nil {
+			log.Printf("Warning: rewrite rules not applied: %v", err)
+		} else if changed {
+			link = rewritten
+		}
+
+		proxyConfig, err := parse(link)
 		if err != nil {
 			if strings.Contains(err.Error(), "skipping port:") {
 				if u, parseErr := url.Parse(link); parseErr == nil {
@@ -140,13 +185,42 @@ func parseProxyLinks(links []string) ([]*models.ProxyConfig, error) {
 				continue
 			}
 
+			var unsupported *parser.UnsupportedError
+			if errors.As(err, &unsupported) {
+				log.Printf("Skipped %s config: %v", unsupported.Protocol, err)
+				continue
+			}
+
 			if !isCommonInvalidString(link) {
 				log.Printf("Warning: error parsing proxy URL: %v", err)
 			}
 			continue
 		}
 
-		configs = append(configs, config)
+		configs = append(configs, proxyConfig)
+	}
+
+	if config.CLIConfig.Proxy.Dedup {
+		var duplicates []dedup.Duplicate
+		configs, duplicates = dedup.Dedup(configs)
+		for _, duplicate := range duplicates {
+			log.Printf("Proxy %s skipped: duplicate of %s", duplicate.Proxy.Name, duplicate.Of.Name)
+		}
+		if len(duplicates) > 0 {
+			log.Printf("Skipped %d duplicate proxies", len(duplicates))
+		}
+	}
+
+	kept, findings := heuristics.Filter(configs)
+	for _, finding := range findings {
+		action := "flagged"
+		if config.CLIConfig.Proxy.SkipGarbage {
+			action = "skipped"
+		}
+		log.Printf("Proxy %s %s: %s", finding.Proxy.Name, action, strings.Join(finding.Reasons, "; "))
+	}
+	if config.CLIConfig.Proxy.SkipGarbage {
+		configs = kept
 	}
 
 	if len(configs) == 0 {